@@ -0,0 +1,453 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	rkmidlog "github.com/rookie-ninja/rk-entry/v2/middleware/log"
+	rkmidmeta "github.com/rookie-ninja/rk-entry/v2/middleware/meta"
+	rkmidpanic "github.com/rookie-ninja/rk-entry/v2/middleware/panic"
+	rkmidprom "github.com/rookie-ninja/rk-entry/v2/middleware/prom"
+	rkmidtrace "github.com/rookie-ninja/rk-entry/v2/middleware/tracing"
+	rkgrpclog "github.com/tegarajipangestu/rk-grpc/v2/middleware/log"
+	rkgrpcmeta "github.com/tegarajipangestu/rk-grpc/v2/middleware/meta"
+	rkgrpcpanic "github.com/tegarajipangestu/rk-grpc/v2/middleware/panic"
+	rkgrpcprom "github.com/tegarajipangestu/rk-grpc/v2/middleware/prom"
+	rkgrpcshed "github.com/tegarajipangestu/rk-grpc/v2/middleware/shed"
+	rkgrpctimeout "github.com/tegarajipangestu/rk-grpc/v2/middleware/timeout"
+	rkgrpctrace "github.com/tegarajipangestu/rk-grpc/v2/middleware/tracing"
+	"google.golang.org/grpc"
+)
+
+const (
+	// MiddlewareLogging name of logging middleware
+	MiddlewareLogging = "logging"
+	// MiddlewarePanic name of panic middleware
+	MiddlewarePanic = "panic"
+	// MiddlewareProm name of prometheus middleware
+	MiddlewareProm = "prom"
+	// MiddlewareTrace name of trace middleware
+	MiddlewareTrace = "trace"
+	// MiddlewareMeta name of meta middleware
+	MiddlewareMeta = "meta"
+	// MiddlewareShed name of load shedding middleware
+	MiddlewareShed = "shed"
+)
+
+// defaultMiddlewareOrder is order of middlewares in interceptor chain if not configured
+var defaultMiddlewareOrder = []string{
+	MiddlewareLogging,
+	MiddlewarePanic,
+	MiddlewareProm,
+	MiddlewareTrace,
+	MiddlewareShed,
+	MiddlewareJwt,
+	MiddlewareMeta,
+	MiddlewareAuth,
+	MiddlewareAuthz,
+	MiddlewareTimeout,
+	MiddlewareRateLimit,
+}
+
+// BootConfigMiddlewareOverride Boot config of middlewares for specific methods.
+//
+// 1: Methods: Glob patterns of grpc methods, * matches any characters and ? matches single character,
+// like /grpc.health.v1.Health/* for all methods of service.
+// 2: Enable: Middlewares applied to methods even if disabled globally, middleware must be configured.
+// 3: Disable: Middlewares skipped for methods.
+// 4: TimeoutMs: Timeout of methods, timeout middleware would be applied with it.
+//
+// Later overrides take precedence if multiple overrides matched the same method.
+type BootConfigMiddlewareOverride struct {
+	Methods   []string `yaml:"methods" json:"methods"`
+	Enable    []string `yaml:"enable" json:"enable"`
+	Disable   []string `yaml:"disable" json:"disable"`
+	TimeoutMs int      `yaml:"timeoutMs" json:"timeoutMs"`
+}
+
+// middlewareOverride is compiled BootConfigMiddlewareOverride
+type middlewareOverride struct {
+	regexps []*regexp.Regexp
+	enable  map[string]bool
+	disable map[string]bool
+	timeout *middlewareInterceptors
+}
+
+// matchMethod returns true if method matches any of patterns
+func (o *middlewareOverride) matchMethod(method string) bool {
+	for i := range o.regexps {
+		if o.regexps[i].MatchString(method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// chainLink is middleware in chain of a method
+type chainLink struct {
+	slot   *reloadableMiddleware
+	forced bool
+	// interceptors replace ones of slot, like timeout of override
+	interceptors *middlewareInterceptors
+}
+
+// unary returns unary interceptor of link, nil if middleware should be skipped
+func (l *chainLink) unary() grpc.UnaryServerInterceptor {
+	if l.interceptors != nil {
+		return l.interceptors.unary
+	}
+
+	if m := l.slot.get(); !m.overrideOnly || l.forced {
+		return m.unary
+	}
+
+	return nil
+}
+
+// stream returns stream interceptor of link, nil if middleware should be skipped
+func (l *chainLink) stream() grpc.StreamServerInterceptor {
+	if l.interceptors != nil {
+		return l.interceptors.stream
+	}
+
+	if m := l.slot.get(); !m.overrideOnly || l.forced {
+		return m.stream
+	}
+
+	return nil
+}
+
+// chainPlan decides middlewares and their order for each method
+type chainPlan struct {
+	order     []string
+	overrides []*middlewareOverride
+	// links resolved before, keyed by indexes of overrides matched by method, so that size of cache is limited by
+	// overrides instead of methods requested by clients
+	links sync.Map
+}
+
+// newChainPlan validate names of middlewares and compile overrides.
+//
+// Middlewares missing in order would be appended with default order.
+func newChainPlan(order []string, overrides []BootConfigMiddlewareOverride, timeout *rkgrpctimeout.BootConfig, entryName string) (*chainPlan, error) {
+	plan := &chainPlan{
+		order:     make([]string, 0, len(defaultMiddlewareOrder)),
+		overrides: make([]*middlewareOverride, 0, len(overrides)),
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range order {
+		if !isChainMiddleware(name) {
+			return nil, fmt.Errorf("unknown middleware %s in order", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate middleware %s in order", name)
+		}
+
+		seen[name] = true
+		plan.order = append(plan.order, name)
+	}
+
+	for _, name := range defaultMiddlewareOrder {
+		if !seen[name] {
+			plan.order = append(plan.order, name)
+		}
+	}
+
+	for i := range overrides {
+		element := &overrides[i]
+		if len(element.Methods) < 1 {
+			return nil, fmt.Errorf("methods of middleware override[%d] is empty", i)
+		}
+
+		override := &middlewareOverride{
+			regexps: make([]*regexp.Regexp, 0, len(element.Methods)),
+			enable:  make(map[string]bool),
+			disable: make(map[string]bool),
+		}
+
+		for _, method := range element.Methods {
+			pattern := regexp.QuoteMeta(method)
+			pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+			pattern = strings.ReplaceAll(pattern, `\?`, ".")
+			override.regexps = append(override.regexps, regexp.MustCompile("^"+pattern+"$"))
+		}
+
+		for _, name := range element.Enable {
+			if !isChainMiddleware(name) {
+				return nil, fmt.Errorf("unknown middleware %s in middleware override[%d]", name, i)
+			}
+			override.enable[name] = true
+		}
+
+		for _, name := range element.Disable {
+			if !isChainMiddleware(name) {
+				return nil, fmt.Errorf("unknown middleware %s in middleware override[%d]", name, i)
+			}
+			if override.enable[name] {
+				return nil, fmt.Errorf("middleware %s is enabled and disabled in middleware override[%d]", name, i)
+			}
+			override.disable[name] = true
+		}
+
+		if element.TimeoutMs > 0 {
+			config := *timeout
+			config.Enabled = true
+			config.TimeoutMs = element.TimeoutMs
+			config.Paths = nil
+			override.timeout = toTimeoutInterceptors(&config, entryName, false)
+		}
+
+		plan.overrides = append(plan.overrides, override)
+	}
+
+	return plan, nil
+}
+
+// resolve returns links of middlewares applied to method
+func (plan *chainPlan) resolve(method string, slots map[string]*reloadableMiddleware) []*chainLink {
+	matched := make([]*middlewareOverride, 0, len(plan.overrides))
+	key := strings.Builder{}
+	for i, override := range plan.overrides {
+		if override.matchMethod(method) {
+			matched = append(matched, override)
+			key.WriteString(strconv.Itoa(i))
+			key.WriteByte(',')
+		}
+	}
+
+	if v, ok := plan.links.Load(key.String()); ok {
+		return v.([]*chainLink)
+	}
+
+	links := make([]*chainLink, 0, len(plan.order))
+	for _, name := range plan.order {
+		slot, ok := slots[name]
+		if !ok {
+			continue
+		}
+
+		link := &chainLink{slot: slot}
+		disabled := false
+		for _, override := range matched {
+			switch {
+			case override.disable[name]:
+				disabled, link.forced, link.interceptors = true, false, nil
+			case override.enable[name]:
+				disabled, link.forced = false, true
+			}
+
+			if name == MiddlewareTimeout && override.timeout != nil {
+				disabled, link.interceptors = false, override.timeout
+			}
+		}
+
+		if !disabled {
+			links = append(links, link)
+		}
+	}
+
+	plan.links.Store(key.String(), links)
+	return links
+}
+
+// middlewareChain runs middlewares of entry in configured order with overrides of methods.
+type middlewareChain struct {
+	slots map[string]*reloadableMiddleware
+	plan  atomic.Value
+}
+
+// newMiddlewareChain create chain with middlewares and plan
+func newMiddlewareChain(slots map[string]*reloadableMiddleware, plan *chainPlan) *middlewareChain {
+	chain := &middlewareChain{
+		slots: slots,
+	}
+	chain.setPlan(plan)
+
+	return chain
+}
+
+// setPlan replace plan, calls in flight would continue with previous one
+func (chain *middlewareChain) setPlan(plan *chainPlan) {
+	chain.plan.Store(plan)
+}
+
+// getPlan returns current plan
+func (chain *middlewareChain) getPlan() *chainPlan {
+	return chain.plan.Load().(*chainPlan)
+}
+
+// unaryInterceptor call middlewares of method in order
+func (chain *middlewareChain) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return runUnaryLinks(chain.getPlan().resolve(info.FullMethod, chain.slots), ctx, req, info, handler)
+}
+
+// streamInterceptor call middlewares of method in order
+func (chain *middlewareChain) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return runStreamLinks(chain.getPlan().resolve(info.FullMethod, chain.slots), srv, stream, info, handler)
+}
+
+// runUnaryLinks call first enabled middleware in links with rest of links as handler
+func runUnaryLinks(links []*chainLink, ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	for i := range links {
+		if interceptor := links[i].unary(); interceptor != nil {
+			rest := links[i+1:]
+			return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return runUnaryLinks(rest, ctx, req, info, handler)
+			})
+		}
+	}
+
+	return handler(ctx, req)
+}
+
+// runStreamLinks call first enabled middleware in links with rest of links as handler
+func runStreamLinks(links []*chainLink, srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	for i := range links {
+		if interceptor := links[i].stream(); interceptor != nil {
+			rest := links[i+1:]
+			return interceptor(srv, stream, info, func(srv interface{}, stream grpc.ServerStream) error {
+				return runStreamLinks(rest, srv, stream, info, handler)
+			})
+		}
+	}
+
+	return handler(srv, stream)
+}
+
+// isChainMiddleware returns true if name is middleware in interceptor chain
+func isChainMiddleware(name string) bool {
+	for i := range defaultMiddlewareOrder {
+		if defaultMiddlewareOrder[i] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enabledByOverrides returns true if any of overrides enables middleware
+func enabledByOverrides(overrides []BootConfigMiddlewareOverride, name string) bool {
+	for i := range overrides {
+		for _, v := range overrides[i].Enable {
+			if v == name {
+				return true
+			}
+		}
+
+		if name == MiddlewareTimeout && overrides[i].TimeoutMs > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toLoggingInterceptors build interceptors of logging middleware
+func toLoggingInterceptors(config *rkmidlog.BootConfig, entryName string, loggerEntry *rkentry.LoggerEntry, eventEntry *rkentry.EventEntry, force bool) *middlewareInterceptors {
+	if !config.Enabled && !force {
+		return &middlewareInterceptors{}
+	}
+
+	enabled := *config
+	enabled.Enabled = true
+
+	return &middlewareInterceptors{
+		unary: rkgrpclog.UnaryServerInterceptor(
+			rkmidlog.ToOptions(&enabled, entryName, GrpcEntryType, loggerEntry, eventEntry)...),
+		stream: rkgrpclog.StreamServerInterceptor(
+			rkmidlog.ToOptions(&enabled, entryName, GrpcEntryType, loggerEntry, eventEntry)...),
+		overrideOnly: !config.Enabled,
+	}
+}
+
+// toPanicInterceptors build interceptors of panic middleware which is always enabled
+func toPanicInterceptors(entryName string) *middlewareInterceptors {
+	return &middlewareInterceptors{
+		unary:  rkgrpcpanic.UnaryServerInterceptor(rkmidpanic.WithEntryNameAndType(entryName, GrpcEntryType)),
+		stream: rkgrpcpanic.StreamServerInterceptor(rkmidpanic.WithEntryNameAndType(entryName, GrpcEntryType)),
+	}
+}
+
+// toPromInterceptors build interceptors of prometheus middleware
+func toPromInterceptors(config *rkmidprom.BootConfig, entryName string, registry *prometheus.Registry, force bool) *middlewareInterceptors {
+	if !config.Enabled && !force {
+		return &middlewareInterceptors{}
+	}
+
+	enabled := *config
+	enabled.Enabled = true
+
+	return &middlewareInterceptors{
+		unary: rkgrpcprom.UnaryServerInterceptor(
+			rkmidprom.ToOptions(&enabled, entryName, GrpcEntryType, registry, rkmidprom.LabelerTypeGrpc)...),
+		stream: rkgrpcprom.StreamServerInterceptor(
+			rkmidprom.ToOptions(&enabled, entryName, GrpcEntryType, registry, rkmidprom.LabelerTypeGrpc)...),
+		overrideOnly: !config.Enabled,
+	}
+}
+
+// toTraceInterceptors build interceptors of trace middleware
+func toTraceInterceptors(config *rkmidtrace.BootConfig, entryName string, force bool) *middlewareInterceptors {
+	if !config.Enabled && !force {
+		return &middlewareInterceptors{}
+	}
+
+	enabled := *config
+	enabled.Enabled = true
+
+	return &middlewareInterceptors{
+		unary:        rkgrpctrace.UnaryServerInterceptor(rkmidtrace.ToOptions(&enabled, entryName, GrpcEntryType)...),
+		stream:       rkgrpctrace.StreamServerInterceptor(rkmidtrace.ToOptions(&enabled, entryName, GrpcEntryType)...),
+		overrideOnly: !config.Enabled,
+	}
+}
+
+// toMetaInterceptors build interceptors of meta middleware
+func toMetaInterceptors(config *rkmidmeta.BootConfig, entryName string, force bool) *middlewareInterceptors {
+	if !config.Enabled && !force {
+		return &middlewareInterceptors{}
+	}
+
+	enabled := *config
+	enabled.Enabled = true
+
+	return &middlewareInterceptors{
+		unary:        rkgrpcmeta.UnaryServerInterceptor(rkmidmeta.ToOptions(&enabled, entryName, GrpcEntryType)...),
+		stream:       rkgrpcmeta.StreamServerInterceptor(rkmidmeta.ToOptions(&enabled, entryName, GrpcEntryType)...),
+		overrideOnly: !config.Enabled,
+	}
+}
+
+// toShedInterceptors build interceptors of load shedding middleware
+func toShedInterceptors(config *rkgrpcshed.BootConfig, entryName string, force bool) *middlewareInterceptors {
+	if !config.Enabled && !force {
+		return &middlewareInterceptors{}
+	}
+
+	enabled := *config
+	enabled.Enabled = true
+
+	// share in-flight calls between unary and stream
+	opts := rkgrpcshed.ToOptions(&enabled, entryName, GrpcEntryType)
+	unary, stream := rkgrpcshed.ServerInterceptors(opts...)
+
+	return &middlewareInterceptors{
+		unary:        unary,
+		stream:       stream,
+		overrideOnly: !config.Enabled,
+	}
+}
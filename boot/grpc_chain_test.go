@@ -0,0 +1,238 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"testing"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	rkgrpctimeout "github.com/tegarajipangestu/rk-grpc/v2/middleware/timeout"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newUtSlot create slot with interceptors which record name into calls
+func newUtSlot(name string, calls *[]string, overrideOnly bool) *reloadableMiddleware {
+	return newReloadableMiddleware(&middlewareInterceptors{
+		unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			*calls = append(*calls, name)
+			return handler(ctx, req)
+		},
+		stream: func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			*calls = append(*calls, name)
+			return handler(srv, stream)
+		},
+		overrideOnly: overrideOnly,
+	})
+}
+
+// callUtChain call unary and stream interceptors of chain, returns names of middlewares called by unary
+func callUtChain(t *testing.T, chain *middlewareChain, calls *[]string, method string) []string {
+	*calls = (*calls)[:0]
+	resp, err := chain.unaryInterceptor(context.TODO(), "ut-req", &grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return req, nil
+		})
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-req", resp)
+	unary := append([]string{}, *calls...)
+
+	*calls = (*calls)[:0]
+	assert.Nil(t, chain.streamInterceptor(nil, nil, &grpc.StreamServerInfo{FullMethod: method},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			return nil
+		}))
+	assert.Equal(t, unary, *calls)
+
+	return unary
+}
+
+func TestNewChainPlan(t *testing.T) {
+	timeout := &rkgrpctimeout.BootConfig{}
+
+	// default order
+	plan, err := newChainPlan(nil, nil, timeout, "ut-entry")
+	assert.Nil(t, err)
+	assert.Equal(t, defaultMiddlewareOrder, plan.order)
+
+	// missing middlewares appended with default order
+	plan, err = newChainPlan([]string{MiddlewareRateLimit, MiddlewareLogging}, nil, timeout, "ut-entry")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{MiddlewareRateLimit, MiddlewareLogging, MiddlewarePanic}, plan.order[:3])
+	assert.Len(t, plan.order, len(defaultMiddlewareOrder))
+
+	// unknown and duplicate middleware in order
+	_, err = newChainPlan([]string{"ut-unknown"}, nil, timeout, "ut-entry")
+	assert.NotNil(t, err)
+	_, err = newChainPlan([]string{MiddlewareAuth, MiddlewareAuth}, nil, timeout, "ut-entry")
+	assert.NotNil(t, err)
+
+	// invalid overrides
+	_, err = newChainPlan(nil, []BootConfigMiddlewareOverride{{Disable: []string{MiddlewareAuth}}}, timeout, "ut-entry")
+	assert.NotNil(t, err)
+	_, err = newChainPlan(nil, []BootConfigMiddlewareOverride{{Methods: []string{"*"}, Enable: []string{"ut-unknown"}}}, timeout, "ut-entry")
+	assert.NotNil(t, err)
+	_, err = newChainPlan(nil, []BootConfigMiddlewareOverride{{Methods: []string{"*"}, Disable: []string{"ut-unknown"}}}, timeout, "ut-entry")
+	assert.NotNil(t, err)
+	_, err = newChainPlan(nil, []BootConfigMiddlewareOverride{
+		{Methods: []string{"*"}, Enable: []string{MiddlewareAuth}, Disable: []string{MiddlewareAuth}},
+	}, timeout, "ut-entry")
+	assert.NotNil(t, err)
+
+	// timeout override
+	plan, err = newChainPlan(nil, []BootConfigMiddlewareOverride{{Methods: []string{"/ut.v1.Slow/*"}, TimeoutMs: 10}}, timeout, "ut-entry")
+	assert.Nil(t, err)
+	assert.NotNil(t, plan.overrides[0].timeout.unary)
+	assert.True(t, plan.overrides[0].matchMethod("/ut.v1.Slow/Get"))
+	assert.False(t, plan.overrides[0].matchMethod("/ut.v1.Fast/Get"))
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	calls := make([]string, 0)
+	slots := map[string]*reloadableMiddleware{
+		MiddlewareLogging: newUtSlot(MiddlewareLogging, &calls, false),
+		MiddlewareJwt:     newUtSlot(MiddlewareJwt, &calls, false),
+		MiddlewareAuth:    newUtSlot(MiddlewareAuth, &calls, false),
+		MiddlewareAuthz:   newUtSlot(MiddlewareAuthz, &calls, true),
+		MiddlewareTimeout: newReloadableMiddleware(nil),
+	}
+
+	plan, err := newChainPlan([]string{MiddlewareAuth, MiddlewareLogging}, []BootConfigMiddlewareOverride{
+		{Methods: []string{"/grpc.health.v1.Health/*"}, Disable: []string{MiddlewareAuth, MiddlewareJwt}},
+		{Methods: []string{"/ut.v1.Admin/*"}, Enable: []string{MiddlewareAuthz}},
+		{Methods: []string{"/ut.v1.Admin/Public"}, Disable: []string{MiddlewareAuthz}},
+	}, &rkgrpctimeout.BootConfig{}, "ut-entry")
+	assert.Nil(t, err)
+	chain := newMiddlewareChain(slots, plan)
+
+	// case 1: configured order, middleware enabled only by override is skipped
+	assert.Equal(t, []string{MiddlewareAuth, MiddlewareLogging, MiddlewareJwt}, callUtChain(t, chain, &calls, "/ut.v1.Greeter/Get"))
+
+	// case 2: disabled by override
+	assert.Equal(t, []string{MiddlewareLogging}, callUtChain(t, chain, &calls, "/grpc.health.v1.Health/Check"))
+
+	// case 3: enabled by override
+	assert.Equal(t, []string{MiddlewareAuth, MiddlewareLogging, MiddlewareJwt, MiddlewareAuthz},
+		callUtChain(t, chain, &calls, "/ut.v1.Admin/Delete"))
+
+	// case 4: later override takes precedence
+	assert.Equal(t, []string{MiddlewareAuth, MiddlewareLogging, MiddlewareJwt},
+		callUtChain(t, chain, &calls, "/ut.v1.Admin/Public"))
+
+	// case 5: replace plan
+	plan, _ = newChainPlan(nil, nil, &rkgrpctimeout.BootConfig{}, "ut-entry")
+	chain.setPlan(plan)
+	assert.Equal(t, []string{MiddlewareLogging, MiddlewareJwt, MiddlewareAuth}, callUtChain(t, chain, &calls, "/ut.v1.Admin/Delete"))
+
+	// case 6: slot replaced
+	slots[MiddlewareJwt].set(nil)
+	assert.Equal(t, []string{MiddlewareLogging, MiddlewareAuth}, callUtChain(t, chain, &calls, "/ut.v1.Admin/Delete"))
+}
+
+func TestMiddlewareChain_Timeout(t *testing.T) {
+	slots := map[string]*reloadableMiddleware{
+		MiddlewareTimeout: newReloadableMiddleware(nil),
+	}
+
+	plan, err := newChainPlan(nil, []BootConfigMiddlewareOverride{
+		{Methods: []string{"/ut.v1.Slow/*"}, TimeoutMs: 1},
+	}, &rkgrpctimeout.BootConfig{}, "ut-entry")
+	assert.Nil(t, err)
+	chain := newMiddlewareChain(slots, plan)
+
+	// timeout of override applied even if timeout middleware is disabled
+	links := plan.resolve("/ut.v1.Slow/Get", slots)
+	assert.Len(t, links, 1)
+	assert.Equal(t, plan.overrides[0].timeout, links[0].interceptors)
+	assert.Empty(t, plan.resolve("/ut.v1.Fast/Get", slots)[0].unary())
+
+	// resolved links are cached
+	assert.Equal(t, links, chain.getPlan().resolve("/ut.v1.Slow/Get", slots))
+
+	// links cached by overrides matched instead of methods
+	for _, method := range []string{"/ut.v1.Slow/Put", "/ut.v1.Unknown/A", "/ut.v1.Unknown/B", "/ut.v1.Unknown/C"} {
+		chain.getPlan().resolve(method, slots)
+	}
+	size := 0
+	plan.links.Range(func(key, value interface{}) bool {
+		size++
+		return true
+	})
+	assert.Equal(t, 2, size)
+	assert.Equal(t, links, chain.getPlan().resolve("/ut.v1.Slow/Put", slots))
+}
+
+func TestRegisterGrpcEntryYAML_WithOverrides(t *testing.T) {
+	entry := RegisterGrpcEntryYAML([]byte(`
+grpc:
+  - name: ut-chain
+    port: 1949
+    enabled: true
+    middleware:
+      order: ["auth", "logging"]
+      auth:
+        enabled: false
+        basic: ["user:pass"]
+      overrides:
+        - methods: ["/ut.v1.Admin/*"]
+          enable: ["auth"]
+`))["ut-chain"].(*GrpcEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, MiddlewareAuth, entry.chain.getPlan().order[0])
+	assert.NotNil(t, entry.middlewares[MiddlewareAuth].get().unary)
+	assert.True(t, entry.middlewares[MiddlewareAuth].get().overrideOnly)
+
+	// invalid order
+	assert.Panics(t, func() {
+		RegisterGrpcEntryYAML([]byte(`
+grpc:
+  - name: ut-chain-invalid
+    port: 1949
+    enabled: true
+    middleware:
+      order: ["ut-unknown"]
+`))
+	})
+}
+
+func TestRegisterGrpcEntryYAML_WithShed(t *testing.T) {
+	entry := RegisterGrpcEntryYAML([]byte(`
+grpc:
+  - name: ut-shed
+    port: 1949
+    enabled: true
+    middleware:
+      shed:
+        enabled: true
+        maxInFlight: 1
+`))["ut-shed"].(*GrpcEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, MiddlewareShed, entry.chain.getPlan().order[4])
+
+	call := func(method string, handler grpc.UnaryHandler) error {
+		_, err := entry.chain.unaryInterceptor(context.TODO(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	// calls are shed while the only slot is in use, except health check
+	var nested, health error
+	assert.Nil(t, call("/ut.v1.Greeter/Hello", func(ctx context.Context, req interface{}) (interface{}, error) {
+		nested = call("/ut.v1.Greeter/Hello", func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		health = call("/grpc.health.v1.Health/Check", func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		return nil, nil
+	}))
+	assert.Equal(t, codes.Unavailable, status.Code(nested))
+	assert.Nil(t, health)
+}
@@ -9,7 +9,9 @@ package rkgrpc
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"net"
@@ -19,6 +21,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	gwruntime "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/prometheus/client_golang/prometheus"
@@ -29,35 +33,33 @@ import (
 	rkmidauth "github.com/rookie-ninja/rk-entry/v2/middleware/auth"
 	rkmidcors "github.com/rookie-ninja/rk-entry/v2/middleware/cors"
 	rkmidcsrf "github.com/rookie-ninja/rk-entry/v2/middleware/csrf"
-	rkmidjwt "github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
 	rkmidlog "github.com/rookie-ninja/rk-entry/v2/middleware/log"
 	rkmidmeta "github.com/rookie-ninja/rk-entry/v2/middleware/meta"
-	rkmidpanic "github.com/rookie-ninja/rk-entry/v2/middleware/panic"
 	rkmidprom "github.com/rookie-ninja/rk-entry/v2/middleware/prom"
-	rkmidlimit "github.com/rookie-ninja/rk-entry/v2/middleware/ratelimit"
 	rkmidsec "github.com/rookie-ninja/rk-entry/v2/middleware/secure"
-	rkmidtimeout "github.com/rookie-ninja/rk-entry/v2/middleware/timeout"
 	rkmidtrace "github.com/rookie-ninja/rk-entry/v2/middleware/tracing"
 	rkquery "github.com/rookie-ninja/rk-query"
 	"github.com/soheilhy/cmux"
-	rkgrpcauth "github.com/tegarajipangestu/rk-grpc/v2/middleware/auth"
+	rkgrpcauthz "github.com/tegarajipangestu/rk-grpc/v2/middleware/authz"
 	rkgrpccors "github.com/tegarajipangestu/rk-grpc/v2/middleware/cors"
 	rkgrpccsrf "github.com/tegarajipangestu/rk-grpc/v2/middleware/csrf"
+	rkgrpcgzip "github.com/tegarajipangestu/rk-grpc/v2/middleware/gzip"
 	rkgrpcjwt "github.com/tegarajipangestu/rk-grpc/v2/middleware/jwt"
-	rkgrpclog "github.com/tegarajipangestu/rk-grpc/v2/middleware/log"
-	rkgrpcmeta "github.com/tegarajipangestu/rk-grpc/v2/middleware/meta"
-	rkgrpcpanic "github.com/tegarajipangestu/rk-grpc/v2/middleware/panic"
-	rkgrpcprom "github.com/tegarajipangestu/rk-grpc/v2/middleware/prom"
 	rkgrpclimit "github.com/tegarajipangestu/rk-grpc/v2/middleware/ratelimit"
 	rkgrpcsec "github.com/tegarajipangestu/rk-grpc/v2/middleware/secure"
+	rkgrpcshed "github.com/tegarajipangestu/rk-grpc/v2/middleware/shed"
 	rkgrpctimeout "github.com/tegarajipangestu/rk-grpc/v2/middleware/timeout"
-	rkgrpctrace "github.com/tegarajipangestu/rk-grpc/v2/middleware/tracing"
 	"go.uber.org/zap"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
+	"google.golang.org/genproto/googleapis/api/annotations"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 // This must be declared in order to register registration function into rk context
@@ -69,6 +71,8 @@ func init() {
 const (
 	// GrpcEntryType default entry type
 	GrpcEntryType = "gRPCEntry"
+	// defaultShutdownTimeout default timeout of graceful shutdown
+	defaultShutdownTimeout = 30 * time.Second
 )
 
 // BootConfig Boot config which is for grpc entry.
@@ -77,6 +81,7 @@ type BootConfig struct {
 		Name               string                        `yaml:"name" json:"name"`
 		Description        string                        `yaml:"description" json:"description"`
 		Port               uint64                        `yaml:"port" json:"port"`
+		GwPort             uint64                        `yaml:"gwPort" json:"gwPort"`
 		Enabled            bool                          `yaml:"enabled" json:"enabled"`
 		EnableReflection   bool                          `yaml:"enableReflection" json:"enableReflection"`
 		NoRecvMsgSizeLimit bool                          `yaml:"noRecvMsgSizeLimit" json:"noRecvMsgSizeLimit"`
@@ -86,26 +91,41 @@ type BootConfig struct {
 		Prom               rkentry.BootProm              `yaml:"prom" json:"prom"`
 		Static             rkentry.BootStaticFileHandler `yaml:"static" json:"static"`
 		Proxy              BootConfigProxy               `yaml:"proxy" json:"proxy"`
+		Reload             BootConfigReload              `yaml:"reload" json:"reload"`
 		CertEntry          string                        `yaml:"certEntry" json:"certEntry"`
 		LoggerEntry        string                        `yaml:"loggerEntry" json:"loggerEntry"`
 		EventEntry         string                        `yaml:"eventEntry" json:"eventEntry"`
 		PProf              rkentry.BootPProf             `yaml:"pprof" json:"pprof"`
 		EnableRkGwOption   bool                          `yaml:"enableRkGwOption" json:"enableRkGwOption"`
 		GwOption           *gwOption                     `yaml:"gwOption" json:"gwOption"`
-		Middleware         struct {
-			Ignore     []string                `yaml:"ignore" json:"ignore"`
-			ErrorModel string                  `yaml:"errorModel" json:"errorModel"`
-			Logging    rkmidlog.BootConfig     `yaml:"logging" json:"logging"`
-			Prom       rkmidprom.BootConfig    `yaml:"prom" json:"prom"`
-			Auth       rkmidauth.BootConfig    `yaml:"auth" json:"auth"`
-			Cors       rkmidcors.BootConfig    `yaml:"cors" json:"cors"`
-			Secure     rkmidsec.BootConfig     `yaml:"secure" json:"secure"`
-			Meta       rkmidmeta.BootConfig    `yaml:"meta" json:"meta"`
-			Jwt        rkmidjwt.BootConfig     `yaml:"jwt" json:"jwt"`
-			Csrf       rkmidcsrf.BootConfig    `yaml:"csrf" yaml:"csrf"`
-			RateLimit  rkmidlimit.BootConfig   `yaml:"rateLimit" json:"rateLimit"`
-			Timeout    rkmidtimeout.BootConfig `yaml:"timeout" json:"timeout"`
-			Trace      rkmidtrace.BootConfig   `yaml:"trace" json:"trace"`
+		Mtls               struct {
+			Enabled      bool   `yaml:"enabled" json:"enabled"`
+			GwCertEntry  string `yaml:"gwCertEntry" json:"gwCertEntry"`
+			GwServerName string `yaml:"gwServerName" json:"gwServerName"`
+		} `yaml:"mtls" json:"mtls"`
+		Shutdown struct {
+			DrainPeriodMs int `yaml:"drainPeriodMs" json:"drainPeriodMs"`
+			TimeoutMs     int `yaml:"timeoutMs" json:"timeoutMs"`
+		} `yaml:"shutdown" json:"shutdown"`
+		Middleware struct {
+			Ignore     []string                       `yaml:"ignore" json:"ignore"`
+			Order      []string                       `yaml:"order" json:"order"`
+			Overrides  []BootConfigMiddlewareOverride `yaml:"overrides" json:"overrides"`
+			ErrorModel string                         `yaml:"errorModel" json:"errorModel"`
+			Logging    rkmidlog.BootConfig            `yaml:"logging" json:"logging"`
+			Prom       rkmidprom.BootConfig           `yaml:"prom" json:"prom"`
+			Auth       rkmidauth.BootConfig           `yaml:"auth" json:"auth"`
+			Authz      rkgrpcauthz.BootConfig         `yaml:"authz" json:"authz"`
+			Cors       rkmidcors.BootConfig           `yaml:"cors" json:"cors"`
+			Secure     rkmidsec.BootConfig            `yaml:"secure" json:"secure"`
+			Meta       rkmidmeta.BootConfig           `yaml:"meta" json:"meta"`
+			Jwt        rkgrpcjwt.BootConfig           `yaml:"jwt" json:"jwt"`
+			Csrf       rkmidcsrf.BootConfig           `yaml:"csrf" yaml:"csrf"`
+			Gzip       rkgrpcgzip.BootConfig          `yaml:"gzip" json:"gzip"`
+			RateLimit  rkgrpclimit.BootConfig         `yaml:"rateLimit" json:"rateLimit"`
+			Shed       rkgrpcshed.BootConfig          `yaml:"shed" json:"shed"`
+			Timeout    rkgrpctimeout.BootConfig       `yaml:"timeout" json:"timeout"`
+			Trace      rkmidtrace.BootConfig          `yaml:"trace" json:"trace"`
 		} `yaml:"middleware" json:"middleware"`
 	} `yaml:"grpc" json:"grpc"`
 }
@@ -118,8 +138,10 @@ type GrpcEntry struct {
 	LoggerEntry       *rkentry.LoggerEntry `json:"-" yaml:"-"`
 	EventEntry        *rkentry.EventEntry  `json:"-" yaml:"-"`
 	Port              uint64               `json:"-" yaml:"-"`
+	GwPort            uint64               `json:"-" yaml:"-"`
 	TlsConfig         *tls.Config          `json:"-" yaml:"-"`
 	TlsConfigInsecure *tls.Config          `json:"-" yaml:"-"`
+	EnableMtls        bool                 `json:"-" yaml:"-"`
 	// GRPC related
 	Server             *grpc.Server                   `json:"-" yaml:"-"`
 	ServerOpts         []grpc.ServerOption            `json:"-" yaml:"-"`
@@ -127,6 +149,7 @@ type GrpcEntry struct {
 	StreamInterceptors []grpc.StreamServerInterceptor `json:"-" yaml:"-"`
 	GrpcRegF           []GrpcRegFunc                  `json:"-" yaml:"-"`
 	EnableReflection   bool                           `json:"-" yaml:"-"`
+	HealthServer       *health.Server                 `json:"-" yaml:"-"`
 	// Gateway related
 	HttpMux         *http.ServeMux             `json:"-" yaml:"-"`
 	HttpServer      *http.Server               `json:"-" yaml:"-"`
@@ -137,6 +160,7 @@ type GrpcEntry struct {
 	gwCorsOptions   []rkmidcors.Option         `json:"-" yaml:"-"`
 	gwSecureOptions []rkmidsec.Option          `json:"-" yaml:"-"`
 	gwCsrfOptions   []rkmidcsrf.Option         `json:"-" yaml:"-"`
+	gzipOptions     []rkgrpcgzip.Option        `json:"-" yaml:"-"`
 	// Utility related
 	SWEntry            *rkentry.SWEntry                `json:"-" yaml:"-"`
 	DocsEntry          *rkentry.DocsEntry              `json:"-" yaml:"-"`
@@ -146,7 +170,20 @@ type GrpcEntry struct {
 	CommonServiceEntry *rkentry.CommonServiceEntry     `json:"-" yaml:"-"`
 	PProfEntry         *rkentry.PProfEntry             `json:"-" yaml:"-"`
 	CertEntry          *rkentry.CertEntry              `json:"-" yaml:"-"`
+	GwCertEntry        *rkentry.CertEntry              `json:"-" yaml:"-"`
+	GwServerName       string                          `json:"-" yaml:"-"`
 	bootstrapLogOnce   sync.Once                       `json:"-" yaml:"-"`
+	// Shutdown related
+	DrainPeriod     time.Duration `json:"-" yaml:"-"`
+	ShutdownTimeout time.Duration `json:"-" yaml:"-"`
+	draining        int32         `json:"-" yaml:"-"`
+	inFlight        int64         `json:"-" yaml:"-"`
+	// Reload related
+	ReloadPath       string                           `json:"-" yaml:"-"`
+	ReloadConfigFile string                           `json:"-" yaml:"-"`
+	middlewares      map[string]*reloadableMiddleware `json:"-" yaml:"-"`
+	chain            *middlewareChain                 `json:"-" yaml:"-"`
+	reloadLock       sync.Mutex                       `json:"-" yaml:"-"`
 }
 
 // RegisterGrpcEntryYAML Register grpc entries with provided config file (Must YAML file).
@@ -217,44 +254,34 @@ func RegisterGrpcEntryYAML(raw []byte) map[string]rkentry.Entry {
 		// Did we enabled proxy?
 		var proxy *ProxyEntry
 		if element.Proxy.Enabled {
-			opts := make([]ruleOption, 0)
-			for i := range element.Proxy.Rules {
-				rule := element.Proxy.Rules[i]
-				switch rule.Type {
-				case HeaderBased:
-					headers := make(map[string]string, 0)
-
-					for i := range rule.HeaderPairs {
-						tokens := strings.SplitN(rule.HeaderPairs[i], ":", 2)
-						if len(tokens) != 2 {
-							continue
-						}
-						headers[tokens[0]] = tokens[1]
-					}
-
-					opts = append(opts, WithHeaderPatterns(&HeaderPattern{
-						Headers: headers,
-						Dest:    rule.Dest,
-					}))
-
-				case PathBased:
-					opts = append(opts, WithPathPatterns(&PathPattern{
-						Paths: rule.Paths,
-						Dest:  rule.Dest,
-					}))
-				case IpBased:
-					opts = append(opts, WithIpPatterns(&IpPattern{
-						Cidrs: rule.Ips,
-						Dest:  rule.Dest,
-					}))
+			gwRules := make([]*annotations.HttpRule, 0)
+			for i := range element.Proxy.GwMappingFiles {
+				rules, err := ReadGwMappingFile(element.Proxy.GwMappingFiles[i])
+				if err != nil {
+					rkentry.ShutdownWithError(err)
 				}
+				gwRules = append(gwRules, rules...)
+			}
+
+			r, err := element.Proxy.ToRule()
+			if err != nil {
+				rkentry.ShutdownWithError(err)
 			}
 
 			proxy = NewProxyEntry(
 				WithNameProxy(element.Name),
 				WithEventEntryProxy(eventEntry),
 				WithLoggerEntryProxy(loggerEntry),
-				WithRuleProxy(NewRule(opts...)))
+				WithPromRegistryProxy(promRegistry),
+				WithRuleProxy(r),
+				WithGwRulesProxy(gwRules...))
+
+			if element.Proxy.Debug.Enabled {
+				proxy.DebugPath = element.Proxy.Debug.Path
+				if len(proxy.DebugPath) < 1 {
+					proxy.DebugPath = defaultProxyDebugPath
+				}
+			}
 		}
 
 		var grpcDialOptions = make([]grpc.DialOption, 0)
@@ -276,6 +303,7 @@ func RegisterGrpcEntryYAML(raw []byte) map[string]rkentry.Entry {
 			WithLoggerEntry(loggerEntry),
 			WithEventEntry(eventEntry),
 			WithPort(element.Port),
+			WithGwPort(element.GwPort),
 			WithGrpcDialOptions(grpcDialOptions...),
 			WithSwEntry(swEntry),
 			WithDocsEntry(docsEntry),
@@ -287,7 +315,21 @@ func RegisterGrpcEntryYAML(raw []byte) map[string]rkentry.Entry {
 			WithCertEntry(certEntry),
 			WithPProfEntry(pprofEntry),
 			WithEnableReflection(element.EnableReflection),
-			WithCertEntry(rkentry.GlobalAppCtx.GetCertEntry(element.CertEntry)))
+			WithCertEntry(rkentry.GlobalAppCtx.GetCertEntry(element.CertEntry)),
+			WithEnableMtls(element.Mtls.Enabled),
+			WithDrainPeriod(time.Duration(element.Shutdown.DrainPeriodMs)*time.Millisecond),
+			WithShutdownTimeout(time.Duration(element.Shutdown.TimeoutMs)*time.Millisecond),
+			WithReloadConfigFile(element.Reload.ConfigFile),
+			WithGwCertEntry(rkentry.GlobalAppCtx.GetCertEntry(element.Mtls.GwCertEntry)),
+			WithGwServerName(element.Mtls.GwServerName))
+
+		// Did we enable reload endpoint?
+		if element.Reload.Enabled {
+			entry.ReloadPath = element.Reload.Path
+			if len(entry.ReloadPath) < 1 {
+				entry.ReloadPath = defaultReloadPath
+			}
+		}
 
 		// Did we disable message size for receiving?
 		if element.NoRecvMsgSizeLimit {
@@ -308,99 +350,77 @@ func RegisterGrpcEntryYAML(raw []byte) map[string]rkentry.Entry {
 			rkmid.SetErrorBuilder(rkerror.NewErrorBuilderAMZN())
 		}
 
-		// logging middleware
-		if element.Middleware.Logging.Enabled {
-			entry.AddUnaryInterceptors(rkgrpclog.UnaryServerInterceptor(
-				rkmidlog.ToOptions(&element.Middleware.Logging, element.Name, GrpcEntryType,
-					loggerEntry, eventEntry)...))
-			entry.AddStreamInterceptors(rkgrpclog.StreamServerInterceptor(
-				rkmidlog.ToOptions(&element.Middleware.Logging, element.Name, GrpcEntryType,
-					loggerEntry, eventEntry)...))
-		}
-
-		// Default middleware should be placed after logging middleware, we should make sure interceptors never panic
-		// insert panic interceptor
-		entry.UnaryInterceptors = append(entry.UnaryInterceptors, rkgrpcpanic.UnaryServerInterceptor(
-			rkmidpanic.WithEntryNameAndType(entry.entryName, entry.entryType)))
-		entry.StreamInterceptors = append(entry.StreamInterceptors, rkgrpcpanic.StreamServerInterceptor(
-			rkmidpanic.WithEntryNameAndType(entry.entryName, entry.entryType)))
-
-		// did we enable metrics interceptor?
-		if element.Middleware.Prom.Enabled {
-			entry.AddUnaryInterceptors(rkgrpcprom.UnaryServerInterceptor(
-				rkmidprom.ToOptions(&element.Middleware.Prom, element.Name, GrpcEntryType,
-					promRegistry, rkmidprom.LabelerTypeGrpc)...))
-			entry.AddStreamInterceptors(rkgrpcprom.StreamServerInterceptor(
-				rkmidprom.ToOptions(&element.Middleware.Prom, element.Name, GrpcEntryType,
-					promRegistry, rkmidprom.LabelerTypeGrpc)...))
-		}
-
-		// trace middleware
-		if element.Middleware.Trace.Enabled {
-			entry.AddUnaryInterceptors(rkgrpctrace.UnaryServerInterceptor(
-				rkmidtrace.ToOptions(&element.Middleware.Trace, element.Name, GrpcEntryType)...))
-			entry.AddStreamInterceptors(rkgrpctrace.StreamServerInterceptor(
-				rkmidtrace.ToOptions(&element.Middleware.Trace, element.Name, GrpcEntryType)...))
-		}
-
-		// cors middleware
+		// gateway middlewares
 		if element.Middleware.Cors.Enabled {
 			entry.AddGwCorsOptions(rkmidcors.ToOptions(
 				&element.Middleware.Cors, element.Name, GrpcEntryType)...)
 		}
 
-		// jwt middleware
-		if element.Middleware.Jwt.Enabled {
-			entry.AddUnaryInterceptors(rkgrpcjwt.UnaryServerInterceptor(
-				rkmidjwt.ToOptions(&element.Middleware.Jwt, element.Name, GrpcEntryType)...))
-			entry.AddStreamInterceptors(rkgrpcjwt.StreamServerInterceptor(
-				rkmidjwt.ToOptions(&element.Middleware.Jwt, element.Name, GrpcEntryType)...))
-		}
-
-		// secure middleware
 		if element.Middleware.Secure.Enabled {
 			entry.AddGwSecureOptions(rkmidsec.ToOptions(
 				&element.Middleware.Secure, element.Name, GrpcEntryType)...)
 		}
 
-		// csrf middleware
 		if element.Middleware.Csrf.Enabled {
 			entry.AddGwCsrfOptions(rkmidcsrf.ToOptions(
 				&element.Middleware.Csrf, element.Name, GrpcEntryType)...)
 		}
 
-		// meta middleware
-		if element.Middleware.Meta.Enabled {
-			entry.AddUnaryInterceptors(rkgrpcmeta.UnaryServerInterceptor(
-				rkmidmeta.ToOptions(&element.Middleware.Meta, element.Name, GrpcEntryType)...))
-			entry.AddStreamInterceptors(rkgrpcmeta.StreamServerInterceptor(
-				rkmidmeta.ToOptions(&element.Middleware.Meta, element.Name, GrpcEntryType)...))
+		if element.Middleware.Gzip.Enabled {
+			entry.AddGzipOptions(rkgrpcgzip.ToOptions(
+				&element.Middleware.Gzip, element.Name, GrpcEntryType)...)
 		}
 
-		// auth middleware
-		if element.Middleware.Auth.Enabled {
-			entry.AddUnaryInterceptors(rkgrpcauth.UnaryServerInterceptor(
-				rkmidauth.ToOptions(&element.Middleware.Auth, element.Name, GrpcEntryType)...))
-			entry.AddStreamInterceptors(rkgrpcauth.StreamServerInterceptor(
-				rkmidauth.ToOptions(&element.Middleware.Auth, element.Name, GrpcEntryType)...))
+		// counter of jwt failures is registered even if disabled, since jwt could be enabled by reloading
+		if err := rkgrpcjwt.RegisterMetrics(promRegistry); err != nil {
+			rkentry.ShutdownWithError(err)
 		}
 
-		// timeout middleware
-		if element.Middleware.Timeout.Enabled {
-			entry.AddUnaryInterceptors(rkgrpctimeout.UnaryServerInterceptor(
-				rkmidtimeout.ToOptions(&element.Middleware.Timeout, element.Name, GrpcEntryType)...))
-			entry.AddStreamInterceptors(rkgrpctimeout.StreamServerInterceptor(
-				rkmidtimeout.ToOptions(&element.Middleware.Timeout, element.Name, GrpcEntryType)...))
+		// interceptor middlewares, chained with configured order and overrides of methods
+		plan, err := newChainPlan(element.Middleware.Order, element.Middleware.Overrides,
+			&element.Middleware.Timeout, element.Name)
+		if err != nil {
+			rkentry.ShutdownWithError(err)
 		}
 
-		// ratelimit middleware
-		if element.Middleware.RateLimit.Enabled {
-			entry.AddUnaryInterceptors(rkgrpclimit.UnaryServerInterceptor(
-				rkmidlimit.ToOptions(&element.Middleware.RateLimit, element.Name, GrpcEntryType)...))
-			entry.AddStreamInterceptors(rkgrpclimit.StreamServerInterceptor(
-				rkmidlimit.ToOptions(&element.Middleware.RateLimit, element.Name, GrpcEntryType)...))
+		overrides := element.Middleware.Overrides
+		slots := map[string]*reloadableMiddleware{
+			MiddlewareLogging: newReloadableMiddleware(toLoggingInterceptors(&element.Middleware.Logging, element.Name,
+				loggerEntry, eventEntry, enabledByOverrides(overrides, MiddlewareLogging))),
+			MiddlewarePanic: newReloadableMiddleware(toPanicInterceptors(element.Name)),
+			MiddlewareProm: newReloadableMiddleware(toPromInterceptors(&element.Middleware.Prom, element.Name,
+				promRegistry, enabledByOverrides(overrides, MiddlewareProm))),
+			MiddlewareTrace: newReloadableMiddleware(toTraceInterceptors(&element.Middleware.Trace, element.Name,
+				enabledByOverrides(overrides, MiddlewareTrace))),
+			MiddlewareMeta: newReloadableMiddleware(toMetaInterceptors(&element.Middleware.Meta, element.Name,
+				enabledByOverrides(overrides, MiddlewareMeta))),
+			MiddlewareShed: newReloadableMiddleware(toShedInterceptors(&element.Middleware.Shed, element.Name,
+				enabledByOverrides(overrides, MiddlewareShed))),
 		}
 
+		// middlewares could be reloaded
+		reloadable := map[string]*middlewareInterceptors{
+			MiddlewareJwt: toJwtInterceptors(&element.Middleware.Jwt, element.Name,
+				enabledByOverrides(overrides, MiddlewareJwt)),
+			MiddlewareAuth: toAuthInterceptors(&element.Middleware.Auth, element.Name,
+				enabledByOverrides(overrides, MiddlewareAuth)),
+			MiddlewareAuthz: toAuthzInterceptors(&element.Middleware.Authz, element.Name,
+				enabledByOverrides(overrides, MiddlewareAuthz)),
+			MiddlewareTimeout: toTimeoutInterceptors(&element.Middleware.Timeout, element.Name,
+				enabledByOverrides(overrides, MiddlewareTimeout)),
+			MiddlewareRateLimit: toRateLimitInterceptors(&element.Middleware.RateLimit, element.Name,
+				enabledByOverrides(overrides, MiddlewareRateLimit)),
+		}
+		for name, interceptors := range reloadable {
+			slots[name] = newReloadableMiddleware(interceptors)
+			entry.middlewares[name] = slots[name]
+			interceptors.commitEntries()
+		}
+
+		entry.chain = newMiddlewareChain(slots, plan)
+		entry.AddUnaryInterceptors(entry.chain.unaryInterceptor)
+		entry.AddStreamInterceptors(entry.chain.streamInterceptor)
+
 		res[element.Name] = entry
 	}
 	return res
@@ -420,6 +440,7 @@ func RegisterGrpcEntry(opts ...GrpcEntryOption) *GrpcEntry {
 		StreamInterceptors: make([]grpc.StreamServerInterceptor, 0),
 		GrpcRegF:           make([]GrpcRegFunc, 0),
 		EnableReflection:   true,
+		ShutdownTimeout:    defaultShutdownTimeout,
 		// grpc-gateway related
 		GwMuxOptions:    make([]gwruntime.ServeMuxOption, 0),
 		GwRegF:          make([]GwRegFunc, 0),
@@ -428,6 +449,8 @@ func RegisterGrpcEntry(opts ...GrpcEntryOption) *GrpcEntry {
 		gwCorsOptions:   make([]rkmidcors.Option, 0),
 		gwCsrfOptions:   make([]rkmidcsrf.Option, 0),
 		gwSecureOptions: make([]rkmidsec.Option, 0),
+		gzipOptions:     make([]rkgrpcgzip.Option, 0),
+		middlewares:     make(map[string]*reloadableMiddleware),
 	}
 
 	for i := range opts {
@@ -438,6 +461,11 @@ func RegisterGrpcEntry(opts ...GrpcEntryOption) *GrpcEntry {
 		entry.entryName = "grpc-" + strconv.FormatUint(entry.Port, 10)
 	}
 
+	// Init grpc health server if common service is enabled
+	if entry.IsCommonServiceEnabled() {
+		entry.HealthServer = health.NewServer()
+	}
+
 	// Init TLS config
 	if entry.IsTlsEnabled() {
 		entry.TlsConfig = &tls.Config{
@@ -448,6 +476,37 @@ func RegisterGrpcEntry(opts ...GrpcEntryOption) *GrpcEntry {
 			InsecureSkipVerify: true,
 			Certificates:       []tls.Certificate{*entry.CertEntry.Certificate},
 		}
+
+		// Init mTLS config, client certificate would be verified with CA of cert entry
+		if entry.EnableMtls {
+			if entry.CertEntry.RootCA == nil {
+				rkentry.ShutdownWithError(errors.New("mTLS is enabled but caPath is missing in cert entry"))
+			}
+
+			// grpc gateway calls grpc server with loopback dial, it should present a client certificate signed by CA.
+			// Certificate of server usually lacks clientAuth usage, so dedicated certificate is required.
+			if entry.GwCertEntry == nil || entry.GwCertEntry.Certificate == nil {
+				rkentry.ShutdownWithError(errors.New("mTLS is enabled but gwCertEntry is missing"))
+			}
+
+			// grpc gateway would require client certificate as well if it shares port with grpc, which breaks probes,
+			// swagger and docs, so it should listen on gwPort without mTLS
+			if !entry.IsGwPortSeparated() {
+				rkentry.ShutdownWithError(errors.New("mTLS is enabled but gwPort is not separated from port"))
+			}
+
+			caPool := x509.NewCertPool()
+			caPool.AddCert(entry.CertEntry.RootCA)
+			entry.TlsConfig.ClientCAs = caPool
+			entry.TlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+			// certificate of server is verified with CA while dialing from grpc gateway
+			entry.TlsConfigInsecure = &tls.Config{
+				Certificates: []tls.Certificate{*entry.GwCertEntry.Certificate},
+				RootCAs:      caPool,
+				ServerName:   entry.getGwServerName(),
+			}
+		}
 	}
 
 	// add entry name and entry type into loki syncer if enabled
@@ -488,20 +547,39 @@ func (entry *GrpcEntry) Bootstrap(ctx context.Context) {
 
 	// 1: Create grpc server
 	// 1.1: Make unary and stream interceptors into server opts
+	// In-flight interceptors are placed at first in order to track every RPC during shutdown.
 	// Important! Do not add tls as options since we already enable tls in listener
 	entry.ServerOpts = append(entry.ServerOpts,
-		grpc.ChainUnaryInterceptor(entry.UnaryInterceptors...),
-		grpc.ChainStreamInterceptor(entry.StreamInterceptors...))
+		grpc.ChainUnaryInterceptor(append([]grpc.UnaryServerInterceptor{entry.inFlightUnaryInterceptor}, entry.UnaryInterceptors...)...),
+		grpc.ChainStreamInterceptor(append([]grpc.StreamServerInterceptor{entry.inFlightStreamInterceptor}, entry.StreamInterceptors...)...))
+
+	// 1.2: Expose TLS state of listener to grpc server, so that peer certificate could be retrieved from context
+	if entry.IsTlsEnabled() {
+		entry.ServerOpts = append(entry.ServerOpts, grpc.Creds(newListenerTlsCredentials()))
+	}
+
+	// 1.3: Register compressors if gzip enabled, server would respond with the same encoding client used
+	if len(entry.gzipOptions) > 0 {
+		if err := rkgrpcgzip.RegisterCompressors(entry.gzipOptions...); err != nil {
+			entry.EventEntry.FinishWithError(event, err)
+			rkentry.ShutdownWithError(err)
+		}
+	}
 
 	// 2: Add proxy entry
 	if entry.IsProxyEnabled() {
 		entry.ServerOpts = append(entry.ServerOpts,
 			grpc.ForceServerCodec(Codec()),
-			grpc.UnknownServiceHandler(TransparentHandler(entry.ProxyEntry.r.GetDirector())),
+			grpc.UnknownServiceHandler(entry.ProxyEntry.streamHandler()),
 		)
 		entry.ProxyEntry.Bootstrap(ctx)
 	}
 
+	// 2.1: Start background jobs of reloadable middlewares like refreshing JWKS
+	for _, m := range entry.middlewares {
+		m.get().startJobs(ctx)
+	}
+
 	// 3: Create grpc server
 	entry.Server = grpc.NewServer(entry.ServerOpts...)
 
@@ -510,9 +588,30 @@ func (entry *GrpcEntry) Bootstrap(ctx context.Context) {
 		regFunc(entry.Server)
 	}
 
-	// 5: Enable grpc reflection
+	// 4.1: Register grpc health service, services without serving status would be marked as SERVING
+	if entry.IsGrpcHealthEnabled() {
+		healthpb.RegisterHealthServer(entry.Server, entry.HealthServer)
+
+		services := []string{""}
+		for name := range entry.Server.GetServiceInfo() {
+			services = append(services, name)
+		}
+
+		for i := range services {
+			_, err := entry.HealthServer.Check(ctx, &healthpb.HealthCheckRequest{Service: services[i]})
+			if status.Code(err) == codes.NotFound {
+				entry.HealthServer.SetServingStatus(services[i], healthpb.HealthCheckResponse_SERVING)
+			}
+		}
+	}
+
+	// 5: Enable grpc reflection, proxied services would be listed if proxy enabled
 	if entry.EnableReflection {
-		reflection.Register(entry.Server)
+		if entry.IsProxyEnabled() {
+			entry.ProxyEntry.registerReflection(entry.Server)
+		} else {
+			reflection.Register(entry.Server)
+		}
 	}
 
 	// 6: Create http server based on grpc gateway
@@ -536,6 +635,15 @@ func (entry *GrpcEntry) Bootstrap(ctx context.Context) {
 		}
 	}
 
+	// 8.1: Register HTTP rules of proxied methods into GwMux
+	if entry.IsProxyEnabled() {
+		err := entry.ProxyEntry.registerGateway(entry.GwMux, "0.0.0.0:"+strconv.FormatUint(entry.Port, 10), entry.GwDialOptions)
+		if err != nil {
+			entry.EventEntry.FinishWithError(event, err)
+			rkentry.ShutdownWithError(err)
+		}
+	}
+
 	// 9: Make http mux listen on path of / and configure TV, swagger, prometheus path
 	entry.HttpMux.Handle("/", entry.GwMux)
 
@@ -566,7 +674,7 @@ func (entry *GrpcEntry) Bootstrap(ctx context.Context) {
 
 	// 14: common service
 	if entry.IsCommonServiceEnabled() {
-		entry.HttpMux.HandleFunc(entry.CommonServiceEntry.ReadyPath, entry.CommonServiceEntry.Ready)
+		entry.HttpMux.HandleFunc(entry.CommonServiceEntry.ReadyPath, entry.ready)
 		entry.HttpMux.HandleFunc(entry.CommonServiceEntry.GcPath, entry.CommonServiceEntry.Gc)
 		entry.HttpMux.HandleFunc(entry.CommonServiceEntry.InfoPath, entry.CommonServiceEntry.Info)
 		entry.HttpMux.HandleFunc(entry.CommonServiceEntry.AlivePath, entry.CommonServiceEntry.Alive)
@@ -575,6 +683,16 @@ func (entry *GrpcEntry) Bootstrap(ctx context.Context) {
 		entry.CommonServiceEntry.Bootstrap(ctx)
 	}
 
+	// 14.1: proxy debug endpoint
+	if entry.IsProxyEnabled() && len(entry.ProxyEntry.DebugPath) > 0 {
+		entry.HttpMux.HandleFunc(entry.ProxyEntry.DebugPath, entry.ProxyEntry.debugHandler)
+	}
+
+	// 14.2: reload endpoint
+	if len(entry.ReloadPath) > 0 {
+		entry.HttpMux.HandleFunc(entry.ReloadPath, entry.reloadHandler)
+	}
+
 	// 15: pprof
 	if entry.IsPProfEnabled() {
 		entry.HttpMux.HandleFunc(entry.PProfEntry.Path, pprof.Index)
@@ -609,13 +727,41 @@ func (entry *GrpcEntry) Bootstrap(ctx context.Context) {
 		httpHandler = rkgrpccsrf.Interceptor(httpHandler, entry.gwCsrfOptions...)
 	}
 
+	// 20: If gzip enabled, then add interceptor for grpc-gateway
+	if len(entry.gzipOptions) > 0 {
+		httpHandler = rkgrpcgzip.Interceptor(httpHandler, entry.gzipOptions...)
+	}
+
 	entry.HttpServer = &http.Server{
-		Addr:    "0.0.0.0:" + strconv.FormatUint(entry.Port, 10),
+		Addr:    "0.0.0.0:" + strconv.FormatUint(entry.getGwPort(), 10),
 		Handler: h2c.NewHandler(httpHandler, &http2.Server{}),
 	}
 
-	// 20: Start http server
+	// 21: Start http server
 	go func(*GrpcEntry) {
+		// grpc and grpc gateway listen on different ports, cmux is not required.
+		if entry.IsGwPortSeparated() {
+			grpcL, err := entry.listen(entry.Port, entry.TlsConfig)
+			if err != nil {
+				entry.bootstrapLogOnce.Do(func() {
+					entry.EventEntry.FinishWithError(event, err)
+				})
+				rkentry.ShutdownWithError(err)
+			}
+
+			httpL, err := entry.listen(entry.GwPort, entry.getGwTlsConfig())
+			if err != nil {
+				entry.bootstrapLogOnce.Do(func() {
+					entry.EventEntry.FinishWithError(event, err)
+				})
+				rkentry.ShutdownWithError(err)
+			}
+
+			go entry.startGrpcServer(grpcL, logger)
+			go entry.startHttpServer(httpL, logger)
+			return
+		}
+
 		// Create inner listener
 		conn, err := net.Listen("tcp4", ":"+strconv.FormatUint(entry.Port, 10))
 		if err != nil {
@@ -689,33 +835,60 @@ func (entry *GrpcEntry) Bootstrap(ctx context.Context) {
 		}
 
 		if entry.IsSWEnabled() {
-			entry.LoggerEntry.Info(fmt.Sprintf("SwaggerEntry: %s://localhost:%d%s", scheme, entry.Port, entry.SWEntry.Path))
+			entry.LoggerEntry.Info(fmt.Sprintf("SwaggerEntry: %s://localhost:%d%s", scheme, entry.getGwPort(), entry.SWEntry.Path))
 		}
 		if entry.IsDocsEnabled() {
-			entry.LoggerEntry.Info(fmt.Sprintf("DocsEntry: %s://localhost:%d%s", scheme, entry.Port, entry.DocsEntry.Path))
+			entry.LoggerEntry.Info(fmt.Sprintf("DocsEntry: %s://localhost:%d%s", scheme, entry.getGwPort(), entry.DocsEntry.Path))
 		}
 		if entry.IsPromEnabled() {
-			entry.LoggerEntry.Info(fmt.Sprintf("PromEntry: %s://localhost:%d%s", scheme, entry.Port, entry.PromEntry.Path))
+			entry.LoggerEntry.Info(fmt.Sprintf("PromEntry: %s://localhost:%d%s", scheme, entry.getGwPort(), entry.PromEntry.Path))
 		}
 		if entry.IsStaticFileHandlerEnabled() {
-			entry.LoggerEntry.Info(fmt.Sprintf("StaticFileHandlerEntry: %s://localhost:%d%s", scheme, entry.Port, entry.StaticFileEntry.Path))
+			entry.LoggerEntry.Info(fmt.Sprintf("StaticFileHandlerEntry: %s://localhost:%d%s", scheme, entry.getGwPort(), entry.StaticFileEntry.Path))
 		}
 		if entry.IsCommonServiceEnabled() {
 			handlers := []string{
-				fmt.Sprintf("%s://localhost:%d%s", scheme, entry.Port, entry.CommonServiceEntry.ReadyPath),
-				fmt.Sprintf("%s://localhost:%d%s", scheme, entry.Port, entry.CommonServiceEntry.AlivePath),
-				fmt.Sprintf("%s://localhost:%d%s", scheme, entry.Port, entry.CommonServiceEntry.InfoPath),
+				fmt.Sprintf("%s://localhost:%d%s", scheme, entry.getGwPort(), entry.CommonServiceEntry.ReadyPath),
+				fmt.Sprintf("%s://localhost:%d%s", scheme, entry.getGwPort(), entry.CommonServiceEntry.AlivePath),
+				fmt.Sprintf("%s://localhost:%d%s", scheme, entry.getGwPort(), entry.CommonServiceEntry.InfoPath),
 			}
 
 			entry.LoggerEntry.Info(fmt.Sprintf("CommonSreviceEntry: %s", strings.Join(handlers, ", ")))
 		}
 		if entry.IsPProfEnabled() {
-			entry.LoggerEntry.Info(fmt.Sprintf("PProfEntry: %s://localhost:%d%s", scheme, entry.Port, entry.PProfEntry.Path))
+			entry.LoggerEntry.Info(fmt.Sprintf("PProfEntry: %s://localhost:%d%s", scheme, entry.getGwPort(), entry.PProfEntry.Path))
 		}
 		entry.EventEntry.Finish(event)
 	})
 }
 
+// listen on port, listener would be wrapped with tls config if TLS is enabled.
+func (entry *GrpcEntry) listen(port uint64, tlsConfig *tls.Config) (net.Listener, error) {
+	lis, err := net.Listen("tcp4", ":"+strconv.FormatUint(port, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.IsTlsEnabled() {
+		return tls.NewListener(lis, tlsConfig), nil
+	}
+
+	return lis, nil
+}
+
+// getGwTlsConfig returns TLS config of grpc gateway listener, client certificate is not required by it even if mTLS
+// is enabled, so that probes, swagger and docs are reachable.
+func (entry *GrpcEntry) getGwTlsConfig() *tls.Config {
+	if !entry.IsMtlsEnabled() {
+		return entry.TlsConfig
+	}
+
+	res := entry.TlsConfig.Clone()
+	res.ClientAuth = tls.NoClientCert
+	res.ClientCAs = nil
+	return res
+}
+
 func (entry *GrpcEntry) startGrpcServer(lis net.Listener, logger *zap.Logger) {
 	if err := entry.Server.Serve(lis); err != nil && !strings.Contains(err.Error(), "mux: server closed") {
 		logger.Error("Error occurs while serving grpc-server.", zap.Error(err))
@@ -724,16 +897,37 @@ func (entry *GrpcEntry) startGrpcServer(lis net.Listener, logger *zap.Logger) {
 }
 
 func (entry *GrpcEntry) startHttpServer(lis net.Listener, logger *zap.Logger) {
-	if err := entry.HttpServer.Serve(lis); err != nil && !strings.Contains(err.Error(), "http: Server closed") {
+	// listener shared with grpc server by cmux may be closed first while servers are stopped concurrently
+	if err := entry.HttpServer.Serve(lis); err != nil && !strings.Contains(err.Error(), "http: Server closed") &&
+		!strings.Contains(err.Error(), "mux: server closed") {
 		logger.Error("Error occurs while serving gateway-server.", zap.Error(err))
 		rkentry.ShutdownWithError(err)
 	}
 }
 
 // Interrupt GrpcEntry.
+//
+// Shutdown steps:
+// 1: Mark entry as not ready, readiness API and grpc health service would report not ready
+// 2: Wait for drain period, so that load balancer would stop routing traffic to this server
+// 3: Stop servers gracefully, servers would be stopped forcibly if in-flight RPCs not finished before timeout
 func (entry *GrpcEntry) Interrupt(ctx context.Context) {
 	event, logger := entry.logBasicInfo("Interrupt", ctx)
 
+	// 1: Mark entry as not ready
+	atomic.StoreInt32(&entry.draining, 1)
+
+	// Mark all services as NOT_SERVING, so that health checker would stop routing traffic to this server
+	if entry.IsGrpcHealthEnabled() {
+		entry.HealthServer.Shutdown()
+	}
+
+	// 2: Wait for drain period
+	if entry.DrainPeriod > 0 {
+		logger.Info(fmt.Sprintf("Draining grpcEntry for %s", entry.DrainPeriod))
+		time.Sleep(entry.DrainPeriod)
+	}
+
 	// Interrupt CommonServiceEntry, SwEntry, TvEntry, PromEntry
 	if entry.IsCommonServiceEnabled() {
 		entry.CommonServiceEntry.Interrupt(ctx)
@@ -759,15 +953,63 @@ func (entry *GrpcEntry) Interrupt(ctx context.Context) {
 		entry.PProfEntry.Interrupt(ctx)
 	}
 
+	// 3: Stop servers with timeout
+	event.SetCounter("inFlightRpc", entry.GetInFlightCount())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), entry.ShutdownTimeout)
+	defer cancel()
+
+	// http and grpc servers are drained concurrently under the same deadline
+	var httpErr error
+	var interrupted int64
+	wg := sync.WaitGroup{}
+
 	if entry.HttpServer != nil {
-		if err := entry.HttpServer.Shutdown(context.Background()); err != nil {
-			event.AddErr(err)
-			logger.Warn("Error occurs while stopping http server")
-		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if httpErr = entry.HttpServer.Shutdown(shutdownCtx); httpErr != nil {
+				entry.HttpServer.Close()
+			}
+		}()
 	}
 
 	if entry.Server != nil {
-		entry.Server.GracefulStop()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopped := make(chan struct{})
+			go func() {
+				entry.Server.GracefulStop()
+				close(stopped)
+			}()
+
+			select {
+			case <-stopped:
+			case <-shutdownCtx.Done():
+				interrupted = entry.GetInFlightCount()
+				logger.Warn(fmt.Sprintf("Timed out waiting for in-flight RPCs, force stopping grpc server with %d RPCs interrupted", interrupted))
+				entry.Server.Stop()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if httpErr != nil {
+		event.AddErr(httpErr)
+		logger.Warn("Error occurs while stopping http server", zap.Error(httpErr))
+	}
+	event.SetCounter("interruptedRpc", interrupted)
+
+	// 4: Close upstream connections after proxied RPCs finished
+	if entry.IsProxyEnabled() {
+		entry.ProxyEntry.Interrupt(ctx)
+	}
+
+	// 5: Stop background jobs of reloadable middlewares
+	for _, m := range entry.middlewares {
+		m.get().stopJobs(ctx)
 	}
 
 	entry.EventEntry.Finish(event)
@@ -775,6 +1017,35 @@ func (entry *GrpcEntry) Interrupt(ctx context.Context) {
 	rkentry.GlobalAppCtx.RemoveEntry(entry)
 }
 
+// ready handler, not ready would be returned while entry is draining.
+func (entry *GrpcEntry) ready(writer http.ResponseWriter, request *http.Request) {
+	if entry.IsDraining() {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		bytes, _ := json.Marshal(rkmid.GetErrorBuilder().New(http.StatusServiceUnavailable, "Server is draining"))
+		writer.Write(bytes)
+		return
+	}
+
+	entry.CommonServiceEntry.Ready(writer, request)
+}
+
+// inFlightUnaryInterceptor track number of in-flight unary RPCs
+func (entry *GrpcEntry) inFlightUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	atomic.AddInt64(&entry.inFlight, 1)
+	defer atomic.AddInt64(&entry.inFlight, -1)
+
+	return handler(ctx, req)
+}
+
+// inFlightStreamInterceptor track number of in-flight stream RPCs
+func (entry *GrpcEntry) inFlightStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	atomic.AddInt64(&entry.inFlight, 1)
+	defer atomic.AddInt64(&entry.inFlight, -1)
+
+	return handler(srv, stream)
+}
+
 // ************* public function *************
 
 // AddServerOptions Add grpc server options.
@@ -807,6 +1078,11 @@ func (entry *GrpcEntry) AddGwSecureOptions(opts ...rkmidsec.Option) {
 	entry.gwSecureOptions = append(entry.gwSecureOptions, opts...)
 }
 
+// AddGzipOptions Enable compression at both grpc and gateway side with options.
+func (entry *GrpcEntry) AddGzipOptions(opts ...rkgrpcgzip.Option) {
+	entry.gzipOptions = append(entry.gzipOptions, opts...)
+}
+
 // AddGwMuxOptions Add mux options at gateway side.
 func (entry *GrpcEntry) AddGwMuxOptions(opts ...gwruntime.ServeMuxOption) {
 	entry.GwMuxOptions = append(entry.GwMuxOptions, opts...)
@@ -834,6 +1110,7 @@ func (entry *GrpcEntry) MarshalJSON() ([]byte, error) {
 		"type":                   entry.entryType,
 		"description":            entry.entryDescription,
 		"port":                   entry.Port,
+		"gwPort":                 entry.getGwPort(),
 		"swEntry":                entry.SWEntry,
 		"docsEntry":              entry.DocsEntry,
 		"commonServiceEntry":     entry.CommonServiceEntry,
@@ -841,6 +1118,7 @@ func (entry *GrpcEntry) MarshalJSON() ([]byte, error) {
 		"staticFileHandlerEntry": entry.StaticFileEntry,
 		"pprofEntry":             entry.PProfEntry,
 		"reflection":             entry.EnableReflection,
+		"mtls":                   entry.IsMtlsEnabled(),
 	}
 
 	if entry.CertEntry != nil {
@@ -860,11 +1138,67 @@ func (entry *GrpcEntry) IsTlsEnabled() bool {
 	return entry.CertEntry != nil && entry.CertEntry.Certificate != nil
 }
 
+// IsGwPortSeparated Is grpc gateway listening on a different port with grpc?
+func (entry *GrpcEntry) IsGwPortSeparated() bool {
+	return entry.GwPort > 0 && entry.GwPort != entry.Port
+}
+
+// getGwPort returns port of grpc gateway, grpc port would be returned if gwPort was not provided.
+func (entry *GrpcEntry) getGwPort() uint64 {
+	if entry.GwPort > 0 {
+		return entry.GwPort
+	}
+
+	return entry.Port
+}
+
+// getGwServerName returns server name verified by grpc gateway, defaults to first DNS name of server certificate
+func (entry *GrpcEntry) getGwServerName() string {
+	if len(entry.GwServerName) > 0 {
+		return entry.GwServerName
+	}
+
+	if cert := entry.CertEntry.Certificate; len(cert.Certificate) > 0 {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && len(leaf.DNSNames) > 0 {
+			return leaf.DNSNames[0]
+		}
+	}
+
+	return "localhost"
+}
+
+// IsMtlsEnabled Is mTLS enabled?
+func (entry *GrpcEntry) IsMtlsEnabled() bool {
+	return entry.IsTlsEnabled() && entry.EnableMtls
+}
+
 // IsCommonServiceEnabled Is common service enabled?
 func (entry *GrpcEntry) IsCommonServiceEnabled() bool {
 	return entry.CommonServiceEntry != nil
 }
 
+// IsDraining Is entry draining? Entry would be marked as draining at the beginning of Interrupt.
+func (entry *GrpcEntry) IsDraining() bool {
+	return atomic.LoadInt32(&entry.draining) == 1
+}
+
+// GetInFlightCount Get number of in-flight unary and stream RPCs.
+func (entry *GrpcEntry) GetInFlightCount() int64 {
+	return atomic.LoadInt64(&entry.inFlight)
+}
+
+// IsGrpcHealthEnabled Is grpc health service enabled?
+func (entry *GrpcEntry) IsGrpcHealthEnabled() bool {
+	return entry.HealthServer != nil
+}
+
+// SetServingStatus Set serving status of service in grpc health service, empty service name stands for whole server.
+func (entry *GrpcEntry) SetServingStatus(service string, servingStatus healthpb.HealthCheckResponse_ServingStatus) {
+	if entry.IsGrpcHealthEnabled() {
+		entry.HealthServer.SetServingStatus(service, servingStatus)
+	}
+}
+
 // IsProxyEnabled Is proxy enabled?
 func (entry *GrpcEntry) IsProxyEnabled() bool {
 	return entry.ProxyEntry != nil
@@ -917,7 +1251,7 @@ func (entry *GrpcEntry) logBasicInfo(operation string, ctx context.Context) (rkq
 	// add general info
 	event.AddPayloads(
 		zap.Uint64("grpcPort", entry.Port),
-		zap.Uint64("gwPort", entry.Port))
+		zap.Uint64("gwPort", entry.getGwPort()))
 
 	// add SWEntry info
 	if entry.IsSWEnabled() {
@@ -929,7 +1263,8 @@ func (entry *GrpcEntry) logBasicInfo(operation string, ctx context.Context) (rkq
 	// add CommonServiceEntry info
 	if entry.IsCommonServiceEnabled() {
 		event.AddPayloads(
-			zap.Bool("commonServiceEnabled", true))
+			zap.Bool("commonServiceEnabled", true),
+			zap.Bool("grpcHealthEnabled", entry.IsGrpcHealthEnabled()))
 	}
 
 	// add DocsEntry info
@@ -950,7 +1285,7 @@ func (entry *GrpcEntry) logBasicInfo(operation string, ctx context.Context) (rkq
 	if entry.IsPromEnabled() {
 		event.AddPayloads(
 			zap.Bool("promEnabled", true),
-			zap.Uint64("promPort", entry.Port),
+			zap.Uint64("promPort", entry.getGwPort()),
 			zap.String("promPath", entry.PromEntry.Path))
 	}
 
@@ -967,6 +1302,12 @@ func (entry *GrpcEntry) logBasicInfo(operation string, ctx context.Context) (rkq
 			zap.Bool("tlsEnabled", true))
 	}
 
+	// add mtls info
+	if entry.IsMtlsEnabled() {
+		event.AddPayloads(
+			zap.Bool("mtlsEnabled", true))
+	}
+
 	// add proxy info
 	if entry.IsProxyEnabled() {
 		event.AddPayloads(
@@ -1035,6 +1376,45 @@ func WithPort(port uint64) GrpcEntryOption {
 	}
 }
 
+// WithGwPort Provide port of grpc gateway, grpc gateway would share the same port with grpc if not provided.
+func WithGwPort(port uint64) GrpcEntryOption {
+	return func(entry *GrpcEntry) {
+		entry.GwPort = port
+	}
+}
+
+// WithDrainPeriod Provide period to wait after entry marked as not ready while interrupting.
+func WithDrainPeriod(period time.Duration) GrpcEntryOption {
+	return func(entry *GrpcEntry) {
+		if period > 0 {
+			entry.DrainPeriod = period
+		}
+	}
+}
+
+// WithShutdownTimeout Provide timeout of graceful shutdown, servers would be stopped forcibly after timeout.
+func WithShutdownTimeout(timeout time.Duration) GrpcEntryOption {
+	return func(entry *GrpcEntry) {
+		if timeout > 0 {
+			entry.ShutdownTimeout = timeout
+		}
+	}
+}
+
+// WithReloadPath Provide path of endpoint which reloads proxy rules and middlewares, endpoint would be disabled if empty.
+func WithReloadPath(path string) GrpcEntryOption {
+	return func(entry *GrpcEntry) {
+		entry.ReloadPath = path
+	}
+}
+
+// WithReloadConfigFile Provide boot config file read by reload endpoint.
+func WithReloadConfigFile(filePath string) GrpcEntryOption {
+	return func(entry *GrpcEntry) {
+		entry.ReloadConfigFile = filePath
+	}
+}
+
 // WithServerOptions Provide grpc.ServerOption.
 func WithServerOptions(opts ...grpc.ServerOption) GrpcEntryOption {
 	return func(entry *GrpcEntry) {
@@ -1070,6 +1450,28 @@ func WithCertEntry(certEntry *rkentry.CertEntry) GrpcEntryOption {
 	}
 }
 
+// WithEnableMtls Provide EnableMtls, client certificate would be required and verified with CA of cert entry.
+func WithEnableMtls(enabled bool) GrpcEntryOption {
+	return func(entry *GrpcEntry) {
+		entry.EnableMtls = enabled
+	}
+}
+
+// WithGwCertEntry Provide rkentry.CertEntry used by grpc gateway as client certificate while mTLS is enabled.
+func WithGwCertEntry(certEntry *rkentry.CertEntry) GrpcEntryOption {
+	return func(entry *GrpcEntry) {
+		entry.GwCertEntry = certEntry
+	}
+}
+
+// WithGwServerName Provide server name verified by grpc gateway while mTLS is enabled,
+// first DNS name of server certificate would be used if missing.
+func WithGwServerName(serverName string) GrpcEntryOption {
+	return func(entry *GrpcEntry) {
+		entry.GwServerName = serverName
+	}
+}
+
 // WithCommonServiceEntry Provide rkentry.CommonServiceEntry.
 func WithCommonServiceEntry(commonService *rkentry.CommonServiceEntry) GrpcEntryOption {
 	return func(entry *GrpcEntry) {
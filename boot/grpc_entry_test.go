@@ -21,6 +21,7 @@ import (
 	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"strconv"
@@ -34,9 +35,14 @@ import (
 	rkmidsec "github.com/rookie-ninja/rk-entry/v2/middleware/secure"
 	"github.com/stretchr/testify/assert"
 	testdata "github.com/tegarajipangestu/rk-grpc/v2/example/middleware/proto/testdata"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	rkgrpcgzip "github.com/tegarajipangestu/rk-grpc/v2/middleware/gzip"
 	rkgrpcmeta "github.com/tegarajipangestu/rk-grpc/v2/middleware/meta"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func TestRegisterGrpcEntriesWithConfig_HappyCase(t *testing.T) {
@@ -86,6 +92,37 @@ grpc:
       - type: IpBased
         Ips: [""]
         dest: [""]
+      - type: composite
+        name: canary
+        priority: 10
+        match:
+          and:
+            - paths: ["/ut.*"]
+            - not:
+                headerPairs: ["env:prod"]
+        dest: ["localhost:8082"]
+        metadata:
+          request:
+            remove: ["authorization"]
+            copyFromPeer: ["x-real-ip:remoteIp"]
+          response:
+            rename: ["x-internal:x-public"]
+      - type: default
+        dest: ["localhost:8083"]
+        upstream:
+          loadBalancer: weighted
+          weights: [95, 5]
+          shadow:
+            dest: "localhost:8084"
+            timeoutMs: 100
+          retry:
+            maxAttempts: 3
+            retryableCodes: ["UNAVAILABLE", "RESOURCE_EXHAUSTED"]
+          hedge:
+            enabled: true
+            delayMs: 10
+    debug:
+      enabled: true
   prom:
     enabled: true                                  # Optional, default: false
     path: "metrics"                                # Optional, default: ""
@@ -130,6 +167,9 @@ grpc:
       enabled: true
     csrf:
       enabled: true
+    gzip:
+      enabled: true
+      level: bestSpeed
     jwt:
       enabled: true
 `
@@ -154,6 +194,21 @@ grpc:
 
 	assert.True(t, len(entry.UnaryInterceptors) > 0)
 	assert.True(t, len(entry.StreamInterceptors) > 0)
+	assert.NotEmpty(t, entry.gzipOptions)
+	assert.Equal(t, defaultProxyDebugPath, entry.ProxyEntry.DebugPath)
+	assert.Len(t, entry.ProxyEntry.getRule().RoutePattern, 1)
+	assert.Equal(t, 10, entry.ProxyEntry.getRule().RoutePattern[0].Priority)
+	assert.Equal(t, []string{"localhost:8083"}, entry.ProxyEntry.getRule().DefaultPattern.Dest)
+	assert.Equal(t, LbWeighted, entry.ProxyEntry.getRule().DefaultPattern.Upstream.LoadBalancer)
+	assert.Equal(t, []int{95, 5}, entry.ProxyEntry.getRule().DefaultPattern.Upstream.Weights)
+	assert.Equal(t, "localhost:8084", entry.ProxyEntry.getRule().DefaultPattern.pool.shadow.addr)
+	assert.Equal(t, 3, entry.ProxyEntry.getRule().DefaultPattern.Upstream.Retry.MaxAttempts)
+	assert.Equal(t, []codes.Code{codes.Unavailable, codes.ResourceExhausted}, entry.ProxyEntry.getRule().DefaultPattern.Upstream.Retry.RetryableCodes)
+	assert.Equal(t, 10*time.Millisecond, entry.ProxyEntry.getRule().DefaultPattern.Upstream.Hedge.Delay)
+	assert.Equal(t, []string{"authorization"}, entry.ProxyEntry.getRule().RoutePattern[0].Metadata.Request.Remove)
+	assert.Equal(t, map[string]string{"x-real-ip": PeerRemoteIp}, entry.ProxyEntry.getRule().RoutePattern[0].Metadata.Request.CopyFromPeer)
+	assert.Equal(t, map[string]string{"x-internal": "x-public"}, entry.ProxyEntry.getRule().RoutePattern[0].Metadata.Response.Rename)
+	assert.Nil(t, entry.ProxyEntry.getRule().DefaultPattern.Metadata)
 
 	// Bootstrap
 	entry.Bootstrap(context.TODO())
@@ -239,6 +294,7 @@ func TestRegisterGrpcEntry_PublicFunc(t *testing.T) {
 	corsOpt := rkmidcors.WithEntryNameAndType("", "")
 	csrfOpt := rkmidcsrf.WithEntryNameAndType("", "")
 	secOpt := rkmidsec.WithEntryNameAndType("", "")
+	gzipOpt := rkgrpcgzip.WithEntryNameAndType("", "")
 	regFuncGrpc := func(server *grpc.Server) {}
 	regFuncGw := func(context.Context, *gwruntime.ServeMux, string, []grpc.DialOption) error { return nil }
 	gwDialOpt := grpc.WithBlock()
@@ -251,6 +307,7 @@ func TestRegisterGrpcEntry_PublicFunc(t *testing.T) {
 	entry.AddGwCorsOptions(corsOpt)
 	entry.AddGwCsrfOptions(csrfOpt)
 	entry.AddGwSecureOptions(secOpt)
+	entry.AddGzipOptions(gzipOpt)
 	entry.AddRegFuncGrpc(regFuncGrpc)
 	entry.AddRegFuncGw(regFuncGw)
 	entry.AddGwDialOptions(gwDialOpt)
@@ -261,6 +318,7 @@ func TestRegisterGrpcEntry_PublicFunc(t *testing.T) {
 	assert.NotEmpty(t, entry.gwCorsOptions)
 	assert.NotEmpty(t, entry.gwCsrfOptions)
 	assert.NotEmpty(t, entry.gwSecureOptions)
+	assert.NotEmpty(t, entry.gzipOptions)
 	assert.NotEmpty(t, entry.GrpcRegF)
 	assert.NotEmpty(t, entry.GwRegF)
 	assert.NotEmpty(t, entry.GwDialOptions)
@@ -346,10 +404,360 @@ func TestRegisterGrpcEntry_EntryFunc(t *testing.T) {
 	entry.AddGwCorsOptions(corsOpt)
 	entry.AddGwSecureOptions(secOpt)
 	entry.AddGwCsrfOptions(csrfOpt)
+	entry.AddGzipOptions(rkgrpcgzip.WithLevel(rkgrpcgzip.BestSpeed))
+
+	entry.Bootstrap(context.TODO())
+	time.Sleep(1 * time.Second)
+	entry.Interrupt(context.TODO())
+}
+
+func TestGrpcEntry_WithGwPort(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// case 1: same port with grpc
+	entry := RegisterGrpcEntry(WithPort(8080), WithGwPort(8080))
+	assert.False(t, entry.IsGwPortSeparated())
+	assert.Equal(t, uint64(8080), entry.getGwPort())
+
+	// case 2: without gwPort
+	entry = RegisterGrpcEntry(WithPort(8080))
+	assert.False(t, entry.IsGwPortSeparated())
+	assert.Equal(t, uint64(8080), entry.getGwPort())
+
+	// case 3: separate ports
+	entry = RegisterGrpcEntry(
+		WithPort(8080),
+		WithGwPort(8081),
+		WithCommonServiceEntry(rkentry.RegisterCommonServiceEntry(&rkentry.BootCommonService{
+			Enabled: true,
+		})))
+	assert.True(t, entry.IsGwPortSeparated())
+	entry.Bootstrap(context.TODO())
+	time.Sleep(1 * time.Second)
+
+	validateServerIsUp(t, 8080)
+	validateServerIsUp(t, 8081)
+
+	// gateway should serve http on its own port
+	resp, err := http.Get("http://localhost:8081" + entry.CommonServiceEntry.AlivePath)
+	assert.Nil(t, err)
+	if resp != nil {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	bytes, err := entry.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Contains(t, string(bytes), `"gwPort":8081`)
+
+	entry.Interrupt(context.TODO())
+
+	// case 4: separate ports with tls
+	certificate, _ := tls.X509KeyPair(generateCerts())
+	certEntry := rkentry.RegisterCertEntry(&rkentry.BootCert{
+		Cert: []*rkentry.BootCertE{
+			{
+				Name: "ut-cert-gw",
+			},
+		},
+	})[0]
+	certEntry.Certificate = &certificate
+
+	entry = RegisterGrpcEntry(
+		WithPort(8080),
+		WithGwPort(8081),
+		WithCertEntry(certEntry))
+	entry.Bootstrap(context.TODO())
+	time.Sleep(1 * time.Second)
+
+	conn, err := tls.Dial("tcp", "localhost:8081", &tls.Config{InsecureSkipVerify: true})
+	assert.Nil(t, err)
+	if conn != nil {
+		conn.Close()
+	}
+
+	entry.Interrupt(context.TODO())
+}
+
+func TestGrpcEntry_WithMtls(t *testing.T) {
+	caCert, caKey := generateCA()
+	serverCert := generateCertSignedByCA(caCert, caKey, "ut-server")
+	clientCert := generateCertSignedByCA(caCert, caKey, "ut-client")
+
+	certEntry := rkentry.RegisterCertEntry(&rkentry.BootCert{
+		Cert: []*rkentry.BootCertE{
+			{
+				Name: "ut-cert-mtls",
+			},
+		},
+	})[0]
+	certEntry.Certificate = &serverCert
+
+	// case 1: CA is missing
+	assert.Panics(t, func() {
+		RegisterGrpcEntry(WithCertEntry(certEntry), WithEnableMtls(true))
+	})
+
+	certEntry.RootCA = caCert
+	gwCertEntry := rkentry.RegisterCertEntry(&rkentry.BootCert{
+		Cert: []*rkentry.BootCertE{
+			{
+				Name: "ut-cert-mtls-gw",
+			},
+		},
+	})[0]
+
+	// case 2: certificate of gateway is missing
+	assert.Panics(t, func() {
+		RegisterGrpcEntry(WithCertEntry(certEntry), WithEnableMtls(true))
+	})
+	assert.Panics(t, func() {
+		RegisterGrpcEntry(WithCertEntry(certEntry), WithEnableMtls(true), WithGwCertEntry(gwCertEntry))
+	})
+
+	// case 3: grpc gateway shares port with grpc
+	gwCertEntry.Certificate = &clientCert
+	assert.Panics(t, func() {
+		RegisterGrpcEntry(WithPort(8080), WithCertEntry(certEntry), WithEnableMtls(true), WithGwCertEntry(gwCertEntry))
+	})
+
+	// case 4: happy case
+	entry := RegisterGrpcEntry(
+		WithPort(8080),
+		WithGwPort(8081),
+		WithCertEntry(certEntry),
+		WithEnableMtls(true),
+		WithGwCertEntry(gwCertEntry),
+		WithGrpcRegF(func(server *grpc.Server) {
+			testdata.RegisterGreeterServer(server, &PeerGreeterServer{})
+		}))
+	assert.True(t, entry.IsMtlsEnabled())
+	assert.Equal(t, tls.RequireAndVerifyClientCert, entry.TlsConfig.ClientAuth)
+	assert.False(t, entry.TlsConfigInsecure.InsecureSkipVerify)
+	assert.NotNil(t, entry.TlsConfigInsecure.RootCAs)
+	assert.Equal(t, "localhost", entry.TlsConfigInsecure.ServerName)
+	assert.Equal(t, clientCert.Certificate, entry.TlsConfigInsecure.Certificates[0].Certificate)
+	entry.Bootstrap(context.TODO())
+	time.Sleep(1 * time.Second)
+
+	sayHello := func(tlsConfig *tls.Config) (*testdata.HelloResponse, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		conn, err := grpc.DialContext(ctx, "localhost:8080",
+			grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		return testdata.NewGreeterClient(conn).SayHello(ctx, &testdata.HelloRequest{Name: "ut"})
+	}
+
+	// case 4.1: client presents a valid certificate, peer identity should be visible to handler
+	resp, err := sayHello(&tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{clientCert},
+	})
+	assert.Nil(t, err)
+	if resp != nil {
+		assert.Equal(t, "CN=ut-client", resp.GetMessage())
+	}
+
+	// case 4.2: client without certificate should be rejected
+	_, err = sayHello(&tls.Config{InsecureSkipVerify: true})
+	assert.NotNil(t, err)
+
+	// case 4.3: loopback dial of grpc gateway should verify server and present certificate of gateway
+	resp, err = sayHello(entry.TlsConfigInsecure)
+	assert.Nil(t, err)
+	if resp != nil {
+		assert.Equal(t, "CN=ut-client", resp.GetMessage())
+	}
+
+	// case 4.4: grpc gateway does not require client certificate
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	httpResp, err := httpClient.Get("https://localhost:8081/rk/v1/ready")
+	assert.Nil(t, err)
+	if httpResp != nil {
+		httpResp.Body.Close()
+	}
+
+	entry.Interrupt(context.TODO())
 
+	// case 5: server name provided
+	entry = RegisterGrpcEntry(
+		WithGwPort(8081),
+		WithCertEntry(certEntry),
+		WithEnableMtls(true),
+		WithGwCertEntry(gwCertEntry),
+		WithGwServerName("ut-server-name"))
+	assert.Equal(t, "ut-server-name", entry.TlsConfigInsecure.ServerName)
+}
+
+func TestGrpcEntry_GrpcHealth(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// case 1: common service disabled
+	entry := RegisterGrpcEntry()
+	assert.False(t, entry.IsGrpcHealthEnabled())
+	entry.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	// case 2: common service enabled
+	entry = RegisterGrpcEntry(
+		WithPort(8080),
+		WithCommonServiceEntry(rkentry.RegisterCommonServiceEntry(&rkentry.BootCommonService{
+			Enabled: true,
+		})),
+		WithGrpcRegF(func(server *grpc.Server) {
+			testdata.RegisterGreeterServer(server, &GreeterServer{})
+			testdata.RegisterChatServer(server, &testdata.UnimplementedChatServer{})
+		}))
+	assert.True(t, entry.IsGrpcHealthEnabled())
+
+	// status provided before bootstrap should be kept
+	entry.SetServingStatus("Chat", healthpb.HealthCheckResponse_NOT_SERVING)
 	entry.Bootstrap(context.TODO())
 	time.Sleep(1 * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "localhost:8080", grpc.WithInsecure(), grpc.WithBlock())
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return healthpb.HealthCheckResponse_UNKNOWN
+		}
+		return resp.GetStatus()
+	}
+
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check("Greeter"))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check("Chat"))
+
+	// case 3: change status of service
+	entry.SetServingStatus("Greeter", healthpb.HealthCheckResponse_NOT_SERVING)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check("Greeter"))
+
+	// case 4: all services should be NOT_SERVING after interrupt
 	entry.Interrupt(context.TODO())
+	resp, err := entry.HealthServer.Check(context.TODO(), &healthpb.HealthCheckRequest{Service: ""})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.GetStatus())
+}
+
+func TestGrpcEntry_GracefulShutdown(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// case 1: default values
+	entry := RegisterGrpcEntry(WithDrainPeriod(0), WithShutdownTimeout(0))
+	assert.Zero(t, entry.DrainPeriod)
+	assert.Equal(t, defaultShutdownTimeout, entry.ShutdownTimeout)
+
+	// case 2: long-lived stream should be interrupted after timeout
+	entry = RegisterGrpcEntry(
+		WithPort(8080),
+		WithDrainPeriod(500*time.Millisecond),
+		WithShutdownTimeout(500*time.Millisecond),
+		WithCommonServiceEntry(rkentry.RegisterCommonServiceEntry(&rkentry.BootCommonService{
+			Enabled: true,
+		})),
+		WithGrpcRegF(func(server *grpc.Server) {
+			testdata.RegisterChatServer(server, &BlockingChatServer{})
+		}))
+	entry.Bootstrap(context.TODO())
+	time.Sleep(1 * time.Second)
+
+	conn, err := grpc.Dial("localhost:8080", grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer conn.Close()
+	stream, err := testdata.NewChatClient(conn).Say(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Send(&testdata.ServerMessage{}))
+
+	for i := 0; i < 100 && entry.GetInFlightCount() < 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int64(1), entry.GetInFlightCount())
+
+	// ready API should be available before interrupt
+	w := httptest.NewRecorder()
+	entry.ready(w, httptest.NewRequest(http.MethodGet, entry.CommonServiceEntry.ReadyPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		entry.Interrupt(context.TODO())
+		close(done)
+	}()
+
+	// entry should be marked as not ready while draining
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, entry.IsDraining())
+	w = httptest.NewRecorder()
+	entry.ready(w, httptest.NewRequest(http.MethodGet, entry.CommonServiceEntry.ReadyPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	select {
+	case <-done:
+		assert.True(t, time.Since(start) >= time.Second)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "interrupt was blocked by in-flight stream")
+	}
+
+	_, err = stream.Recv()
+	assert.NotNil(t, err)
+}
+
+func TestGrpcEntry_GracefulShutdown_Concurrent(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// slow http request should not delay shutdown of grpc server
+	entry := RegisterGrpcEntry(
+		WithPort(8080),
+		WithGwPort(8081),
+		WithShutdownTimeout(time.Second),
+		WithGrpcRegF(func(server *grpc.Server) {
+			testdata.RegisterGreeterServer(server, &GreeterServer{})
+		}))
+	released := make(chan struct{})
+	entry.HttpMux.HandleFunc("/ut-slow", func(writer http.ResponseWriter, request *http.Request) {
+		<-released
+	})
+	entry.Bootstrap(context.TODO())
+	time.Sleep(1 * time.Second)
+
+	go http.Get("http://localhost:8081/ut-slow")
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		entry.Interrupt(context.TODO())
+		close(done)
+	}()
+
+	// grpc server should stop accepting while http server is still draining
+	stopped := false
+	for i := 0; i < 50 && !stopped; i++ {
+		time.Sleep(10 * time.Millisecond)
+		conn, err := net.DialTimeout("tcp", "localhost:8080", 100*time.Millisecond)
+		if err != nil {
+			stopped = true
+		} else {
+			conn.Close()
+		}
+	}
+	assert.True(t, stopped)
+
+	close(released)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "interrupt was blocked by http server")
+	}
 }
 
 func TestGrpcEntry_startGrpcServer_Panic(t *testing.T) {
@@ -393,6 +801,29 @@ func (server *GreeterServer) SayHello(ctx context.Context, request *testdata.Hel
 	}, nil
 }
 
+// PeerGreeterServer returns subject of peer certificate.
+type PeerGreeterServer struct {
+	testdata.UnimplementedGreeterServer
+}
+
+// SayHello Handle SayHello method.
+func (server *PeerGreeterServer) SayHello(ctx context.Context, request *testdata.HelloRequest) (*testdata.HelloResponse, error) {
+	return &testdata.HelloResponse{
+		Message: rkgrpcctx.GetPeerSubject(ctx),
+	}, nil
+}
+
+// BlockingChatServer blocks stream until client or server closed.
+type BlockingChatServer struct {
+	testdata.UnimplementedChatServer
+}
+
+// Say Handle Say method.
+func (server *BlockingChatServer) Say(stream testdata.Chat_SayServer) error {
+	<-stream.Context().Done()
+	return nil
+}
+
 type ErrListener struct{}
 
 func (e ErrListener) Accept() (net.Conn, error) {
@@ -435,6 +866,44 @@ func generateCerts() ([]byte, []byte) {
 	return pem.EncodeToMemory(c), pem.EncodeToMemory(k)
 }
 
+func generateCA() (*x509.Certificate, *rsa.PrivateKey) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "ut-ca"},
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(2 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	raw, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	ca, _ := x509.ParseCertificate(raw)
+
+	return ca, key
+}
+
+func generateCertSignedByCA(ca *x509.Certificate, caKey *rsa.PrivateKey, cn string) tls.Certificate {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := &x509.Certificate{
+		Subject:      pkix.Name{CommonName: cn},
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(2 * time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+
+	raw, _ := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+
+	return tls.Certificate{
+		Certificate: [][]byte{raw},
+		PrivateKey:  key,
+	}
+}
+
 func validateServerIsUp(t *testing.T, port uint64) {
 	conn, err := net.DialTimeout("tcp", net.JoinHostPort("0.0.0.0", strconv.FormatUint(port, 10)), time.Second)
 	assert.Nil(t, err)
@@ -0,0 +1,435 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkmidauth "github.com/rookie-ninja/rk-entry/v2/middleware/auth"
+	rkgrpcauth "github.com/tegarajipangestu/rk-grpc/v2/middleware/auth"
+	rkgrpcauthz "github.com/tegarajipangestu/rk-grpc/v2/middleware/authz"
+	rkgrpcjwt "github.com/tegarajipangestu/rk-grpc/v2/middleware/jwt"
+	rkgrpclimit "github.com/tegarajipangestu/rk-grpc/v2/middleware/ratelimit"
+	rkgrpctimeout "github.com/tegarajipangestu/rk-grpc/v2/middleware/timeout"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+const (
+	// MiddlewareAuth name of auth middleware which could be reloaded
+	MiddlewareAuth = "auth"
+	// MiddlewareAuthz name of authorization middleware which could be reloaded
+	MiddlewareAuthz = "authz"
+	// MiddlewareJwt name of jwt middleware which could be reloaded
+	MiddlewareJwt = "jwt"
+	// MiddlewareTimeout name of timeout middleware which could be reloaded
+	MiddlewareTimeout = "timeout"
+	// MiddlewareRateLimit name of rate limit middleware which could be reloaded
+	MiddlewareRateLimit = "rateLimit"
+
+	defaultReloadPath = "/rk/v1/reload"
+)
+
+// BootConfigReload Boot config of reloading.
+//
+// 1: Enabled: Enable endpoint which reloads proxy rules and middlewares from config file.
+// 2: Path: Path of endpoint, only POST is allowed, default: /rk/v1/reload
+// 3: ConfigFile: Boot config file read by endpoint.
+type BootConfigReload struct {
+	Enabled    bool   `yaml:"enabled" json:"enabled"`
+	Path       string `yaml:"path" json:"path"`
+	ConfigFile string `yaml:"configFile" json:"configFile"`
+}
+
+// middlewareInterceptors are interceptors of middleware, nil if middleware disabled.
+//
+// Interceptors of middleware disabled globally but enabled by overrides of methods are marked as overrideOnly.
+// Building interceptors has no side effects, entries like signers are registered by commit once interceptors are in use.
+// Background jobs like refreshing JWKS are started by start and stopped by stop.
+type middlewareInterceptors struct {
+	unary        grpc.UnaryServerInterceptor
+	stream       grpc.StreamServerInterceptor
+	overrideOnly bool
+	commit       func()
+	start        func(context.Context)
+	stop         func(context.Context)
+}
+
+// commitEntries register entries of middleware into rkentry.GlobalAppCtx
+func (m *middlewareInterceptors) commitEntries() {
+	if m.commit != nil {
+		m.commit()
+	}
+}
+
+// startJobs start background jobs of middleware
+func (m *middlewareInterceptors) startJobs(ctx context.Context) {
+	if m.start != nil {
+		m.start(ctx)
+	}
+}
+
+// stopJobs stop background jobs of middleware, middleware never started could be stopped
+func (m *middlewareInterceptors) stopJobs(ctx context.Context) {
+	if m.stop != nil {
+		m.stop(ctx)
+	}
+}
+
+// reloadableMiddleware delegates calls to interceptors which could be replaced at runtime.
+//
+// Calls in flight would continue with interceptors they entered.
+type reloadableMiddleware struct {
+	interceptors atomic.Value
+}
+
+// newReloadableMiddleware create reloadableMiddleware with interceptors
+func newReloadableMiddleware(interceptors *middlewareInterceptors) *reloadableMiddleware {
+	m := &reloadableMiddleware{}
+	m.set(interceptors)
+
+	return m
+}
+
+// set replace interceptors of middleware
+func (m *reloadableMiddleware) set(interceptors *middlewareInterceptors) {
+	if interceptors == nil {
+		interceptors = &middlewareInterceptors{}
+	}
+	m.interceptors.Store(interceptors)
+}
+
+// get returns current interceptors of middleware
+func (m *reloadableMiddleware) get() *middlewareInterceptors {
+	if v, ok := m.interceptors.Load().(*middlewareInterceptors); ok {
+		return v
+	}
+
+	return &middlewareInterceptors{}
+}
+
+// unaryInterceptor call current unary interceptor, handler would be called directly if middleware disabled
+func (m *reloadableMiddleware) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if v := m.get(); v.unary != nil && !v.overrideOnly {
+		return v.unary(ctx, req, info, handler)
+	}
+
+	return handler(ctx, req)
+}
+
+// streamInterceptor call current stream interceptor, handler would be called directly if middleware disabled
+func (m *reloadableMiddleware) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if v := m.get(); v.stream != nil && !v.overrideOnly {
+		return v.stream(srv, stream, info, handler)
+	}
+
+	return handler(srv, stream)
+}
+
+// toAuthInterceptors build interceptors of auth middleware
+func toAuthInterceptors(config *rkmidauth.BootConfig, entryName string, force bool) *middlewareInterceptors {
+	if !config.Enabled && !force {
+		return &middlewareInterceptors{}
+	}
+
+	enabled := *config
+	enabled.Enabled = true
+
+	return &middlewareInterceptors{
+		unary:        rkgrpcauth.UnaryServerInterceptor(rkmidauth.ToOptions(&enabled, entryName, GrpcEntryType)...),
+		stream:       rkgrpcauth.StreamServerInterceptor(rkmidauth.ToOptions(&enabled, entryName, GrpcEntryType)...),
+		overrideOnly: !config.Enabled,
+	}
+}
+
+// toAuthzInterceptors build interceptors of authorization middleware
+func toAuthzInterceptors(config *rkgrpcauthz.BootConfig, entryName string, force bool) *middlewareInterceptors {
+	if !config.Enabled && !force {
+		return &middlewareInterceptors{}
+	}
+
+	enabled := *config
+	enabled.Enabled = true
+
+	return &middlewareInterceptors{
+		unary:        rkgrpcauthz.UnaryServerInterceptor(rkgrpcauthz.ToOptions(&enabled, entryName, GrpcEntryType)...),
+		stream:       rkgrpcauthz.StreamServerInterceptor(rkgrpcauthz.ToOptions(&enabled, entryName, GrpcEntryType)...),
+		overrideOnly: !config.Enabled,
+	}
+}
+
+// toJwtInterceptors build interceptors of jwt middleware
+func toJwtInterceptors(config *rkgrpcjwt.BootConfig, entryName string, force bool) *middlewareInterceptors {
+	if !config.Enabled && !force {
+		return &middlewareInterceptors{}
+	}
+
+	enabled := *config
+	enabled.Enabled = true
+
+	// signer of JWKS would be created once and shared, registered after interceptors are in use
+	signer := rkgrpcjwt.ToJwksSigner(&enabled, entryName)
+	opts := rkgrpcjwt.ToOptionsWithSigner(&enabled, entryName, GrpcEntryType, signer)
+	// failures are classified with error of signer verifying jwt
+	verifier := rkgrpcjwt.ToSigner(&enabled, entryName, signer)
+
+	return &middlewareInterceptors{
+		unary:        rkgrpcjwt.UnaryServerInterceptorWithSigner(verifier, config.ClaimsToLog, opts...),
+		stream:       rkgrpcjwt.StreamServerInterceptorWithSigner(verifier, config.ClaimsToLog, opts...),
+		overrideOnly: !config.Enabled,
+		commit: func() {
+			if signer != nil {
+				rkentry.GlobalAppCtx.AddEntry(signer)
+			}
+		},
+		start: func(ctx context.Context) {
+			if signer != nil {
+				signer.Bootstrap(ctx)
+			}
+		},
+		stop: func(ctx context.Context) {
+			if signer != nil {
+				signer.Interrupt(ctx)
+			}
+		},
+	}
+}
+
+// toTimeoutInterceptors build interceptors of timeout middleware
+func toTimeoutInterceptors(config *rkgrpctimeout.BootConfig, entryName string, force bool) *middlewareInterceptors {
+	if !config.Enabled && !force {
+		return &middlewareInterceptors{}
+	}
+
+	enabled := *config
+	enabled.Enabled = true
+
+	opts := append(rkgrpctimeout.ToOptions(&enabled, entryName, GrpcEntryType),
+		rkgrpctimeout.WithMinBudget(rkgrpctimeout.ToMinBudget(&enabled)))
+
+	return &middlewareInterceptors{
+		unary: rkgrpctimeout.UnaryServerInterceptor(opts...),
+		stream: rkgrpctimeout.StreamServerInterceptor(
+			append(opts, rkgrpctimeout.WithStreamTimeout(rkgrpctimeout.ToStreamTimeout(&enabled)))...),
+		overrideOnly: !config.Enabled,
+	}
+}
+
+// toRateLimitInterceptors build interceptors of rate limit middleware
+func toRateLimitInterceptors(config *rkgrpclimit.BootConfig, entryName string, force bool) *middlewareInterceptors {
+	if !config.Enabled && !force {
+		return &middlewareInterceptors{}
+	}
+
+	enabled := *config
+	enabled.Enabled = true
+
+	// share per-key limiters between unary and stream
+	limiter := rkgrpclimit.ToKeyLimiter(&enabled)
+
+	return &middlewareInterceptors{
+		unary:        rkgrpclimit.UnaryServerInterceptorWithKeys(limiter, rkgrpclimit.ToOptions(&enabled, entryName, GrpcEntryType)...),
+		stream:       rkgrpclimit.StreamServerInterceptorWithKeys(limiter, rkgrpclimit.ToOptions(&enabled, entryName, GrpcEntryType)...),
+		overrideOnly: !config.Enabled,
+		stop: func(context.Context) {
+			if err := limiter.Close(); err != nil {
+				rkentry.GlobalAppCtx.GetLoggerEntryDefault().Warn("Failed to close rate limit backend",
+					zap.String("entryName", entryName), zap.Error(err))
+			}
+		},
+	}
+}
+
+// AddReloadableMiddleware Add interceptors of middleware with name which could be replaced by Reload.
+//
+// Middlewares of boot config are placed by order and overrides of interceptor chain, interceptors of them are replaced
+// in place. Entries created without boot config have no interceptor chain, middleware is placed at current position of
+// interceptors instead. Pass empty interceptors if middleware is disabled but could be enabled by reloading.
+func (entry *GrpcEntry) AddReloadableMiddleware(name string, unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) {
+	interceptors := &middlewareInterceptors{unary: unary, stream: stream}
+
+	// replace interceptors of middleware in chain
+	if m, ok := entry.middlewares[name]; ok && entry.chain != nil {
+		prev := m.get()
+		m.set(interceptors)
+		prev.stopJobs(context.Background())
+		return
+	}
+
+	m := newReloadableMiddleware(interceptors)
+	if entry.middlewares == nil {
+		entry.middlewares = make(map[string]*reloadableMiddleware)
+	}
+	entry.middlewares[name] = m
+	entry.AddUnaryInterceptors(m.unaryInterceptor)
+	entry.AddStreamInterceptors(m.streamInterceptor)
+}
+
+// restoreSigner restore signer of entry registered before reloading, signer registered while reloading is removed
+func restoreSigner(entryName string, prev rkentry.Entry) {
+	if prev != nil {
+		rkentry.GlobalAppCtx.AddEntry(prev)
+		return
+	}
+
+	if v := rkentry.GlobalAppCtx.GetEntry(rkentry.SignerJwtEntryType, entryName); v != nil {
+		rkentry.GlobalAppCtx.RemoveEntry(v)
+	}
+}
+
+// ReloadFile Reload proxy rules and middlewares from boot config file, see Reload for details.
+func (entry *GrpcEntry) ReloadFile(filePath string) error {
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	return entry.Reload(raw)
+}
+
+// Reload Reload proxy rules and middlewares from boot config in YAML.
+//
+// Config of grpc entry with the same name would be used. Proxy rules, auth, authz, jwt, timeout and rate limit
+// middlewares, order and overrides of middlewares are replaced atomically, calls in flight would continue with previous
+// ones. Other settings including enabling or disabling proxy and enabling logging, prom, trace or meta middlewares
+// by overrides require restarting. Nothing would be changed if any error occurs, signers are registered into
+// rkentry.GlobalAppCtx and background jobs of middlewares are started only after every step succeeded.
+func (entry *GrpcEntry) Reload(raw []byte) (err error) {
+	entry.reloadLock.Lock()
+	defer entry.reloadLock.Unlock()
+
+	// symmetric and asymmetric signers are registered by rk-entry while building jwt options, restore them if failed
+	prevSigner := rkentry.GlobalAppCtx.GetEntry(rkentry.SignerJwtEntryType, entry.entryName)
+
+	// middlewares built would be stopped if failed
+	middlewares := make(map[string]*middlewareInterceptors)
+
+	event, logger := entry.logBasicInfo("Reload", context.Background())
+	defer func() {
+		// invalid config would cause panic while parsing, recover and keep current settings
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("invalid boot config, %v", recovered)
+		}
+
+		if err != nil {
+			restoreSigner(entry.entryName, prevSigner)
+			for _, interceptors := range middlewares {
+				interceptors.stopJobs(context.Background())
+			}
+			logger.Warn("Failed to reload grpcEntry", zap.Error(err))
+			entry.EventEntry.FinishWithError(event, err)
+			return
+		}
+		entry.EventEntry.Finish(event)
+	}()
+
+	// 1: decode config and find config of current entry
+	config := &BootConfig{}
+	rkentry.UnmarshalBootYAML(raw, config)
+
+	index := -1
+	for i := range config.Grpc {
+		if config.Grpc[i].Name == entry.entryName && config.Grpc[i].Enabled {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("grpc entry %s not found in boot config", entry.entryName)
+	}
+	element := config.Grpc[index]
+
+	if element.Proxy.Enabled != entry.IsProxyEnabled() {
+		return errors.New("proxy could not be enabled or disabled without restarting")
+	}
+
+	// 2: build middlewares and proxy rules before replacing, so that nothing would be changed if failed
+	overrides := element.Middleware.Overrides
+	middlewares[MiddlewareAuth] = toAuthInterceptors(&element.Middleware.Auth, element.Name,
+		enabledByOverrides(overrides, MiddlewareAuth))
+	middlewares[MiddlewareAuthz] = toAuthzInterceptors(&element.Middleware.Authz, element.Name,
+		enabledByOverrides(overrides, MiddlewareAuthz))
+	middlewares[MiddlewareJwt] = toJwtInterceptors(&element.Middleware.Jwt, element.Name,
+		enabledByOverrides(overrides, MiddlewareJwt))
+	middlewares[MiddlewareTimeout] = toTimeoutInterceptors(&element.Middleware.Timeout, element.Name,
+		enabledByOverrides(overrides, MiddlewareTimeout))
+	middlewares[MiddlewareRateLimit] = toRateLimitInterceptors(&element.Middleware.RateLimit, element.Name,
+		enabledByOverrides(overrides, MiddlewareRateLimit))
+
+	plan, err := newChainPlan(element.Middleware.Order, overrides, &element.Middleware.Timeout, element.Name)
+	if err != nil {
+		return err
+	}
+
+	var r *rule
+	if element.Proxy.Enabled {
+		if r, err = element.Proxy.ToRule(); err != nil {
+			return err
+		}
+	}
+
+	// 3: replace middlewares and proxy rules
+	for name, interceptors := range middlewares {
+		if m, ok := entry.middlewares[name]; ok {
+			prev := m.get()
+			m.set(interceptors)
+			interceptors.commitEntries()
+			interceptors.startJobs(context.Background())
+			prev.stopJobs(context.Background())
+			event.AddPayloads(zap.Bool(name+"Enabled", interceptors.unary != nil && !interceptors.overrideOnly))
+		} else {
+			interceptors.stopJobs(context.Background())
+		}
+	}
+
+	if entry.chain != nil {
+		entry.chain.setPlan(plan)
+	}
+
+	if r != nil {
+		entry.ProxyEntry.ReloadRule(r)
+	}
+
+	return nil
+}
+
+// reloadHandler reload proxy rules and middlewares from config file, only POST is allowed
+func (entry *GrpcEntry) reloadHandler(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		bytes, _ := json.Marshal(rkmid.GetErrorBuilder().New(http.StatusMethodNotAllowed, "Only POST is allowed"))
+		writer.Write(bytes)
+		return
+	}
+
+	if len(entry.ReloadConfigFile) < 1 {
+		writer.WriteHeader(http.StatusPreconditionFailed)
+		bytes, _ := json.Marshal(rkmid.GetErrorBuilder().New(http.StatusPreconditionFailed, "Config file of reloading is missing"))
+		writer.Write(bytes)
+		return
+	}
+
+	if err := entry.ReloadFile(entry.ReloadConfigFile); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		bytes, _ := json.Marshal(rkmid.GetErrorBuilder().New(http.StatusBadRequest, fmt.Sprintf("Failed to reload, %v", err)))
+		writer.Write(bytes)
+		return
+	}
+
+	bytes, _ := json.Marshal(map[string]bool{"reloaded": true})
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(bytes)
+}
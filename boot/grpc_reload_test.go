@@ -0,0 +1,392 @@
+//go:build !race
+// +build !race
+
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	rkgrpclimit "github.com/tegarajipangestu/rk-grpc/v2/middleware/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const utReloadConfig = `
+grpc:
+  - name: ut-reload
+    port: 1949
+    enabled: true
+    proxy:
+      enabled: true
+      rules:
+        - type: pathBased
+          paths: ["/ut.*"]
+          dest: ["localhost:8081"]
+    reload:
+      enabled: true
+`
+
+const utReloadConfigUpdated = `
+grpc:
+  - name: ut-reload
+    port: 1949
+    enabled: true
+    proxy:
+      enabled: true
+      rules:
+        - type: pathBased
+          paths: ["/ut.*"]
+          dest: ["localhost:8082"]
+    middleware:
+      auth:
+        enabled: true
+        basic: ["user:pass"]
+      rateLimit:
+        enabled: true
+        reqPerSec: 10
+        keys:
+          - type: metadata
+            header: x-tenant-id
+            reqPerSec: 5
+            quotas: ["ut-tenant:10"]
+      authz:
+        enabled: true
+        policies:
+          - methods: ["/ut.*"]
+            roles: ["admin"]
+`
+
+func TestReloadableMiddleware(t *testing.T) {
+	m := &reloadableMiddleware{}
+
+	unaryHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+	streamHandler := func(srv interface{}, stream grpc.ServerStream) error {
+		return nil
+	}
+
+	// without interceptors
+	resp, err := m.unaryInterceptor(context.TODO(), "ut-req", &grpc.UnaryServerInfo{}, unaryHandler)
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-req", resp)
+	assert.Nil(t, m.streamInterceptor(nil, nil, &grpc.StreamServerInfo{}, streamHandler))
+
+	// with interceptors
+	m.set(&middlewareInterceptors{
+		unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			return nil, status.Error(codes.PermissionDenied, "")
+		},
+		stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return status.Error(codes.PermissionDenied, "")
+		},
+	})
+	_, err = m.unaryInterceptor(context.TODO(), "ut-req", &grpc.UnaryServerInfo{}, unaryHandler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	err = m.streamInterceptor(nil, nil, &grpc.StreamServerInfo{}, streamHandler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// disable with nil
+	m.set(nil)
+	_, err = m.unaryInterceptor(context.TODO(), "ut-req", &grpc.UnaryServerInfo{}, unaryHandler)
+	assert.Nil(t, err)
+}
+
+func TestGrpcEntry_Reload(t *testing.T) {
+	entry := RegisterGrpcEntryYAML([]byte(utReloadConfig))["ut-reload"].(*GrpcEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	defer entry.ProxyEntry.Interrupt(context.TODO())
+
+	assert.Equal(t, defaultReloadPath, entry.ReloadPath)
+	assert.Len(t, entry.middlewares, 5)
+	assert.Nil(t, entry.middlewares[MiddlewareAuth].get().unary)
+	prev := entry.ProxyEntry.getRule()
+
+	// reload proxy rules and middlewares
+	assert.Nil(t, entry.Reload([]byte(utReloadConfigUpdated)))
+	assert.NotEqual(t, prev, entry.ProxyEntry.getRule())
+	assert.Equal(t, []string{"localhost:8082"}, entry.ProxyEntry.getRule().PathPattern[0].Dest)
+	assert.NotNil(t, entry.middlewares[MiddlewareAuth].get().unary)
+	assert.NotNil(t, entry.middlewares[MiddlewareRateLimit].get().stream)
+	assert.NotNil(t, entry.middlewares[MiddlewareAuthz].get().unary)
+	assert.Nil(t, entry.middlewares[MiddlewareJwt].get().unary)
+	assert.Nil(t, entry.middlewares[MiddlewareTimeout].get().unary)
+
+	// settings would not be changed if failed
+	current := entry.ProxyEntry.getRule()
+
+	// entry not exist
+	assert.NotNil(t, entry.Reload([]byte(`
+grpc:
+  - name: ut-other
+    enabled: true
+`)))
+
+	// proxy disabled
+	assert.NotNil(t, entry.Reload([]byte(`
+grpc:
+  - name: ut-reload
+    enabled: true
+    middleware:
+      auth:
+        enabled: false
+`)))
+
+	assert.Equal(t, current, entry.ProxyEntry.getRule())
+	assert.NotNil(t, entry.middlewares[MiddlewareAuth].get().unary)
+
+	// invalid order of middlewares
+	assert.NotNil(t, entry.Reload([]byte(`
+grpc:
+  - name: ut-reload
+    enabled: true
+    proxy:
+      enabled: true
+    middleware:
+      order: ["ut-unknown"]
+`)))
+	assert.Equal(t, defaultMiddlewareOrder, entry.chain.getPlan().order)
+
+	// signers would not be registered if failed
+	rkentry.GlobalAppCtx.RemoveEntryByType(rkentry.SignerJwtEntryType)
+	for _, signer := range []string{"jwks:\n          url: http://ut-url/keys", "symmetric:\n          token: ut-token"} {
+		assert.NotNil(t, entry.Reload([]byte(`
+grpc:
+  - name: ut-reload
+    enabled: true
+    proxy:
+      enabled: true
+    middleware:
+      order: ["ut-unknown"]
+      jwt:
+        enabled: true
+        `+signer+`
+`)))
+		assert.Nil(t, rkentry.GlobalAppCtx.GetEntry(rkentry.SignerJwtEntryType, "ut-reload"))
+		assert.Nil(t, entry.middlewares[MiddlewareJwt].get().unary)
+	}
+
+	// signer registered once reloaded
+	assert.Nil(t, entry.Reload([]byte(`
+grpc:
+  - name: ut-reload
+    enabled: true
+    proxy:
+      enabled: true
+    middleware:
+      jwt:
+        enabled: true
+        jwks:
+          url: http://ut-url/keys
+`)))
+	assert.NotNil(t, rkentry.GlobalAppCtx.GetEntry(rkentry.SignerJwtEntryType, "ut-reload"))
+	prevSigner := rkentry.GlobalAppCtx.GetEntry(rkentry.SignerJwtEntryType, "ut-reload")
+
+	// previous signer restored if failed
+	assert.NotNil(t, entry.Reload([]byte(`
+grpc:
+  - name: ut-reload
+    enabled: true
+    proxy:
+      enabled: true
+    middleware:
+      order: ["ut-unknown"]
+      jwt:
+        enabled: true
+        symmetric:
+          token: ut-token
+`)))
+	assert.Equal(t, prevSigner, rkentry.GlobalAppCtx.GetEntry(rkentry.SignerJwtEntryType, "ut-reload"))
+	rkentry.GlobalAppCtx.RemoveEntryByType(rkentry.SignerJwtEntryType)
+
+	// order and overrides of middlewares
+	assert.Nil(t, entry.Reload([]byte(`
+grpc:
+  - name: ut-reload
+    enabled: true
+    proxy:
+      enabled: true
+    middleware:
+      order: ["rateLimit"]
+      overrides:
+        - methods: ["/grpc.health.v1.Health/*"]
+          disable: ["auth"]
+`)))
+	assert.Equal(t, MiddlewareRateLimit, entry.chain.getPlan().order[0])
+	assert.Len(t, entry.chain.getPlan().overrides, 1)
+
+	// file not exist
+	assert.NotNil(t, entry.ReloadFile(path.Join(t.TempDir(), "not-exist.yaml")))
+}
+
+func TestGrpcEntry_ReloadHandler(t *testing.T) {
+	entry := RegisterGrpcEntryYAML([]byte(utReloadConfig))["ut-reload"].(*GrpcEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	defer entry.ProxyEntry.Interrupt(context.TODO())
+
+	// only POST is allowed
+	writer := httptest.NewRecorder()
+	entry.reloadHandler(writer, httptest.NewRequest(http.MethodGet, defaultReloadPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, writer.Code)
+
+	// config file missing
+	writer = httptest.NewRecorder()
+	entry.reloadHandler(writer, httptest.NewRequest(http.MethodPost, defaultReloadPath, nil))
+	assert.Equal(t, http.StatusPreconditionFailed, writer.Code)
+
+	// invalid config file
+	entry.ReloadConfigFile = path.Join(t.TempDir(), "boot.yaml")
+	assert.Nil(t, os.WriteFile(entry.ReloadConfigFile, []byte("grpc: []"), 0644))
+	writer = httptest.NewRecorder()
+	entry.reloadHandler(writer, httptest.NewRequest(http.MethodPost, defaultReloadPath, nil))
+	assert.Equal(t, http.StatusBadRequest, writer.Code)
+
+	// happy case
+	assert.Nil(t, os.WriteFile(entry.ReloadConfigFile, []byte(utReloadConfigUpdated), 0644))
+	writer = httptest.NewRecorder()
+	entry.reloadHandler(writer, httptest.NewRequest(http.MethodPost, defaultReloadPath, nil))
+	assert.Equal(t, http.StatusOK, writer.Code)
+	assert.Equal(t, []string{"localhost:8082"}, entry.ProxyEntry.getRule().PathPattern[0].Dest)
+}
+
+func TestGrpcEntry_ReloadWithJwks(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	entry := RegisterGrpcEntryYAML([]byte(utReloadConfig))["ut-reload"].(*GrpcEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	defer entry.ProxyEntry.Interrupt(context.TODO())
+	defer rkentry.GlobalAppCtx.RemoveEntryByType(rkentry.SignerJwtEntryType)
+
+	// keys refreshed periodically once reloaded, even if failed to fetch
+	assert.Nil(t, entry.Reload([]byte(`
+grpc:
+  - name: ut-reload
+    enabled: true
+    proxy:
+      enabled: true
+    middleware:
+      jwt:
+        enabled: true
+        jwks:
+          url: `+server.URL+`
+          refreshIntervalMs: 10
+`)))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) > 2
+	}, time.Second, 10*time.Millisecond)
+
+	// refreshing of replaced signer stopped
+	assert.Nil(t, entry.Reload([]byte(`
+grpc:
+  - name: ut-reload
+    enabled: true
+    proxy:
+      enabled: true
+`)))
+	time.Sleep(30 * time.Millisecond)
+	current := atomic.LoadInt32(&calls)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, current, atomic.LoadInt32(&calls))
+}
+
+func TestGrpcEntry_AddReloadableMiddleware(t *testing.T) {
+	deny := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return nil, status.Error(codes.PermissionDenied, "")
+	}
+
+	// entry without interceptor chain, middleware appended to interceptors
+	entry := RegisterGrpcEntry(WithName("ut-add-reloadable"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	interceptors := len(entry.UnaryInterceptors)
+	entry.AddReloadableMiddleware(MiddlewareAuth, deny, nil)
+	assert.Len(t, entry.UnaryInterceptors, interceptors+1)
+	assert.NotNil(t, entry.middlewares[MiddlewareAuth].get().unary)
+
+	// entry with interceptor chain, interceptors of middleware in chain replaced in place
+	entry = RegisterGrpcEntryYAML([]byte(utReloadConfig))["ut-reload"].(*GrpcEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	defer entry.ProxyEntry.Interrupt(context.TODO())
+	interceptors = len(entry.UnaryInterceptors)
+	slot := entry.middlewares[MiddlewareAuth]
+	entry.AddReloadableMiddleware(MiddlewareAuth, deny, nil)
+	assert.Len(t, entry.UnaryInterceptors, interceptors)
+	assert.Equal(t, slot, entry.middlewares[MiddlewareAuth])
+	_, err := entry.chain.unaryInterceptor(context.TODO(), nil, &grpc.UnaryServerInfo{FullMethod: "/ut.v1.Greeter/Get"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestToRateLimitInterceptors_CloseStore(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	// store replies 1 to every command and reports when connection is closed by client
+	released := make(chan struct{})
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(released)
+				return
+			}
+			if strings.HasPrefix(line, "*") {
+				conn.Write([]byte(":1\r\n"))
+			}
+		}
+	}()
+
+	config := &rkgrpclimit.BootConfig{
+		Keys:  []rkgrpclimit.BootConfigKey{{Type: rkgrpclimit.KeyTypeApiKey, ReqPerSec: 10}},
+		Store: &rkgrpclimit.BootConfigStore{Addr: listener.Addr().String()},
+	}
+	config.Enabled = true
+	interceptors := toRateLimitInterceptors(config, "ut-entry", false)
+
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(rkmid.HeaderApiKey, "ut-api-key"))
+	_, err = interceptors.unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/ut.Service/Method"},
+		func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+	assert.Nil(t, err)
+
+	// connections of store are released once stopped
+	interceptors.stopJobs(context.TODO())
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		assert.Fail(t, "connection of store is not closed")
+	}
+}
@@ -4,7 +4,8 @@
 // license that can be found in the LICENSE file.
 
 // Experimental. This is used as grpc proxy server which forwarding grpc request to backend grpc server if not implemented.
-// Currently, grpc-gateway and grpcurl is not supported. The grpc client called from code is supported.
+// Services of backend grpc server would be listed by grpc reflection if reflection is enabled, and grpc-gateway could
+// route to proxied methods with HTTP rules in gateway mapping files.
 package rkgrpc
 
 import (
@@ -14,15 +15,24 @@ import (
 	"math/rand"
 	"net"
 	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	gwruntime "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus"
 	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
 	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkmidprom "github.com/rookie-ninja/rk-entry/v2/middleware/prom"
 	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/api/annotations"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/encoding"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 )
@@ -38,32 +48,116 @@ const (
 	PathBased = "pathBased"
 	// IpBased remote IP based proxy pattern
 	IpBased = "ipBased"
+
+	// rules replaced by reloading would be checked in this interval until calls in flight finished
+	ruleRetireInterval = 100 * time.Millisecond
 )
 
 // BootConfigProxy Boot config which is for proxy entry.
 //
 // 1: Enabled: Enable prom entry.
 // 2: Rules: Provide rules for proxying.
+// 3: Rules.Upstream: Load balancer, weights, health check, TLS and shadow destination of rule.
+// 4: Rules.Name, Rules.Priority, Rules.Match: Name, priority and condition of composite rule.
+// 5: GwMappingFiles: Gateway mapping files with HTTP rules of proxied methods.
+// 6: Debug: Enable endpoint which shows matched rule of method, metadata and IP.
+// 7: Rules.Metadata: Transforms of request metadata, response headers and trailers.
+// 8: TrustedProxies: IPs or CIDRs of proxies whose forwarded addresses would be copied from peer.
 type BootConfigProxy struct {
-	Enabled bool `yaml:"enabled" json:"enabled"`
-	Rules   []struct {
-		Type        string   `yaml:"type" json:"type"`
-		HeaderPairs []string `yaml:"headerPairs" json:"headerPairs"`
-		Dest        []string `yaml:"dest" json:"dest"`
-		Paths       []string `yaml:"paths" json:"paths"`
-		Ips         []string `yaml:"ips" json:"ips"`
+	Enabled        bool     `yaml:"enabled" json:"enabled"`
+	GwMappingFiles []string `yaml:"gwMappingFiles" json:"gwMappingFiles"`
+	TrustedProxies []string `yaml:"trustedProxies" json:"trustedProxies"`
+	Debug          struct {
+		Enabled bool   `yaml:"enabled" json:"enabled"`
+		Path    string `yaml:"path" json:"path"`
+	} `yaml:"debug" json:"debug"`
+	Rules []struct {
+		Type        string                   `yaml:"type" json:"type"`
+		Name        string                   `yaml:"name" json:"name"`
+		Priority    int                      `yaml:"priority" json:"priority"`
+		HeaderPairs []string                 `yaml:"headerPairs" json:"headerPairs"`
+		Dest        []string                 `yaml:"dest" json:"dest"`
+		Paths       []string                 `yaml:"paths" json:"paths"`
+		Ips         []string                 `yaml:"ips" json:"ips"`
+		Match       BootConfigProxyCondition `yaml:"match" json:"match"`
+		Upstream    BootConfigProxyUpstream  `yaml:"upstream" json:"upstream"`
+		Metadata    BootConfigProxyMetadata  `yaml:"metadata" json:"metadata"`
 	} `yaml:"rules" json:"rules"`
 }
 
+// ToRule convert BootConfigProxy into rules of proxy entry, error would be returned if any pattern is invalid
+func (boot *BootConfigProxy) ToRule() (*rule, error) {
+	trustedProxies, err := rkgrpcmid.ParseTrustedProxies(boot.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []ruleOption{WithTrustedProxies(trustedProxies...)}
+	for i := range boot.Rules {
+		rule := boot.Rules[i]
+		switch rule.Type {
+		case HeaderBased:
+			opts = append(opts, WithHeaderPatterns(&HeaderPattern{
+				Headers:  parseHeaderPairs(rule.HeaderPairs),
+				Dest:     rule.Dest,
+				Upstream: rule.Upstream.ToUpstreamConfig(),
+				Metadata: rule.Metadata.ToMetadataRule(),
+			}))
+
+		case PathBased:
+			opts = append(opts, WithPathPatterns(&PathPattern{
+				Paths:    rule.Paths,
+				Dest:     rule.Dest,
+				Upstream: rule.Upstream.ToUpstreamConfig(),
+				Metadata: rule.Metadata.ToMetadataRule(),
+			}))
+		case IpBased:
+			opts = append(opts, WithIpPatterns(&IpPattern{
+				Cidrs:    rule.Ips,
+				Dest:     rule.Dest,
+				Upstream: rule.Upstream.ToUpstreamConfig(),
+				Metadata: rule.Metadata.ToMetadataRule(),
+			}))
+		case CompositeBased:
+			opts = append(opts, WithRoutePatterns(&RoutePattern{
+				Name:     rule.Name,
+				Priority: rule.Priority,
+				Match:    rule.Match.ToCondition(),
+				Dest:     rule.Dest,
+				Upstream: rule.Upstream.ToUpstreamConfig(),
+				Metadata: rule.Metadata.ToMetadataRule(),
+			}))
+		case DefaultBased:
+			opts = append(opts, WithDefaultPattern(&RoutePattern{
+				Name:     rule.Name,
+				Dest:     rule.Dest,
+				Upstream: rule.Upstream.ToUpstreamConfig(),
+				Metadata: rule.Metadata.ToMetadataRule(),
+			}))
+		}
+	}
+
+	return NewRule(opts...)
+}
+
 type rule struct {
-	HeaderPattern []*HeaderPattern
-	PathPattern   []*PathPattern
-	IpPattern     []*IpPattern
-	rand          *rand.Rand
+	inFlight       int64
+	HeaderPattern  []*HeaderPattern
+	PathPattern    []*PathPattern
+	IpPattern      []*IpPattern
+	RoutePattern   []*RoutePattern
+	DefaultPattern *RoutePattern
+	trustedProxies []*net.IPNet
+	rand           *rand.Rand
+	routes         []*route
+	defaultRoute   *route
+	index          *routeIndex
 }
 
 // NewRule create a new proxy rules with options.
-func NewRule(opts ...ruleOption) *rule {
+//
+// Regex of paths and CIDR of IPs are compiled once, error would be returned if any of them is invalid.
+func NewRule(opts ...ruleOption) (*rule, error) {
 	r := &rule{
 		HeaderPattern: make([]*HeaderPattern, 0),
 		PathPattern:   make([]*PathPattern, 0),
@@ -75,11 +169,84 @@ func NewRule(opts ...ruleOption) *rule {
 		opts[i](r)
 	}
 
-	return r
+	// compile patterns before creating upstream pools, so that nothing would be leaked if invalid
+	if err := r.compilePatterns(); err != nil {
+		return nil, err
+	}
+
+	r.trustProxies()
+
+	// build upstream pools, start with random offset so that proxies would not hit the same destination first
+	for _, pattern := range r.HeaderPattern {
+		pattern.pool = newUpstreamPool(pattern.Dest, pattern.Upstream, r.rand.Uint64())
+	}
+	for _, pattern := range r.PathPattern {
+		pattern.pool = newUpstreamPool(pattern.Dest, pattern.Upstream, r.rand.Uint64())
+	}
+	for _, pattern := range r.IpPattern {
+		pattern.pool = newUpstreamPool(pattern.Dest, pattern.Upstream, r.rand.Uint64())
+	}
+	for _, pattern := range r.RoutePattern {
+		pattern.pool = newUpstreamPool(pattern.Dest, pattern.Upstream, r.rand.Uint64())
+	}
+	if r.DefaultPattern != nil {
+		r.DefaultPattern.pool = newUpstreamPool(r.DefaultPattern.Dest, r.DefaultPattern.Upstream, r.rand.Uint64())
+	}
+
+	r.compileRoutes()
+
+	return r, nil
+}
+
+// compilePatterns compile regex and CIDR of all patterns
+func (r *rule) compilePatterns() error {
+	for _, pattern := range r.PathPattern {
+		if err := pattern.compile(); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range r.IpPattern {
+		if err := pattern.compile(); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range r.RoutePattern {
+		if err := pattern.Match.compile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// trustProxies set trusted proxies of rule into metadata transforms of all patterns
+func (r *rule) trustProxies() {
+	for _, pattern := range r.HeaderPattern {
+		pattern.Metadata.trust(r.trustedProxies)
+	}
+	for _, pattern := range r.PathPattern {
+		pattern.Metadata.trust(r.trustedProxies)
+	}
+	for _, pattern := range r.IpPattern {
+		pattern.Metadata.trust(r.trustedProxies)
+	}
+	for _, pattern := range r.RoutePattern {
+		pattern.Metadata.trust(r.trustedProxies)
+	}
+	if r.DefaultPattern != nil {
+		r.DefaultPattern.Metadata.trust(r.trustedProxies)
+	}
 }
 
 type ruleOption func(*rule)
 
+// WithTrustedProxies provide proxies whose forwarded addresses would be copied from peer by metadata transforms.
+func WithTrustedProxies(proxies ...*net.IPNet) ruleOption {
+	return func(r *rule) {
+		r.trustedProxies = append(r.trustedProxies, proxies...)
+	}
+}
+
 // WithHeaderPatterns provide header based patterns.
 func WithHeaderPatterns(pattern ...*HeaderPattern) ruleOption {
 	return func(r *rule) {
@@ -101,12 +268,29 @@ func WithIpPatterns(pattern ...*IpPattern) ruleOption {
 	}
 }
 
+// WithRoutePatterns provide composite patterns with priority.
+func WithRoutePatterns(pattern ...*RoutePattern) ruleOption {
+	return func(r *rule) {
+		r.RoutePattern = append(r.RoutePattern, pattern...)
+	}
+}
+
+// WithDefaultPattern provide fallback destinations if no patterns matched, Match of pattern would be ignored.
+func WithDefaultPattern(pattern *RoutePattern) ruleOption {
+	return func(r *rule) {
+		r.DefaultPattern = pattern
+	}
+}
+
 // HeaderPattern defines proxy rules based on header.
 //
 // Proxy will validate headers in metadata with provided rules.
 type HeaderPattern struct {
-	Headers map[string]string
-	Dest    []string
+	Headers  map[string]string
+	Dest     []string
+	Upstream *UpstreamConfig
+	Metadata *MetadataRule
+	pool     *upstreamPool
 }
 
 // PathPattern defines proxy rules based on path.
@@ -114,101 +298,67 @@ type HeaderPattern struct {
 // The incoming path should match with rules.
 // Path rule support regex.
 type PathPattern struct {
-	Paths []string
-	Dest  []string
+	Paths    []string
+	Dest     []string
+	Upstream *UpstreamConfig
+	Metadata *MetadataRule
+	pool     *upstreamPool
+	regexps  []*regexp.Regexp
 }
 
 // IpPattern defines proxy rules based on remote IPs.
 //
 // Ip rule support CIDR.
 type IpPattern struct {
-	Cidrs []string
-	Dest  []string
+	Cidrs    []string
+	Dest     []string
+	Upstream *UpstreamConfig
+	Metadata *MetadataRule
+	pool     *upstreamPool
+	subnets  []*net.IPNet
 }
 
-// Incoming remote IP should match user defined CIDR.
-func (r *rule) matchIpPattern(ctx context.Context) (bool, string) {
-	remoteIp, _, _ := rkgrpcmid.GetRemoteAddressSet(ctx)
-
-	// iterate pattern slice
-	for i := range r.IpPattern {
-		pattern := r.IpPattern[i]
-
-		// iterate CIDR
-		for j := range pattern.Cidrs {
-			cidr := pattern.Cidrs[j]
-			_, subnet, err := net.ParseCIDR(cidr)
-			if err != nil {
-				continue
-			}
-
-			// match CIDR
-			if subnet.Contains(net.ParseIP(remoteIp)) {
-				return true, pattern.Dest[r.rand.Intn(len(pattern.Dest))]
-			}
-		}
-	}
-
-	return false, ""
+// compile parse CIDR of pattern, IP without mask would be treated as single host.
+func (pattern *IpPattern) compile() (err error) {
+	pattern.subnets, err = compileCidrs(pattern.Cidrs)
+	return err
 }
 
-// Incoming path should match user defined regex.
-func (r *rule) matchPathPattern(ctx context.Context) (bool, string) {
-	method, ok := grpc.Method(ctx)
-
-	if !ok {
-		return false, ""
-	}
-
-	// iterate pattern slice
-	for i := range r.PathPattern {
-		pattern := r.PathPattern[i]
-
-		// iterate path
-		for j := range pattern.Paths {
-			pathRegex := pattern.Paths[j]
+// matches returns true if remote IP is in any of CIDR.
+func (pattern *IpPattern) matches(ctx context.Context) bool {
+	return matchCidrs(pattern.subnets, ctx)
+}
 
-			// match regex
-			if matched, err := regexp.MatchString(pathRegex, method); err == nil && matched {
-				return true, pattern.Dest[r.rand.Intn(len(pattern.Dest))]
-			}
-		}
-	}
+// compile compile regex of paths in pattern.
+func (pattern *PathPattern) compile() (err error) {
+	pattern.regexps, err = compilePaths(pattern.Paths)
+	return err
+}
 
-	return false, ""
+// matches returns true if incoming path matches any of regex.
+func (pattern *PathPattern) matches(ctx context.Context) bool {
+	return matchPaths(pattern.regexps, ctx)
 }
 
-// Incoming header should match user defined rule.
-func (r *rule) matchHeaderPattern(ctx context.Context) (bool, string) {
+// matches returns true if all the headers exist in metadata.
+func (pattern *HeaderPattern) matches(ctx context.Context) bool {
 	md, ok := metadata.FromIncomingContext(ctx)
 
 	if !ok {
-		return false, ""
+		return false
 	}
 
-	// iterate pattern slice
-	for i := range r.HeaderPattern {
-		pattern := r.HeaderPattern[i]
-
-		matched := true
-		// iterate header
-		for k, v1 := range pattern.Headers {
-			// all the headers must be exists in metadata
-			v2, _ := md[k]
-			matched = containsSlice(v2, v1)
-
-			if !matched {
-				break
-			}
-		}
+	// iterate header
+	for k, v1 := range pattern.Headers {
+		// all the headers must be exists in metadata
+		v2, _ := md[k]
 
-		if matched {
-			return true, pattern.Dest[r.rand.Intn(len(pattern.Dest))]
+		if !containsSlice(v2, v1) {
+			return false
 		}
-
 	}
 
-	return false, ""
+	return true
 }
 
 func containsSlice(src []string, target string) bool {
@@ -224,45 +374,118 @@ func containsSlice(src []string, target string) bool {
 	return false
 }
 
+// pools returns upstream pools of all patterns
+func (r *rule) pools() []*upstreamPool {
+	res := make([]*upstreamPool, 0)
+
+	for i := range r.IpPattern {
+		res = append(res, r.IpPattern[i].pool)
+	}
+	for i := range r.PathPattern {
+		res = append(res, r.PathPattern[i].pool)
+	}
+	for i := range r.HeaderPattern {
+		res = append(res, r.HeaderPattern[i].pool)
+	}
+	for i := range r.RoutePattern {
+		res = append(res, r.RoutePattern[i].pool)
+	}
+	if r.DefaultPattern != nil {
+		res = append(res, r.DefaultPattern.pool)
+	}
+
+	return res
+}
+
 // GetDirector creates a default Director based on rules.
+//
+// Patterns are checked by priority, IP based patterns, path based patterns and header based patterns are checked
+// before composite patterns with the same priority.
+//
+// Connections to destinations are cached in upstream pool of matched pattern.
 func (r *rule) GetDirector() Director {
 	return func(ctx context.Context) (context.Context, *grpc.ClientConn, error) {
-		// check ip pattern
-		if matched, dest := r.matchIpPattern(ctx); matched && len(dest) > 0 {
-			conn, err := grpc.DialContext(ctx, dest,
-				grpc.WithInsecure(),
-				grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec())))
+		// check patterns by priority, fallback to default pattern
+		rt := r.match(ctx)
+		if rt == nil {
+			return nil, nil, status.Errorf(codes.Unimplemented, "Unknown method")
+		}
 
-			return ctx, conn, err
+		up, err := rt.pool.pick(ctx)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		// check path pattern
-		if matched, dest := r.matchPathPattern(ctx); matched && len(dest) > 0 {
-			conn, err := grpc.DialContext(ctx, dest,
-				grpc.WithInsecure(),
-				grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec())))
-			return ctx, conn, err
+		conn, err := up.getConn()
+		if err != nil {
+			return nil, nil, err
 		}
 
-		// check header pattern
-		if matched, dest := r.matchHeaderPattern(ctx); matched && len(dest) > 0 {
-			conn, err := grpc.DialContext(ctx, dest,
-				grpc.WithInsecure(),
-				grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec())))
-			return ctx, conn, err
+		return withProxyRoute(ctx, rt), conn, nil
+	}
+}
+
+// acquire count a call in flight which is served by rule
+func (r *rule) acquire() {
+	atomic.AddInt64(&r.inFlight, 1)
+}
+
+// release mark a call served by rule as finished
+func (r *rule) release() {
+	atomic.AddInt64(&r.inFlight, -1)
+}
+
+// retire wait for calls in flight served by rule to finish, and then stop upstream pools of rule
+func (r *rule) retire() {
+	for atomic.LoadInt64(&r.inFlight) > 0 {
+		time.Sleep(ruleRetireInterval)
+	}
+
+	for _, pool := range r.pools() {
+		if pool != nil {
+			pool.stop()
 		}
+	}
+}
+
+// proxyRuleKey is key of rule in context which serves the call
+type proxyRuleKey struct{}
 
-		return nil, nil, status.Errorf(codes.Unimplemented, "Unknown method")
+// getProxyRule returns rule in context which serves the call, nil if not exist
+func getProxyRule(ctx context.Context) *rule {
+	if ctx == nil {
+		return nil
+	}
+
+	if v, ok := ctx.Value(proxyRuleKey{}).(*rule); ok {
+		return v
+	}
+
+	return nil
+}
+
+// releaseProxyRule release rule in context acquired by director of proxy entry
+func releaseProxyRule(ctx context.Context) {
+	if r := getProxyRule(ctx); r != nil {
+		r.release()
 	}
 }
 
 type ProxyEntry struct {
-	entryName        string               `json:"-" yaml:"-"`
-	entryType        string               `json:"-" yaml:"-"`
-	entryDescription string               `json:"-" yaml:"-"`
-	LoggerEntry      *rkentry.LoggerEntry `json:"-" yaml:"-"`
-	EventEntry       *rkentry.EventEntry  `json:"-" yaml:"-"`
-	r                *rule                `json:"-" yaml:"-"`
+	entryName        string                  `json:"-" yaml:"-"`
+	entryType        string                  `json:"-" yaml:"-"`
+	entryDescription string                  `json:"-" yaml:"-"`
+	LoggerEntry      *rkentry.LoggerEntry    `json:"-" yaml:"-"`
+	EventEntry       *rkentry.EventEntry     `json:"-" yaml:"-"`
+	r                atomic.Value            `json:"-" yaml:"-"`
+	descriptors      *proxyDescriptors       `json:"-" yaml:"-"`
+	gwRules          []*annotations.HttpRule `json:"-" yaml:"-"`
+	gwConn           *grpc.ClientConn        `json:"-" yaml:"-"`
+	DebugPath        string                  `json:"-" yaml:"-"`
+	registerer       prometheus.Registerer   `json:"-" yaml:"-"`
+	metricsSet       *rkmidprom.MetricsSet   `json:"-" yaml:"-"`
+	bootstrapped     bool                    `json:"-" yaml:"-"`
+	reloadLock       sync.Mutex              `json:"-" yaml:"-"`
 }
 
 // ProxyEntryOption Proxy entry option used while initializing proxy entry via code
@@ -292,7 +515,28 @@ func WithEventEntryProxy(eventEntry *rkentry.EventEntry) ProxyEntryOption {
 // WithRuleProxy Provide rule
 func WithRuleProxy(r *rule) ProxyEntryOption {
 	return func(entry *ProxyEntry) {
-		entry.r = r
+		entry.r.Store(r)
+	}
+}
+
+// WithGwRulesProxy Provide HTTP rules of proxied methods for grpc-gateway
+func WithGwRulesProxy(rules ...*annotations.HttpRule) ProxyEntryOption {
+	return func(entry *ProxyEntry) {
+		entry.gwRules = append(entry.gwRules, rules...)
+	}
+}
+
+// WithDebugPathProxy Provide path of debug endpoint which shows matched rule, endpoint would be disabled if empty
+func WithDebugPathProxy(path string) ProxyEntryOption {
+	return func(entry *ProxyEntry) {
+		entry.DebugPath = path
+	}
+}
+
+// WithPromRegistryProxy Provide prometheus.Registerer of shadow metrics, a new registry would be used if not provided
+func WithPromRegistryProxy(registerer prometheus.Registerer) ProxyEntryOption {
+	return func(entry *ProxyEntry) {
+		entry.registerer = registerer
 	}
 }
 
@@ -318,17 +562,176 @@ func NewProxyEntry(opts ...ProxyEntryOption) *ProxyEntry {
 		entry.EventEntry = rkentry.NewEventEntryStdout()
 	}
 
+	if entry.registerer == nil {
+		entry.registerer = prometheus.NewRegistry()
+	}
+
+	entry.descriptors = newProxyDescriptors(entry.getRule(), entry.LoggerEntry.Logger)
+	entry.metricsSet = rkmidprom.NewMetricsSet("rk", "proxy", entry.registerer)
+	entry.registerMetrics()
+
 	return entry
 }
 
-// Bootstrap Start prometheus client
+// Bootstrap Start health check of upstream pools and fetching descriptors of proxied services
 func (entry *ProxyEntry) Bootstrap(ctx context.Context) {
-	// Noop
+	entry.LoggerEntry.Info("Bootstrap ProxyEntry", zap.String("entryName", entry.entryName))
+
+	entry.reloadLock.Lock()
+	defer entry.reloadLock.Unlock()
+
+	entry.bootstrapped = true
+	startPools(entry.getRule())
+
+	// fetch descriptors in background so that they are ready before proxied calls need them
+	entry.descriptors.maybeRefresh()
 }
 
-// Interrupt Shutdown prometheus client
+// Interrupt Stop health check and close connections of upstream pools
 func (entry *ProxyEntry) Interrupt(ctx context.Context) {
-	// Noop
+	entry.LoggerEntry.Info("Interrupt ProxyEntry", zap.String("entryName", entry.entryName))
+
+	if entry.gwConn != nil {
+		entry.gwConn.Close()
+	}
+
+	entry.reloadLock.Lock()
+	defer entry.reloadLock.Unlock()
+
+	entry.bootstrapped = false
+
+	r := entry.getRule()
+	if r == nil {
+		return
+	}
+
+	for _, pool := range r.pools() {
+		if pool != nil {
+			pool.stop()
+		}
+	}
+}
+
+// ReloadRule Replace rules of proxy entry atomically.
+//
+// Calls in flight would continue with previous rules, health check and connections of previous rules would be
+// stopped after these calls finished.
+func (entry *ProxyEntry) ReloadRule(r *rule) {
+	if r == nil {
+		r, _ = NewRule()
+	}
+
+	entry.reloadLock.Lock()
+	defer entry.reloadLock.Unlock()
+
+	if entry.bootstrapped {
+		startPools(r)
+	}
+
+	prev := entry.getRule()
+	entry.r.Store(r)
+	entry.descriptors.setRule(r)
+
+	entry.LoggerEntry.Info("Reload ProxyEntry",
+		zap.String("entryName", entry.entryName),
+		zap.Int("rules", len(r.routes)))
+
+	if prev != nil {
+		go prev.retire()
+	}
+}
+
+// getRule returns current rules of proxy entry
+func (entry *ProxyEntry) getRule() *rule {
+	if entry == nil {
+		return nil
+	}
+
+	r, _ := entry.r.Load().(*rule)
+	return r
+}
+
+// acquireRule returns current rules and count the call as in flight, nil if rules not exist
+func (entry *ProxyEntry) acquireRule() *rule {
+	for {
+		r := entry.getRule()
+		if r == nil {
+			return nil
+		}
+
+		// rules may be replaced before acquired, check it again so that retired rules would never serve new calls
+		r.acquire()
+		if entry.getRule() == r {
+			return r
+		}
+		r.release()
+	}
+}
+
+// director returns Director with current rules of proxy entry, rules in context should be released after call finished
+func (entry *ProxyEntry) director() Director {
+	return func(ctx context.Context) (context.Context, *grpc.ClientConn, error) {
+		r := entry.acquireRule()
+		if r == nil {
+			return nil, nil, status.Errorf(codes.Unimplemented, "Unknown method")
+		}
+
+		outgoingCtx, conn, err := r.GetDirector()(ctx)
+		if err != nil {
+			r.release()
+			return nil, nil, err
+		}
+
+		return context.WithValue(outgoingCtx, proxyRuleKey{}, r), conn, nil
+	}
+}
+
+// startPools start health check of upstream pools of rules
+func startPools(r *rule) {
+	if r == nil {
+		return
+	}
+
+	for _, pool := range r.pools() {
+		if pool != nil {
+			pool.start()
+		}
+	}
+}
+
+// streamHandler returns handler which proxy unknown services and record shadow calls of proxy entry
+func (entry *ProxyEntry) streamHandler() grpc.StreamHandler {
+	streamer := &handler{
+		director: entry.director(),
+		entry:    entry,
+	}
+	return streamer.handler
+}
+
+// registerReflection register grpc reflection which lists services of server and proxied services
+func (entry *ProxyEntry) registerReflection(server *grpc.Server) {
+	rpb.RegisterServerReflectionServer(server, reflection.NewServer(reflection.ServerOptions{
+		Services: &proxyServiceInfo{
+			server:      server,
+			descriptors: entry.descriptors,
+		},
+		DescriptorResolver: entry.descriptors,
+	}))
+}
+
+// registerGateway route HTTP rules of proxied methods to grpc server at address
+func (entry *ProxyEntry) registerGateway(mux *gwruntime.ServeMux, addr string, opts []grpc.DialOption) error {
+	if len(entry.gwRules) < 1 {
+		return nil
+	}
+
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return err
+	}
+	entry.gwConn = conn
+
+	return entry.registerGwRules(mux, conn)
 }
 
 // GetName Return name of proxy entry
@@ -457,19 +860,23 @@ var clientStreamDescForProxying = &grpc.StreamDesc{
 // backends. It should be used as a `grpc.UnknownServiceHandler`.
 //
 // This can *only* be used if the `server` also uses grpcproxy.CodecForServer() ServerOption.
+//
+// Calls would be copied to shadow destination returned by director, however, result of shadow calls would not
+// be recorded, use ProxyEntry instead.
 func TransparentHandler(director Director) grpc.StreamHandler {
-	streamer := &handler{director}
+	streamer := &handler{director: director}
 	return streamer.handler
 }
 
 type handler struct {
 	director Director
+	entry    *ProxyEntry
 }
 
 // handler is where the real magic of proxying happens.
 // It is invoked like any gRPC server stream and uses the gRPC server framing to get and receive bytes from the wire,
 // forwarding it to a ClientStream established against the relevant ClientConn.
-func (s *handler) handler(srv interface{}, serverStream grpc.ServerStream) error {
+func (s *handler) handler(srv interface{}, serverStream grpc.ServerStream) (err error) {
 	// little bit of gRPC internals never hurt anyone
 	fullMethodName, ok := grpc.MethodFromServerStream(serverStream)
 
@@ -481,20 +888,52 @@ func (s *handler) handler(srv interface{}, serverStream grpc.ServerStream) error
 	if err != nil {
 		return err
 	}
+	// rules would be retired after calls served by them finished
+	defer releaseProxyRule(outgoingCtx)
+
+	// record metrics, trace, event and log of destination
+	call := newProxyCall(s.entry, serverStream.Context(), outgoingCtx, backendConn, fullMethodName)
+	defer func() {
+		call.finish(err)
+	}()
+
+	// forward metadata of caller with transforms of matched route
+	rt := getProxyRoute(outgoingCtx)
+	md := outgoingMetadata(serverStream.Context(), outgoingCtx, rt.requestTransform())
+	resTransform := rt.responseTransform()
 
-	clientCtx, clientCancel := context.WithCancel(outgoingCtx)
+	clientCtx, clientCancel := context.WithCancel(metadata.NewOutgoingContext(outgoingCtx, md))
+	defer clientCancel()
 	clientCtx = metadata.AppendToOutgoingContext(clientCtx, "X-Forwarded-For", rkmid.LocalIp.String)
+	clientCtx = call.injectTrace(clientCtx)
+
+	// retry and hedge call if request frames could be replayed, fallback to streaming if buffer limit exceeded
+	if policy := newReplayPolicy(rt); policy != nil && s.entry.isReplayable(fullMethodName) {
+		frames, complete, bufErr := bufferRequest(serverStream, policy.bufferBytes)
+		if bufErr != nil {
+			return status.Errorf(codes.Internal, "failed proxying s2c: %v", bufErr)
+		}
+
+		if complete {
+			return s.replay(serverStream, clientCtx, backendConn, fullMethodName, frames, policy, call, resTransform)
+		}
+		serverStream = &replayServerStream{ServerStream: serverStream, frames: frames}
+	}
 
 	clientStream, err := grpc.NewClientStream(clientCtx, clientStreamDescForProxying, backendConn, fullMethodName)
 
 	if err != nil {
 		return err
 	}
+
+	// copy request frames to shadow destination if exists
+	shadow := s.entry.startShadow(clientCtx, fullMethodName)
+
 	// Explicitly *do not close* s2cErrChan and c2sErrChan, otherwise the select below will not terminate.
 	// Channels do not have to be closed, it is just a control flow mechanism, see
 	// https://groups.google.com/forum/#!msg/golang-nuts/pZwdYRGxCIk/qpbHxRRPJdUJ
-	s2cErrChan := s.forwardServerToClient(serverStream, clientStream)
-	c2sErrChan := s.forwardClientToServer(clientStream, serverStream)
+	s2cErrChan := s.forwardServerToClient(serverStream, clientStream, shadow, call)
+	c2sErrChan := s.forwardClientToServer(clientStream, serverStream, call, resTransform)
 	// We don't know which side is going to stop sending first, so we need a select between the two.
 	for i := 0; i < 2; i++ {
 		select {
@@ -513,9 +952,7 @@ func (s *handler) handler(srv interface{}, serverStream grpc.ServerStream) error
 			}
 		case c2sErr := <-c2sErrChan:
 			// This happens when the clientStream has nothing else to offer (io.EOF), returned a gRPC error. In those two
-			// cases we may have received Trailers as part of the call. In case of other errors (stream closed) the trailers
-			// will be nil.
-			serverStream.SetTrailer(clientStream.Trailer())
+			// cases trailers have been set by forwardClientToServer.
 			// c2sErr will contain RPC error from client code. If not io.EOF return the RPC error as server stream error.
 			if c2sErr != io.EOF {
 				return c2sErr
@@ -526,12 +963,14 @@ func (s *handler) handler(srv interface{}, serverStream grpc.ServerStream) error
 	return status.Errorf(codes.Internal, "gRPC proxying should never reach this stage.")
 }
 
-func (s *handler) forwardClientToServer(src grpc.ClientStream, dst grpc.ServerStream) chan error {
+func (s *handler) forwardClientToServer(src grpc.ClientStream, dst grpc.ServerStream, call *proxyCall, transform *MetadataTransform) chan error {
 	ret := make(chan error, 1)
 	go func() {
 		f := &frame{}
 		for i := 0; ; i++ {
 			if err := src.RecvMsg(f); err != nil {
+				// In case of other errors (stream closed) the trailers will be nil.
+				dst.SetTrailer(transformResponse(dst.Context(), src.Trailer(), transform))
 				ret <- err // this can be io.EOF which is happy case
 				break
 			}
@@ -544,7 +983,7 @@ func (s *handler) forwardClientToServer(src grpc.ClientStream, dst grpc.ServerSt
 					ret <- err
 					break
 				}
-				if err := dst.SendHeader(md); err != nil {
+				if err := dst.SendHeader(transformResponse(dst.Context(), md, transform)); err != nil {
 					ret <- err
 					break
 				}
@@ -553,24 +992,28 @@ func (s *handler) forwardClientToServer(src grpc.ClientStream, dst grpc.ServerSt
 				ret <- err
 				break
 			}
+			call.addBytesReceived(len(f.payload))
 		}
 	}()
 	return ret
 }
 
-func (s *handler) forwardServerToClient(src grpc.ServerStream, dst grpc.ClientStream) chan error {
+func (s *handler) forwardServerToClient(src grpc.ServerStream, dst grpc.ClientStream, shadow *shadowCall, call *proxyCall) chan error {
 	ret := make(chan error, 1)
 	go func() {
+		defer shadow.closeSend()
 		f := &frame{}
 		for i := 0; ; i++ {
 			if err := src.RecvMsg(f); err != nil {
 				ret <- err // this can be io.EOF which is happy case
 				break
 			}
+			shadow.send(f.payload)
 			if err := dst.SendMsg(f); err != nil {
 				ret <- err
 				break
 			}
+			call.addBytesSent(len(f.payload))
 		}
 	}()
 	return ret
@@ -13,6 +13,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"testing"
+	"time"
 )
 
 type MockServerTransportStream struct {
@@ -37,20 +38,37 @@ func (m MockServerTransportStream) SetTrailer(md metadata.MD) error {
 
 func TestNewRule(t *testing.T) {
 	// without options
-	r := NewRule()
+	r := newUtRule(t)
 	assert.Empty(t, r.IpPattern)
 	assert.Empty(t, r.PathPattern)
 	assert.Empty(t, r.HeaderPattern)
 	assert.NotNil(t, r.rand)
 
 	// with options
-	r = NewRule(
+	r = newUtRule(t,
 		WithHeaderPatterns(&HeaderPattern{}),
 		WithPathPatterns(&PathPattern{}),
 		WithIpPatterns(&IpPattern{}))
 	assert.NotEmpty(t, r.HeaderPattern)
 	assert.NotEmpty(t, r.PathPattern)
 	assert.NotEmpty(t, r.IpPattern)
+
+	// invalid CIDR
+	r, err := NewRule(WithIpPatterns(&IpPattern{Cidrs: []string{"invalid"}}))
+	assert.Nil(t, r)
+	assert.NotNil(t, err)
+
+	// invalid path
+	r, err = NewRule(WithPathPatterns(&PathPattern{Paths: []string{"/ut.("}}))
+	assert.Nil(t, r)
+	assert.NotNil(t, err)
+
+	// invalid condition of composite pattern
+	r, err = NewRule(WithRoutePatterns(&RoutePattern{
+		Match: &Condition{Or: []*Condition{{Cidrs: []string{"10.0.0.0/33"}}}},
+	}))
+	assert.Nil(t, r)
+	assert.NotNil(t, err)
 }
 
 func TestRule_MathIpPattern(t *testing.T) {
@@ -59,30 +77,28 @@ func TestRule_MathIpPattern(t *testing.T) {
 		Dest:  []string{"0.0.0.0"},
 	}
 
-	r := NewRule(WithIpPatterns(ipPattern))
+	r := newUtRule(t, WithIpPatterns(ipPattern))
 
 	// match IP
 	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs("x-forwarded-remote-addr", "192.168.0.1:1949"))
-	matched, dest := r.matchIpPattern(ctx)
-	assert.True(t, matched)
-	assert.Equal(t, ipPattern.Dest[0], dest)
+	rt := r.match(ctx)
+	assert.NotNil(t, rt)
+	assert.Equal(t, ipPattern.Dest, rt.dest)
 
 	// failed to match IP
 	ctx = metadata.NewIncomingContext(context.TODO(), metadata.Pairs("x-forwarded-remote-addr", "10.0.0.1:1949"))
-	matched, dest = r.matchIpPattern(ctx)
-	assert.False(t, matched)
-	assert.Empty(t, dest)
+	rt = r.match(ctx)
+	assert.Nil(t, rt)
 
-	// invalid CIDR
-	invalidIpPattern := &IpPattern{
-		Cidrs: []string{"invalid"},
+	// plain IP
+	r = newUtRule(t, WithIpPatterns(&IpPattern{
+		Cidrs: []string{"10.0.0.1"},
 		Dest:  []string{"0.0.0.0"},
-	}
-	r = NewRule(WithIpPatterns(invalidIpPattern))
-	ctx = metadata.NewIncomingContext(context.TODO(), metadata.Pairs("x-forwarded-remote-addr", "192.168.0.1:1949"))
-	matched, dest = r.matchIpPattern(ctx)
-	assert.False(t, matched)
-	assert.Empty(t, dest)
+	}))
+	ctx = metadata.NewIncomingContext(context.TODO(), metadata.Pairs("x-forwarded-remote-addr", "10.0.0.1:1949"))
+	assert.NotNil(t, r.match(ctx))
+	ctx = metadata.NewIncomingContext(context.TODO(), metadata.Pairs("x-forwarded-remote-addr", "10.0.0.2:1949"))
+	assert.Nil(t, r.match(ctx))
 }
 
 func TestRule_MatchPathPattern(t *testing.T) {
@@ -91,23 +107,22 @@ func TestRule_MatchPathPattern(t *testing.T) {
 		Dest:  []string{"0.0.0.0"},
 	}
 
-	r := NewRule(WithPathPatterns(pathPattern))
+	r := newUtRule(t, WithPathPatterns(pathPattern))
 
 	// match path
 	ctx := grpc.NewContextWithServerTransportStream(context.TODO(), &MockServerTransportStream{
 		method: "ut-path",
 	})
-	matched, dest := r.matchPathPattern(ctx)
-	assert.True(t, matched)
-	assert.Equal(t, pathPattern.Dest[0], dest)
+	rt := r.match(ctx)
+	assert.NotNil(t, rt)
+	assert.Equal(t, pathPattern.Dest, rt.dest)
 
 	// failed to match path
 	ctx = grpc.NewContextWithServerTransportStream(context.TODO(), &MockServerTransportStream{
 		method: "not-matched",
 	})
-	matched, dest = r.matchPathPattern(ctx)
-	assert.False(t, matched)
-	assert.Empty(t, dest)
+	rt = r.match(ctx)
+	assert.Nil(t, rt)
 }
 
 func TestRule_MatchHeaderPattern(t *testing.T) {
@@ -119,24 +134,22 @@ func TestRule_MatchHeaderPattern(t *testing.T) {
 		Dest: []string{"0.0.0.0"},
 	}
 
-	r := NewRule(WithHeaderPatterns(headerPatter))
+	r := newUtRule(t, WithHeaderPatterns(headerPatter))
 
 	// without metadata
-	matched, dest := r.matchHeaderPattern(context.TODO())
-	assert.False(t, matched)
-	assert.Empty(t, dest)
+	rt := r.match(context.TODO())
+	assert.Nil(t, rt)
 
 	// match header
 	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs("key-1", "val-1", "key-2", "val-2", "key-3", "val-3"))
-	matched, dest = r.matchHeaderPattern(ctx)
-	assert.True(t, matched)
-	assert.Equal(t, headerPatter.Dest[0], dest)
+	rt = r.match(ctx)
+	assert.NotNil(t, rt)
+	assert.Equal(t, headerPatter.Dest, rt.dest)
 
 	// failed to match header
 	ctx = metadata.NewIncomingContext(context.TODO(), metadata.Pairs("key-1", "val-1"))
-	matched, dest = r.matchHeaderPattern(ctx)
-	assert.False(t, matched)
-	assert.Empty(t, dest)
+	rt = r.match(ctx)
+	assert.Nil(t, rt)
 }
 
 func TestRule_GetDirector(t *testing.T) {
@@ -146,7 +159,7 @@ func TestRule_GetDirector(t *testing.T) {
 		Dest:  []string{"0.0.0.0"},
 	}
 
-	r := NewRule(WithIpPatterns(ipPattern))
+	r := newUtRule(t, WithIpPatterns(ipPattern))
 
 	// match IP
 	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs("x-forwarded-remote-addr", "192.168.0.1:1949"))
@@ -160,7 +173,7 @@ func TestRule_GetDirector(t *testing.T) {
 		Paths: []string{"ut-path"},
 		Dest:  []string{"0.0.0.0"},
 	}
-	r = NewRule(WithPathPatterns(pathPattern))
+	r = newUtRule(t, WithPathPatterns(pathPattern))
 	ctx = grpc.NewContextWithServerTransportStream(context.TODO(), &MockServerTransportStream{
 		method: "ut-path",
 	})
@@ -177,7 +190,7 @@ func TestRule_GetDirector(t *testing.T) {
 		},
 		Dest: []string{"0.0.0.0"},
 	}
-	r = NewRule(WithHeaderPatterns(headerPatter))
+	r = newUtRule(t, WithHeaderPatterns(headerPatter))
 	ctx = metadata.NewIncomingContext(context.TODO(), metadata.Pairs("key-1", "val-1", "key-2", "val-2", "key-3", "val-3"))
 	ctx, conn, err = r.GetDirector()(ctx)
 	assert.NotNil(t, ctx)
@@ -185,7 +198,7 @@ func TestRule_GetDirector(t *testing.T) {
 	assert.Nil(t, err)
 
 	// failed to match any
-	r = NewRule()
+	r = newUtRule(t)
 	ctx, conn, err = r.GetDirector()(ctx)
 	assert.Nil(t, ctx)
 	assert.Nil(t, conn)
@@ -215,7 +228,7 @@ func TestNewProxyEntry(t *testing.T) {
 	assert.Equal(t, name, entry.entryName)
 	assert.Equal(t, logger, entry.LoggerEntry)
 	assert.Equal(t, event, entry.EventEntry)
-	assert.Equal(t, rule, entry.r)
+	assert.Equal(t, rule, entry.getRule())
 }
 
 func TestProxyEntry_Bootstrap(t *testing.T) {
@@ -240,6 +253,121 @@ func TestProxyEntry_String(t *testing.T) {
 	assert.NotEmpty(t, entry.String())
 }
 
+func TestRule_Retire(t *testing.T) {
+	r := newUtRule(t, WithPathPatterns(&PathPattern{
+		Paths: []string{"/ut.proxy.*"},
+		Dest:  []string{"localhost:1"},
+	}))
+	pool := r.PathPattern[0].pool
+
+	// pools would not be stopped until calls in flight finished
+	r.acquire()
+	go r.retire()
+	time.Sleep(2 * ruleRetireInterval)
+	assert.False(t, isUtPoolStopped(pool))
+
+	r.release()
+	assert.Eventually(t, func() bool {
+		return isUtPoolStopped(pool)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestProxyEntry_ReloadRule(t *testing.T) {
+	// first backend blocks until released
+	received, released := make(chan struct{}), make(chan struct{})
+	addrA, stopA := startUtBackend(t, func(srv interface{}, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&frame{}); err != nil {
+			return err
+		}
+		close(received)
+		<-released
+		return stream.SendMsg(&frame{payload: []byte("a")})
+	})
+	defer stopA()
+
+	addrB, stopB := startUtBackend(t, func(srv interface{}, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&frame{}); err != nil {
+			return err
+		}
+		return stream.SendMsg(&frame{payload: []byte("b")})
+	})
+	defer stopB()
+
+	newRule := func(dest string) *rule {
+		return newUtRule(t, WithPathPatterns(&PathPattern{
+			Paths: []string{"/ut.proxy.*"},
+			Dest:  []string{dest},
+		}))
+	}
+
+	entry := NewProxyEntry(WithRuleProxy(newRule(addrA)))
+	entry.Bootstrap(context.TODO())
+	prev := entry.getRule()
+
+	proxyAddr, stopProxy := startUtProxy(t, entry)
+	defer stopProxy()
+
+	conn, err := grpc.Dial(proxyAddr, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec())))
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// start call with previous rules
+	inFlight := make(chan *frame, 1)
+	go func() {
+		resp := &frame{}
+		assert.Nil(t, conn.Invoke(context.TODO(), "/ut.proxy.Echo/Echo", &frame{}, resp))
+		inFlight <- resp
+	}()
+	<-received
+
+	// new calls would be served by new rules
+	entry.ReloadRule(newRule(addrB))
+	assert.NotEqual(t, prev, entry.getRule())
+
+	resp := &frame{}
+	assert.Nil(t, conn.Invoke(context.TODO(), "/ut.proxy.Echo/Echo", &frame{}, resp))
+	assert.Equal(t, []byte("b"), resp.payload)
+
+	// call in flight would not be affected
+	time.Sleep(2 * ruleRetireInterval)
+	assert.False(t, isUtPoolStopped(prev.PathPattern[0].pool))
+
+	close(released)
+	assert.Equal(t, []byte("a"), (<-inFlight).payload)
+
+	assert.Eventually(t, func() bool {
+		return isUtPoolStopped(prev.PathPattern[0].pool)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// nil rules would be replaced with empty rules
+	entry.ReloadRule(nil)
+	err = conn.Invoke(context.TODO(), "/ut.proxy.Echo/Echo", &frame{}, &frame{})
+	assert.NotNil(t, err)
+}
+
+func TestProxyEntry_AcquireRule(t *testing.T) {
+	// without rules
+	entry := NewProxyEntry()
+	assert.Nil(t, entry.acquireRule())
+	_, _, err := entry.director()(context.TODO())
+	assert.NotNil(t, err)
+
+	// rules would be released if director failed
+	r := newUtRule(t)
+	entry = NewProxyEntry(WithRuleProxy(r))
+	_, _, err = entry.director()(newUtRouteContext("/ut.proxy.Echo/Echo", "10.0.0.1"))
+	assert.NotNil(t, err)
+	assert.Zero(t, r.inFlight)
+
+	assert.Equal(t, r, entry.acquireRule())
+	assert.Equal(t, int64(1), r.inFlight)
+	releaseProxyRule(context.WithValue(context.TODO(), proxyRuleKey{}, r))
+	assert.Zero(t, r.inFlight)
+
+	// noop without rules in context
+	releaseProxyRule(context.TODO())
+}
+
 func TestCodec(t *testing.T) {
 	assert.NotNil(t, Codec())
 }
@@ -260,3 +388,20 @@ func TestCodec_ReadYourWrites(t *testing.T) {
 	require.Equal(t, []byte{0x55}, out, "output and data must be the same")
 
 }
+
+// isUtPoolStopped returns true if pool is stopped
+func isUtPoolStopped(pool *upstreamPool) bool {
+	select {
+	case <-pool.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// newUtRule create rule with options, patterns must be valid
+func newUtRule(t *testing.T, opts ...ruleOption) *rule {
+	r, err := NewRule(opts...)
+	assert.Nil(t, err)
+	return r
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	gwruntime "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	rkgrpcapi "github.com/tegarajipangestu/rk-grpc/v2/boot/api/third_party/gen/v1"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"gopkg.in/yaml.v3"
+)
+
+// ReadGwMappingFile read HTTP rules from gateway mapping file.
+//
+// The file is the same format as rk_gw_mapping.proto which is used by protoc-gen-grpc-gateway, example:
+//
+//	type: google.api.Service
+//	config_version: 3
+//	http:
+//	  rules:
+//	    - selector: api.v1.Greeter.Greeter
+//	      get: /v1/greeter
+func ReadGwMappingFile(filePath string) ([]*annotations.HttpRule, error) {
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGwMapping(raw)
+}
+
+// parseGwMapping convert YAML into rkgrpcapi.GrpcAPIService and returns HTTP rules with additional bindings flattened
+func parseGwMapping(raw []byte) ([]*annotations.HttpRule, error) {
+	m := make(map[string]interface{})
+	if err := yaml.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &rkgrpcapi.GrpcAPIService{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(bytes, svc); err != nil {
+		return nil, err
+	}
+
+	res := make([]*annotations.HttpRule, 0)
+	for _, rule := range svc.GetHttp().GetRules() {
+		res = append(res, rule)
+		for _, binding := range rule.GetAdditionalBindings() {
+			// selector is not allowed in additional bindings, inherit from parent
+			binding.Selector = rule.GetSelector()
+			res = append(res, binding)
+		}
+	}
+
+	return res, nil
+}
+
+// httpMethodAndPattern returns HTTP method and path pattern of rule
+func httpMethodAndPattern(rule *annotations.HttpRule) (string, string) {
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		return http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		return http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		return http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		return http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Custom:
+		return p.Custom.GetKind(), p.Custom.GetPath()
+	}
+
+	return "", ""
+}
+
+// registerGwRules register HTTP rules into gateway mux, requests would be sent to proxy server with conn.
+//
+// Descriptors of methods are resolved from destinations at request time.
+func (entry *ProxyEntry) registerGwRules(mux *gwruntime.ServeMux, conn *grpc.ClientConn) error {
+	for _, rule := range entry.gwRules {
+		method, pattern := httpMethodAndPattern(rule)
+		if len(method) < 1 || len(pattern) < 1 {
+			return fmt.Errorf("invalid http rule of %s", rule.GetSelector())
+		}
+
+		index := strings.LastIndex(rule.GetSelector(), ".")
+		if index < 1 {
+			return fmt.Errorf("invalid selector %s", rule.GetSelector())
+		}
+
+		fullMethod := "/" + rule.GetSelector()[:index] + "/" + rule.GetSelector()[index+1:]
+
+		if err := mux.HandlePath(method, pattern, entry.gwHandler(mux, conn, rule, fullMethod, pattern)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gwHandler translate HTTP request into grpc request of proxied method
+func (entry *ProxyEntry) gwHandler(mux *gwruntime.ServeMux, conn *grpc.ClientConn, rule *annotations.HttpRule, fullMethod, pattern string) gwruntime.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+
+		inbound, outbound := gwruntime.MarshalerForRequest(mux, req)
+
+		desc, err := entry.descriptors.findMethod(rule.GetSelector())
+		if err == nil && (desc.IsStreamingClient() || desc.IsStreamingServer()) {
+			err = status.Errorf(codes.Unimplemented, "Streaming method %s is not supported by gateway", rule.GetSelector())
+		}
+		if err != nil {
+			gwruntime.HTTPError(ctx, mux, outbound, w, req, err)
+			return
+		}
+
+		in := dynamicpb.NewMessage(desc.Input())
+		out := dynamicpb.NewMessage(desc.Output())
+
+		if err := populateGwRequest(in, req, rule, pathParams, inbound); err != nil {
+			gwruntime.HTTPError(ctx, mux, outbound, w, req, status.Error(codes.InvalidArgument, err.Error()))
+			return
+		}
+
+		ctx, err = gwruntime.AnnotateContext(ctx, mux, req, fullMethod, gwruntime.WithHTTPPathPattern(pattern))
+		if err != nil {
+			gwruntime.HTTPError(ctx, mux, outbound, w, req, err)
+			return
+		}
+
+		var md gwruntime.ServerMetadata
+		err = conn.Invoke(ctx, fullMethod, in, out, grpc.Header(&md.HeaderMD), grpc.Trailer(&md.TrailerMD))
+		ctx = gwruntime.NewServerMetadataContext(ctx, md)
+		if err != nil {
+			gwruntime.HTTPError(ctx, mux, outbound, w, req, err)
+			return
+		}
+
+		var resp proto.Message = out
+		if len(rule.GetResponseBody()) > 0 {
+			fd := desc.Output().Fields().ByName(protoreflect.Name(rule.GetResponseBody()))
+			if fd == nil || fd.Message() == nil {
+				gwruntime.HTTPError(ctx, mux, outbound, w, req,
+					status.Errorf(codes.Internal, "Invalid response body %s", rule.GetResponseBody()))
+				return
+			}
+			resp = out.Get(fd).Message().Interface()
+		}
+
+		gwruntime.ForwardResponseMessage(ctx, mux, outbound, w, req, resp)
+	}
+}
+
+// populateGwRequest fill request message with body, path params and query params
+func populateGwRequest(msg *dynamicpb.Message, req *http.Request, rule *annotations.HttpRule, pathParams map[string]string, inbound gwruntime.Marshaler) error {
+	// 1: body
+	switch body := rule.GetBody(); body {
+	case "":
+	case "*":
+		if err := inbound.NewDecoder(req.Body).Decode(msg); err != nil && err != io.EOF {
+			return err
+		}
+	default:
+		fd := msg.Descriptor().Fields().ByName(protoreflect.Name(body))
+		if fd == nil || fd.Message() == nil {
+			return fmt.Errorf("invalid body field %s", body)
+		}
+		if err := inbound.NewDecoder(req.Body).Decode(msg.Mutable(fd).Message().Interface()); err != nil && err != io.EOF {
+			return err
+		}
+	}
+
+	// 2: path params
+	filter := make([][]string, 0)
+	for k, v := range pathParams {
+		if err := gwruntime.PopulateFieldFromPath(msg, k, v); err != nil {
+			return err
+		}
+		filter = append(filter, strings.Split(k, "."))
+	}
+
+	// 3: query params, fields in body would not be populated
+	if rule.GetBody() == "*" {
+		return nil
+	}
+
+	if len(rule.GetBody()) > 0 {
+		filter = append(filter, []string{rule.GetBody()})
+	}
+
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+
+	return gwruntime.PopulateQueryParameters(msg, req.Form, utilities.NewDoubleArray(filter))
+}
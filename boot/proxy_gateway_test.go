@@ -0,0 +1,141 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	gwruntime "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+)
+
+const utGwMapping = `
+type: google.api.Service
+config_version: 3
+
+http:
+  rules:
+    - selector: ut.proxy.Echo.Echo
+      post: /v1/echo/{name}
+      body: "*"
+      additional_bindings:
+        - get: /v1/echo/{name}
+    - selector: ut.proxy.Echo.EchoStream
+      get: /v1/echo-stream
+    - selector: ut.proxy.Echo.Missing
+      get: /v1/missing
+`
+
+func TestReadGwMappingFile(t *testing.T) {
+	// file not exist
+	_, err := ReadGwMappingFile("not-exist.yaml")
+	assert.NotNil(t, err)
+
+	// invalid file
+	filePath := path.Join(t.TempDir(), "gw-mapping.yaml")
+	assert.Nil(t, os.WriteFile(filePath, []byte("http: [invalid"), 0644))
+	_, err = ReadGwMappingFile(filePath)
+	assert.NotNil(t, err)
+
+	// valid file
+	assert.Nil(t, os.WriteFile(filePath, []byte(utGwMapping), 0644))
+	rules, err := ReadGwMappingFile(filePath)
+	assert.Nil(t, err)
+	assert.Len(t, rules, 4)
+
+	// additional binding inherit selector
+	assert.Equal(t, "ut.proxy.Echo.Echo", rules[1].GetSelector())
+	method, pattern := httpMethodAndPattern(rules[1])
+	assert.Equal(t, http.MethodGet, method)
+	assert.Equal(t, "/v1/echo/{name}", pattern)
+
+	method, pattern = httpMethodAndPattern(rules[0])
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "/v1/echo/{name}", pattern)
+}
+
+func TestProxyEntry_RegisterGateway(t *testing.T) {
+	backendAddr, stopBackend := startUtEchoBackend(t)
+	defer stopBackend()
+
+	rules, err := parseGwMapping([]byte(utGwMapping))
+	assert.Nil(t, err)
+
+	entry := NewProxyEntry(
+		WithRuleProxy(newUtRule(t, WithPathPatterns(&PathPattern{
+			Paths: []string{"/ut.proxy.*"},
+			Dest:  []string{backendAddr},
+		}))),
+		WithGwRulesProxy(rules...))
+	proxyAddr, stopProxy := startUtProxy(t, entry)
+	defer stopProxy()
+
+	mux := gwruntime.NewServeMux()
+	assert.Nil(t, entry.registerGateway(mux, proxyAddr, []grpc.DialOption{grpc.WithInsecure()}))
+
+	// case 1: path and query params
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/echo/ut-name?count=2", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertUtEchoResponse(t, w, "ut-name", 2)
+
+	// case 2: path params and body
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/echo/ut-name", strings.NewReader(`{"count":3}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertUtEchoResponse(t, w, "ut-name", 3)
+
+	// case 3: invalid body
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/echo/ut-name", strings.NewReader(`{"count":"invalid"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// case 4: streaming method
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/echo-stream", nil))
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+
+	// case 5: method not exist
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/missing", nil))
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestProxyEntry_RegisterGatewayWithInvalidRule(t *testing.T) {
+	// without rules
+	entry := NewProxyEntry()
+	assert.Nil(t, entry.registerGateway(gwruntime.NewServeMux(), "localhost:1", []grpc.DialOption{grpc.WithInsecure()}))
+	assert.Nil(t, entry.gwConn)
+
+	// without pattern
+	entry = NewProxyEntry(WithGwRulesProxy(&annotations.HttpRule{Selector: "ut.proxy.Echo.Echo"}))
+	assert.NotNil(t, entry.registerGateway(gwruntime.NewServeMux(), "localhost:1", []grpc.DialOption{grpc.WithInsecure()}))
+	entry.Interrupt(context.TODO())
+
+	// invalid selector
+	entry = NewProxyEntry(WithGwRulesProxy(&annotations.HttpRule{
+		Selector: "invalid",
+		Pattern:  &annotations.HttpRule_Get{Get: "/v1/invalid"},
+	}))
+	assert.NotNil(t, entry.registerGateway(gwruntime.NewServeMux(), "localhost:1", []grpc.DialOption{grpc.WithInsecure()}))
+	entry.Interrupt(context.TODO())
+}
+
+func assertUtEchoResponse(t *testing.T, w *httptest.ResponseRecorder, name string, count float64) {
+	resp := make(map[string]interface{})
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, name, resp["name"])
+	assert.Equal(t, count, resp["count"])
+}
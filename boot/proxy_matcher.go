@@ -0,0 +1,326 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	"google.golang.org/grpc"
+)
+
+// compilePaths compile regex of grpc methods, error would be returned if any of them is invalid
+func compilePaths(paths []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(paths))
+
+	for i := range paths {
+		re, err := regexp.Compile(paths[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %s in proxy rule, %v", paths[i], err)
+		}
+		res = append(res, re)
+	}
+
+	return res, nil
+}
+
+// compileCidrs parse CIDR of remote IPs, IP without mask would be treated as single host
+func compileCidrs(cidrs []string) ([]*net.IPNet, error) {
+	res := make([]*net.IPNet, 0, len(cidrs))
+
+	for i := range cidrs {
+		if ip := net.ParseIP(cidrs[i]); ip != nil {
+			if v4 := ip.To4(); v4 != nil {
+				res = append(res, &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)})
+			} else {
+				res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+			}
+			continue
+		}
+
+		_, subnet, err := net.ParseCIDR(cidrs[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s in proxy rule, %v", cidrs[i], err)
+		}
+		res = append(res, subnet)
+	}
+
+	return res, nil
+}
+
+// matchPaths returns true if grpc method in context matches any of regex
+func matchPaths(regexps []*regexp.Regexp, ctx context.Context) bool {
+	method, ok := grpc.Method(ctx)
+	if !ok {
+		return false
+	}
+
+	for i := range regexps {
+		if regexps[i].MatchString(method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchCidrs returns true if remote IP in context is in any of CIDR
+func matchCidrs(subnets []*net.IPNet, ctx context.Context) bool {
+	remoteIp, _, _ := rkgrpcmid.GetRemoteAddressSet(ctx)
+
+	ip := net.ParseIP(remoteIp)
+	if ip == nil {
+		return false
+	}
+
+	for i := range subnets {
+		if subnets[i].Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// routeIndex returns routes which may match request without checking all of them.
+//
+// Routes require remote IP in CIDR are indexed with ipTrie, routes require grpc method matches regex starts with ^
+// are indexed by literal prefix of regex, other routes would always be checked.
+type routeIndex struct {
+	ips     *ipTrie
+	paths   *prefixTrie
+	always  []int
+	indexed bool
+}
+
+// newRouteIndex build index of routes, value of index is position of route
+func newRouteIndex(routes []*route) *routeIndex {
+	idx := &routeIndex{
+		ips:    newIpTrie(),
+		paths:  newPrefixTrie(),
+		always: make([]int, 0),
+	}
+
+	for i, rt := range routes {
+		if len(rt.subnets) > 0 {
+			for _, subnet := range rt.subnets {
+				idx.ips.insert(subnet, i)
+			}
+			idx.indexed = true
+			continue
+		}
+
+		if prefixes, ok := literalPrefixes(rt.regexps); ok {
+			for _, prefix := range prefixes {
+				idx.paths.insert(prefix, i)
+			}
+			idx.indexed = true
+			continue
+		}
+
+		idx.always = append(idx.always, i)
+	}
+
+	return idx
+}
+
+// candidates returns sorted positions of routes which may match request in context
+func (idx *routeIndex) candidates(ctx context.Context) []int {
+	res := make([]int, 0, len(idx.always)+4)
+	res = append(res, idx.always...)
+
+	if idx.paths.size > 0 {
+		if method, ok := grpc.Method(ctx); ok {
+			res = idx.paths.collect(method, res)
+		}
+	}
+
+	if idx.ips.size > 0 {
+		remoteIp, _, _ := rkgrpcmid.GetRemoteAddressSet(ctx)
+		if ip := net.ParseIP(remoteIp); ip != nil {
+			res = idx.ips.collect(ip, res)
+		}
+	}
+
+	// routes would be checked in order, remove duplicates which have multiple CIDRs or paths matched
+	sort.Ints(res)
+	unique := res[:0]
+	for i := range res {
+		if i == 0 || res[i] != res[i-1] {
+			unique = append(unique, res[i])
+		}
+	}
+
+	return unique
+}
+
+// literalPrefixes returns literal prefixes of regex, false would be returned if any regex is not anchored with ^
+func literalPrefixes(regexps []*regexp.Regexp) ([]string, bool) {
+	if len(regexps) < 1 {
+		return nil, false
+	}
+
+	res := make([]string, 0, len(regexps))
+	for _, re := range regexps {
+		prefix, ok := literalPrefix(re.String())
+		if !ok {
+			return nil, false
+		}
+		res = append(res, prefix)
+	}
+
+	return res, true
+}
+
+// literalPrefix returns literal which string must start with to match regex, false would be returned if regex is not
+// anchored at beginning of text
+func literalPrefix(pattern string) (string, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+
+	if re.Op == syntax.OpBeginText {
+		return "", true
+	}
+
+	if re.Op != syntax.OpConcat || len(re.Sub) < 1 || re.Sub[0].Op != syntax.OpBeginText {
+		return "", false
+	}
+
+	prefix := strings.Builder{}
+	for _, sub := range re.Sub[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix.WriteString(string(sub.Rune))
+	}
+
+	return prefix.String(), true
+}
+
+// ipTrie is binary trie of CIDR, IPv4 would be stored as IPv4-mapped IPv6 address
+type ipTrie struct {
+	root *ipTrieNode
+	size int
+}
+
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	values   []int
+}
+
+func newIpTrie() *ipTrie {
+	return &ipTrie{
+		root: &ipTrieNode{},
+	}
+}
+
+// insert add value to node of CIDR
+func (t *ipTrie) insert(subnet *net.IPNet, value int) {
+	ip := subnet.IP.To16()
+	if ip == nil {
+		return
+	}
+
+	ones, bits := subnet.Mask.Size()
+	if bits == net.IPv4len*8 {
+		ones += (net.IPv6len - net.IPv4len) * 8
+	}
+
+	node := t.root
+	for i := 0; i < ones; i++ {
+		bit := ipBit(ip, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &ipTrieNode{}
+		}
+		node = node.children[bit]
+	}
+
+	node.values = append(node.values, value)
+	t.size++
+}
+
+// collect append values of all CIDR which contain IP
+func (t *ipTrie) collect(ip net.IP, res []int) []int {
+	ip = ip.To16()
+	if ip == nil {
+		return res
+	}
+
+	node := t.root
+	for i := 0; node != nil; i++ {
+		res = append(res, node.values...)
+		if i >= net.IPv6len*8 {
+			break
+		}
+		node = node.children[ipBit(ip, i)]
+	}
+
+	return res
+}
+
+// ipBit returns bit of IP at position from the highest bit
+func ipBit(ip net.IP, pos int) byte {
+	return ip[pos/8] >> (7 - uint(pos%8)) & 1
+}
+
+// prefixTrie is trie of string prefixes
+type prefixTrie struct {
+	root *prefixTrieNode
+	size int
+}
+
+type prefixTrieNode struct {
+	children map[byte]*prefixTrieNode
+	values   []int
+}
+
+func newPrefixTrie() *prefixTrie {
+	return &prefixTrie{
+		root: &prefixTrieNode{},
+	}
+}
+
+// insert add value to node of prefix
+func (t *prefixTrie) insert(prefix string, value int) {
+	node := t.root
+	for i := 0; i < len(prefix); i++ {
+		if node.children == nil {
+			node.children = make(map[byte]*prefixTrieNode)
+		}
+
+		child, ok := node.children[prefix[i]]
+		if !ok {
+			child = &prefixTrieNode{}
+			node.children[prefix[i]] = child
+		}
+		node = child
+	}
+
+	node.values = append(node.values, value)
+	t.size++
+}
+
+// collect append values of all prefixes of str
+func (t *prefixTrie) collect(str string, res []int) []int {
+	node := t.root
+	for i := 0; node != nil; i++ {
+		res = append(res, node.values...)
+		if i >= len(str) {
+			break
+		}
+		node = node.children[str[i]]
+	}
+
+	return res
+}
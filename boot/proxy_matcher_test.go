@@ -0,0 +1,213 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilePaths(t *testing.T) {
+	// valid
+	regexps, err := compilePaths([]string{"^/ut.v1.Greeter/", "/ut.*"})
+	assert.Nil(t, err)
+	assert.Len(t, regexps, 2)
+
+	// invalid
+	regexps, err = compilePaths([]string{"/ut.("})
+	assert.Nil(t, regexps)
+	assert.Contains(t, err.Error(), "/ut.(")
+}
+
+func TestCompileCidrs(t *testing.T) {
+	// CIDR and plain IP
+	subnets, err := compileCidrs([]string{"10.0.0.0/8", "192.168.0.1", "::1"})
+	assert.Nil(t, err)
+	assert.Len(t, subnets, 3)
+	assert.Equal(t, "10.0.0.0/8", subnets[0].String())
+	assert.Equal(t, "192.168.0.1/32", subnets[1].String())
+	assert.Equal(t, "::1/128", subnets[2].String())
+
+	// invalid
+	subnets, err = compileCidrs([]string{"10.0.0.0/8", "invalid"})
+	assert.Nil(t, subnets)
+	assert.Contains(t, err.Error(), "invalid")
+}
+
+func TestMatchPathsAndCidrs(t *testing.T) {
+	regexps, _ := compilePaths([]string{"^/ut.v1.Greeter/"})
+	subnets, _ := compileCidrs([]string{"10.0.0.0/8"})
+
+	assert.True(t, matchPaths(regexps, newUtRouteContext("/ut.v1.Greeter/Hello", "10.0.0.1")))
+	assert.False(t, matchPaths(regexps, newUtRouteContext("/ut.v2.Greeter/Hello", "10.0.0.1")))
+	assert.True(t, matchCidrs(subnets, newUtRouteContext("/ut.v1.Greeter/Hello", "10.0.0.1")))
+	assert.False(t, matchCidrs(subnets, newUtRouteContext("/ut.v1.Greeter/Hello", "192.168.0.1")))
+	assert.False(t, matchCidrs(subnets, newUtRouteContext("/ut.v1.Greeter/Hello", "invalid")))
+}
+
+func TestLiteralPrefixes(t *testing.T) {
+	// anchored
+	prefixes, ok := literalPrefixes([]*regexp.Regexp{
+		regexp.MustCompile(`^/ut\.v1\.Greeter/`),
+		regexp.MustCompile(`^/ut.*`),
+	})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"/ut.v1.Greeter/", "/ut"}, prefixes)
+
+	// anchored with literal in any case, alternation is not anchored
+	prefix, ok := literalPrefix(`^/ut\.v1(?i)\.greeter/.*`)
+	assert.True(t, ok)
+	assert.Equal(t, "/ut.v1", prefix)
+	_, ok = literalPrefix(`^/ut.v1|/ut.v2`)
+	assert.False(t, ok)
+
+	// not anchored
+	_, ok = literalPrefixes([]*regexp.Regexp{
+		regexp.MustCompile(`^/ut.*`),
+		regexp.MustCompile(`Hello$`),
+	})
+	assert.False(t, ok)
+
+	// empty
+	_, ok = literalPrefixes(nil)
+	assert.False(t, ok)
+}
+
+func TestIpTrie(t *testing.T) {
+	trie := newIpTrie()
+	subnets, _ := compileCidrs([]string{"10.0.0.0/8", "10.1.0.0/16", "10.1.1.1", "0.0.0.0/0", "fd00::/8"})
+	for i := range subnets {
+		trie.insert(subnets[i], i)
+	}
+	assert.Equal(t, 5, trie.size)
+
+	assert.Equal(t, []int{3, 0, 1, 2}, trie.collect(net.ParseIP("10.1.1.1"), []int{}))
+	assert.Equal(t, []int{3, 0}, trie.collect(net.ParseIP("10.2.0.1"), []int{}))
+	assert.Equal(t, []int{3}, trie.collect(net.ParseIP("192.168.0.1"), []int{}))
+	assert.Equal(t, []int{4}, trie.collect(net.ParseIP("fd00::1"), []int{}))
+	assert.Empty(t, trie.collect(net.ParseIP("fe80::1"), []int{}))
+}
+
+func TestPrefixTrie(t *testing.T) {
+	trie := newPrefixTrie()
+	trie.insert("/ut.v1.", 0)
+	trie.insert("/ut.v1.Greeter/", 1)
+	trie.insert("", 2)
+	assert.Equal(t, 3, trie.size)
+
+	assert.Equal(t, []int{2, 0, 1}, trie.collect("/ut.v1.Greeter/Hello", []int{}))
+	assert.Equal(t, []int{2, 0}, trie.collect("/ut.v1.Other/Hello", []int{}))
+	assert.Equal(t, []int{2}, trie.collect("/ut.v2.Greeter/Hello", []int{}))
+}
+
+func TestRouteIndex_Candidates(t *testing.T) {
+	r := newUtRule(t,
+		WithIpPatterns(&IpPattern{Cidrs: []string{"10.0.0.0/8", "10.1.0.0/16"}, Dest: []string{"localhost:1"}}),
+		WithPathPatterns(
+			&PathPattern{Paths: []string{`^/ut\.v1\.Greeter/`}, Dest: []string{"localhost:2"}},
+			&PathPattern{Paths: []string{"/ut.v2.*"}, Dest: []string{"localhost:3"}}),
+		WithHeaderPatterns(&HeaderPattern{Headers: map[string]string{"env": "canary"}, Dest: []string{"localhost:4"}}))
+	assert.True(t, r.index.indexed)
+
+	// routes are sorted as IP, path, header
+	assert.Equal(t, []int{0, 1, 2, 3}, r.index.candidates(newUtRouteContext("/ut.v1.Greeter/Hello", "10.1.0.1")))
+	assert.Equal(t, []int{1, 2, 3}, r.index.candidates(newUtRouteContext("/ut.v1.Greeter/Hello", "192.168.0.1")))
+	assert.Equal(t, []int{2, 3}, r.index.candidates(newUtRouteContext("/ut.v2.Greeter/Hello", "192.168.0.1")))
+
+	// matched in order of routes
+	assert.Equal(t, IpBased, r.match(newUtRouteContext("/ut.v1.Greeter/Hello", "10.1.0.1")).kind)
+	assert.Equal(t, "localhost:2", r.match(newUtRouteContext("/ut.v1.Greeter/Hello", "192.168.0.1")).dest[0])
+	assert.Equal(t, "localhost:3", r.match(newUtRouteContext("/ut.v2.Greeter/Hello", "192.168.0.1")).dest[0])
+	assert.Equal(t, HeaderBased, r.match(newUtRouteContext("/ut.v3.Greeter/Hello", "192.168.0.1", "env", "canary")).kind)
+	assert.Nil(t, r.match(newUtRouteContext("/ut.v3.Greeter/Hello", "192.168.0.1")))
+
+	// nothing could be indexed
+	r = newUtRule(t, WithPathPatterns(&PathPattern{Paths: []string{"/ut.*"}, Dest: []string{"localhost:1"}}))
+	assert.False(t, r.index.indexed)
+	assert.NotNil(t, r.match(newUtRouteContext("/ut.v1.Greeter/Hello", "10.0.0.1")))
+}
+
+// ************ Benchmark ************
+
+const utBenchmarkRoutes = 500
+
+func newUtBenchmarkIpRule(b *testing.B) *rule {
+	patterns := make([]*IpPattern, 0, utBenchmarkRoutes)
+	for i := 0; i < utBenchmarkRoutes; i++ {
+		patterns = append(patterns, &IpPattern{
+			Cidrs: []string{fmt.Sprintf("10.%d.%d.0/24", i/256, i%256)},
+			Dest:  []string{"localhost:1"},
+		})
+	}
+
+	r, err := NewRule(WithIpPatterns(patterns...))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return r
+}
+
+func newUtBenchmarkPathRule(b *testing.B, anchored bool) *rule {
+	patterns := make([]*PathPattern, 0, utBenchmarkRoutes)
+	for i := 0; i < utBenchmarkRoutes; i++ {
+		path := fmt.Sprintf(`/ut\.v%d\.Greeter/.*`, i)
+		if anchored {
+			path = "^" + path
+		}
+
+		patterns = append(patterns, &PathPattern{
+			Paths: []string{path},
+			Dest:  []string{"localhost:1"},
+		})
+	}
+
+	r, err := NewRule(WithPathPatterns(patterns...))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return r
+}
+
+func benchmarkRuleMatch(b *testing.B, r *rule, method, ip string) {
+	ctx := newUtRouteContext(method, ip)
+	if r.match(ctx) == nil {
+		b.Fatal("route not matched")
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.match(ctx)
+	}
+}
+
+func BenchmarkRule_MatchIp_Indexed(b *testing.B) {
+	benchmarkRuleMatch(b, newUtBenchmarkIpRule(b), "/ut.v1.Greeter/Hello", "10.1.243.1")
+}
+
+func BenchmarkRule_MatchIp_Linear(b *testing.B) {
+	r := newUtBenchmarkIpRule(b)
+	r.index = nil
+	benchmarkRuleMatch(b, r, "/ut.v1.Greeter/Hello", "10.1.243.1")
+}
+
+func BenchmarkRule_MatchPath_Indexed(b *testing.B) {
+	benchmarkRuleMatch(b, newUtBenchmarkPathRule(b, true), "/ut.v499.Greeter/Hello", "10.0.0.1")
+}
+
+func BenchmarkRule_MatchPath_Linear(b *testing.B) {
+	r := newUtBenchmarkPathRule(b, true)
+	r.index = nil
+	benchmarkRuleMatch(b, r, "/ut.v499.Greeter/Hello", "10.0.0.1")
+}
+
+func BenchmarkRule_MatchPath_NotAnchored(b *testing.B) {
+	benchmarkRuleMatch(b, newUtBenchmarkPathRule(b, false), "/ut.v499.Greeter/Hello", "10.0.0.1")
+}
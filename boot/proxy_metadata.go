@@ -0,0 +1,228 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// PeerRemoteIp remote IP of caller, forwarded addresses would be respected only from gateway or trusted proxies
+	PeerRemoteIp = "remoteIp"
+	// PeerRemotePort remote port of caller
+	PeerRemotePort = "remotePort"
+	// PeerRemoteAddr remote IP and port of caller
+	PeerRemoteAddr = "remoteAddr"
+	// PeerSubject subject of client certificate
+	PeerSubject = "peerSubject"
+)
+
+// BootConfigProxyMetadata Boot config of metadata transforms of proxy rule.
+//
+// 1: Request: Transforms of metadata sent to destination.
+// 2: Response: Transforms of headers and trailers sent back to caller.
+type BootConfigProxyMetadata struct {
+	Request  BootConfigProxyTransform `yaml:"request" json:"request"`
+	Response BootConfigProxyTransform `yaml:"response" json:"response"`
+}
+
+// ToMetadataRule convert BootConfigProxyMetadata into MetadataRule
+func (boot *BootConfigProxyMetadata) ToMetadataRule() *MetadataRule {
+	res := &MetadataRule{
+		Request:  boot.Request.ToMetadataTransform(),
+		Response: boot.Response.ToMetadataTransform(),
+	}
+
+	if res.Request == nil && res.Response == nil {
+		return nil
+	}
+
+	return res
+}
+
+// BootConfigProxyTransform Boot config of metadata transform.
+//
+// Transforms would be applied in order of remove, rename, copyFromPeer, set and add.
+// 1: Remove: Keys to remove, key ends with * would remove keys with the same prefix.
+// 2: Rename: Keys to rename as old:new.
+// 3: CopyFromPeer: Keys set from peer info as key:field, options: remoteIp, remotePort, remoteAddr, peerSubject.
+// 4: Set: Keys to set as key:value, existing values would be replaced.
+// 5: Add: Keys to append as key:value.
+type BootConfigProxyTransform struct {
+	Remove       []string `yaml:"remove" json:"remove"`
+	Rename       []string `yaml:"rename" json:"rename"`
+	CopyFromPeer []string `yaml:"copyFromPeer" json:"copyFromPeer"`
+	Set          []string `yaml:"set" json:"set"`
+	Add          []string `yaml:"add" json:"add"`
+}
+
+// ToMetadataTransform convert BootConfigProxyTransform into MetadataTransform, nil would be returned if empty
+func (boot *BootConfigProxyTransform) ToMetadataTransform() *MetadataTransform {
+	res := &MetadataTransform{
+		Remove:       boot.Remove,
+		Rename:       parseHeaderPairs(boot.Rename),
+		CopyFromPeer: parseHeaderPairs(boot.CopyFromPeer),
+		Set:          parseHeaderPairs(boot.Set),
+		Add:          parseHeaderPairs(boot.Add),
+	}
+
+	if res.isEmpty() {
+		return nil
+	}
+
+	return res
+}
+
+// MetadataRule defines transforms of request and response metadata of proxy rule.
+type MetadataRule struct {
+	Request  *MetadataTransform
+	Response *MetadataTransform
+}
+
+// MetadataTransform defines how metadata would be rewritten.
+//
+// Transforms would be applied in order of Remove, Rename, CopyFromPeer, Set and Add.
+// Addresses forwarded by TrustedProxies would be copied from peer, transport peer would be used otherwise.
+type MetadataTransform struct {
+	Remove         []string
+	Rename         map[string]string
+	CopyFromPeer   map[string]string
+	Set            map[string]string
+	Add            map[string]string
+	TrustedProxies []*net.IPNet
+}
+
+// trust set trusted proxies of request and response transforms which have none
+func (m *MetadataRule) trust(proxies []*net.IPNet) {
+	if m == nil {
+		return
+	}
+
+	for _, t := range []*MetadataTransform{m.Request, m.Response} {
+		if t != nil && len(t.TrustedProxies) < 1 {
+			t.TrustedProxies = proxies
+		}
+	}
+}
+
+// isEmpty returns true if there is no transforms
+func (t *MetadataTransform) isEmpty() bool {
+	return t == nil ||
+		len(t.Remove)+len(t.Rename)+len(t.CopyFromPeer)+len(t.Set)+len(t.Add) < 1
+}
+
+// apply transforms on metadata, peer info would be read from context of caller
+func (t *MetadataTransform) apply(ctx context.Context, md metadata.MD) {
+	if t == nil || md == nil {
+		return
+	}
+
+	for _, key := range t.Remove {
+		key = strings.ToLower(key)
+		if prefix := strings.TrimSuffix(key, "*"); prefix != key {
+			for k := range md {
+				if strings.HasPrefix(k, prefix) {
+					delete(md, k)
+				}
+			}
+			continue
+		}
+		md.Delete(key)
+	}
+
+	for from, to := range t.Rename {
+		if v := md.Get(from); len(v) > 0 {
+			md.Delete(from)
+			md.Append(to, v...)
+		}
+	}
+
+	for key, field := range t.CopyFromPeer {
+		if v := peerValue(ctx, field, t.TrustedProxies); len(v) > 0 {
+			md.Set(key, v)
+		}
+	}
+
+	for key, value := range t.Set {
+		md.Set(key, value)
+	}
+
+	for key, value := range t.Add {
+		md.Append(key, value)
+	}
+}
+
+// peerValue returns field of peer info of caller, addresses forwarded by trusted proxies would be respected
+func peerValue(ctx context.Context, field string, trustedProxies []*net.IPNet) string {
+	ip, port := rkgrpcmid.GetPeerAddressSet(ctx, trustedProxies)
+
+	switch field {
+	case PeerRemoteIp:
+		return ip
+	case PeerRemotePort:
+		return port
+	case PeerRemoteAddr:
+		return net.JoinHostPort(ip, port)
+	case PeerSubject:
+		return rkgrpcctx.GetPeerSubject(ctx)
+	}
+
+	return ""
+}
+
+// requestTransform returns transform of request metadata of route, nil if not exist
+func (rt *route) requestTransform() *MetadataTransform {
+	if rt == nil || rt.metadata == nil {
+		return nil
+	}
+
+	return rt.metadata.Request
+}
+
+// responseTransform returns transform of response metadata of route, nil if not exist
+func (rt *route) responseTransform() *MetadataTransform {
+	if rt == nil || rt.metadata == nil {
+		return nil
+	}
+
+	return rt.metadata.Response
+}
+
+// outgoingMetadata returns metadata forwarded to destination, which is incoming metadata of caller and
+// outgoing metadata provided by director, pseudo headers like :authority would be ignored
+func outgoingMetadata(serverCtx, outgoingCtx context.Context, transform *MetadataTransform) metadata.MD {
+	incoming, _ := metadata.FromIncomingContext(serverCtx)
+	outgoing, _ := metadata.FromOutgoingContext(outgoingCtx)
+
+	md := metadata.Join(incoming, outgoing)
+	for k := range md {
+		if strings.HasPrefix(k, ":") {
+			delete(md, k)
+		}
+	}
+
+	transform.apply(serverCtx, md)
+
+	return md
+}
+
+// transformResponse returns copy of header or trailer of destination with transforms applied
+func transformResponse(ctx context.Context, md metadata.MD, transform *MetadataTransform) metadata.MD {
+	if transform == nil {
+		return md
+	}
+
+	md = md.Copy()
+	transform.apply(ctx, md)
+
+	return md
+}
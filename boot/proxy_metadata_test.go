@@ -0,0 +1,193 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestBootConfigProxyMetadata_ToMetadataRule(t *testing.T) {
+	// empty
+	boot := &BootConfigProxyMetadata{}
+	assert.Nil(t, boot.ToMetadataRule())
+
+	boot.Request = BootConfigProxyTransform{
+		Remove:       []string{"authorization"},
+		Rename:       []string{"x-old:x-new"},
+		CopyFromPeer: []string{"x-client-ip:remoteIp"},
+		Set:          []string{"x-env:prod"},
+		Add:          []string{"x-tenant:acme"},
+	}
+	rule := boot.ToMetadataRule()
+	assert.Nil(t, rule.Response)
+	assert.Equal(t, []string{"authorization"}, rule.Request.Remove)
+	assert.Equal(t, map[string]string{"x-old": "x-new"}, rule.Request.Rename)
+	assert.Equal(t, map[string]string{"x-client-ip": PeerRemoteIp}, rule.Request.CopyFromPeer)
+	assert.Equal(t, map[string]string{"x-env": "prod"}, rule.Request.Set)
+	assert.Equal(t, map[string]string{"x-tenant": "acme"}, rule.Request.Add)
+}
+
+func TestMetadataTransform_Apply(t *testing.T) {
+	// forwarded by gateway of entry over loopback
+	ctx := peer.NewContext(newUtRouteContext("/ut.proxy.Echo/Echo", "10.0.0.1"),
+		&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080}})
+
+	// nil transform is noop
+	var transform *MetadataTransform
+	md := metadata.Pairs("k", "v")
+	transform.apply(ctx, md)
+	assert.Equal(t, metadata.Pairs("k", "v"), md)
+
+	transform = &MetadataTransform{
+		Remove:       []string{"Authorization", "x-internal-*"},
+		Rename:       map[string]string{"x-old": "x-new", "x-missing": "x-other"},
+		CopyFromPeer: map[string]string{"x-client-ip": PeerRemoteIp, "x-client-addr": PeerRemoteAddr, "x-invalid": "invalid"},
+		Set:          map[string]string{"x-env": "prod"},
+		Add:          map[string]string{"x-tenant": "acme"},
+	}
+	md = metadata.Pairs(
+		"authorization", "ut-token",
+		"x-internal-user", "ut-user",
+		"x-internal-role", "ut-role",
+		"x-old", "ut-old",
+		"x-env", "test",
+		"x-tenant", "ut-tenant",
+		"x-keep", "ut-keep")
+	transform.apply(ctx, md)
+
+	assert.Equal(t, metadata.Pairs(
+		"x-new", "ut-old",
+		"x-client-ip", "10.0.0.1",
+		"x-client-addr", "10.0.0.1:1949",
+		"x-env", "prod",
+		"x-tenant", "ut-tenant",
+		"x-tenant", "acme",
+		"x-keep", "ut-keep"), md)
+}
+
+func TestMetadataTransform_ApplyWithTrustedProxies(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs("x-forwarded-for", "1.1.1.1"))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8080}})
+
+	// forwarded address of untrusted peer is ignored
+	transform := &MetadataTransform{CopyFromPeer: map[string]string{"x-client-ip": PeerRemoteIp}}
+	md := metadata.MD{}
+	transform.apply(ctx, md)
+	assert.Equal(t, []string{"10.0.0.1"}, md.Get("x-client-ip"))
+
+	// trusted by rule
+	trusted := []*net.IPNet{{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}}
+	rule, err := NewRule(WithTrustedProxies(trusted...), WithDefaultPattern(&RoutePattern{
+		Dest:     []string{"localhost:1949"},
+		Metadata: &MetadataRule{Request: transform},
+	}))
+	assert.Nil(t, err)
+	defer rule.retire()
+
+	md = metadata.MD{}
+	transform.apply(ctx, md)
+	assert.Equal(t, []string{"1.1.1.1"}, md.Get("x-client-ip"))
+
+	// invalid trusted proxy
+	_, err = (&BootConfigProxy{TrustedProxies: []string{"ut-proxy"}}).ToRule()
+	assert.NotNil(t, err)
+}
+
+func TestOutgoingMetadata(t *testing.T) {
+	serverCtx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(
+		":authority", "localhost",
+		"authorization", "ut-token",
+		"x-user", "ut-user"))
+	outgoingCtx := metadata.NewOutgoingContext(serverCtx, metadata.Pairs("x-director", "ut-director"))
+
+	md := outgoingMetadata(serverCtx, outgoingCtx, &MetadataTransform{Remove: []string{"authorization"}})
+	assert.Equal(t, metadata.Pairs("x-user", "ut-user", "x-director", "ut-director"), md)
+}
+
+func TestTransformResponse(t *testing.T) {
+	md := metadata.Pairs("x-internal", "ut-value")
+
+	// without transform
+	assert.Equal(t, md, transformResponse(context.TODO(), md, nil))
+
+	// original metadata would not be changed
+	res := transformResponse(context.TODO(), md, &MetadataTransform{Rename: map[string]string{"x-internal": "x-public"}})
+	assert.Equal(t, metadata.Pairs("x-public", "ut-value"), res)
+	assert.Equal(t, metadata.Pairs("x-internal", "ut-value"), md)
+
+	// nil metadata
+	res = transformResponse(context.TODO(), nil, &MetadataTransform{Set: map[string]string{"x-public": "ut-value"}})
+	assert.Equal(t, metadata.Pairs("x-public", "ut-value"), res)
+}
+
+func TestProxyEntry_MetadataTransform(t *testing.T) {
+	// backend records request metadata, returns header and trailer
+	backendMD := make(chan metadata.MD, 1)
+	backendAddr, stopBackend := startUtBackend(t, func(srv interface{}, stream grpc.ServerStream) error {
+		f := &frame{}
+		if err := stream.RecvMsg(f); err != nil {
+			return err
+		}
+
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		backendMD <- md
+
+		stream.SetHeader(metadata.Pairs("x-internal-header", "ut-header"))
+		stream.SetTrailer(metadata.Pairs("x-internal-trailer", "ut-trailer"))
+		return stream.SendMsg(f)
+	})
+	defer stopBackend()
+
+	proxyAddr, stopProxy := startUtProxy(t, NewProxyEntry(WithRuleProxy(newUtRule(t, WithPathPatterns(&PathPattern{
+		Paths: []string{"/ut.proxy.*"},
+		Dest:  []string{backendAddr},
+		Metadata: &MetadataRule{
+			Request: &MetadataTransform{
+				Remove: []string{"authorization"},
+				Rename: map[string]string{"x-old": "x-new"},
+				Add:    map[string]string{"x-tenant": "acme"},
+			},
+			Response: &MetadataTransform{
+				Remove: []string{"x-internal-header"},
+				Rename: map[string]string{"x-internal-trailer": "x-public-trailer"},
+			},
+		},
+	})))))
+	defer stopProxy()
+
+	conn, err := grpc.Dial(proxyAddr, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec())))
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.TODO(),
+		"authorization", "ut-token",
+		"x-old", "ut-old",
+		"x-keep", "ut-keep")
+	header, trailer := metadata.MD{}, metadata.MD{}
+	assert.Nil(t, conn.Invoke(ctx, "/ut.proxy.Echo/Echo", &frame{payload: []byte("ut-payload")}, &frame{},
+		grpc.Header(&header), grpc.Trailer(&trailer)))
+
+	// request metadata
+	md := <-backendMD
+	assert.Empty(t, md.Get("authorization"))
+	assert.Empty(t, md.Get("x-old"))
+	assert.Equal(t, []string{"ut-old"}, md.Get("x-new"))
+	assert.Equal(t, []string{"ut-keep"}, md.Get("x-keep"))
+	assert.Equal(t, []string{"acme"}, md.Get("x-tenant"))
+	assert.NotEmpty(t, md.Get("x-forwarded-for"))
+
+	// response header and trailer
+	assert.Empty(t, header.Get("x-internal-header"))
+	assert.Empty(t, trailer.Get("x-internal-trailer"))
+	assert.Equal(t, []string{"ut-trailer"}, trailer.Get("x-public-trailer"))
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	proxyElapsedNano   = "elapsedNano"
+	proxyResCode       = "resCode"
+	proxyBytesSent     = "bytesSent"
+	proxyBytesReceived = "bytesReceived"
+)
+
+// proxyElapsedBuckets are buckets of latency histogram from 1ms to 16s in nanoseconds
+var proxyElapsedBuckets = prometheus.ExponentialBuckets(float64(time.Millisecond), 2, 15)
+
+// proxyRouteKey is key of matched route in context returned by director
+type proxyRouteKey struct{}
+
+// withProxyRoute attach matched route into context
+func withProxyRoute(ctx context.Context, rt *route) context.Context {
+	return context.WithValue(ctx, proxyRouteKey{}, rt)
+}
+
+// getProxyRoute returns matched route in context, nil if not exist
+func getProxyRoute(ctx context.Context) *route {
+	if ctx == nil {
+		return nil
+	}
+
+	if v, ok := ctx.Value(proxyRouteKey{}).(*route); ok {
+		return v
+	}
+
+	return nil
+}
+
+// registerMetrics register metrics of proxied calls and shadow calls
+func (entry *ProxyEntry) registerMetrics() {
+	entry.metricsSet.RegisterHistogram(proxyElapsedNano, proxyElapsedBuckets, "rule", "dest", "method", "code")
+	entry.metricsSet.RegisterCounter(proxyResCode, "rule", "dest", "method", "code")
+	entry.metricsSet.RegisterCounter(proxyBytesSent, "rule", "dest", "method")
+	entry.metricsSet.RegisterCounter(proxyBytesReceived, "rule", "dest", "method")
+	entry.registerShadowMetrics()
+}
+
+// proxyCall records metrics, trace, event and log of a call forwarded to destination
+type proxyCall struct {
+	entry         *ProxyEntry
+	ctx           context.Context
+	rule          string
+	dest          string
+	method        string
+	startTime     time.Time
+	span          trace.Span
+	attempts      int
+	bytesSent     int64
+	bytesReceived int64
+}
+
+// newProxyCall create proxyCall with context of server stream and context returned by director
+func newProxyCall(entry *ProxyEntry, serverCtx, outgoingCtx context.Context, conn *grpc.ClientConn, method string) *proxyCall {
+	call := &proxyCall{
+		entry:     entry,
+		ctx:       serverCtx,
+		dest:      conn.Target(),
+		method:    method,
+		startTime: time.Now(),
+	}
+
+	if rt := getProxyRoute(outgoingCtx); rt != nil {
+		call.rule = rt.name
+	}
+
+	return call
+}
+
+// injectTrace start client span of destination and inject it into outgoing metadata if tracing is enabled
+func (c *proxyCall) injectTrace(ctx context.Context) context.Context {
+	propagator := rkgrpcctx.GetTracerPropagator(c.ctx)
+	if propagator == nil {
+		return ctx
+	}
+
+	spanCtx, span := rkgrpcctx.GetTracer(c.ctx).Start(c.ctx, c.method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("proxy.rule", c.rule),
+			attribute.String("proxy.dest", c.dest)))
+	c.span = span
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	propagator.Inject(spanCtx, &rkgrpcctx.GrpcMetadataCarrier{Md: &md})
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// addBytesSent count bytes forwarded to destination
+func (c *proxyCall) addBytesSent(n int) {
+	atomic.AddInt64(&c.bytesSent, int64(n))
+}
+
+// addBytesReceived count bytes forwarded from destination
+func (c *proxyCall) addBytesReceived(n int) {
+	atomic.AddInt64(&c.bytesReceived, int64(n))
+}
+
+// finish end span and record result of call into event, log and prometheus
+func (c *proxyCall) finish(err error) {
+	elapsed := time.Since(c.startTime)
+	code := status.Code(err)
+
+	if c.span != nil {
+		c.span.SetAttributes(
+			attribute.Int("grpc.code", int(code)),
+			attribute.String("grpc.status", code.String()))
+		if err != nil {
+			c.span.SetStatus(otelcodes.Error, status.Convert(err).Message())
+		} else {
+			c.span.SetStatus(otelcodes.Ok, otelcodes.Ok.String())
+		}
+		c.span.End()
+	}
+
+	// destination in event and log of request
+	rkgrpcctx.GetEvent(c.ctx).AddPayloads(
+		zap.String("proxyRule", c.rule),
+		zap.String("proxyDest", c.dest))
+	if c.attempts > 1 {
+		rkgrpcctx.GetEvent(c.ctx).AddPayloads(zap.Int("proxyAttempts", c.attempts))
+	}
+
+	fields := []zap.Field{
+		zap.String("proxyRule", c.rule),
+		zap.String("proxyDest", c.dest),
+		zap.String("grpcMethod", c.method),
+		zap.String("resCode", code.String()),
+		zap.Int64("elapsedNano", elapsed.Nanoseconds()),
+	}
+	if err != nil {
+		rkgrpcctx.GetLogger(c.ctx).Warn("Failed to proxy call", append(fields, zap.Error(err))...)
+	} else {
+		rkgrpcctx.GetLogger(c.ctx).Debug("Proxied call", fields...)
+	}
+
+	if c.entry == nil || c.entry.metricsSet == nil {
+		return
+	}
+
+	set := c.entry.metricsSet
+	if observer := set.GetHistogramWithValues(proxyElapsedNano, c.rule, c.dest, c.method, code.String()); observer != nil {
+		observer.Observe(float64(elapsed.Nanoseconds()))
+	}
+
+	if counter := set.GetCounterWithValues(proxyResCode, c.rule, c.dest, c.method, code.String()); counter != nil {
+		counter.Inc()
+	}
+
+	if counter := set.GetCounterWithValues(proxyBytesSent, c.rule, c.dest, c.method); counter != nil {
+		counter.Add(float64(atomic.LoadInt64(&c.bytesSent)))
+	}
+
+	if counter := set.GetCounterWithValues(proxyBytesReceived, c.rule, c.dest, c.method); counter != nil {
+		counter.Add(float64(atomic.LoadInt64(&c.bytesReceived)))
+	}
+}
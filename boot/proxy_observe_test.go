@@ -0,0 +1,136 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGetProxyRoute(t *testing.T) {
+	assert.Nil(t, getProxyRoute(nil))
+	assert.Nil(t, getProxyRoute(context.TODO()))
+
+	rt := &route{name: "ut-rule"}
+	assert.Equal(t, rt, getProxyRoute(withProxyRoute(context.TODO(), rt)))
+}
+
+func TestProxyCall_InjectTrace(t *testing.T) {
+	conn, err := grpc.Dial("localhost:1", grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// without tracing middleware
+	call := newProxyCall(nil, context.TODO(), context.TODO(), conn, "/ut.proxy.Echo/Echo")
+	ctx := call.injectTrace(context.TODO())
+	_, ok := metadata.FromOutgoingContext(ctx)
+	assert.False(t, ok)
+	assert.Nil(t, call.span)
+
+	// with propagator and parent span
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	serverCtx := rkgrpcmid.WrapContextForServer(trace.ContextWithRemoteSpanContext(context.TODO(), spanCtx))
+	rkgrpcmid.AddToServerContextPayload(serverCtx, rkmid.PropagatorKey, propagation.TraceContext{})
+
+	call = newProxyCall(nil, serverCtx, withProxyRoute(context.TODO(), &route{name: "ut-rule"}), conn, "/ut.proxy.Echo/Echo")
+	assert.Equal(t, "ut-rule", call.rule)
+	assert.Equal(t, "localhost:1", call.dest)
+
+	ctx = call.injectTrace(metadata.AppendToOutgoingContext(context.TODO(), "ut-key", "ut-value"))
+	md, _ := metadata.FromOutgoingContext(ctx)
+	assert.Equal(t, []string{"ut-value"}, md.Get("ut-key"))
+	assert.Contains(t, md.Get("traceparent")[0], spanCtx.TraceID().String())
+	assert.NotNil(t, call.span)
+
+	assert.NotPanics(t, func() {
+		call.finish(nil)
+	})
+}
+
+func TestProxyEntry_RecordCall(t *testing.T) {
+	backendAddr, stopBackend := startUtEchoBackend(t)
+	defer stopBackend()
+
+	registry := prometheus.NewRegistry()
+	entry := NewProxyEntry(
+		WithPromRegistryProxy(registry),
+		WithRuleProxy(newUtRule(t, WithPathPatterns(&PathPattern{
+			Paths: []string{"/ut.proxy.*"},
+			Dest:  []string{backendAddr},
+		}))))
+	proxyAddr, stopProxy := startUtProxy(t, entry)
+	defer stopProxy()
+
+	conn, err := grpc.Dial(proxyAddr, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec())))
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	resp := &frame{}
+	assert.Nil(t, conn.Invoke(context.TODO(), "/ut.proxy.Echo/Echo", &frame{payload: []byte("ut-payload")}, resp))
+
+	// metrics would be recorded after handler returned
+	assert.Eventually(t, func() bool {
+		return getUtProxyMetric(t, registry, "rk_proxy_resCode") != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	metric := getUtProxyMetric(t, registry, "rk_proxy_resCode")
+	assert.Equal(t, float64(1), metric.GetCounter().GetValue())
+	assertUtLabels(t, metric, map[string]string{
+		"rule":   PathBased + "-0",
+		"dest":   backendAddr,
+		"method": "/ut.proxy.Echo/Echo",
+		"code":   "OK",
+	})
+
+	metric = getUtProxyMetric(t, registry, "rk_proxy_elapsedNano")
+	assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+
+	metric = getUtProxyMetric(t, registry, "rk_proxy_bytesSent")
+	assert.Equal(t, float64(len("ut-payload")), metric.GetCounter().GetValue())
+
+	metric = getUtProxyMetric(t, registry, "rk_proxy_bytesReceived")
+	assert.Equal(t, float64(len("ut-payload")), metric.GetCounter().GetValue())
+}
+
+// ************ Test utility ************
+
+// getUtProxyMetric returns first metric of family, nil if not exist
+func getUtProxyMetric(t *testing.T, registry *prometheus.Registry, name string) *dto.Metric {
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0]
+		}
+	}
+
+	return nil
+}
+
+func assertUtLabels(t *testing.T, metric *dto.Metric, expected map[string]string) {
+	labels := make(map[string]string)
+	for _, label := range metric.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+
+	assert.Equal(t, expected, labels)
+}
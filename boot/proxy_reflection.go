@@ -0,0 +1,394 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	// descriptors would not be fetched from destinations more than once in this interval
+	descriptorRefreshInterval = 30 * time.Second
+	descriptorFetchTimeout    = 5 * time.Second
+)
+
+// proxyDescriptors fetch and cache descriptors of proxied services from destinations with grpc reflection.
+//
+// It implements protodesc.Resolver, local descriptors in protoregistry.GlobalFiles would be used first.
+// Descriptors are fetched in background, lookups of proxied calls never wait for fetching.
+// Cached descriptors are kept if some destinations failed to respond, so transient outages never wipe them.
+type proxyDescriptors struct {
+	r           *rule
+	logger      *zap.Logger
+	files       *protoregistry.Files
+	protos      map[string]*descriptorpb.FileDescriptorProto
+	services    map[string]bool
+	lastRefresh time.Time
+	refreshing  chan struct{}
+	lock        sync.RWMutex
+	refreshLock sync.Mutex
+}
+
+// newProxyDescriptors create proxyDescriptors, descriptors would be fetched lazily
+func newProxyDescriptors(r *rule, logger *zap.Logger) *proxyDescriptors {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &proxyDescriptors{
+		r:        r,
+		logger:   logger,
+		files:    new(protoregistry.Files),
+		protos:   make(map[string]*descriptorpb.FileDescriptorProto),
+		services: make(map[string]bool),
+	}
+}
+
+// FindFileByPath find file descriptor from local and destinations.
+//
+// It is used by reflection service, which would wait for descriptors being fetched if not found.
+func (d *proxyDescriptors) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fd, err := protoregistry.GlobalFiles.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+
+	if fd, err := d.getFiles().FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+
+	<-d.maybeRefresh()
+	return d.getFiles().FindFileByPath(path)
+}
+
+// FindDescriptorByName find descriptor from local and destinations.
+//
+// It is used by reflection service, which would wait for descriptors being fetched if not found.
+func (d *proxyDescriptors) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if desc, err := d.findDescriptor(name); err == nil {
+		return desc, nil
+	}
+
+	<-d.maybeRefresh()
+	return d.findDescriptor(name)
+}
+
+// findDescriptor find descriptor from local and cached descriptors of destinations without waiting
+func (d *proxyDescriptors) findDescriptor(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if desc, err := protoregistry.GlobalFiles.FindDescriptorByName(name); err == nil {
+		return desc, nil
+	}
+
+	return d.getFiles().FindDescriptorByName(name)
+}
+
+// findMethod find method descriptor with full name like package.Service.Method.
+//
+// It is used by proxied calls, cached descriptors would be used and refresh would be started in background
+// if not found.
+func (d *proxyDescriptors) findMethod(name string) (protoreflect.MethodDescriptor, error) {
+	desc, err := d.findDescriptor(protoreflect.FullName(name))
+	if err != nil {
+		d.maybeRefresh()
+		return nil, status.Errorf(codes.Unimplemented, "Method %s not found", name)
+	}
+
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "%s is not a method", name)
+	}
+
+	return method, nil
+}
+
+// listServices returns names of proxied services, it would wait for descriptors being fetched if stale
+func (d *proxyDescriptors) listServices() []string {
+	<-d.maybeRefresh()
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	res := make([]string, 0, len(d.services))
+	for k := range d.services {
+		res = append(res, k)
+	}
+
+	return res
+}
+
+func (d *proxyDescriptors) getFiles() *protoregistry.Files {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.files
+}
+
+// maybeRefresh start refresh in background if last refresh is older than descriptorRefreshInterval.
+//
+// Returned channel would be closed once running refresh finished, it is closed already if no refresh is running.
+func (d *proxyDescriptors) maybeRefresh() <-chan struct{} {
+	d.refreshLock.Lock()
+	defer d.refreshLock.Unlock()
+
+	if d.refreshing != nil {
+		return d.refreshing
+	}
+
+	if time.Since(d.lastRefresh) < descriptorRefreshInterval {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+
+	done := make(chan struct{})
+	d.refreshing = done
+	d.lastRefresh = time.Now()
+
+	go func(r *rule) {
+		d.refresh(r)
+
+		d.refreshLock.Lock()
+		defer d.refreshLock.Unlock()
+		d.refreshing = nil
+		close(done)
+	}(d.r)
+
+	return done
+}
+
+// setRule replace rules which provide destinations, descriptors would be fetched again in background
+func (d *proxyDescriptors) setRule(r *rule) {
+	d.refreshLock.Lock()
+	d.r = r
+	d.lastRefresh = time.Time{}
+	d.refreshLock.Unlock()
+
+	d.maybeRefresh()
+}
+
+// refresh fetch descriptors from all healthy destinations of rule.
+//
+// Cached descriptors are replaced only if every destination responded, otherwise fetched ones are merged into them.
+func (d *proxyDescriptors) refresh(r *rule) {
+	if r == nil {
+		return
+	}
+
+	protos := make(map[string]*descriptorpb.FileDescriptorProto)
+	services := make(map[string]bool)
+	visited := make(map[string]bool)
+	complete := true
+
+	for _, pool := range r.pools() {
+		if pool.isEmpty() {
+			continue
+		}
+
+		for _, u := range pool.upstreams {
+			if visited[u.addr] {
+				continue
+			}
+			visited[u.addr] = true
+
+			if !u.isHealthy() {
+				complete = false
+				continue
+			}
+
+			if err := fetchDescriptors(u, protos, services); err != nil {
+				complete = false
+				d.logger.Warn("Failed to fetch descriptors from destination",
+					zap.String("dest", u.addr),
+					zap.Error(err))
+			}
+		}
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !complete {
+		for name, fdp := range d.protos {
+			if _, ok := protos[name]; !ok {
+				protos[name] = fdp
+			}
+		}
+		for name := range d.services {
+			services[name] = true
+		}
+	}
+
+	files := new(protoregistry.Files)
+	for name := range protos {
+		if err := registerFileDescriptor(name, protos, files); err != nil {
+			d.logger.Warn("Failed to register descriptor fetched from destination",
+				zap.String("file", name),
+				zap.Error(err))
+		}
+	}
+
+	d.files = files
+	d.protos = protos
+	d.services = services
+}
+
+// fetchDescriptors list services of destination and fetch files contain these services with dependencies
+func fetchDescriptors(u *upstream, protos map[string]*descriptorpb.FileDescriptorProto, services map[string]bool) error {
+	conn, err := u.getConn()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), descriptorFetchTimeout)
+	defer cancel()
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 1: list services
+	resp, err := reflectionRoundTrip(stream, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// 2: fetch files contain services
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		// reflection service is served by proxy itself
+		if strings.HasPrefix(svc.GetName(), "grpc.reflection.") {
+			continue
+		}
+		services[svc.GetName()] = true
+
+		resp, err = reflectionRoundTrip(stream, &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: svc.GetName(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fdp := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(raw, fdp); err != nil {
+				return err
+			}
+			protos[fdp.GetName()] = fdp
+		}
+	}
+
+	return stream.CloseSend()
+}
+
+func reflectionRoundTrip(stream rpb.ServerReflection_ServerReflectionInfoClient, req *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	if errResp := resp.GetErrorResponse(); errResp != nil {
+		return nil, status.Error(codes.Code(errResp.GetErrorCode()), errResp.GetErrorMessage())
+	}
+
+	return resp, nil
+}
+
+// registerFileDescriptor register file after its dependencies, files exist in local would be skipped
+func registerFileDescriptor(name string, protos map[string]*descriptorpb.FileDescriptorProto, files *protoregistry.Files) error {
+	if _, err := protoregistry.GlobalFiles.FindFileByPath(name); err == nil {
+		return nil
+	}
+
+	if _, err := files.FindFileByPath(name); err == nil {
+		return nil
+	}
+
+	fdp, ok := protos[name]
+	if !ok {
+		return fmt.Errorf("file %s not found", name)
+	}
+
+	for _, dep := range fdp.GetDependency() {
+		if err := registerFileDescriptor(dep, protos, files); err != nil {
+			return err
+		}
+	}
+
+	fd, err := protodesc.NewFile(fdp, chainResolver{protoregistry.GlobalFiles, files})
+	if err != nil {
+		return err
+	}
+
+	return files.RegisterFile(fd)
+}
+
+// chainResolver find descriptors from resolvers in order
+type chainResolver []protodesc.Resolver
+
+// FindFileByPath returns first file found
+func (c chainResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	for i := range c {
+		if fd, err := c[i].FindFileByPath(path); err == nil {
+			return fd, nil
+		}
+	}
+
+	return nil, protoregistry.NotFound
+}
+
+// FindDescriptorByName returns first descriptor found
+func (c chainResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	for i := range c {
+		if desc, err := c[i].FindDescriptorByName(name); err == nil {
+			return desc, nil
+		}
+	}
+
+	return nil, protoregistry.NotFound
+}
+
+// proxyServiceInfo list services registered in server and services proxied to destinations
+type proxyServiceInfo struct {
+	server      reflection.ServiceInfoProvider
+	descriptors *proxyDescriptors
+}
+
+// GetServiceInfo returns service info, only names are available for proxied services
+func (p *proxyServiceInfo) GetServiceInfo() map[string]grpc.ServiceInfo {
+	res := make(map[string]grpc.ServiceInfo)
+
+	for _, name := range p.descriptors.listServices() {
+		res[name] = grpc.ServiceInfo{}
+	}
+
+	for k, v := range p.server.GetServiceInfo() {
+		res[k] = v
+	}
+
+	return res
+}
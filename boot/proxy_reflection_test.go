@@ -0,0 +1,283 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestProxyDescriptors_WithoutRule(t *testing.T) {
+	d := newProxyDescriptors(nil, nil)
+
+	// local descriptors
+	fd, err := d.FindFileByPath("reflection/grpc_reflection_v1alpha/reflection.proto")
+	assert.Nil(t, err)
+	assert.NotNil(t, fd)
+
+	desc, err := d.FindDescriptorByName("grpc.reflection.v1alpha.ServerReflection")
+	assert.Nil(t, err)
+	assert.NotNil(t, desc)
+
+	// not found
+	_, err = d.FindFileByPath("ut/not/exist.proto")
+	assert.NotNil(t, err)
+	_, err = d.findMethod("ut.not.Exist.Method")
+	assert.NotNil(t, err)
+	_, err = d.findMethod("grpc.reflection.v1alpha.ServerReflection")
+	assert.NotNil(t, err)
+
+	assert.Empty(t, d.listServices())
+}
+
+func TestProxyDescriptors_FromDestination(t *testing.T) {
+	backendAddr, stopBackend := startUtEchoBackend(t)
+	defer stopBackend()
+
+	d := newProxyDescriptors(newUtRule(t, WithPathPatterns(&PathPattern{
+		Paths: []string{"/ut.proxy.*"},
+		Dest:  []string{backendAddr, "localhost:1"},
+	})), nil)
+
+	// descriptors are fetched in background, proxied calls would not wait for it
+	_, err := d.findMethod("ut.proxy.Echo.Echo")
+	assert.NotNil(t, err)
+	<-d.maybeRefresh()
+
+	method, err := d.findMethod("ut.proxy.Echo.Echo")
+	assert.Nil(t, err)
+	assert.Equal(t, protoreflect.FullName("ut.proxy.EchoMessage"), method.Input().FullName())
+
+	fd, err := d.FindFileByPath("ut/proxy/echo.proto")
+	assert.Nil(t, err)
+	assert.NotNil(t, fd)
+
+	assert.Equal(t, []string{"ut.proxy.Echo"}, d.listServices())
+}
+
+func TestProxyDescriptors_WithFailedRefresh(t *testing.T) {
+	backendAddr, stopBackend := startUtEchoBackend(t)
+
+	d := newProxyDescriptors(newUtRule(t, WithPathPatterns(&PathPattern{
+		Paths: []string{"/ut.proxy.*"},
+		Dest:  []string{backendAddr},
+	})), nil)
+
+	<-d.maybeRefresh()
+	assert.Equal(t, []string{"ut.proxy.Echo"}, d.listServices())
+
+	// destination is down while refreshing, cached descriptors should be kept
+	stopBackend()
+	d.setRule(d.r)
+	<-d.maybeRefresh()
+
+	method, err := d.findMethod("ut.proxy.Echo.Echo")
+	assert.Nil(t, err)
+	assert.Equal(t, protoreflect.FullName("ut.proxy.EchoMessage"), method.Input().FullName())
+	assert.Equal(t, []string{"ut.proxy.Echo"}, d.listServices())
+}
+
+func TestProxyDescriptors_WithSlowDestination(t *testing.T) {
+	// destination accepts connection but never responds
+	lis, err := net.Listen("tcp", "localhost:0")
+	assert.Nil(t, err)
+	defer lis.Close()
+	go func() {
+		for {
+			if _, err := lis.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+
+	d := newProxyDescriptors(newUtRule(t, WithPathPatterns(&PathPattern{
+		Paths: []string{"/ut.proxy.*"},
+		Dest:  []string{lis.Addr().String()},
+	})), nil)
+
+	// lookup of proxied call should not wait for fetching
+	start := time.Now()
+	_, err = d.findMethod("ut.proxy.Echo.Echo")
+	assert.NotNil(t, err)
+	_, err = d.findMethod("ut.proxy.Echo.Echo")
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// refresh is still running in background
+	select {
+	case <-d.maybeRefresh():
+		assert.Fail(t, "refresh should be running")
+	default:
+	}
+}
+
+func TestProxyEntry_RegisterReflection(t *testing.T) {
+	backendAddr, stopBackend := startUtEchoBackend(t)
+	defer stopBackend()
+
+	proxyAddr, stopProxy := startUtProxy(t, NewProxyEntry(WithRuleProxy(newUtRule(t, WithPathPatterns(&PathPattern{
+		Paths: []string{"/ut.proxy.*"},
+		Dest:  []string{backendAddr},
+	})))))
+	defer stopProxy()
+
+	conn, err := grpc.Dial(proxyAddr, grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.TODO())
+	assert.Nil(t, err)
+
+	// list services
+	resp, err := reflectionRoundTrip(stream, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+	})
+	assert.Nil(t, err)
+
+	services := make([]string, 0)
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		services = append(services, svc.GetName())
+	}
+	assert.Contains(t, services, "ut.proxy.Echo")
+	assert.Contains(t, services, "grpc.reflection.v1alpha.ServerReflection")
+
+	// file of proxied service
+	resp, err = reflectionRoundTrip(stream, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: "ut.proxy.Echo",
+		},
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, resp.GetFileDescriptorResponse().GetFileDescriptorProto())
+}
+
+// ************ Test utility ************
+
+// utEchoFile returns descriptor of service ut.proxy.Echo which is not registered in protoregistry.GlobalFiles
+func utEchoFile(t *testing.T) protoreflect.FileDescriptor {
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("ut/proxy/echo.proto"),
+		Package: proto.String("ut.proxy"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("EchoMessage"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("name"),
+						JsonName: proto.String("name"),
+						Number:   proto.Int32(1),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					},
+					{
+						Name:     proto.String("count"),
+						JsonName: proto.String("count"),
+						Number:   proto.Int32(2),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					},
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Echo"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("Echo"),
+						InputType:  proto.String(".ut.proxy.EchoMessage"),
+						OutputType: proto.String(".ut.proxy.EchoMessage"),
+					},
+					{
+						Name:            proto.String("EchoStream"),
+						InputType:       proto.String(".ut.proxy.EchoMessage"),
+						OutputType:      proto.String(".ut.proxy.EchoMessage"),
+						ServerStreaming: proto.Bool(true),
+					},
+				},
+			},
+		},
+	}
+
+	fd, err := protodesc.NewFile(fdp, nil)
+	assert.Nil(t, err)
+
+	return fd
+}
+
+type utServiceInfo map[string]grpc.ServiceInfo
+
+func (u utServiceInfo) GetServiceInfo() map[string]grpc.ServiceInfo {
+	return u
+}
+
+// startUtEchoBackend start grpc server which echo raw request of ut.proxy.Echo with reflection enabled
+func startUtEchoBackend(t *testing.T) (string, func()) {
+	return startUtBackend(t, func(srv interface{}, stream grpc.ServerStream) error {
+		f := &frame{}
+		if err := stream.RecvMsg(f); err != nil {
+			return err
+		}
+		return stream.SendMsg(f)
+	})
+}
+
+// startUtBackend start grpc server which handle ut.proxy.Echo with handler and reflection enabled
+func startUtBackend(t *testing.T, handler grpc.StreamHandler) (string, func()) {
+	files := new(protoregistry.Files)
+	assert.Nil(t, files.RegisterFile(utEchoFile(t)))
+
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(Codec()),
+		grpc.UnknownServiceHandler(handler))
+
+	rpb.RegisterServerReflectionServer(server, reflection.NewServer(reflection.ServerOptions{
+		Services: utServiceInfo{
+			"ut.proxy.Echo": {},
+			"grpc.reflection.v1alpha.ServerReflection": {},
+		},
+		DescriptorResolver: files,
+	}))
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	assert.Nil(t, err)
+	go server.Serve(lis)
+
+	return lis.Addr().String(), server.Stop
+}
+
+// startUtProxy start grpc server which proxy unknown services with reflection enabled
+func startUtProxy(t *testing.T, entry *ProxyEntry) (string, func()) {
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(Codec()),
+		grpc.UnknownServiceHandler(entry.streamHandler()))
+	entry.registerReflection(server)
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	assert.Nil(t, err)
+	go server.Serve(lis)
+
+	// wait for descriptors fetched in background as Bootstrap does
+	<-entry.descriptors.maybeRefresh()
+
+	return lis.Addr().String(), func() {
+		server.Stop()
+		entry.Interrupt(context.TODO())
+	}
+}
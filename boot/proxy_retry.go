@@ -0,0 +1,475 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = time.Second
+	defaultRetryMultiplier     = 2.0
+	defaultHedgeDelay          = 100 * time.Millisecond
+	defaultHedgeMaxAttempts    = 2
+	defaultReplayBufferBytes   = 1 << 20
+	// number of previous attempts is added to metadata of retried and hedged attempts
+	previousAttemptsKey = "grpc-previous-rpc-attempts"
+)
+
+// RetryPolicy defines how proxied calls would be retried if destination failed.
+//
+// Calls would be retried only if request frames could be replayed, which means method is known by proxy with
+// grpc reflection, is not bidirectional streaming and request frames are less than buffer limit.
+type RetryPolicy struct {
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	RetryableCodes    []codes.Code
+}
+
+// HedgePolicy defines hedged attempts which would be sent if no response received within Delay.
+//
+// The first response would be used and other attempts would be canceled.
+type HedgePolicy struct {
+	Delay       time.Duration
+	MaxAttempts int
+}
+
+// BootConfigProxyRetry Boot config of retry policy of destinations.
+type BootConfigProxyRetry struct {
+	MaxAttempts       int      `yaml:"maxAttempts" json:"maxAttempts"`
+	InitialBackoffMs  int      `yaml:"initialBackoffMs" json:"initialBackoffMs"`
+	MaxBackoffMs      int      `yaml:"maxBackoffMs" json:"maxBackoffMs"`
+	BackoffMultiplier float64  `yaml:"backoffMultiplier" json:"backoffMultiplier"`
+	RetryableCodes    []string `yaml:"retryableCodes" json:"retryableCodes"`
+}
+
+// ToRetryPolicy convert BootConfigProxyRetry into RetryPolicy, nil would be returned if retry is disabled
+func (boot *BootConfigProxyRetry) ToRetryPolicy() *RetryPolicy {
+	if boot.MaxAttempts < 2 {
+		return nil
+	}
+
+	return &RetryPolicy{
+		MaxAttempts:       boot.MaxAttempts,
+		InitialBackoff:    time.Duration(boot.InitialBackoffMs) * time.Millisecond,
+		MaxBackoff:        time.Duration(boot.MaxBackoffMs) * time.Millisecond,
+		BackoffMultiplier: boot.BackoffMultiplier,
+		RetryableCodes:    parseCodes(boot.RetryableCodes),
+	}
+}
+
+// BootConfigProxyHedge Boot config of hedge policy of destinations.
+type BootConfigProxyHedge struct {
+	Enabled     bool `yaml:"enabled" json:"enabled"`
+	DelayMs     int  `yaml:"delayMs" json:"delayMs"`
+	MaxAttempts int  `yaml:"maxAttempts" json:"maxAttempts"`
+}
+
+// ToHedgePolicy convert BootConfigProxyHedge into HedgePolicy, nil would be returned if hedge is disabled
+func (boot *BootConfigProxyHedge) ToHedgePolicy() *HedgePolicy {
+	if !boot.Enabled {
+		return nil
+	}
+
+	return &HedgePolicy{
+		Delay:       time.Duration(boot.DelayMs) * time.Millisecond,
+		MaxAttempts: boot.MaxAttempts,
+	}
+}
+
+// parseCodes parse names of grpc codes like Unavailable or UNAVAILABLE, invalid names would be ignored
+func parseCodes(names []string) []codes.Code {
+	res := make([]codes.Code, 0)
+
+	for i := range names {
+		name := strings.ReplaceAll(strings.TrimSpace(names[i]), "_", "")
+		for c := codes.OK; c <= codes.Unauthenticated; c++ {
+			if strings.EqualFold(name, c.String()) {
+				res = append(res, c)
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+// normalizeReplay fill defaults of retry and hedge policies
+func normalizeReplay(config *UpstreamConfig) {
+	if config.ReplayBufferBytes <= 0 {
+		config.ReplayBufferBytes = defaultReplayBufferBytes
+	}
+
+	if retry := config.Retry; retry != nil {
+		if retry.MaxAttempts < 1 {
+			retry.MaxAttempts = defaultRetryMaxAttempts
+		}
+		if retry.InitialBackoff <= 0 {
+			retry.InitialBackoff = defaultRetryInitialBackoff
+		}
+		if retry.MaxBackoff <= 0 {
+			retry.MaxBackoff = defaultRetryMaxBackoff
+		}
+		if retry.BackoffMultiplier < 1 {
+			retry.BackoffMultiplier = defaultRetryMultiplier
+		}
+		if len(retry.RetryableCodes) < 1 {
+			retry.RetryableCodes = []codes.Code{codes.Unavailable}
+		}
+	}
+
+	if hedge := config.Hedge; hedge != nil {
+		if hedge.Delay <= 0 {
+			hedge.Delay = defaultHedgeDelay
+		}
+		if hedge.MaxAttempts < 2 {
+			hedge.MaxAttempts = defaultHedgeMaxAttempts
+		}
+	}
+}
+
+// replayPolicy combines retry and hedge policies of matched route
+type replayPolicy struct {
+	pool        *upstreamPool
+	maxAttempts int
+	bufferBytes int
+	retry       *RetryPolicy
+	hedgeDelay  time.Duration
+}
+
+// newReplayPolicy returns policy of route, nil if neither retry nor hedge is enabled
+func newReplayPolicy(rt *route) *replayPolicy {
+	if rt == nil || rt.pool == nil {
+		return nil
+	}
+
+	config := rt.pool.config
+	if config.Retry == nil && config.Hedge == nil {
+		return nil
+	}
+
+	p := &replayPolicy{
+		pool:        rt.pool,
+		maxAttempts: 1,
+		bufferBytes: config.ReplayBufferBytes,
+		retry:       config.Retry,
+	}
+
+	if config.Retry != nil {
+		p.maxAttempts = config.Retry.MaxAttempts
+	}
+
+	if config.Hedge != nil {
+		p.hedgeDelay = config.Hedge.Delay
+		if config.Hedge.MaxAttempts > p.maxAttempts {
+			p.maxAttempts = config.Hedge.MaxAttempts
+		}
+	}
+
+	if p.maxAttempts < 2 {
+		return nil
+	}
+
+	return p
+}
+
+// isRetryable returns true if another attempt could be sent after error
+func (p *replayPolicy) isRetryable(err error) bool {
+	code := status.Code(err)
+
+	if p.retry == nil {
+		return code == codes.Unavailable
+	}
+
+	for i := range p.retry.RetryableCodes {
+		if p.retry.RetryableCodes[i] == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns duration before next attempt with jitter of 20%
+func (p *replayPolicy) backoff(attempts int) time.Duration {
+	if p.retry == nil {
+		return defaultRetryInitialBackoff
+	}
+
+	backoff := float64(p.retry.InitialBackoff) * math.Pow(p.retry.BackoffMultiplier, float64(attempts-1))
+	if backoff > float64(p.retry.MaxBackoff) {
+		backoff = float64(p.retry.MaxBackoff)
+	}
+
+	return time.Duration(backoff * (0.8 + 0.4*rand.Float64()))
+}
+
+// nextConn pick upstream for next attempt
+func (p *replayPolicy) nextConn(ctx context.Context) (*grpc.ClientConn, error) {
+	up, err := p.pool.pick(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return up.getConn()
+}
+
+// isReplayable returns true if method is known and not bidirectional streaming
+func (entry *ProxyEntry) isReplayable(fullMethodName string) bool {
+	if entry == nil || entry.descriptors == nil {
+		return false
+	}
+
+	name := strings.TrimPrefix(fullMethodName, "/")
+	if i := strings.LastIndex(name, "/"); i > 0 {
+		name = name[:i] + "." + name[i+1:]
+	}
+
+	method, err := entry.descriptors.findMethod(name)
+	if err != nil {
+		return false
+	}
+
+	return !(method.IsStreamingClient() && method.IsStreamingServer())
+}
+
+// bufferRequest receive request frames until EOF or buffer limit exceeded
+func bufferRequest(src grpc.ServerStream, limit int) (frames [][]byte, complete bool, err error) {
+	size := 0
+
+	for size <= limit {
+		f := &frame{}
+		if err := src.RecvMsg(f); err != nil {
+			if err == io.EOF {
+				return frames, true, nil
+			}
+			return frames, false, err
+		}
+
+		frames = append(frames, f.payload)
+		size += len(f.payload)
+	}
+
+	return frames, false, nil
+}
+
+// replayServerStream returns buffered frames before receiving from server stream
+type replayServerStream struct {
+	grpc.ServerStream
+	frames [][]byte
+}
+
+// RecvMsg returns buffered frames first
+func (s *replayServerStream) RecvMsg(m interface{}) error {
+	if f, ok := m.(*frame); ok && len(s.frames) > 0 {
+		f.payload = s.frames[0]
+		s.frames = s.frames[1:]
+		return nil
+	}
+
+	return s.ServerStream.RecvMsg(m)
+}
+
+// replayAttempt sends buffered frames to destination and waits for the first response
+type replayAttempt struct {
+	conn   *grpc.ClientConn
+	ctx    context.Context
+	cancel context.CancelFunc
+	stream grpc.ClientStream
+	first  *frame
+	err    error
+}
+
+// newReplayAttempt create attempt with number of previous attempts in metadata
+func newReplayAttempt(parent context.Context, conn *grpc.ClientConn, previous int) *replayAttempt {
+	ctx, cancel := context.WithCancel(parent)
+	if previous > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, previousAttemptsKey, strconv.Itoa(previous))
+	}
+
+	return &replayAttempt{
+		conn:   conn,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// run send frames and report attempt into results
+func (a *replayAttempt) run(method string, frames [][]byte, results chan<- *replayAttempt) {
+	a.err = a.roundTrip(method, frames)
+	results <- a
+}
+
+// roundTrip send frames and receive the first response, io.EOF means there is no response message
+func (a *replayAttempt) roundTrip(method string, frames [][]byte) error {
+	stream, err := grpc.NewClientStream(a.ctx, clientStreamDescForProxying, a.conn, method)
+	if err != nil {
+		return err
+	}
+	a.stream = stream
+
+	// status of stream would be returned by RecvMsg if failed to send
+	for i := range frames {
+		if err := stream.SendMsg(&frame{payload: frames[i]}); err != nil {
+			break
+		}
+	}
+	stream.CloseSend()
+
+	f := &frame{}
+	if err := stream.RecvMsg(f); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	a.first = f
+
+	return nil
+}
+
+// commit forward header, responses and trailer of attempt to server stream
+func (a *replayAttempt) commit(dst grpc.ServerStream, call *proxyCall, transform *MetadataTransform) error {
+	if a.err != nil {
+		if a.stream != nil {
+			dst.SetTrailer(transformResponse(dst.Context(), a.stream.Trailer(), transform))
+		}
+		return a.err
+	}
+
+	md, err := a.stream.Header()
+	if err != nil {
+		return err
+	}
+	if err := dst.SendHeader(transformResponse(dst.Context(), md, transform)); err != nil {
+		return err
+	}
+
+	for f := a.first; f != nil; {
+		if err := dst.SendMsg(f); err != nil {
+			return err
+		}
+		call.addBytesReceived(len(f.payload))
+
+		if err := a.stream.RecvMsg(f); err != nil {
+			dst.SetTrailer(transformResponse(dst.Context(), a.stream.Trailer(), transform))
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+
+	dst.SetTrailer(transformResponse(dst.Context(), a.stream.Trailer(), transform))
+	return nil
+}
+
+// replay send buffered frames to destinations with retries and hedged attempts, the first successful
+// or non-retryable attempt would be committed
+func (s *handler) replay(serverStream grpc.ServerStream, clientCtx context.Context, conn *grpc.ClientConn,
+	method string, frames [][]byte, policy *replayPolicy, call *proxyCall, transform *MetadataTransform) error {
+	// shadow destination receives frames once
+	shadow := s.entry.startShadow(clientCtx, method)
+	for i := range frames {
+		shadow.send(frames[i])
+		call.addBytesSent(len(frames[i]))
+	}
+	shadow.closeSend()
+
+	results := make(chan *replayAttempt, policy.maxAttempts)
+	attempts := make([]*replayAttempt, 0, policy.maxAttempts)
+	defer func() {
+		for i := range attempts {
+			attempts[i].cancel()
+		}
+	}()
+
+	start := func(conn *grpc.ClientConn) {
+		a := newReplayAttempt(clientCtx, conn, len(attempts))
+		attempts = append(attempts, a)
+		go a.run(method, frames, results)
+	}
+
+	start(conn)
+	pending := 1
+
+	var hedgeC, retryC <-chan time.Time
+	var hedgeTimer, retryTimer *time.Timer
+	if policy.hedgeDelay > 0 {
+		hedgeTimer = time.NewTimer(policy.hedgeDelay)
+		defer hedgeTimer.Stop()
+		hedgeC = hedgeTimer.C
+	}
+
+	for {
+		select {
+		case <-hedgeC:
+			hedgeC = nil
+			if next, err := policy.nextConn(clientCtx); err == nil && len(attempts) < policy.maxAttempts {
+				start(next)
+				pending++
+			}
+			if len(attempts) < policy.maxAttempts {
+				hedgeTimer.Reset(policy.hedgeDelay)
+				hedgeC = hedgeTimer.C
+			}
+		case <-retryC:
+			retryC = nil
+			next, err := policy.nextConn(clientCtx)
+			if err != nil {
+				return err
+			}
+			start(next)
+			pending++
+		case a := <-results:
+			pending--
+			if a.err == nil || !policy.isRetryable(a.err) {
+				call.dest = a.conn.Target()
+				call.attempts = len(attempts)
+				return a.commit(serverStream, call, transform)
+			}
+
+			// wait for pending attempts or retry after backoff
+			if pending > 0 {
+				continue
+			}
+
+			if len(attempts) >= policy.maxAttempts {
+				call.dest = a.conn.Target()
+				call.attempts = len(attempts)
+				return a.commit(serverStream, call, transform)
+			}
+
+			if retryTimer == nil {
+				retryTimer = time.NewTimer(policy.backoff(len(attempts)))
+				defer retryTimer.Stop()
+			} else {
+				retryTimer.Reset(policy.backoff(len(attempts)))
+			}
+			retryC = retryTimer.C
+
+			// stop hedging once retry is scheduled
+			hedgeC = nil
+		case <-serverStream.Context().Done():
+			return status.FromContextError(serverStream.Context().Err()).Err()
+		}
+	}
+}
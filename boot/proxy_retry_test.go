@@ -0,0 +1,249 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestBootConfigProxyRetry_ToRetryPolicy(t *testing.T) {
+	// disabled
+	boot := &BootConfigProxyRetry{MaxAttempts: 1}
+	assert.Nil(t, boot.ToRetryPolicy())
+
+	boot = &BootConfigProxyRetry{
+		MaxAttempts:       3,
+		InitialBackoffMs:  10,
+		MaxBackoffMs:      100,
+		BackoffMultiplier: 1.5,
+		RetryableCodes:    []string{"UNAVAILABLE", "ResourceExhausted", "invalid"},
+	}
+	policy := boot.ToRetryPolicy()
+	assert.Equal(t, 3, policy.MaxAttempts)
+	assert.Equal(t, 10*time.Millisecond, policy.InitialBackoff)
+	assert.Equal(t, 100*time.Millisecond, policy.MaxBackoff)
+	assert.Equal(t, 1.5, policy.BackoffMultiplier)
+	assert.Equal(t, []codes.Code{codes.Unavailable, codes.ResourceExhausted}, policy.RetryableCodes)
+}
+
+func TestBootConfigProxyHedge_ToHedgePolicy(t *testing.T) {
+	// disabled
+	boot := &BootConfigProxyHedge{DelayMs: 10}
+	assert.Nil(t, boot.ToHedgePolicy())
+
+	boot.Enabled = true
+	boot.MaxAttempts = 3
+	policy := boot.ToHedgePolicy()
+	assert.Equal(t, 10*time.Millisecond, policy.Delay)
+	assert.Equal(t, 3, policy.MaxAttempts)
+}
+
+func TestNewReplayPolicy(t *testing.T) {
+	assert.Nil(t, newReplayPolicy(nil))
+
+	// without retry and hedge
+	pool := newUpstreamPool([]string{"localhost:1"}, nil, 0)
+	defer pool.stop()
+	assert.Nil(t, newReplayPolicy(&route{pool: pool}))
+
+	// retry with default values
+	pool = newUpstreamPool([]string{"localhost:1"}, &UpstreamConfig{Retry: &RetryPolicy{}}, 0)
+	defer pool.stop()
+	policy := newReplayPolicy(&route{pool: pool})
+	assert.Equal(t, defaultRetryMaxAttempts, policy.maxAttempts)
+	assert.Equal(t, defaultReplayBufferBytes, policy.bufferBytes)
+	assert.Zero(t, policy.hedgeDelay)
+	assert.True(t, policy.isRetryable(status.Error(codes.Unavailable, "")))
+	assert.False(t, policy.isRetryable(status.Error(codes.Internal, "")))
+
+	// backoff with jitter and limit
+	backoff := policy.backoff(1)
+	assert.True(t, backoff >= 80*time.Millisecond && backoff <= 120*time.Millisecond)
+	backoff = policy.backoff(10)
+	assert.True(t, backoff >= 800*time.Millisecond && backoff <= 1200*time.Millisecond)
+
+	// hedge with default values
+	pool = newUpstreamPool([]string{"localhost:1"}, &UpstreamConfig{Hedge: &HedgePolicy{}}, 0)
+	defer pool.stop()
+	policy = newReplayPolicy(&route{pool: pool})
+	assert.Equal(t, defaultHedgeMaxAttempts, policy.maxAttempts)
+	assert.Equal(t, defaultHedgeDelay, policy.hedgeDelay)
+	assert.True(t, policy.isRetryable(status.Error(codes.Unavailable, "")))
+	assert.Equal(t, defaultRetryInitialBackoff, policy.backoff(1))
+}
+
+func TestProxyEntry_IsReplayable(t *testing.T) {
+	var entry *ProxyEntry
+	assert.False(t, entry.isReplayable("/ut.proxy.Echo/Echo"))
+
+	backendAddr, stopBackend := startUtEchoBackend(t)
+	defer stopBackend()
+
+	entry = NewProxyEntry(WithRuleProxy(newUtRule(t, WithPathPatterns(&PathPattern{
+		Paths: []string{"/ut.proxy.*"},
+		Dest:  []string{backendAddr},
+	}))))
+	defer entry.Interrupt(context.TODO())
+
+	// unknown until descriptors fetched in background
+	assert.False(t, entry.isReplayable("/ut.proxy.Echo/Echo"))
+	<-entry.descriptors.maybeRefresh()
+
+	assert.True(t, entry.isReplayable("/ut.proxy.Echo/Echo"))
+	assert.True(t, entry.isReplayable("/ut.proxy.Echo/EchoStream"))
+	assert.False(t, entry.isReplayable("/ut.proxy.Echo/Missing"))
+}
+
+func TestProxyEntry_Retry(t *testing.T) {
+	// fail first call with Unavailable
+	backend := &utReplayBackend{failures: 1, code: codes.Unavailable}
+	conn, stop := startUtReplayProxy(t, backend, &UpstreamConfig{
+		Retry: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	})
+	defer stop()
+
+	resp := &frame{}
+	assert.Nil(t, conn.Invoke(context.TODO(), "/ut.proxy.Echo/Echo", &frame{payload: []byte("ut-payload")}, resp))
+	assert.Equal(t, []byte("ut-payload"), resp.payload)
+	assert.Equal(t, []string{"", "1"}, backend.getAttempts())
+}
+
+func TestProxyEntry_RetryExhausted(t *testing.T) {
+	backend := &utReplayBackend{failures: 10, code: codes.Unavailable}
+	conn, stop := startUtReplayProxy(t, backend, &UpstreamConfig{
+		Retry: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	})
+	defer stop()
+
+	err := conn.Invoke(context.TODO(), "/ut.proxy.Echo/Echo", &frame{payload: []byte("ut-payload")}, &frame{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, []string{"", "1", "2"}, backend.getAttempts())
+}
+
+func TestProxyEntry_RetryWithNonRetryableCode(t *testing.T) {
+	backend := &utReplayBackend{failures: 10, code: codes.Internal}
+	conn, stop := startUtReplayProxy(t, backend, &UpstreamConfig{
+		Retry: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	})
+	defer stop()
+
+	err := conn.Invoke(context.TODO(), "/ut.proxy.Echo/Echo", &frame{payload: []byte("ut-payload")}, &frame{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Len(t, backend.getAttempts(), 1)
+}
+
+func TestProxyEntry_RetryWithBufferExceeded(t *testing.T) {
+	// request frames could not be buffered, call would be streamed without retry
+	backend := &utReplayBackend{failures: 1, code: codes.Unavailable}
+	conn, stop := startUtReplayProxy(t, backend, &UpstreamConfig{
+		Retry:             &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+		ReplayBufferBytes: 1,
+	})
+	defer stop()
+
+	err := conn.Invoke(context.TODO(), "/ut.proxy.Echo/Echo", &frame{payload: []byte("ut-payload")}, &frame{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Len(t, backend.getAttempts(), 1)
+
+	resp := &frame{}
+	assert.Nil(t, conn.Invoke(context.TODO(), "/ut.proxy.Echo/Echo", &frame{payload: []byte("ut-payload")}, resp))
+	assert.Equal(t, []byte("ut-payload"), resp.payload)
+}
+
+func TestProxyEntry_Hedge(t *testing.T) {
+	// first call would not response until canceled
+	backend := &utReplayBackend{slow: 1}
+	conn, stop := startUtReplayProxy(t, backend, &UpstreamConfig{
+		Hedge: &HedgePolicy{Delay: 20 * time.Millisecond},
+	})
+	defer stop()
+
+	startTime := time.Now()
+	resp := &frame{}
+	assert.Nil(t, conn.Invoke(context.TODO(), "/ut.proxy.Echo/Echo", &frame{payload: []byte("ut-payload")}, resp))
+	assert.Equal(t, []byte("ut-payload"), resp.payload)
+	assert.True(t, time.Since(startTime) < 5*time.Second)
+	assert.Equal(t, []string{"", "1"}, backend.getAttempts())
+}
+
+// ************ Test utility ************
+
+// utReplayBackend echo request, fails with code or blocks in the first N calls
+type utReplayBackend struct {
+	lock     sync.Mutex
+	failures int
+	slow     int
+	code     codes.Code
+	attempts []string
+}
+
+func (b *utReplayBackend) getAttempts() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return append([]string{}, b.attempts...)
+}
+
+func (b *utReplayBackend) handler(srv interface{}, stream grpc.ServerStream) error {
+	f := &frame{}
+	if err := stream.RecvMsg(f); err != nil {
+		return err
+	}
+
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	attempt := ""
+	if v := md.Get(previousAttemptsKey); len(v) > 0 {
+		attempt = v[0]
+	}
+
+	b.lock.Lock()
+	b.attempts = append(b.attempts, attempt)
+	fail := b.failures > 0
+	b.failures--
+	slow := b.slow > 0
+	b.slow--
+	b.lock.Unlock()
+
+	if fail {
+		return status.Error(b.code, "ut-error")
+	}
+
+	if slow {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}
+
+	return stream.SendMsg(f)
+}
+
+// startUtReplayProxy start backend and proxy with upstream config, returns connection to proxy
+func startUtReplayProxy(t *testing.T, backend *utReplayBackend, config *UpstreamConfig) (*grpc.ClientConn, func()) {
+	backendAddr, stopBackend := startUtBackend(t, backend.handler)
+
+	proxyAddr, stopProxy := startUtProxy(t, NewProxyEntry(WithRuleProxy(newUtRule(t, WithPathPatterns(&PathPattern{
+		Paths:    []string{"/ut.proxy.*"},
+		Dest:     []string{backendAddr},
+		Upstream: config,
+	})))))
+
+	conn, err := grpc.Dial(proxyAddr, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec())))
+	assert.Nil(t, err)
+
+	return conn, func() {
+		conn.Close()
+		stopProxy()
+		stopBackend()
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// CompositeBased proxy pattern combines path, header and IP conditions with priority
+	CompositeBased = "composite"
+	// DefaultBased fallback destination if no rules matched
+	DefaultBased = "default"
+
+	defaultProxyDebugPath = "/rk/v1/proxy"
+)
+
+// BootConfigProxyCondition Boot config of condition in composite proxy rule.
+//
+// All non-empty fields must be matched.
+// 1: Paths: Regex of grpc method, any of them should match.
+// 2: HeaderPairs: Headers as key:value, all of them should exist in metadata.
+// 3: Ips: CIDR of remote IP, any of them should contain remote IP.
+// 4: And: All of sub conditions should match.
+// 5: Or: Any of sub conditions should match.
+// 6: Not: Sub condition should not match.
+type BootConfigProxyCondition struct {
+	Paths       []string                    `yaml:"paths" json:"paths"`
+	HeaderPairs []string                    `yaml:"headerPairs" json:"headerPairs"`
+	Ips         []string                    `yaml:"ips" json:"ips"`
+	And         []*BootConfigProxyCondition `yaml:"and" json:"and"`
+	Or          []*BootConfigProxyCondition `yaml:"or" json:"or"`
+	Not         *BootConfigProxyCondition   `yaml:"not" json:"not"`
+}
+
+// ToCondition convert BootConfigProxyCondition into Condition
+func (boot *BootConfigProxyCondition) ToCondition() *Condition {
+	if boot == nil {
+		return nil
+	}
+
+	res := &Condition{
+		Paths:   boot.Paths,
+		Headers: parseHeaderPairs(boot.HeaderPairs),
+		Cidrs:   boot.Ips,
+		Not:     boot.Not.ToCondition(),
+	}
+
+	for i := range boot.And {
+		res.And = append(res.And, boot.And[i].ToCondition())
+	}
+
+	for i := range boot.Or {
+		res.Or = append(res.Or, boot.Or[i].ToCondition())
+	}
+
+	return res
+}
+
+// parseHeaderPairs parse key:value pairs into map, invalid pairs would be ignored
+func parseHeaderPairs(pairs []string) map[string]string {
+	res := make(map[string]string)
+
+	for i := range pairs {
+		tokens := strings.SplitN(pairs[i], ":", 2)
+		if len(tokens) != 2 {
+			continue
+		}
+		res[tokens[0]] = tokens[1]
+	}
+
+	return res
+}
+
+// Condition defines predicate of incoming request.
+//
+// All non-empty fields must be matched, empty condition matches any request.
+type Condition struct {
+	Paths   []string
+	Headers map[string]string
+	Cidrs   []string
+	And     []*Condition
+	Or      []*Condition
+	Not     *Condition
+	regexps []*regexp.Regexp
+	subnets []*net.IPNet
+}
+
+// compile compile regex of paths and CIDR of IPs in condition and sub conditions
+func (c *Condition) compile() (err error) {
+	if c == nil {
+		return nil
+	}
+
+	if c.regexps, err = compilePaths(c.Paths); err != nil {
+		return err
+	}
+
+	if c.subnets, err = compileCidrs(c.Cidrs); err != nil {
+		return err
+	}
+
+	for i := range c.And {
+		if err := c.And[i].compile(); err != nil {
+			return err
+		}
+	}
+
+	for i := range c.Or {
+		if err := c.Or[i].compile(); err != nil {
+			return err
+		}
+	}
+
+	return c.Not.compile()
+}
+
+// matches returns true if request in context satisfies condition, condition should be compiled before
+func (c *Condition) matches(ctx context.Context) bool {
+	if c == nil {
+		return true
+	}
+
+	if len(c.Paths) > 0 && !matchPaths(c.regexps, ctx) {
+		return false
+	}
+
+	if len(c.Headers) > 0 && !(&HeaderPattern{Headers: c.Headers}).matches(ctx) {
+		return false
+	}
+
+	if len(c.Cidrs) > 0 && !matchCidrs(c.subnets, ctx) {
+		return false
+	}
+
+	for i := range c.And {
+		if !c.And[i].matches(ctx) {
+			return false
+		}
+	}
+
+	if len(c.Or) > 0 {
+		matched := false
+		for i := range c.Or {
+			if c.Or[i].matches(ctx) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	if c.Not != nil && c.Not.matches(ctx) {
+		return false
+	}
+
+	return true
+}
+
+// RoutePattern defines proxy rules with priority and composable condition.
+//
+// Patterns with higher priority would be checked first. Header, path and IP based patterns have priority of 0,
+// and would be checked before route patterns with the same priority.
+type RoutePattern struct {
+	Name     string
+	Priority int
+	Match    *Condition
+	Dest     []string
+	Upstream *UpstreamConfig
+	Metadata *MetadataRule
+	pool     *upstreamPool
+}
+
+// route is a compiled pattern which is checked by director in order
+type route struct {
+	name     string
+	kind     string
+	priority int
+	dest     []string
+	matches  func(ctx context.Context) bool
+	pool     *upstreamPool
+	metadata *MetadataRule
+	// remote IP must be in one of subnets and method must match one of regexps if not empty, used by index
+	subnets []*net.IPNet
+	regexps []*regexp.Regexp
+}
+
+// compileRoutes build routes from patterns and sort them by priority
+func (r *rule) compileRoutes() {
+	r.routes = make([]*route, 0)
+
+	for i, pattern := range r.IpPattern {
+		r.routes = append(r.routes, &route{
+			name:     IpBased + "-" + strconv.Itoa(i),
+			kind:     IpBased,
+			dest:     pattern.Dest,
+			matches:  pattern.matches,
+			pool:     pattern.pool,
+			metadata: pattern.Metadata,
+			subnets:  pattern.subnets,
+		})
+	}
+
+	for i, pattern := range r.PathPattern {
+		r.routes = append(r.routes, &route{
+			name:     PathBased + "-" + strconv.Itoa(i),
+			kind:     PathBased,
+			dest:     pattern.Dest,
+			matches:  pattern.matches,
+			pool:     pattern.pool,
+			metadata: pattern.Metadata,
+			regexps:  pattern.regexps,
+		})
+	}
+
+	for i, pattern := range r.HeaderPattern {
+		r.routes = append(r.routes, &route{
+			name:     HeaderBased + "-" + strconv.Itoa(i),
+			kind:     HeaderBased,
+			dest:     pattern.Dest,
+			matches:  pattern.matches,
+			pool:     pattern.pool,
+			metadata: pattern.Metadata,
+		})
+	}
+
+	for i, pattern := range r.RoutePattern {
+		name := pattern.Name
+		if len(name) < 1 {
+			name = CompositeBased + "-" + strconv.Itoa(i)
+		}
+
+		rt := &route{
+			name:     name,
+			kind:     CompositeBased,
+			priority: pattern.Priority,
+			dest:     pattern.Dest,
+			matches:  pattern.Match.matches,
+			pool:     pattern.pool,
+			metadata: pattern.Metadata,
+		}
+		if pattern.Match != nil {
+			rt.subnets = pattern.Match.subnets
+			rt.regexps = pattern.Match.regexps
+		}
+
+		r.routes = append(r.routes, rt)
+	}
+
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return r.routes[i].priority > r.routes[j].priority
+	})
+
+	r.index = newRouteIndex(r.routes)
+
+	if r.DefaultPattern != nil {
+		name := r.DefaultPattern.Name
+		if len(name) < 1 {
+			name = DefaultBased
+		}
+
+		r.defaultRoute = &route{
+			name:     name,
+			kind:     DefaultBased,
+			priority: r.DefaultPattern.Priority,
+			dest:     r.DefaultPattern.Dest,
+			matches: func(context.Context) bool {
+				return true
+			},
+			pool:     r.DefaultPattern.pool,
+			metadata: r.DefaultPattern.Metadata,
+		}
+	}
+}
+
+// match returns first route matched with request in context, default route would be returned if nothing matched
+func (r *rule) match(ctx context.Context) *route {
+	if r.index != nil && r.index.indexed {
+		for _, i := range r.index.candidates(ctx) {
+			if rt := r.routes[i]; !rt.pool.isEmpty() && rt.matches(ctx) {
+				return rt
+			}
+		}
+	} else {
+		for _, rt := range r.routes {
+			if !rt.pool.isEmpty() && rt.matches(ctx) {
+				return rt
+			}
+		}
+	}
+
+	if r.defaultRoute != nil && !r.defaultRoute.pool.isEmpty() {
+		return r.defaultRoute
+	}
+
+	return nil
+}
+
+// proxyMatchResult is response of debug endpoint
+type proxyMatchResult struct {
+	Matched  bool     `json:"matched"`
+	Name     string   `json:"name,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Priority int      `json:"priority"`
+	Dest     []string `json:"dest,omitempty"`
+}
+
+// debugHandler shows which rule would be matched with method, ip and header in query.
+//
+// Example: /rk/v1/proxy?method=/api.v1.Greeter/Greeter&ip=10.0.0.1&header=domain:test
+func (entry *ProxyEntry) debugHandler(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	md := metadata.MD{}
+	for k, v := range parseHeaderPairs(query["header"]) {
+		md.Append(strings.ToLower(k), v)
+	}
+
+	if ip := query.Get("ip"); len(ip) > 0 {
+		md.Set("x-forwarded-remote-addr", net.JoinHostPort(ip, "0"))
+	}
+
+	ctx := metadata.NewIncomingContext(request.Context(), md)
+	ctx = grpc.NewContextWithServerTransportStream(ctx, &debugTransportStream{method: query.Get("method")})
+
+	res := &proxyMatchResult{}
+	if r := entry.getRule(); r != nil {
+		if rt := r.match(ctx); rt != nil {
+			res.Matched = true
+			res.Name = rt.name
+			res.Type = rt.kind
+			res.Priority = rt.priority
+			res.Dest = rt.dest
+		}
+	}
+
+	bytes, _ := json.Marshal(res)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(bytes)
+}
+
+// debugTransportStream provides method for grpc.Method() in debug endpoint
+type debugTransportStream struct {
+	method string
+}
+
+// Method returns method in query
+func (s *debugTransportStream) Method() string {
+	return s.method
+}
+
+// SetHeader is noop
+func (s *debugTransportStream) SetHeader(metadata.MD) error {
+	return nil
+}
+
+// SendHeader is noop
+func (s *debugTransportStream) SendHeader(metadata.MD) error {
+	return nil
+}
+
+// SetTrailer is noop
+func (s *debugTransportStream) SetTrailer(metadata.MD) error {
+	return nil
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestBootConfigProxyCondition_ToCondition(t *testing.T) {
+	var boot *BootConfigProxyCondition
+	assert.Nil(t, boot.ToCondition())
+
+	boot = &BootConfigProxyCondition{
+		Paths:       []string{"/ut.*"},
+		HeaderPairs: []string{"env:canary", "invalid"},
+		Ips:         []string{"10.0.0.0/8"},
+		And: []*BootConfigProxyCondition{
+			{Paths: []string{"/ut.v1.*"}},
+		},
+		Or: []*BootConfigProxyCondition{
+			{HeaderPairs: []string{"user:ut-1"}},
+			{HeaderPairs: []string{"user:ut-2"}},
+		},
+		Not: &BootConfigProxyCondition{
+			Ips: []string{"10.0.0.1/32"},
+		},
+	}
+
+	c := boot.ToCondition()
+	assert.Equal(t, []string{"/ut.*"}, c.Paths)
+	assert.Equal(t, map[string]string{"env": "canary"}, c.Headers)
+	assert.Equal(t, []string{"10.0.0.0/8"}, c.Cidrs)
+	assert.Len(t, c.And, 1)
+	assert.Len(t, c.Or, 2)
+	assert.Equal(t, []string{"10.0.0.1/32"}, c.Not.Cidrs)
+}
+
+func TestCondition_Matches(t *testing.T) {
+	// nil and empty condition matches any request
+	var c *Condition
+	assert.True(t, c.matches(context.TODO()))
+	assert.True(t, (&Condition{}).matches(context.TODO()))
+
+	// path AND header AND CIDR
+	c = &Condition{
+		Paths:   []string{"/ut.v1.*"},
+		Headers: map[string]string{"env": "canary"},
+		Cidrs:   []string{"10.0.0.0/8"},
+	}
+	assert.Nil(t, c.compile())
+	assert.True(t, c.matches(newUtRouteContext("/ut.v1.Greeter/Hello", "10.0.0.1", "env", "canary")))
+	assert.False(t, c.matches(newUtRouteContext("/ut.v2.Greeter/Hello", "10.0.0.1", "env", "canary")))
+	assert.False(t, c.matches(newUtRouteContext("/ut.v1.Greeter/Hello", "10.0.0.1", "env", "prod")))
+	assert.False(t, c.matches(newUtRouteContext("/ut.v1.Greeter/Hello", "192.168.0.1", "env", "canary")))
+
+	// OR
+	c = &Condition{
+		Or: []*Condition{
+			{Headers: map[string]string{"user": "ut-1"}},
+			{Cidrs: []string{"10.0.0.0/8"}},
+		},
+	}
+	assert.Nil(t, c.compile())
+	assert.True(t, c.matches(newUtRouteContext("", "192.168.0.1", "user", "ut-1")))
+	assert.True(t, c.matches(newUtRouteContext("", "10.0.0.1")))
+	assert.False(t, c.matches(newUtRouteContext("", "192.168.0.1", "user", "ut-2")))
+
+	// NOT nested in AND
+	c = &Condition{
+		And: []*Condition{
+			{Paths: []string{"/ut.*"}},
+			{Not: &Condition{Headers: map[string]string{"env": "prod"}}},
+		},
+	}
+	assert.Nil(t, c.compile())
+	assert.True(t, c.matches(newUtRouteContext("/ut.v1.Greeter/Hello", "10.0.0.1", "env", "canary")))
+	assert.False(t, c.matches(newUtRouteContext("/ut.v1.Greeter/Hello", "10.0.0.1", "env", "prod")))
+
+	// invalid regex in nested condition
+	c = &Condition{Not: &Condition{Paths: []string{"/ut.("}}}
+	assert.NotNil(t, c.compile())
+}
+
+func TestRule_MatchWithPriority(t *testing.T) {
+	headerPattern := &HeaderPattern{
+		Headers: map[string]string{"env": "canary"},
+		Dest:    []string{"localhost:1"},
+	}
+	lowPattern := &RoutePattern{
+		Name:     "low",
+		Priority: -1,
+		Match:    &Condition{Paths: []string{"/ut.*"}},
+		Dest:     []string{"localhost:2"},
+	}
+	highPattern := &RoutePattern{
+		Name:     "high",
+		Priority: 10,
+		Match: &Condition{
+			Paths:   []string{"/ut.v1.*"},
+			Headers: map[string]string{"env": "canary"},
+		},
+		Dest: []string{"localhost:3"},
+	}
+	emptyPattern := &RoutePattern{
+		Priority: 100,
+		Dest:     []string{""},
+	}
+
+	r := newUtRule(t,
+		WithHeaderPatterns(headerPattern),
+		WithRoutePatterns(lowPattern, highPattern, emptyPattern),
+		WithDefaultPattern(&RoutePattern{Dest: []string{"localhost:4"}}))
+	defer NewProxyEntry(WithRuleProxy(r)).Interrupt(context.TODO())
+
+	// high priority composite pattern wins over header pattern
+	rt := r.match(newUtRouteContext("/ut.v1.Greeter/Hello", "10.0.0.1", "env", "canary"))
+	assert.Equal(t, "high", rt.name)
+	assert.Equal(t, CompositeBased, rt.kind)
+
+	// header pattern with priority of 0
+	rt = r.match(newUtRouteContext("/ut.v2.Greeter/Hello", "10.0.0.1", "env", "canary"))
+	assert.Equal(t, "headerBased-0", rt.name)
+	assert.Equal(t, HeaderBased, rt.kind)
+
+	// low priority composite pattern
+	rt = r.match(newUtRouteContext("/ut.v2.Greeter/Hello", "10.0.0.1"))
+	assert.Equal(t, "low", rt.name)
+
+	// fallback to default
+	rt = r.match(newUtRouteContext("/other.Greeter/Hello", "10.0.0.1"))
+	assert.Equal(t, DefaultBased, rt.name)
+	assert.Equal(t, DefaultBased, rt.kind)
+
+	ctx, conn, err := r.GetDirector()(newUtRouteContext("/other.Greeter/Hello", "10.0.0.1"))
+	assert.NotNil(t, ctx)
+	assert.NotNil(t, conn)
+	assert.Nil(t, err)
+
+	// without default
+	r = newUtRule(t, WithRoutePatterns(highPattern))
+	assert.Nil(t, r.match(newUtRouteContext("/other.Greeter/Hello", "10.0.0.1")))
+}
+
+func TestProxyEntry_DebugHandler(t *testing.T) {
+	entry := NewProxyEntry(
+		WithDebugPathProxy(defaultProxyDebugPath),
+		WithRuleProxy(newUtRule(t,
+			WithRoutePatterns(&RoutePattern{
+				Name:     "canary",
+				Priority: 1,
+				Match: &Condition{
+					Paths:   []string{"/ut.v1.*"},
+					Headers: map[string]string{"env": "canary"},
+					Cidrs:   []string{"10.0.0.0/8"},
+				},
+				Dest: []string{"localhost:1"},
+			}))))
+	assert.Equal(t, defaultProxyDebugPath, entry.DebugPath)
+
+	// matched
+	w := httptest.NewRecorder()
+	entry.debugHandler(w, httptest.NewRequest(http.MethodGet,
+		"/rk/v1/proxy?method=/ut.v1.Greeter/Hello&ip=10.0.0.1&header=Env:canary", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	res := &proxyMatchResult{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), res))
+	assert.True(t, res.Matched)
+	assert.Equal(t, "canary", res.Name)
+	assert.Equal(t, CompositeBased, res.Type)
+	assert.Equal(t, 1, res.Priority)
+	assert.Equal(t, []string{"localhost:1"}, res.Dest)
+
+	// not matched
+	w = httptest.NewRecorder()
+	entry.debugHandler(w, httptest.NewRequest(http.MethodGet, "/rk/v1/proxy?method=/ut.v1.Greeter/Hello", nil))
+	res = &proxyMatchResult{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), res))
+	assert.False(t, res.Matched)
+}
+
+// ************ Test utility ************
+
+func newUtRouteContext(method, ip string, kv ...string) context.Context {
+	md := metadata.Pairs(kv...)
+	md.Set("x-forwarded-remote-addr", ip+":1949")
+
+	ctx := metadata.NewIncomingContext(context.TODO(), md)
+	return grpc.NewContextWithServerTransportStream(ctx, &debugTransportStream{method: method})
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkmidprom "github.com/rookie-ninja/rk-entry/v2/middleware/prom"
+	rkquery "github.com/rookie-ninja/rk-query"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ShadowHeaderKey is added to metadata of calls sent to shadow destination
+	ShadowHeaderKey = "x-rk-proxy-shadow"
+
+	shadowElapsedNano = "shadowElapsedNano"
+	shadowResCode     = "shadowResCode"
+	// number of request frames buffered for shadow destination, shadow call would be aborted if exceeded
+	shadowBufferSize = 64
+)
+
+// shadowTarget is shadow destination of matched rule
+type shadowTarget struct {
+	rule     string
+	upstream *upstream
+	timeout  time.Duration
+}
+
+// newShadowTarget returns shadow destination of route, nil if not exist
+func newShadowTarget(rt *route) *shadowTarget {
+	if rt == nil || rt.pool == nil || rt.pool.shadow == nil {
+		return nil
+	}
+
+	return &shadowTarget{
+		rule:     rt.name,
+		upstream: rt.pool.shadow,
+		timeout:  rt.pool.config.ShadowTimeout,
+	}
+}
+
+// shadowCall copies request frames of proxied call to shadow destination.
+//
+// Shadow call never blocks proxied call, it would be aborted with ResourceExhausted if shadow destination
+// could not keep up with frames.
+type shadowCall struct {
+	target    *shadowTarget
+	method    string
+	frames    chan []byte
+	overflow  int32
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+// newShadowCall create shadow call detached from proxied call, deadline of proxied call would be used if
+// it is earlier than timeout of shadow destination. Outgoing metadata of proxied call is copied so that shadow
+// call carries the same caller metadata and request transforms.
+func newShadowCall(parent context.Context, target *shadowTarget, method string) *shadowCall {
+	deadline := time.Now().Add(target.timeout)
+	if d, ok := parent.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	md, _ := metadata.FromOutgoingContext(parent)
+	md = md.Copy()
+	if len(md.Get("X-Forwarded-For")) < 1 {
+		md.Set("X-Forwarded-For", rkmid.LocalIp.String)
+	}
+	md.Set(ShadowHeaderKey, "true")
+
+	ctx, cancel := context.WithDeadline(metadata.NewOutgoingContext(context.Background(), md), deadline)
+
+	return &shadowCall{
+		target: target,
+		method: method,
+		frames: make(chan []byte, shadowBufferSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// send copy payload to shadow call without blocking
+func (c *shadowCall) send(payload []byte) {
+	if c == nil || atomic.LoadInt32(&c.overflow) == 1 {
+		return
+	}
+
+	copied := make([]byte, len(payload))
+	copy(copied, payload)
+
+	select {
+	case c.frames <- copied:
+	default:
+		atomic.StoreInt32(&c.overflow, 1)
+		c.cancel()
+	}
+}
+
+// closeSend notify shadow call that there are no more frames
+func (c *shadowCall) closeSend() {
+	if c == nil {
+		return
+	}
+
+	c.closeOnce.Do(func() {
+		close(c.frames)
+	})
+}
+
+// run forward frames to shadow destination and discard responses, returns status of shadow call
+func (c *shadowCall) run() error {
+	defer c.cancel()
+
+	err := c.forward()
+	if atomic.LoadInt32(&c.overflow) == 1 {
+		return status.Error(codes.ResourceExhausted, "Shadow buffer overflow")
+	}
+
+	return err
+}
+
+// forward send frames until closeSend and wait for end of stream
+func (c *shadowCall) forward() error {
+	// drain frames if shadow destination is not available
+	stream, err := c.newStream()
+	if err != nil {
+		for range c.frames {
+		}
+		return err
+	}
+
+	recvErrCh := make(chan error, 1)
+	go func() {
+		f := &frame{}
+		for {
+			if err := stream.RecvMsg(f); err != nil {
+				recvErrCh <- err
+				return
+			}
+		}
+	}()
+
+	var sendErr error
+	for payload := range c.frames {
+		if sendErr == nil {
+			sendErr = stream.SendMsg(&frame{payload: payload})
+		}
+	}
+	stream.CloseSend()
+
+	if err := <-recvErrCh; err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+// newStream create client stream to shadow destination
+func (c *shadowCall) newStream() (grpc.ClientStream, error) {
+	conn, err := c.target.upstream.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc.NewClientStream(c.ctx, clientStreamDescForProxying, conn, c.method)
+}
+
+// registerShadowMetrics register latency and result code metrics of shadow calls
+func (entry *ProxyEntry) registerShadowMetrics() {
+	entry.metricsSet.RegisterSummary(shadowElapsedNano, rkmidprom.SummaryObjectives, "rule", "dest", "method", "code")
+	entry.metricsSet.RegisterCounter(shadowResCode, "rule", "dest", "method", "code")
+}
+
+// startShadow start shadow call if matched route in context has shadow destination, nil would be returned if not.
+// Context should carry outgoing metadata of proxied call.
+func (entry *ProxyEntry) startShadow(ctx context.Context, method string) *shadowCall {
+	target := newShadowTarget(getProxyRoute(ctx))
+	if target == nil {
+		return nil
+	}
+
+	// shadow call may finish after proxied call, keep rules from being retired until then
+	r := getProxyRule(ctx)
+	if r != nil {
+		r.acquire()
+	}
+
+	call := newShadowCall(ctx, target, method)
+	go func() {
+		if r != nil {
+			defer r.release()
+		}
+
+		startTime := time.Now()
+		err := call.run()
+		entry.recordShadow(target, method, time.Since(startTime), err)
+	}()
+
+	return call
+}
+
+// recordShadow record latency and status of shadow call into prometheus and event
+func (entry *ProxyEntry) recordShadow(target *shadowTarget, method string, elapsed time.Duration, err error) {
+	if entry == nil {
+		return
+	}
+
+	code := status.Code(err).String()
+
+	if entry.metricsSet != nil {
+		if observer := entry.metricsSet.GetSummaryWithValues(shadowElapsedNano, target.rule, target.upstream.addr, method, code); observer != nil {
+			observer.Observe(float64(elapsed.Nanoseconds()))
+		}
+
+		if counter := entry.metricsSet.GetCounterWithValues(shadowResCode, target.rule, target.upstream.addr, method, code); counter != nil {
+			counter.Inc()
+		}
+	}
+
+	if entry.EventEntry != nil {
+		event := entry.EventEntry.Start("proxyShadow",
+			rkquery.WithEntryName(entry.entryName),
+			rkquery.WithEntryType(entry.entryType))
+		event.AddPayloads(
+			zap.String("rule", target.rule),
+			zap.String("shadowDest", target.upstream.addr),
+			zap.String("grpcMethod", method),
+			zap.Int64("elapsedNano", elapsed.Nanoseconds()))
+		event.SetResCode(code)
+		if err != nil {
+			event.AddErr(err)
+		}
+		entry.EventEntry.Finish(event)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewShadowTarget(t *testing.T) {
+	assert.Nil(t, newShadowTarget(nil))
+	assert.Nil(t, newShadowTarget(&route{name: "ut-rule"}))
+
+	// pool without shadow destination
+	pool := newUpstreamPool([]string{"localhost:1"}, nil, 0)
+	defer pool.stop()
+	assert.Nil(t, newShadowTarget(&route{name: "ut-rule", pool: pool}))
+
+	pool = newUpstreamPool([]string{"localhost:1"}, &UpstreamConfig{
+		ShadowDest:    "localhost:2",
+		ShadowTimeout: time.Second,
+	}, 0)
+	defer pool.stop()
+
+	target := newShadowTarget(&route{name: "ut-rule", pool: pool})
+	assert.Equal(t, "ut-rule", target.rule)
+	assert.Equal(t, pool.shadow, target.upstream)
+	assert.Equal(t, time.Second, target.timeout)
+}
+
+func TestShadowCall_Overflow(t *testing.T) {
+	target := &shadowTarget{
+		rule:     "ut-rule",
+		upstream: newUpstream("localhost:1", []grpc.DialOption{grpc.WithInsecure()}),
+		timeout:  time.Second,
+	}
+	defer target.upstream.close()
+
+	// deadline of proxied call is earlier
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond)
+	defer cancel()
+	call := newShadowCall(ctx, target, "/ut.proxy.Echo/Echo")
+	deadline, _ := call.ctx.Deadline()
+	assert.True(t, deadline.Before(time.Now().Add(time.Second)))
+
+	// frames exceeded buffer before shadow call started
+	for i := 0; i < shadowBufferSize+1; i++ {
+		call.send([]byte("ut"))
+	}
+	call.closeSend()
+	call.closeSend()
+
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call.run()))
+
+	// nil call is noop
+	var nilCall *shadowCall
+	nilCall.send([]byte("ut"))
+	nilCall.closeSend()
+}
+
+func TestProxyEntry_RecordShadowWithNilEntry(t *testing.T) {
+	var entry *ProxyEntry
+	assert.NotPanics(t, func() {
+		entry.recordShadow(&shadowTarget{}, "/ut.proxy.Echo/Echo", time.Second, nil)
+	})
+	assert.Nil(t, entry.startShadow(context.TODO(), "/ut.proxy.Echo/Echo"))
+}
+
+func TestProxyEntry_Shadow(t *testing.T) {
+	primaryAddr, stopPrimary := startUtEchoBackend(t)
+	defer stopPrimary()
+
+	// shadow destination records metadata and returns error
+	shadowMD := make(chan metadata.MD, 1)
+	shadowAddr, stopShadow := startUtShadowBackend(t, shadowMD)
+	defer stopShadow()
+
+	registry := prometheus.NewRegistry()
+	entry := NewProxyEntry(
+		WithPromRegistryProxy(registry),
+		WithRuleProxy(newUtRule(t, WithPathPatterns(&PathPattern{
+			Paths: []string{"/ut.proxy.*"},
+			Dest:  []string{primaryAddr},
+			Upstream: &UpstreamConfig{
+				ShadowDest: shadowAddr,
+			},
+			Metadata: &MetadataRule{
+				Request: &MetadataTransform{Set: map[string]string{"x-ut-set": "ut-value"}},
+			},
+		}))))
+	proxyAddr, stopProxy := startUtProxy(t, entry)
+	defer stopProxy()
+
+	conn, err := grpc.Dial(proxyAddr, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec())))
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// error of shadow destination would be discarded
+	resp := &frame{}
+	ctx := metadata.AppendToOutgoingContext(context.TODO(), "x-tenant", "ut-tenant")
+	assert.Nil(t, conn.Invoke(ctx, "/ut.proxy.Echo/Echo", &frame{payload: []byte("ut-payload")}, resp))
+	assert.Equal(t, []byte("ut-payload"), resp.payload)
+
+	select {
+	case md := <-shadowMD:
+		assert.Equal(t, []string{"true"}, md.Get(ShadowHeaderKey))
+		// caller metadata and request transforms should be mirrored
+		assert.Equal(t, []string{"ut-tenant"}, md.Get("x-tenant"))
+		assert.Equal(t, []string{"ut-value"}, md.Get("x-ut-set"))
+		assert.Len(t, md.Get("X-Forwarded-For"), 1)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "shadow destination not called")
+	}
+
+	// latency and code of shadow call would be recorded
+	assert.Eventually(t, func() bool {
+		families, err := registry.Gather()
+		if err != nil {
+			return false
+		}
+
+		for _, family := range families {
+			if family.GetName() != "rk_proxy_shadowResCode" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "code" && label.GetValue() == codes.Internal.String() {
+						return metric.GetCounter().GetValue() == 1
+					}
+				}
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// ************ Test utility ************
+
+// startUtShadowBackend start grpc server which receive request, record metadata and return Internal error
+func startUtShadowBackend(t *testing.T, mdCh chan metadata.MD) (string, func()) {
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(Codec()),
+		grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+			if err := stream.RecvMsg(&frame{}); err != nil {
+				return err
+			}
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			mdCh <- md
+			return status.Error(codes.Internal, "ut-shadow-error")
+		}))
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	assert.Nil(t, err)
+	go server.Serve(lis)
+
+	return lis.Addr().String(), server.Stop
+}
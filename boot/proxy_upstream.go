@@ -0,0 +1,481 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// LbRoundRobin pick destinations in turn
+	LbRoundRobin = "roundRobin"
+	// LbLeastRequest pick destination with the least in-flight requests
+	LbLeastRequest = "leastRequest"
+	// LbConsistentHash pick destination by hash of header value, requests with the same value go to the same destination
+	LbConsistentHash = "consistentHash"
+	// LbWeighted pick destinations in proportion to weights with smooth weighted round-robin
+	LbWeighted = "weighted"
+
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultHealthCheckTimeout  = time.Second
+	defaultShadowTimeout       = 10 * time.Second
+	// number of virtual nodes of each destination on consistent hash ring
+	hashRingReplicas = 100
+)
+
+// BootConfigProxyUpstream Boot config of upstream pool for each proxy rule.
+//
+// 1: LoadBalancer: Strategy to pick destination, options: roundRobin, leastRequest, consistentHash, weighted.
+// 2: HashHeader: Header used as hash key while loadBalancer is consistentHash.
+// 3: Weights: Weights of destinations in the same order while loadBalancer is weighted, default weight is 1.
+// 4: HealthCheck: Eject destinations which fail on grpc.health.v1.Health/Check.
+// 5: Tls: Connect destinations with TLS, certEntry provides root CA and client certificate.
+// 6: Shadow: Send a copy of each call to shadow destination, response of shadow destination would be discarded.
+// 7: Retry: Retry calls failed with retryable codes if request frames could be replayed.
+// 8: Hedge: Send hedged attempts if no response received within delay.
+// 9: ReplayBufferBytes: Max bytes of request frames buffered for retry and hedge.
+type BootConfigProxyUpstream struct {
+	LoadBalancer      string               `yaml:"loadBalancer" json:"loadBalancer"`
+	HashHeader        string               `yaml:"hashHeader" json:"hashHeader"`
+	Weights           []int                `yaml:"weights" json:"weights"`
+	Retry             BootConfigProxyRetry `yaml:"retry" json:"retry"`
+	Hedge             BootConfigProxyHedge `yaml:"hedge" json:"hedge"`
+	ReplayBufferBytes int                  `yaml:"replayBufferBytes" json:"replayBufferBytes"`
+	HealthCheck       struct {
+		Enabled    bool   `yaml:"enabled" json:"enabled"`
+		Service    string `yaml:"service" json:"service"`
+		IntervalMs int    `yaml:"intervalMs" json:"intervalMs"`
+		TimeoutMs  int    `yaml:"timeoutMs" json:"timeoutMs"`
+	} `yaml:"healthCheck" json:"healthCheck"`
+	Tls struct {
+		Enabled            bool   `yaml:"enabled" json:"enabled"`
+		CertEntry          string `yaml:"certEntry" json:"certEntry"`
+		ServerName         string `yaml:"serverName" json:"serverName"`
+		InsecureSkipVerify bool   `yaml:"insecureSkipVerify" json:"insecureSkipVerify"`
+	} `yaml:"tls" json:"tls"`
+	Shadow struct {
+		Dest      string `yaml:"dest" json:"dest"`
+		TimeoutMs int    `yaml:"timeoutMs" json:"timeoutMs"`
+	} `yaml:"shadow" json:"shadow"`
+}
+
+// ToUpstreamConfig convert BootConfigProxyUpstream into UpstreamConfig
+func (boot *BootConfigProxyUpstream) ToUpstreamConfig() *UpstreamConfig {
+	res := &UpstreamConfig{
+		LoadBalancer:        boot.LoadBalancer,
+		HashHeader:          boot.HashHeader,
+		Weights:             boot.Weights,
+		HealthCheck:         boot.HealthCheck.Enabled,
+		HealthCheckService:  boot.HealthCheck.Service,
+		HealthCheckInterval: time.Duration(boot.HealthCheck.IntervalMs) * time.Millisecond,
+		HealthCheckTimeout:  time.Duration(boot.HealthCheck.TimeoutMs) * time.Millisecond,
+		ShadowDest:          boot.Shadow.Dest,
+		ShadowTimeout:       time.Duration(boot.Shadow.TimeoutMs) * time.Millisecond,
+		Retry:               boot.Retry.ToRetryPolicy(),
+		Hedge:               boot.Hedge.ToHedgePolicy(),
+		ReplayBufferBytes:   boot.ReplayBufferBytes,
+	}
+
+	if boot.Tls.Enabled {
+		res.TlsConfig = &tls.Config{
+			ServerName:         boot.Tls.ServerName,
+			InsecureSkipVerify: boot.Tls.InsecureSkipVerify,
+		}
+
+		if certEntry := rkentry.GlobalAppCtx.GetCertEntry(boot.Tls.CertEntry); certEntry != nil {
+			if certEntry.RootCA != nil {
+				res.TlsConfig.RootCAs = x509.NewCertPool()
+				res.TlsConfig.RootCAs.AddCert(certEntry.RootCA)
+			}
+
+			if certEntry.Certificate != nil {
+				res.TlsConfig.Certificates = []tls.Certificate{*certEntry.Certificate}
+			}
+		}
+	}
+
+	return res
+}
+
+// UpstreamConfig defines how destinations of proxy pattern would be connected and picked.
+//
+// Round-robin with insecure connection would be used if not provided.
+type UpstreamConfig struct {
+	LoadBalancer        string
+	HashHeader          string
+	Weights             []int
+	HealthCheck         bool
+	HealthCheckService  string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	TlsConfig           *tls.Config
+	ShadowDest          string
+	ShadowTimeout       time.Duration
+	Retry               *RetryPolicy
+	Hedge               *HedgePolicy
+	ReplayBufferBytes   int
+}
+
+// upstream is a destination with cached grpc.ClientConn
+type upstream struct {
+	addr     string
+	dialOpts []grpc.DialOption
+	conn     *grpc.ClientConn
+	connErr  error
+	connOnce sync.Once
+	inFlight int64
+	healthy  int32
+	// weight and currentWeight are used by smooth weighted round-robin
+	weight        int
+	currentWeight int
+}
+
+// newUpstream create upstream which is healthy by default
+func newUpstream(addr string, dialOpts []grpc.DialOption) *upstream {
+	u := &upstream{
+		addr:    addr,
+		healthy: 1,
+		weight:  1,
+	}
+
+	// dial options are shared by upstreams of pool, copy them before appending interceptor of this upstream
+	u.dialOpts = append(dialOpts[:len(dialOpts):len(dialOpts)], grpc.WithStreamInterceptor(u.trackInFlight))
+
+	return u
+}
+
+// getConn dial destination lazily, connection would be reused by following requests
+func (u *upstream) getConn() (*grpc.ClientConn, error) {
+	u.connOnce.Do(func() {
+		u.conn, u.connErr = grpc.Dial(u.addr, u.dialOpts...)
+	})
+
+	// upstream was closed before dialing
+	if u.conn == nil && u.connErr == nil {
+		return nil, status.Errorf(codes.Unavailable, "Destination %s is closed", u.addr)
+	}
+
+	return u.conn, u.connErr
+}
+
+// trackInFlight count stream as in-flight until context of stream is done
+func (u *upstream) trackInFlight(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	atomic.AddInt64(&u.inFlight, 1)
+
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		atomic.AddInt64(&u.inFlight, -1)
+		return stream, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		atomic.AddInt64(&u.inFlight, -1)
+	}()
+
+	return stream, err
+}
+
+func (u *upstream) isHealthy() bool {
+	return atomic.LoadInt32(&u.healthy) == 1
+}
+
+func (u *upstream) setHealthy(healthy bool) {
+	if healthy {
+		atomic.StoreInt32(&u.healthy, 1)
+	} else {
+		atomic.StoreInt32(&u.healthy, 0)
+	}
+}
+
+// close connection if dialed
+func (u *upstream) close() {
+	u.connOnce.Do(func() {})
+	if u.conn != nil {
+		u.conn.Close()
+	}
+}
+
+// upstreamPool picks upstream for each request based on load balancer strategy
+type upstreamPool struct {
+	config    *UpstreamConfig
+	upstreams []*upstream
+	counter   uint64
+	ring      []uint32
+	ringNodes map[uint32]*upstream
+	shadow    *upstream
+	lock      sync.Mutex
+	stopCh    chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// newUpstreamPool create pool with destinations, empty destinations would be ignored
+func newUpstreamPool(dest []string, config *UpstreamConfig, offset uint64) *upstreamPool {
+	if config == nil {
+		config = &UpstreamConfig{}
+	}
+
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = defaultHealthCheckInterval
+	}
+
+	if config.HealthCheckTimeout <= 0 {
+		config.HealthCheckTimeout = defaultHealthCheckTimeout
+	}
+
+	if config.ShadowTimeout <= 0 {
+		config.ShadowTimeout = defaultShadowTimeout
+	}
+
+	normalizeReplay(config)
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec())),
+	}
+	if config.TlsConfig != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(config.TlsConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+
+	pool := &upstreamPool{
+		config:    config,
+		upstreams: make([]*upstream, 0),
+		counter:   offset,
+		ringNodes: make(map[uint32]*upstream),
+		stopCh:    make(chan struct{}),
+	}
+
+	for i := range dest {
+		if len(strings.TrimSpace(dest[i])) < 1 {
+			continue
+		}
+
+		u := newUpstream(dest[i], dialOpts)
+		if i < len(config.Weights) && config.Weights[i] >= 0 {
+			u.weight = config.Weights[i]
+		}
+		pool.upstreams = append(pool.upstreams, u)
+
+		// build consistent hash ring
+		for j := 0; j < hashRingReplicas; j++ {
+			h := hashKey(u.addr + "#" + strconv.Itoa(j))
+			pool.ring = append(pool.ring, h)
+			pool.ringNodes[h] = u
+		}
+	}
+
+	sort.Slice(pool.ring, func(i, j int) bool {
+		return pool.ring[i] < pool.ring[j]
+	})
+
+	if len(strings.TrimSpace(config.ShadowDest)) > 0 {
+		pool.shadow = newUpstream(config.ShadowDest, dialOpts)
+	}
+
+	return pool
+}
+
+// isEmpty returns true if there is no destination in pool
+func (pool *upstreamPool) isEmpty() bool {
+	return pool == nil || len(pool.upstreams) < 1
+}
+
+// pick healthy upstream based on load balancer strategy
+func (pool *upstreamPool) pick(ctx context.Context) (*upstream, error) {
+	healthy := make([]*upstream, 0, len(pool.upstreams))
+	for i := range pool.upstreams {
+		if pool.upstreams[i].isHealthy() {
+			healthy = append(healthy, pool.upstreams[i])
+		}
+	}
+
+	if len(healthy) < 1 {
+		return nil, status.Errorf(codes.Unavailable, "No healthy upstream")
+	}
+
+	switch pool.config.LoadBalancer {
+	case LbLeastRequest:
+		return pool.pickLeastRequest(healthy), nil
+	case LbWeighted:
+		return pool.pickWeighted(healthy), nil
+	case LbConsistentHash:
+		if key := getFirstHeaderValue(ctx, pool.config.HashHeader); len(key) > 0 {
+			return pool.pickConsistentHash(key), nil
+		}
+		// fallback to round-robin if header is missing
+		return pool.pickRoundRobin(healthy), nil
+	default:
+		return pool.pickRoundRobin(healthy), nil
+	}
+}
+
+func (pool *upstreamPool) pickRoundRobin(healthy []*upstream) *upstream {
+	next := atomic.AddUint64(&pool.counter, 1)
+	return healthy[next%uint64(len(healthy))]
+}
+
+func (pool *upstreamPool) pickLeastRequest(healthy []*upstream) *upstream {
+	// start from round-robin position, so that ties would be distributed
+	start := int(atomic.AddUint64(&pool.counter, 1) % uint64(len(healthy)))
+
+	res := healthy[start]
+	for i := 1; i < len(healthy); i++ {
+		candidate := healthy[(start+i)%len(healthy)]
+		if atomic.LoadInt64(&candidate.inFlight) < atomic.LoadInt64(&res.inFlight) {
+			res = candidate
+		}
+	}
+
+	return res
+}
+
+// pickWeighted pick upstream with smooth weighted round-robin, weights of healthy upstreams would be used only,
+// fallback to round-robin if all of them are zero.
+func (pool *upstreamPool) pickWeighted(healthy []*upstream) *upstream {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	total := 0
+	var best *upstream
+	for _, u := range healthy {
+		u.currentWeight += u.weight
+		total += u.weight
+		if best == nil || u.currentWeight > best.currentWeight {
+			best = u
+		}
+	}
+
+	if total < 1 {
+		return pool.pickRoundRobin(healthy)
+	}
+
+	best.currentWeight -= total
+	return best
+}
+
+// pickConsistentHash walk through ring clockwise until a healthy upstream found.
+// Caller should make sure there is at least one healthy upstream.
+func (pool *upstreamPool) pickConsistentHash(key string) *upstream {
+	h := hashKey(key)
+	start := sort.Search(len(pool.ring), func(i int) bool {
+		return pool.ring[i] >= h
+	})
+
+	for i := 0; i < len(pool.ring); i++ {
+		u := pool.ringNodes[pool.ring[(start+i)%len(pool.ring)]]
+		if u.isHealthy() {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// start health check in background
+func (pool *upstreamPool) start() {
+	if !pool.config.HealthCheck || pool.isEmpty() {
+		return
+	}
+
+	pool.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(pool.config.HealthCheckInterval)
+			defer ticker.Stop()
+
+			pool.checkHealth()
+			for {
+				select {
+				case <-pool.stopCh:
+					return
+				case <-ticker.C:
+					pool.checkHealth()
+				}
+			}
+		}()
+	})
+}
+
+// stop health check and close connections
+func (pool *upstreamPool) stop() {
+	pool.stopOnce.Do(func() {
+		close(pool.stopCh)
+		for i := range pool.upstreams {
+			pool.upstreams[i].close()
+		}
+		if pool.shadow != nil {
+			pool.shadow.close()
+		}
+	})
+}
+
+// checkHealth call grpc.health.v1.Health/Check for each upstream.
+// Destinations which not implement health service are treated as healthy.
+func (pool *upstreamPool) checkHealth() {
+	for i := range pool.upstreams {
+		u := pool.upstreams[i]
+
+		conn, err := u.getConn()
+		if err != nil {
+			u.setHealthy(false)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), pool.config.HealthCheckTimeout)
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{
+			Service: pool.config.HealthCheckService,
+		})
+		cancel()
+
+		switch {
+		case status.Code(err) == codes.Unimplemented:
+			u.setHealthy(true)
+		case err != nil:
+			u.setHealthy(false)
+		default:
+			u.setHealthy(resp.GetStatus() == healthpb.HealthCheckResponse_SERVING)
+		}
+	}
+}
+
+// getFirstHeaderValue returns first value of header in incoming metadata
+func getFirstHeaderValue(ctx context.Context, key string) string {
+	if len(key) < 1 {
+		return ""
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+	}
+
+	return ""
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestBootConfigProxyUpstream_ToUpstreamConfig(t *testing.T) {
+	boot := &BootConfigProxyUpstream{
+		LoadBalancer: LbConsistentHash,
+		HashHeader:   "x-user-id",
+		Weights:      []int{95, 5},
+	}
+	boot.HealthCheck.Enabled = true
+	boot.HealthCheck.Service = "ut-service"
+	boot.HealthCheck.IntervalMs = 100
+	boot.HealthCheck.TimeoutMs = 10
+	boot.Shadow.Dest = "localhost:1"
+	boot.Shadow.TimeoutMs = 100
+
+	// without TLS
+	config := boot.ToUpstreamConfig()
+	assert.Equal(t, LbConsistentHash, config.LoadBalancer)
+	assert.Equal(t, "x-user-id", config.HashHeader)
+	assert.True(t, config.HealthCheck)
+	assert.Equal(t, "ut-service", config.HealthCheckService)
+	assert.Equal(t, 100*time.Millisecond, config.HealthCheckInterval)
+	assert.Equal(t, 10*time.Millisecond, config.HealthCheckTimeout)
+	assert.Equal(t, []int{95, 5}, config.Weights)
+	assert.Equal(t, "localhost:1", config.ShadowDest)
+	assert.Equal(t, 100*time.Millisecond, config.ShadowTimeout)
+	assert.Nil(t, config.TlsConfig)
+
+	// with TLS
+	boot.Tls.Enabled = true
+	boot.Tls.ServerName = "ut-server"
+	boot.Tls.InsecureSkipVerify = true
+	config = boot.ToUpstreamConfig()
+	assert.NotNil(t, config.TlsConfig)
+	assert.Equal(t, "ut-server", config.TlsConfig.ServerName)
+	assert.True(t, config.TlsConfig.InsecureSkipVerify)
+}
+
+func TestNewUpstreamPool(t *testing.T) {
+	// empty destinations would be ignored
+	pool := newUpstreamPool([]string{"", " "}, nil, 0)
+	assert.True(t, pool.isEmpty())
+	assert.Equal(t, defaultHealthCheckInterval, pool.config.HealthCheckInterval)
+	assert.Equal(t, defaultHealthCheckTimeout, pool.config.HealthCheckTimeout)
+	assert.Equal(t, defaultShadowTimeout, pool.config.ShadowTimeout)
+	assert.Nil(t, pool.shadow)
+
+	pool = newUpstreamPool([]string{"localhost:1", "localhost:2"}, nil, 0)
+	assert.False(t, pool.isEmpty())
+	assert.Len(t, pool.ring, 2*hashRingReplicas)
+
+	// connection would be cached
+	conn1, err := pool.upstreams[0].getConn()
+	assert.Nil(t, err)
+	conn2, _ := pool.upstreams[0].getConn()
+	assert.Equal(t, conn1, conn2)
+
+	pool.stop()
+
+	// with shadow destination
+	pool = newUpstreamPool([]string{"localhost:1"}, &UpstreamConfig{ShadowDest: "localhost:2"}, 0)
+	assert.Equal(t, "localhost:2", pool.shadow.addr)
+	pool.stop()
+}
+
+func TestUpstreamPool_RoundRobin(t *testing.T) {
+	pool := newUpstreamPool([]string{"localhost:1", "localhost:2"}, nil, 0)
+	defer pool.stop()
+
+	first, _ := pool.pick(context.TODO())
+	second, _ := pool.pick(context.TODO())
+	third, _ := pool.pick(context.TODO())
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, first, third)
+
+	// unhealthy upstream would be ejected
+	first.setHealthy(false)
+	for i := 0; i < 3; i++ {
+		u, _ := pool.pick(context.TODO())
+		assert.Equal(t, second, u)
+	}
+
+	// no healthy upstream
+	second.setHealthy(false)
+	u, err := pool.pick(context.TODO())
+	assert.Nil(t, u)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestUpstreamPool_LeastRequest(t *testing.T) {
+	pool := newUpstreamPool([]string{"localhost:1", "localhost:2", "localhost:3"}, &UpstreamConfig{
+		LoadBalancer: LbLeastRequest,
+	}, 0)
+	defer pool.stop()
+
+	pool.upstreams[0].inFlight = 3
+	pool.upstreams[1].inFlight = 1
+	pool.upstreams[2].inFlight = 2
+
+	for i := 0; i < 3; i++ {
+		u, _ := pool.pick(context.TODO())
+		assert.Equal(t, pool.upstreams[1], u)
+	}
+
+	// least one is unhealthy
+	pool.upstreams[1].setHealthy(false)
+	u, _ := pool.pick(context.TODO())
+	assert.Equal(t, pool.upstreams[2], u)
+}
+
+func TestUpstreamPool_ConsistentHash(t *testing.T) {
+	pool := newUpstreamPool([]string{"localhost:1", "localhost:2", "localhost:3"}, &UpstreamConfig{
+		LoadBalancer: LbConsistentHash,
+		HashHeader:   "x-user-id",
+	}, 0)
+	defer pool.stop()
+
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs("x-user-id", "ut-user"))
+	expected, _ := pool.pick(ctx)
+	for i := 0; i < 10; i++ {
+		u, _ := pool.pick(ctx)
+		assert.Equal(t, expected, u)
+	}
+
+	// destination is unhealthy, move to next one on ring
+	expected.setHealthy(false)
+	next, _ := pool.pick(ctx)
+	assert.NotEqual(t, expected, next)
+	assert.True(t, next.isHealthy())
+
+	// destination recovered
+	expected.setHealthy(true)
+	u, _ := pool.pick(ctx)
+	assert.Equal(t, expected, u)
+
+	// fallback to round-robin without header
+	u, err := pool.pick(context.TODO())
+	assert.NotNil(t, u)
+	assert.Nil(t, err)
+}
+
+func TestUpstreamPool_Weighted(t *testing.T) {
+	pool := newUpstreamPool([]string{"localhost:1", "localhost:2", "localhost:3"}, &UpstreamConfig{
+		LoadBalancer: LbWeighted,
+		Weights:      []int{95, 5, 0},
+	}, 0)
+	defer pool.stop()
+
+	count := make(map[*upstream]int)
+	for i := 0; i < 100; i++ {
+		u, _ := pool.pick(context.TODO())
+		count[u]++
+	}
+	assert.Equal(t, 95, count[pool.upstreams[0]])
+	assert.Equal(t, 5, count[pool.upstreams[1]])
+	assert.Equal(t, 0, count[pool.upstreams[2]])
+
+	// unhealthy upstream would be ejected
+	pool.upstreams[0].setHealthy(false)
+	for i := 0; i < 10; i++ {
+		u, _ := pool.pick(context.TODO())
+		assert.Equal(t, pool.upstreams[1], u)
+	}
+
+	// fallback to round-robin if weights of healthy upstreams are zero
+	pool.upstreams[1].setHealthy(false)
+	u, err := pool.pick(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, pool.upstreams[2], u)
+}
+
+func TestUpstreamPool_HealthCheck(t *testing.T) {
+	// server with health service
+	healthLis, _ := net.Listen("tcp", "localhost:0")
+	healthServer := grpc.NewServer()
+	healthService := health.NewServer()
+	healthpb.RegisterHealthServer(healthServer, healthService)
+	go healthServer.Serve(healthLis)
+	defer healthServer.Stop()
+
+	// server without health service
+	plainLis, _ := net.Listen("tcp", "localhost:0")
+	plainServer := grpc.NewServer()
+	go plainServer.Serve(plainLis)
+	defer plainServer.Stop()
+
+	// destination not reachable
+	closedLis, _ := net.Listen("tcp", "localhost:0")
+	closedLis.Close()
+
+	pool := newUpstreamPool([]string{
+		healthLis.Addr().String(),
+		plainLis.Addr().String(),
+		closedLis.Addr().String(),
+	}, &UpstreamConfig{
+		HealthCheck:        true,
+		HealthCheckTimeout: 500 * time.Millisecond,
+	}, 0)
+	defer pool.stop()
+
+	pool.checkHealth()
+	assert.True(t, pool.upstreams[0].isHealthy())
+	assert.True(t, pool.upstreams[1].isHealthy())
+	assert.False(t, pool.upstreams[2].isHealthy())
+
+	// destination reported NOT_SERVING
+	healthService.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	pool.checkHealth()
+	assert.False(t, pool.upstreams[0].isHealthy())
+
+	healthService.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	pool.checkHealth()
+	assert.True(t, pool.upstreams[0].isHealthy())
+}
+
+func TestNewUpstream_WithSharedDialOpts(t *testing.T) {
+	dialOpts := make([]grpc.DialOption, 0, 4)
+	dialOpts = append(dialOpts, grpc.WithInsecure())
+
+	first := newUpstream("localhost:1949", dialOpts)
+	second := newUpstream("localhost:1950", dialOpts)
+
+	// interceptor of first upstream is not overwritten by second one
+	assert.Len(t, first.dialOpts, 2)
+	assert.Len(t, second.dialOpts, 2)
+	assert.NotSame(t, &first.dialOpts[1], &second.dialOpts[1])
+}
+
+func TestUpstream_TrackInFlight(t *testing.T) {
+	u := newUpstream("localhost:1", nil)
+
+	// failed to create stream
+	_, err := u.trackInFlight(context.TODO(), nil, nil, "", func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, status.Error(codes.Unavailable, "")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&u.inFlight))
+
+	// stream is in-flight until context done
+	ctx, cancel := context.WithCancel(context.TODO())
+	u.trackInFlight(ctx, nil, nil, "", func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, nil
+	})
+	assert.Equal(t, int64(1), atomic.LoadInt64(&u.inFlight))
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&u.inFlight) == 0
+	}, time.Second, 10*time.Millisecond)
+}
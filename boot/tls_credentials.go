@@ -0,0 +1,76 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/soheilhy/cmux"
+	"google.golang.org/grpc/credentials"
+)
+
+// listenerTlsCredentials implements credentials.TransportCredentials.
+//
+// TLS handshake is done by listener before connection routed by cmux, as a result, grpc server could not see TLS
+// state of connection. listenerTlsCredentials would not do handshake again, it only expose TLS state of connection
+// as credentials.TLSInfo, so that handlers could get peer certificate with peer.FromContext().
+type listenerTlsCredentials struct{}
+
+// newListenerTlsCredentials create new listenerTlsCredentials
+func newListenerTlsCredentials() credentials.TransportCredentials {
+	return &listenerTlsCredentials{}
+}
+
+// ClientHandshake is not supported
+func (c *listenerTlsCredentials) ClientHandshake(ctx context.Context, s string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("client handshake is not supported")
+}
+
+// ServerHandshake extract TLS state from connection accepted by TLS listener
+func (c *listenerTlsCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	raw := conn
+	if muxConn, ok := raw.(*cmux.MuxConn); ok {
+		raw = muxConn.Conn
+	}
+
+	tlsConn, ok := raw.(*tls.Conn)
+	if !ok {
+		// not a TLS connection, nothing to expose
+		return conn, nil, nil
+	}
+
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, nil, err
+	}
+
+	return conn, credentials.TLSInfo{
+		State: tlsConn.ConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{
+			SecurityLevel: credentials.PrivacyAndIntegrity,
+		},
+	}, nil
+}
+
+// Info returns protocol info
+func (c *listenerTlsCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: "tls",
+		SecurityVersion:  "1.2",
+	}
+}
+
+// Clone returns a copy of listenerTlsCredentials
+func (c *listenerTlsCredentials) Clone() credentials.TransportCredentials {
+	return &listenerTlsCredentials{}
+}
+
+// OverrideServerName is not supported
+func (c *listenerTlsCredentials) OverrideServerName(s string) error {
+	return nil
+}
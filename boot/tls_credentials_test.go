@@ -0,0 +1,36 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenerTlsCredentials(t *testing.T) {
+	creds := newListenerTlsCredentials()
+
+	// client handshake is not supported
+	_, _, err := creds.ClientHandshake(context.TODO(), "", nil)
+	assert.NotNil(t, err)
+
+	// plain connection should be passed through without auth info
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn, authInfo, err := creds.ServerHandshake(server)
+	assert.Nil(t, err)
+	assert.Nil(t, authInfo)
+	assert.Equal(t, server, conn)
+
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+	assert.NotNil(t, creds.Clone())
+	assert.Nil(t, creds.OverrideServerName(""))
+}
@@ -5,7 +5,9 @@ go 1.17
 require (
 	github.com/golang-jwt/jwt/v4 v4.4.2
 	github.com/grpc-ecosystem/grpc-gateway/v2 v2.10.3
+	github.com/klauspost/compress v1.15.9
 	github.com/prometheus/client_golang v1.12.2
+	github.com/prometheus/client_model v0.2.0
 	github.com/rookie-ninja/rk-entry/v2 v2.2.3
 	github.com/rookie-ninja/rk-logger v1.2.11
 	github.com/rookie-ninja/rk-query v1.2.14
@@ -39,7 +41,6 @@ require (
 	github.com/pelletier/go-toml v1.9.5 // indirect
 	github.com/pelletier/go-toml/v2 v2.0.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/common v0.32.1 // indirect
 	github.com/prometheus/procfs v0.7.3 // indirect
 	github.com/spf13/afero v1.8.2 // indirect
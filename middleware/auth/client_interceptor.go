@@ -0,0 +1,81 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcauth
+
+import (
+	"context"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkmidauth "github.com/rookie-ninja/rk-entry/v2/middleware/auth"
+	rkgrpcerr "github.com/tegarajipangestu/rk-grpc/v2/boot/error"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryClientInterceptor create new unary client interceptor.
+//
+// Credentials attached to outgoing metadata would be validated before sending request to server.
+func UnaryClientInterceptor(opts ...rkmidauth.Option) grpc.UnaryClientInterceptor {
+	set := rkmidauth.NewOptionSet(opts...)
+
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		// 1: create beforeCtx
+		beforeCtx := set.BeforeCtx(nil)
+		beforeCtx.Input.UrlPath = method
+
+		// 2: assign values
+		md, _ := metadata.FromOutgoingContext(ctx)
+		beforeCtx.Input.BasicAuthHeader = getFirstHeader(md, rkmid.HeaderAuthorization)
+		beforeCtx.Input.ApiKeyHeader = getFirstHeader(md, rkmid.HeaderApiKey)
+
+		// 3: call before
+		set.Before(beforeCtx)
+
+		// case 1: return to caller if error occur
+		if beforeCtx.Output.ErrResp != nil {
+			return rkgrpcerr.Unauthenticated(beforeCtx.Output.ErrResp.Message()).Err()
+		}
+
+		// case 2: authorized, call next
+		return invoker(ctx, method, req, resp, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor create new stream client interceptor.
+//
+// Credentials attached to outgoing metadata would be validated before creating stream.
+func StreamClientInterceptor(opts ...rkmidauth.Option) grpc.StreamClientInterceptor {
+	set := rkmidauth.NewOptionSet(opts...)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		// 1: create beforeCtx
+		beforeCtx := set.BeforeCtx(nil)
+		beforeCtx.Input.UrlPath = method
+
+		// 2: assign values
+		md, _ := metadata.FromOutgoingContext(ctx)
+		beforeCtx.Input.BasicAuthHeader = getFirstHeader(md, rkmid.HeaderAuthorization)
+		beforeCtx.Input.ApiKeyHeader = getFirstHeader(md, rkmid.HeaderApiKey)
+
+		// 3: call before
+		set.Before(beforeCtx)
+
+		// case 1: return to caller if error occur
+		if beforeCtx.Output.ErrResp != nil {
+			return nil, rkgrpcerr.Unauthenticated(beforeCtx.Output.ErrResp.Message()).Err()
+		}
+
+		// case 2: authorized, call next
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkgrpcauthz is authorization interceptor for grpc framework
+package rkgrpcauthz
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v4"
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkgrpcerr "github.com/tegarajipangestu/rk-grpc/v2/boot/error"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor create new unary server interceptor.
+//
+// Roles of caller are collected from JWT, API key and verified client certificate, JWT middleware should be placed before.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	set := newOptionSet(opts...)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = rkgrpcmid.WrapContextForServer(ctx)
+		rkgrpcmid.AddToServerContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		if err := before(ctx, set, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor create new stream server interceptor.
+//
+// Roles of caller are collected from JWT, API key and verified client certificate, JWT middleware should be placed before.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	set := newOptionSet(opts...)
+
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		// Before invoking
+		wrappedStream := rkgrpcctx.WrapServerStream(stream)
+		wrappedStream.WrappedContext = rkgrpcmid.WrapContextForServer(wrappedStream.WrappedContext)
+
+		rkgrpcmid.AddToServerContextPayload(wrappedStream.WrappedContext, rkmid.EntryNameKey, set.GetEntryName())
+
+		if err := before(wrappedStream.WrappedContext, set, info.FullMethod); err != nil {
+			return err
+		}
+
+		// Invoking
+		return handler(srv, wrappedStream)
+	}
+}
+
+// before returns PermissionDenied error with reason as detail if caller is not allowed, nil would be returned in dry run mode
+func before(ctx context.Context, set *optionSet, method string) error {
+	if set.ShouldIgnore(method) {
+		return nil
+	}
+
+	reason := set.authorize(method, getIdentity(ctx, set))
+	if len(reason) < 1 {
+		return nil
+	}
+
+	// case 1: dry run, log and allow
+	if set.dryRun {
+		rkgrpcctx.GetEvent(ctx).AddPair("authzDryRunDenied", reason)
+		rkgrpcctx.GetLogger(ctx).Warn("Permission denied in dry run mode", zap.String("reason", reason))
+		return nil
+	}
+
+	// case 2: denied
+	return rkgrpcerr.PermissionDenied("Permission denied", status.Error(codes.PermissionDenied, reason)).Err()
+}
+
+// getIdentity collect roles and claims of caller from context
+func getIdentity(ctx context.Context, set *optionSet) *identity {
+	id := &identity{
+		roles:  make([]string, 0),
+		claims: jwt.MapClaims{},
+	}
+
+	// 1: JWT
+	id.claims = rkgrpcctx.GetJwtClaims(ctx)
+	id.addRoles(rkgrpcctx.ClaimToStrings(id.claims[set.roleClaim])...)
+
+	// 2: API key
+	if keys := rkgrpcctx.GetIncomingHeaders(ctx).Get(rkmid.HeaderApiKey); len(keys) > 0 {
+		id.addRoles(set.apiKeyRoles[keys[0]]...)
+	}
+
+	// 3: subject and SANs of verified client certificate
+	if subject := rkgrpcctx.GetPeerSubject(ctx); len(subject) > 0 {
+		id.addRoles(set.peerRoles[subject]...)
+		for _, san := range rkgrpcctx.GetPeerSANs(ctx) {
+			id.addRoles(set.peerRoles[san]...)
+		}
+	}
+
+	return id
+}
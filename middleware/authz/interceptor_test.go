@@ -0,0 +1,158 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcauthz
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	rkerror "github.com/tegarajipangestu/rk-grpc/v2/boot/error/gen"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var utPolicies = WithPolicies(
+	&Policy{Methods: []string{"/ut.v1.Admin/*"}, Roles: []string{"admin"}},
+	&Policy{Methods: []string{"/ut.v1.Greeter/*"}, Roles: []string{"reader"}},
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	inter := UnaryServerInterceptor(utPolicies, WithApiKeyRoles(map[string][]string{"ut-key": {"admin"}}))
+
+	// case 1: denied with reason in detail
+	_, err := inter(newUnaryServerInput(context.TODO(), "/ut.v1.Admin/Delete"))
+	st := status.Convert(err)
+	assert.Equal(t, codes.PermissionDenied, st.Code())
+	assert.Len(t, st.Details(), 2)
+	assert.Contains(t, st.Details()[1].(*rkerror.ErrorDetail).Message, "requires one of roles [admin]")
+
+	// case 2: allowed by API key
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(rkmid.HeaderApiKey, "ut-key"))
+	_, err = inter(newUnaryServerInput(ctx, "/ut.v1.Admin/Delete"))
+	assert.Nil(t, err)
+
+	// case 3: ignored path
+	inter = UnaryServerInterceptor(utPolicies, WithPathToIgnore("/ut.v1.Admin"))
+	_, err = inter(newUnaryServerInput(context.TODO(), "/ut.v1.Admin/Delete"))
+	assert.Nil(t, err)
+
+	// case 4: dry run
+	inter = UnaryServerInterceptor(utPolicies, WithDryRun(true))
+	_, err = inter(newUnaryServerInput(context.TODO(), "/ut.v1.Admin/Delete"))
+	assert.Nil(t, err)
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	inter := StreamServerInterceptor(utPolicies)
+
+	// case 1: denied
+	err := inter(newStreamServerInput(context.TODO(), "/ut.v1.Greeter/Stream"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// case 2: allowed by JWT
+	ctx := context.WithValue(context.TODO(), rkmid.JwtTokenKey, &jwt.Token{
+		Claims: jwt.MapClaims{DefaultRoleClaim: []interface{}{"reader"}},
+	})
+	err = inter(newStreamServerInput(ctx, "/ut.v1.Greeter/Stream"))
+	assert.Nil(t, err)
+
+	// case 3: dry run
+	inter = StreamServerInterceptor(utPolicies, WithDryRun(true))
+	err = inter(newStreamServerInput(context.TODO(), "/ut.v1.Greeter/Stream"))
+	assert.Nil(t, err)
+}
+
+func TestGetIdentity(t *testing.T) {
+	set := newOptionSet(
+		WithRoleClaim("groups"),
+		WithApiKeyRoles(map[string][]string{"ut-key": {"operator"}}),
+		WithPeerRoles(map[string][]string{
+			"CN=ut-client":           {"reader"},
+			"spiffe://ut.org/client": {"writer"},
+		}))
+
+	// empty
+	id := getIdentity(context.TODO(), set)
+	assert.Empty(t, id.roles)
+
+	// JWT, API key and peer certificate
+	ctx := context.WithValue(context.TODO(), rkmid.JwtTokenKey, &jwt.Token{
+		Claims: jwt.MapClaims{"groups": "admin", "tenant": "acme"},
+	})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(rkmid.HeaderApiKey, "ut-key"))
+	ctx = peer.NewContext(ctx, &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{{
+					Subject: pkix.Name{CommonName: "ut-client"},
+					URIs:    []*url.URL{{Scheme: "spiffe", Host: "ut.org", Path: "/client"}},
+				}}},
+			},
+		},
+	})
+
+	id = getIdentity(ctx, set)
+	assert.Equal(t, []string{"admin", "operator", "reader", "writer"}, id.roles)
+	assert.True(t, id.hasClaim("tenant", "acme"))
+}
+
+// ************ Test utility ************
+
+type ServerStreamMock struct {
+	ctx context.Context
+}
+
+func (f ServerStreamMock) SetHeader(md metadata.MD) error {
+	return nil
+}
+
+func (f ServerStreamMock) SendHeader(md metadata.MD) error {
+	return nil
+}
+
+func (f ServerStreamMock) SetTrailer(md metadata.MD) {
+	return
+}
+
+func (f ServerStreamMock) Context() context.Context {
+	return f.ctx
+}
+
+func (f ServerStreamMock) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (f ServerStreamMock) RecvMsg(m interface{}) error {
+	return nil
+}
+
+func newUnaryServerInput(ctx context.Context, method string) (context.Context, interface{}, *grpc.UnaryServerInfo, grpc.UnaryHandler) {
+	return ctx, nil,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		}
+}
+
+func newStreamServerInput(ctx context.Context, method string) (interface{}, grpc.ServerStream, *grpc.StreamServerInfo, grpc.StreamHandler) {
+	return nil,
+		ServerStreamMock{ctx: ctx},
+		&grpc.StreamServerInfo{FullMethod: method},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			return nil
+		}
+}
@@ -0,0 +1,340 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcauthz
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+)
+
+const (
+	// DefaultRoleClaim is claim of JWT which contains roles of caller.
+	DefaultRoleClaim = "roles"
+)
+
+// ***************** Policy *****************
+
+// Policy allows callers to call methods.
+//
+// 1: Methods: Glob patterns of grpc methods, * matches any characters and ? matches single character.
+// 2: Roles: Caller must have one of roles, any caller would be allowed if empty.
+// 3: Claims: Claims of JWT caller must have with value.
+type Policy struct {
+	Methods []string
+	Roles   []string
+	Claims  map[string]string
+	regexps []*regexp.Regexp
+}
+
+// compile convert glob patterns of methods into regex
+func (p *Policy) compile() {
+	p.regexps = make([]*regexp.Regexp, 0, len(p.Methods))
+
+	for i := range p.Methods {
+		pattern := regexp.QuoteMeta(p.Methods[i])
+		pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+		pattern = strings.ReplaceAll(pattern, `\?`, ".")
+		p.regexps = append(p.regexps, regexp.MustCompile("^"+pattern+"$"))
+	}
+}
+
+// matchMethod returns true if method matches any of patterns
+func (p *Policy) matchMethod(method string) bool {
+	for i := range p.regexps {
+		if p.regexps[i].MatchString(method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evaluate returns reason if caller is not allowed by policy, empty string would be returned if allowed
+func (p *Policy) evaluate(method string, id *identity) string {
+	if len(p.Roles) > 0 && !id.hasAnyRole(p.Roles) {
+		return fmt.Sprintf("method %s requires one of roles %v, caller has roles %v", method, p.Roles, id.roles)
+	}
+
+	for k, v := range p.Claims {
+		if !id.hasClaim(k, v) {
+			return fmt.Sprintf("method %s requires claim %s with value %s", method, k, v)
+		}
+	}
+
+	return ""
+}
+
+// ***************** Identity *****************
+
+// identity of caller collected from JWT, API key and peer certificate
+type identity struct {
+	roles  []string
+	claims jwt.MapClaims
+}
+
+// addRoles add roles to identity without duplication
+func (id *identity) addRoles(roles ...string) {
+	for i := range roles {
+		if len(roles[i]) > 0 && !id.hasAnyRole(roles[i:i+1]) {
+			id.roles = append(id.roles, roles[i])
+		}
+	}
+}
+
+// hasAnyRole returns true if identity has any of roles
+func (id *identity) hasAnyRole(roles []string) bool {
+	for i := range roles {
+		for j := range id.roles {
+			if roles[i] == id.roles[j] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hasClaim returns true if claim equals to value or contains value if claim is a list
+func (id *identity) hasClaim(key, value string) bool {
+	for _, v := range rkgrpcctx.ClaimToStrings(id.claims[key]) {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ***************** OptionSet *****************
+
+// Options which is used while initializing extension interceptor
+type optionSet struct {
+	entryName    string
+	entryType    string
+	dryRun       bool
+	roleClaim    string
+	apiKeyRoles  map[string][]string
+	peerRoles    map[string][]string
+	policies     []*Policy
+	pathToIgnore []string
+}
+
+// newOptionSet Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:    "fake-entry",
+		entryType:    "",
+		roleClaim:    DefaultRoleClaim,
+		apiKeyRoles:  make(map[string][]string),
+		peerRoles:    make(map[string][]string),
+		policies:     make([]*Policy, 0),
+		pathToIgnore: []string{},
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// ShouldIgnore determine whether authorization should be ignored based on path
+func (set *optionSet) ShouldIgnore(path string) bool {
+	for i := range set.pathToIgnore {
+		if strings.HasPrefix(path, set.pathToIgnore[i]) {
+			return true
+		}
+	}
+
+	return rkmid.ShouldIgnoreGlobal(path)
+}
+
+// authorize returns reason if caller is not allowed to call method, empty string would be returned if allowed.
+//
+// Caller is allowed if any of policies matched method allows it, methods without any policy would be denied.
+func (set *optionSet) authorize(method string, id *identity) string {
+	reason := ""
+
+	for _, p := range set.policies {
+		if !p.matchMethod(method) {
+			continue
+		}
+
+		res := p.evaluate(method, id)
+		if len(res) < 1 {
+			return ""
+		}
+
+		// keep reason of first policy matched method
+		if len(reason) < 1 {
+			reason = res
+		}
+	}
+
+	if len(reason) < 1 {
+		reason = fmt.Sprintf("no policy allows method %s", method)
+	}
+
+	return reason
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML
+type BootConfig struct {
+	Enabled     bool               `yaml:"enabled" json:"enabled"`
+	Ignore      []string           `yaml:"ignore" json:"ignore"`
+	DryRun      bool               `yaml:"dryRun" json:"dryRun"`
+	RoleClaim   string             `yaml:"roleClaim" json:"roleClaim"`
+	ApiKeyRoles []string           `yaml:"apiKeyRoles" json:"apiKeyRoles"`
+	PeerRoles   []string           `yaml:"peerRoles" json:"peerRoles"`
+	Policies    []BootConfigPolicy `yaml:"policies" json:"policies"`
+}
+
+// BootConfigPolicy Boot config of policy, claims are pairs of key:value.
+type BootConfigPolicy struct {
+	Methods []string `yaml:"methods" json:"methods"`
+	Roles   []string `yaml:"roles" json:"roles"`
+	Claims  []string `yaml:"claims" json:"claims"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		policies := make([]*Policy, 0)
+		for _, element := range config.Policies {
+			policy := &Policy{
+				Methods: element.Methods,
+				Roles:   element.Roles,
+				Claims:  make(map[string]string),
+			}
+
+			for _, pair := range element.Claims {
+				tokens := strings.SplitN(pair, ":", 2)
+				if len(tokens) == 2 {
+					policy.Claims[strings.TrimSpace(tokens[0])] = strings.TrimSpace(tokens[1])
+				}
+			}
+
+			policies = append(policies, policy)
+		}
+
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithDryRun(config.DryRun),
+			WithRoleClaim(config.RoleClaim),
+			WithApiKeyRoles(toRoles(config.ApiKeyRoles)),
+			WithPeerRoles(toRoles(config.PeerRoles)),
+			WithPolicies(policies...),
+			WithPathToIgnore(config.Ignore...))
+	}
+
+	return opts
+}
+
+// toRoles convert pairs of identity:role into map, identity may contain colon, like URI of peer certificate
+func toRoles(pairs []string) map[string][]string {
+	res := make(map[string][]string)
+
+	for _, pair := range pairs {
+		index := strings.LastIndex(pair, ":")
+		if index < 1 || index == len(pair)-1 {
+			continue
+		}
+
+		key := strings.TrimSpace(pair[:index])
+		res[key] = append(res[key], strings.TrimSpace(pair[index+1:]))
+	}
+
+	return res
+}
+
+// ***************** Option *****************
+
+// Option options provided to Interceptor or optionsSet while creating
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithDryRun provide dry run mode, denied calls would be logged and allowed.
+func WithDryRun(dryRun bool) Option {
+	return func(set *optionSet) {
+		set.dryRun = dryRun
+	}
+}
+
+// WithRoleClaim provide claim of JWT which contains roles, either a string or a list of string.
+func WithRoleClaim(claim string) Option {
+	return func(set *optionSet) {
+		if len(claim) > 0 {
+			set.roleClaim = claim
+		}
+	}
+}
+
+// WithApiKeyRoles provide roles of API keys in X-API-Key header.
+func WithApiKeyRoles(roles map[string][]string) Option {
+	return func(set *optionSet) {
+		for k, v := range roles {
+			set.apiKeyRoles[k] = append(set.apiKeyRoles[k], v...)
+		}
+	}
+}
+
+// WithPeerRoles provide roles of verified client certificates, key is subject or any of subject alternative names.
+func WithPeerRoles(roles map[string][]string) Option {
+	return func(set *optionSet) {
+		for k, v := range roles {
+			set.peerRoles[k] = append(set.peerRoles[k], v...)
+		}
+	}
+}
+
+// WithPolicies provide policies, methods without any policy would be denied.
+func WithPolicies(policies ...*Policy) Option {
+	return func(set *optionSet) {
+		for i := range policies {
+			if policies[i] != nil {
+				policies[i].compile()
+				set.policies = append(set.policies, policies[i])
+			}
+		}
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will ignore.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
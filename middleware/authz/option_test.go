@@ -0,0 +1,114 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcauthz
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{
+		Enabled:     false,
+		Ignore:      []string{"/ut-ignore"},
+		DryRun:      true,
+		RoleClaim:   "groups",
+		ApiKeyRoles: []string{"ut-key:admin", "ut-key:reader", "invalid", "ut-other:"},
+		PeerRoles:   []string{"spiffe://ut.org/client:reader"},
+		Policies: []BootConfigPolicy{
+			{
+				Methods: []string{"/ut.v1.Admin/*"},
+				Roles:   []string{"admin"},
+				Claims:  []string{"tenant: acme", "invalid"},
+			},
+		},
+	}
+
+	// case 1: disabled
+	assert.Empty(t, ToOptions(config, "ut-entry", "ut-type"))
+
+	// case 2: enabled
+	config.Enabled = true
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.True(t, set.dryRun)
+	assert.Equal(t, "groups", set.roleClaim)
+	assert.Equal(t, map[string][]string{"ut-key": {"admin", "reader"}}, set.apiKeyRoles)
+	assert.Equal(t, map[string][]string{"spiffe://ut.org/client": {"reader"}}, set.peerRoles)
+	assert.Len(t, set.policies, 1)
+	assert.Equal(t, map[string]string{"tenant": "acme"}, set.policies[0].Claims)
+	assert.True(t, set.ShouldIgnore("/ut-ignore"))
+	assert.False(t, set.ShouldIgnore("/ut"))
+}
+
+func TestNewOptionSet(t *testing.T) {
+	set := newOptionSet(WithRoleClaim(""), WithPolicies(nil))
+	assert.Equal(t, DefaultRoleClaim, set.roleClaim)
+	assert.False(t, set.dryRun)
+	assert.Empty(t, set.policies)
+}
+
+func TestPolicy_MatchMethod(t *testing.T) {
+	p := &Policy{
+		Methods: []string{"/ut.v1.Greeter/Get*", "/ut.v?.Admin/*", "/ut.v3.*"},
+	}
+	p.compile()
+
+	assert.True(t, p.matchMethod("/ut.v1.Greeter/GetUser"))
+	assert.False(t, p.matchMethod("/ut.v1.Greeter/DeleteUser"))
+	assert.True(t, p.matchMethod("/ut.v2.Admin/Delete"))
+	assert.False(t, p.matchMethod("/ut.v10.Admin/Delete"))
+	assert.True(t, p.matchMethod("/ut.v3.Greeter/DeleteUser"))
+	// dot is not wildcard
+	assert.False(t, p.matchMethod("/utxv1.Greeter/GetUser"))
+}
+
+func TestOptionSet_Authorize(t *testing.T) {
+	set := newOptionSet(WithPolicies(
+		&Policy{Methods: []string{"/ut.v1.Public/*"}},
+		&Policy{Methods: []string{"/ut.v1.Admin/*"}, Roles: []string{"admin"}},
+		&Policy{Methods: []string{"/ut.v1.Admin/*"}, Roles: []string{"operator"}, Claims: map[string]string{"tenant": "acme"}},
+	))
+
+	anonymous := &identity{}
+	admin := &identity{roles: []string{"admin"}}
+	operator := &identity{
+		roles:  []string{"operator"},
+		claims: jwt.MapClaims{"tenant": []interface{}{"other", "acme"}},
+	}
+	otherOperator := &identity{
+		roles:  []string{"operator"},
+		claims: jwt.MapClaims{"tenant": "other"},
+	}
+
+	// policy without roles allows any caller
+	assert.Empty(t, set.authorize("/ut.v1.Public/Get", anonymous))
+
+	// roles and claims
+	assert.Empty(t, set.authorize("/ut.v1.Admin/Delete", admin))
+	assert.Empty(t, set.authorize("/ut.v1.Admin/Delete", operator))
+	assert.Contains(t, set.authorize("/ut.v1.Admin/Delete", anonymous), "requires one of roles [admin]")
+	assert.Contains(t, set.authorize("/ut.v1.Admin/Delete", otherOperator), "requires one of roles [admin]")
+
+	// no policy
+	assert.Equal(t, "no policy allows method /ut.v1.Other/Get", set.authorize("/ut.v1.Other/Get", admin))
+
+	// claim mismatched
+	set = newOptionSet(WithPolicies(&Policy{Methods: []string{"*"}, Claims: map[string]string{"tenant": "acme"}}))
+	assert.Equal(t, "method /ut.v1.Other/Get requires claim tenant with value acme",
+		set.authorize("/ut.v1.Other/Get", otherOperator))
+}
+
+func TestIdentity(t *testing.T) {
+	id := &identity{}
+	id.addRoles("admin", "", "reader", "admin")
+	assert.Equal(t, []string{"admin", "reader"}, id.roles)
+	assert.True(t, id.hasAnyRole([]string{"other", "reader"}))
+	assert.False(t, id.hasAnyRole([]string{"other"}))
+}
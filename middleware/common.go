@@ -8,13 +8,17 @@ package rkgrpcmid
 
 import (
 	"context"
+	"fmt"
 	"github.com/rookie-ninja/rk-entry/v2/middleware"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"io"
 	"net"
 	"path"
 	"strings"
+	"sync"
 )
 
 var (
@@ -23,6 +27,7 @@ var (
 	LocalHostname = zap.String("localHostname", rkmid.LocalHostname.String)
 
 	serverPayloadKey = &serverPayload{}
+	clientPayloadKey = &clientPayload{}
 )
 
 // RpcPayloadAppended a flag used in inner middleware
@@ -34,6 +39,11 @@ type serverPayload struct {
 	m map[interface{}]interface{}
 }
 
+type clientPayload struct {
+	incomingHeaders *metadata.MD
+	m               map[interface{}]interface{}
+}
+
 // GetGwInfo Extract gateway related information from metadata.
 func GetGwInfo(md metadata.MD) (gwMethod, gwPath, gwScheme, gwUserAgent string) {
 	gwMethod, gwPath, gwScheme, gwUserAgent = "", "", "", ""
@@ -144,6 +154,117 @@ func GetRemoteAddressSet(ctx context.Context) (ip, port, netType string) {
 	return ip, port, netType
 }
 
+// ParseTrustedProxies parse list of IP or CIDR of trusted proxies.
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	res := make([]*net.IPNet, 0, len(proxies))
+
+	for _, raw := range proxies {
+		raw = strings.TrimSpace(raw)
+		if len(raw) < 1 {
+			continue
+		}
+
+		if !strings.Contains(raw, "/") {
+			ip := net.ParseIP(raw)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %s, expect IP or CIDR", raw)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, cidr, err := net.ParseCIDR(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s, %v", raw, err)
+		}
+
+		res = append(res, cidr)
+	}
+
+	return res, nil
+}
+
+// GetPeerAddressSet Read remote Ip and port of transport peer.
+//
+// Addresses forwarded in metadata are client supplied, they are respected only if peer is loopback, which is the
+// gateway of entry, or one of trusted proxies:
+// 1: x-forwarded-remote-addr
+// 2: right-most address in x-forwarded-for which is not a trusted proxy
+// 3: x-real-ip
+func GetPeerAddressSet(ctx context.Context, trustedProxies []*net.IPNet) (ip, port string) {
+	ip, port = "0.0.0.0", "0"
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, pt, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			ip, port = host, pt
+		}
+	}
+
+	if !isTrustedProxy(ip, trustedProxies) {
+		return localhostOf(ip), port
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if fwdIp, fwdPort := GetRemoteAddressSetFromMeta(md); len(fwdIp) > 0 {
+		return fwdIp, fwdPort
+	}
+
+	hops := make([]string, 0)
+	for _, v := range md.Get("x-forwarded-for") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); len(hop) > 0 {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !isTrustedProxy(hops[i], trustedProxies) || i == 0 {
+			return localhostOf(hops[i]), "0"
+		}
+	}
+
+	if v := md.Get("x-real-ip"); len(v) > 0 && len(strings.TrimSpace(v[0])) > 0 {
+		return localhostOf(strings.TrimSpace(v[0])), "0"
+	}
+
+	return localhostOf(ip), port
+}
+
+// isTrustedProxy returns true if ip is loopback or in one of trusted proxies
+func isTrustedProxy(raw string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return raw == "localhost"
+	}
+
+	if ip.IsLoopback() {
+		return true
+	}
+
+	for _, cidr := range trustedProxies {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// localhostOf replace IPv6 loopback with localhost as GetRemoteAddressSet does
+func localhostOf(ip string) string {
+	if ip == "::1" {
+		return "localhost"
+	}
+
+	return ip
+}
+
 // MergeToOutgoingMD Merge md to context outgoing metadata.
 func MergeToOutgoingMD(ctx context.Context, md metadata.MD) context.Context {
 	if appended := ctx.Value(RpcPayloadAppended); appended == nil {
@@ -231,3 +352,125 @@ func ContainsServerPayload(ctx context.Context) bool {
 func GetServerPayloadKey() interface{} {
 	return serverPayloadKey
 }
+
+// WrapContextForClient Wrap client context.
+func WrapContextForClient(ctx context.Context) context.Context {
+	if v := ctx.Value(clientPayloadKey); v != nil {
+		return ctx
+	}
+
+	md := metadata.Pairs()
+	return context.WithValue(ctx, clientPayloadKey, clientPayload{
+		incomingHeaders: &md,
+		m:               make(map[interface{}]interface{}),
+	})
+}
+
+// GetClientContextPayload get context payload injected into client side context
+func GetClientContextPayload(ctx context.Context) map[interface{}]interface{} {
+	if ctx == nil {
+		return make(map[interface{}]interface{})
+	}
+
+	if v := ctx.Value(clientPayloadKey); v != nil {
+		return v.(clientPayload).m
+	}
+
+	return make(map[interface{}]interface{})
+}
+
+// AddToClientContextPayload add k/v into payload injected into client side context
+func AddToClientContextPayload(ctx context.Context, key interface{}, value interface{}) {
+	if value != nil {
+		GetClientContextPayload(ctx)[key] = value
+	}
+}
+
+// GetIncomingHeadersOfClient get headers returned from server which injected into client side context
+func GetIncomingHeadersOfClient(ctx context.Context) *metadata.MD {
+	if ctx == nil {
+		md := metadata.Pairs()
+		return &md
+	}
+
+	if v := ctx.Value(clientPayloadKey); v != nil {
+		return v.(clientPayload).incomingHeaders
+	}
+
+	md := metadata.Pairs()
+	return &md
+}
+
+// ContainsClientPayload is payload injected into client side context?
+func ContainsClientPayload(ctx context.Context) bool {
+	if v := ctx.Value(clientPayloadKey); v != nil {
+		return true
+	}
+
+	return false
+}
+
+// GetClientPayloadKey get client payload key used in context.Context
+func GetClientPayloadKey() interface{} {
+	return clientPayloadKey
+}
+
+// WrapClientStreamWithFinish wraps client stream, finish would be called once with status of stream when stream
+// finished, which is the first error of RecvMsg, Header or CloseSend, io.EOF is reported as nil.
+//
+// Stream without server streaming is finished once response is received.
+func WrapClientStreamWithFinish(stream grpc.ClientStream, desc *grpc.StreamDesc, finish func(error)) grpc.ClientStream {
+	return &finishClientStream{
+		ClientStream:  stream,
+		serverStreams: desc != nil && desc.ServerStreams,
+		finish:        finish,
+	}
+}
+
+// finishClientStream calls finish once stream finished
+type finishClientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	once          sync.Once
+	finish        func(error)
+}
+
+// RecvMsg receives message, stream is finished with error or io.EOF, or response of stream without server streaming
+func (s *finishClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || !s.serverStreams {
+		s.done(err)
+	}
+
+	return err
+}
+
+// Header returns header, stream is finished if failed
+func (s *finishClientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.done(err)
+	}
+
+	return md, err
+}
+
+// CloseSend closes send direction, stream is finished if failed
+func (s *finishClientStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.done(err)
+	}
+
+	return err
+}
+
+func (s *finishClientStream) done(err error) {
+	if err == io.EOF {
+		err = nil
+	}
+
+	s.once.Do(func() {
+		s.finish(err)
+	})
+}
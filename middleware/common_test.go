@@ -8,8 +8,15 @@ package rkgrpcmid
 import (
 	"context"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"io"
+	"net"
+	"strings"
 	"testing"
 )
 
@@ -105,6 +112,69 @@ func TestGetRemoteAddressSet(t *testing.T) {
 	assert.Equal(t, "ut-net", netType)
 }
 
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.168.1.1 ", "", "fd00::1"})
+	assert.Nil(t, err)
+	assert.Len(t, proxies, 3)
+	assert.True(t, proxies[0].Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, proxies[1].Contains(net.ParseIP("192.168.1.1")))
+	assert.False(t, proxies[1].Contains(net.ParseIP("192.168.1.2")))
+	assert.True(t, proxies[2].Contains(net.ParseIP("fd00::1")))
+
+	// invalid IP and CIDR
+	_, err = ParseTrustedProxies([]string{"ut-proxy"})
+	assert.NotNil(t, err)
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/99"})
+	assert.NotNil(t, err)
+}
+
+func TestGetPeerAddressSet(t *testing.T) {
+	withPeer := func(addr string, pairs ...string) context.Context {
+		tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+		ctx := peer.NewContext(context.TODO(), &peer.Peer{Addr: tcpAddr})
+		return metadata.NewIncomingContext(ctx, metadata.Pairs(pairs...))
+	}
+	trusted, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+
+	// missing peer
+	ip, port := GetPeerAddressSet(context.TODO(), nil)
+	assert.Equal(t, "0.0.0.0", ip)
+	assert.Equal(t, "0", port)
+
+	// forwarded addresses from untrusted peer are ignored
+	ctx := withPeer("1.1.1.1:8080",
+		"x-forwarded-remote-addr", "2.2.2.2:1",
+		"x-forwarded-for", "3.3.3.3",
+		"x-real-ip", "4.4.4.4")
+	ip, port = GetPeerAddressSet(ctx, trusted)
+	assert.Equal(t, "1.1.1.1", ip)
+	assert.Equal(t, "8080", port)
+
+	// gateway of entry dials over loopback
+	ip, port = GetPeerAddressSet(withPeer("127.0.0.1:8080", "x-forwarded-remote-addr", "2.2.2.2:1"), nil)
+	assert.Equal(t, "2.2.2.2", ip)
+	assert.Equal(t, "1", port)
+
+	// right-most untrusted address in x-forwarded-for
+	ctx = withPeer("10.0.0.1:8080", "x-forwarded-for", "5.5.5.5, 3.3.3.3, 10.0.0.2")
+	ip, port = GetPeerAddressSet(ctx, trusted)
+	assert.Equal(t, "3.3.3.3", ip)
+	assert.Equal(t, "0", port)
+
+	// all addresses in x-forwarded-for are trusted
+	ip, _ = GetPeerAddressSet(withPeer("10.0.0.1:8080", "x-forwarded-for", "10.0.0.3, 10.0.0.2"), trusted)
+	assert.Equal(t, "10.0.0.3", ip)
+
+	// x-real-ip
+	ip, _ = GetPeerAddressSet(withPeer("10.0.0.1:8080", "x-real-ip", "4.4.4.4"), trusted)
+	assert.Equal(t, "4.4.4.4", ip)
+
+	// nothing forwarded by trusted proxy
+	ip, port = GetPeerAddressSet(withPeer("[::1]:8080"), nil)
+	assert.Equal(t, "localhost", ip)
+	assert.Equal(t, "8080", port)
+}
+
 func TestMergeToOutgoingMD(t *testing.T) {
 	// Without existing outgoing MD
 	md := metadata.New(map[string]string{
@@ -181,6 +251,140 @@ func TestGetServerPayloadKey(t *testing.T) {
 	assert.NotNil(t, GetServerPayloadKey())
 }
 
+func TestWrapContextForClient(t *testing.T) {
+	// For the first time
+	ctx := WrapContextForClient(context.TODO())
+	assert.True(t, ContainsClientPayload(ctx))
+
+	// Wrap it again
+	assert.Equal(t, ctx, WrapContextForClient(ctx))
+}
+
+func TestGetClientContextPayload(t *testing.T) {
+	// With nil context
+	assert.NotNil(t, GetClientContextPayload(nil))
+
+	// With payload in context
+	ctx := WrapContextForClient(context.TODO())
+	assert.NotNil(t, GetClientContextPayload(ctx))
+}
+
+func TestAddToClientContextPayload(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// With nil value
+	AddToClientContextPayload(context.TODO(), "key", nil)
+
+	// Happy case
+	ctx := WrapContextForClient(context.TODO())
+	AddToClientContextPayload(ctx, "key", "value")
+	assert.Equal(t, "value", GetClientContextPayload(ctx)["key"])
+}
+
+func TestGetIncomingHeadersOfClient(t *testing.T) {
+	// With nil context
+	assert.NotNil(t, GetIncomingHeadersOfClient(nil))
+
+	// Without payload
+	assert.Empty(t, *GetIncomingHeadersOfClient(context.TODO()))
+
+	// With payload in context
+	ctx := WrapContextForClient(context.TODO())
+	GetIncomingHeadersOfClient(ctx).Set("key", "value")
+	assert.Equal(t, []string{"value"}, GetIncomingHeadersOfClient(ctx).Get("key"))
+}
+
+func TestContainsClientPayload(t *testing.T) {
+	// Expect true
+	ctx := WrapContextForClient(context.TODO())
+	assert.True(t, ContainsClientPayload(ctx))
+
+	// Expect false
+	assert.False(t, ContainsClientPayload(context.TODO()))
+}
+
+func TestGetClientPayloadKey(t *testing.T) {
+	assert.NotNil(t, GetClientPayloadKey())
+}
+
+func TestWrapClientStreamWithFinish(t *testing.T) {
+	// server echoes one message, methods with Fail suffix are failed after that
+	server := grpc.NewServer(grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		msg := &emptypb.Empty{}
+		if err := stream.RecvMsg(msg); err != nil {
+			return err
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			return err
+		}
+
+		if method, _ := grpc.MethodFromServerStream(stream); strings.HasSuffix(method, "Fail") {
+			return status.Error(codes.Internal, "ut-error")
+		}
+		return nil
+	}))
+	lis, err := net.Listen("tcp", "localhost:0")
+	assert.Nil(t, err)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer cc.Close()
+
+	desc := &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}
+	drive := func(method string) ([]error, error) {
+		var finished []error
+		stream, err := cc.NewStream(context.TODO(), desc, method)
+		assert.Nil(t, err)
+
+		stream = WrapClientStreamWithFinish(stream, desc, func(err error) {
+			finished = append(finished, err)
+		})
+		assert.Nil(t, stream.SendMsg(&emptypb.Empty{}))
+		assert.Nil(t, stream.CloseSend())
+
+		// stream is not finished until status is received
+		assert.Nil(t, stream.RecvMsg(&emptypb.Empty{}))
+		assert.Empty(t, finished)
+
+		err = stream.RecvMsg(&emptypb.Empty{})
+		// receiving again would not finish stream twice
+		stream.RecvMsg(&emptypb.Empty{})
+
+		return finished, err
+	}
+
+	// stream finished with io.EOF
+	finished, err := drive("/ut.Service/Echo")
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []error{nil}, finished)
+
+	// stream finished with error
+	finished, err = drive("/ut.Service/EchoFail")
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, []error{err}, finished)
+}
+
+func TestWrapClientStreamWithFinish_WithoutServerStreams(t *testing.T) {
+	var finished []error
+	stream := WrapClientStreamWithFinish(&fakeClientStream{}, &grpc.StreamDesc{ClientStreams: true}, func(err error) {
+		finished = append(finished, err)
+	})
+
+	// stream is finished once response received
+	assert.Nil(t, stream.RecvMsg(nil))
+	assert.Equal(t, []error{nil}, finished)
+}
+
+type fakeClientStream struct {
+	grpc.ClientStream
+}
+
+func (f *fakeClientStream) RecvMsg(m interface{}) error {
+	return nil
+}
+
 func assertNotPanic(t *testing.T) {
 	if r := recover(); r != nil {
 		// Expect panic to be called with non nil error
@@ -7,6 +7,7 @@
 package rkgrpcctx
 
 import (
+	"crypto/x509"
 	"net/http"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -21,7 +22,9 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 var (
@@ -64,9 +67,19 @@ func GetIncomingHeaders(ctx context.Context) metadata.MD {
 		return v
 	}
 
+	// called from client
+	if rkgrpcmid.ContainsClientPayload(ctx) {
+		return *rkgrpcmid.GetIncomingHeadersOfClient(ctx)
+	}
+
 	return metadata.Pairs()
 }
 
+// AddHeaderToServer Headers that would be sent to server.
+func AddHeaderToServer(ctx context.Context, key, value string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, key, value)
+}
+
 // AddHeaderToClient Headers that would be sent to client.
 func AddHeaderToClient(ctx context.Context, key, value string) {
 	// set to grpc header
@@ -93,6 +106,12 @@ func GetEvent(ctx context.Context) rkquery.Event {
 		return v.(rkquery.Event)
 	}
 
+	// case 2: called from client side
+	m = rkgrpcmid.GetClientContextPayload(ctx)
+	if v, ok := m[rkmid.EventKey]; ok {
+		return v.(rkquery.Event)
+	}
+
 	return noopEvent
 }
 
@@ -102,7 +121,15 @@ func GetLogger(ctx context.Context) *zap.Logger {
 
 	// case 1: called from server side
 	m := rkgrpcmid.GetServerContextPayload(ctx)
-	if v1, ok := m[rkmid.LoggerKey]; ok {
+	v1, ok := m[rkmid.LoggerKey]
+
+	// case 2: called from client side
+	if !ok {
+		m = rkgrpcmid.GetClientContextPayload(ctx)
+		v1, ok = m[rkmid.LoggerKey]
+	}
+
+	if ok {
 		requestId := GetRequestId(ctx)
 		traceId := GetTraceId(ctx)
 		fields := make([]zap.Field, 0)
@@ -126,6 +153,12 @@ func GetRequestId(ctx context.Context) string {
 		return id.(string)
 	}
 
+	// case 2: called from client side context which wrapped with WrapContextForClient()
+	m = rkgrpcmid.GetClientContextPayload(ctx)
+	if id := m[rkmid.HeaderRequestId]; id != nil {
+		return id.(string)
+	}
+
 	return ""
 }
 
@@ -137,6 +170,12 @@ func GetTraceId(ctx context.Context) string {
 		return id.(string)
 	}
 
+	// case 2: called from client side context which wrapped with WrapContextForClient()
+	m = rkgrpcmid.GetClientContextPayload(ctx)
+	if id := m[rkmid.HeaderTraceId]; id != nil {
+		return id.(string)
+	}
+
 	return ""
 }
 
@@ -148,6 +187,12 @@ func GetEntryName(ctx context.Context) string {
 		return v1.(string)
 	}
 
+	// case 2: called from client side
+	m = rkgrpcmid.GetClientContextPayload(ctx)
+	if v1, ok := m[rkmid.EntryNameKey]; ok {
+		return v1.(string)
+	}
+
 	return ""
 }
 
@@ -161,6 +206,12 @@ func GetTraceSpan(ctx context.Context) trace.Span {
 		return v1.(trace.Span)
 	}
 
+	// case 2: called from client side
+	m = rkgrpcmid.GetClientContextPayload(ctx)
+	if v1, ok := m[rkmid.SpanKey]; ok {
+		return v1.(trace.Span)
+	}
+
 	return span
 }
 
@@ -172,6 +223,12 @@ func GetTracer(ctx context.Context) trace.Tracer {
 		return v1.(trace.Tracer)
 	}
 
+	// case 2: called from client side
+	m = rkgrpcmid.GetClientContextPayload(ctx)
+	if v1, ok := m[rkmid.TracerKey]; ok {
+		return v1.(trace.Tracer)
+	}
+
 	return noopTracerProvider.Tracer("rk-trace-noop")
 }
 
@@ -183,6 +240,12 @@ func GetTracerProvider(ctx context.Context) trace.TracerProvider {
 		return v1.(trace.TracerProvider)
 	}
 
+	// case 2: called from client side
+	m = rkgrpcmid.GetClientContextPayload(ctx)
+	if v1, ok := m[rkmid.TracerProviderKey]; ok {
+		return v1.(trace.TracerProvider)
+	}
+
 	return noopTracerProvider
 }
 
@@ -194,6 +257,12 @@ func GetTracerPropagator(ctx context.Context) propagation.TextMapPropagator {
 		return v1.(propagation.TextMapPropagator)
 	}
 
+	// case 2: called from client side
+	m = rkgrpcmid.GetClientContextPayload(ctx)
+	if v1, ok := m[rkmid.PropagatorKey]; ok {
+		return v1.(propagation.TextMapPropagator)
+	}
+
 	return nil
 }
 
@@ -248,3 +317,54 @@ func GetJwtToken(ctx context.Context) *jwt.Token {
 
 	return nil
 }
+
+// GetPeerCertificate return verified certificate of peer if mTLS is enabled
+func GetPeerCertificate(ctx context.Context) *x509.Certificate {
+	if ctx == nil {
+		return nil
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.AuthInfo == nil {
+		return nil
+	}
+
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		if len(info.State.VerifiedChains) > 0 && len(info.State.VerifiedChains[0]) > 0 {
+			return info.State.VerifiedChains[0][0]
+		}
+	}
+
+	return nil
+}
+
+// GetPeerSubject return subject of verified peer certificate, empty string would be returned if not exists
+func GetPeerSubject(ctx context.Context) string {
+	if cert := GetPeerCertificate(ctx); cert != nil {
+		return cert.Subject.String()
+	}
+
+	return ""
+}
+
+// GetPeerSANs return subject alternative names of verified peer certificate including DNS names,
+// email addresses, IP addresses and URIs
+func GetPeerSANs(ctx context.Context) []string {
+	res := make([]string, 0)
+
+	cert := GetPeerCertificate(ctx)
+	if cert == nil {
+		return res
+	}
+
+	res = append(res, cert.DNSNames...)
+	res = append(res, cert.EmailAddresses...)
+	for i := range cert.IPAddresses {
+		res = append(res, cert.IPAddresses[i].String())
+	}
+	for i := range cert.URIs {
+		res = append(res, cert.URIs[i].String())
+	}
+
+	return res
+}
@@ -7,7 +7,12 @@ package rkgrpcctx
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
 	"net/http"
+	"net/url"
 	"testing"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -17,7 +22,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
 	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 type FakeClientStream struct {
@@ -94,6 +101,11 @@ func TestGetIncomingHeaders(t *testing.T) {
 	ctx := metadata.NewIncomingContext(context.TODO(), md)
 	assert.Equal(t, md, GetIncomingHeaders(ctx))
 
+	// On client side
+	ctx = rkgrpcmid.WrapContextForClient(context.TODO())
+	rkgrpcmid.GetIncomingHeadersOfClient(ctx).Set("key", "value")
+	assert.Equal(t, []string{"value"}, GetIncomingHeaders(ctx).Get("key"))
+
 	// Neither of above
 	assert.NotNil(t, GetIncomingHeaders(context.TODO()))
 }
@@ -106,6 +118,13 @@ func TestAddHeaderToClient(t *testing.T) {
 	assert.Equal(t, "value", rkgrpcmid.GetServerContextPayload(ctx)["key"])
 }
 
+func TestAddHeaderToServer(t *testing.T) {
+	ctx := AddHeaderToServer(context.TODO(), "key", "value")
+	md, ok := metadata.FromOutgoingContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"value"}, md.Get("key"))
+}
+
 func TestGetEvent(t *testing.T) {
 	event := rkquery.NewEventFactory().CreateEventNoop()
 
@@ -114,6 +133,11 @@ func TestGetEvent(t *testing.T) {
 	rkgrpcmid.AddToServerContextPayload(ctx, rkmid.EventKey, event)
 	assert.Equal(t, event, GetEvent(ctx))
 
+	// For client side
+	ctx = rkgrpcmid.WrapContextForClient(context.TODO())
+	rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EventKey, event)
+	assert.Equal(t, event, GetEvent(ctx))
+
 	// For neither of above
 	assert.Equal(t, noopEvent, GetEvent(context.TODO()))
 }
@@ -128,6 +152,12 @@ func TestGetLogger(t *testing.T) {
 	rkgrpcmid.AddToServerContextPayload(ctx, rkmid.HeaderTraceId, "ut-trace-id")
 	assert.NotNil(t, GetLogger(ctx))
 
+	// For client side
+	ctx = rkgrpcmid.WrapContextForClient(context.TODO())
+	rkgrpcmid.AddToClientContextPayload(ctx, rkmid.LoggerKey, logger)
+	rkgrpcmid.AddToClientContextPayload(ctx, rkmid.HeaderRequestId, "ut-request-id")
+	assert.NotNil(t, GetLogger(ctx))
+
 	// For neither of above
 	assert.NotNil(t, GetLogger(context.TODO()))
 }
@@ -140,6 +170,11 @@ func TestGetRequestId(t *testing.T) {
 	rkgrpcmid.AddToServerContextPayload(ctx, rkmid.HeaderRequestId, requestId)
 	assert.Equal(t, requestId, GetRequestId(ctx))
 
+	// For client side
+	ctx = rkgrpcmid.WrapContextForClient(context.TODO())
+	rkgrpcmid.AddToClientContextPayload(ctx, rkmid.HeaderRequestId, requestId)
+	assert.Equal(t, requestId, GetRequestId(ctx))
+
 	// For neither of above
 	assert.Empty(t, GetRequestId(context.TODO()))
 }
@@ -152,6 +187,11 @@ func TestGetTraceId(t *testing.T) {
 	rkgrpcmid.AddToServerContextPayload(ctx, rkmid.HeaderTraceId, traceId)
 	assert.Equal(t, traceId, GetTraceId(ctx))
 
+	// For client side
+	ctx = rkgrpcmid.WrapContextForClient(context.TODO())
+	rkgrpcmid.AddToClientContextPayload(ctx, rkmid.HeaderTraceId, traceId)
+	assert.Equal(t, traceId, GetTraceId(ctx))
+
 	// For neither of above
 	assert.Empty(t, GetTraceId(context.TODO()))
 }
@@ -164,6 +204,11 @@ func TestGetEntryName(t *testing.T) {
 	rkgrpcmid.AddToServerContextPayload(ctx, rkmid.EntryNameKey, entryName)
 	assert.Equal(t, entryName, GetEntryName(ctx))
 
+	// For client side
+	ctx = rkgrpcmid.WrapContextForClient(context.TODO())
+	rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, entryName)
+	assert.Equal(t, entryName, GetEntryName(ctx))
+
 	// For neither of above
 	assert.Empty(t, GetEntryName(context.TODO()))
 }
@@ -340,3 +385,36 @@ func assertNotPanic(t *testing.T) {
 		assert.True(t, true)
 	}
 }
+
+func TestGetPeerCertificate(t *testing.T) {
+	// case 1: nil context
+	assert.Nil(t, GetPeerCertificate(nil))
+
+	// case 2: without peer
+	assert.Nil(t, GetPeerCertificate(context.TODO()))
+	assert.Empty(t, GetPeerSubject(context.TODO()))
+	assert.Empty(t, GetPeerSANs(context.TODO()))
+
+	// case 3: peer without verified chains
+	ctx := peer.NewContext(context.TODO(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{}},
+	})
+	assert.Nil(t, GetPeerCertificate(ctx))
+
+	// case 4: happy case
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "ut-client", Organization: []string{"rk"}},
+		DNSNames:       []string{"ut.example.com"},
+		EmailAddresses: []string{"ut@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "rk", Path: "/ut"}},
+	}
+	ctx = peer.NewContext(context.TODO(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}},
+	})
+	assert.Equal(t, cert, GetPeerCertificate(ctx))
+	assert.Equal(t, "CN=ut-client,O=rk", GetPeerSubject(ctx))
+	assert.Equal(t, []string{"ut.example.com", "ut@example.com", "127.0.0.1", "spiffe://rk/ut"}, GetPeerSANs(ctx))
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcctx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// type of custom claims registered by user
+var jwtClaimsType atomic.Value
+
+// GetJwtClaims returns claims of jwt.Token as jwt.MapClaims, empty claims would be returned if token not exists.
+//
+// Claims in other types would be converted with JSON tags.
+func GetJwtClaims(ctx context.Context) jwt.MapClaims {
+	token := GetJwtToken(ctx)
+	if token == nil || token.Claims == nil {
+		return jwt.MapClaims{}
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		return claims
+	}
+
+	claims := jwt.MapClaims{}
+	if bytes, err := json.Marshal(token.Claims); err == nil {
+		json.Unmarshal(bytes, &claims)
+	}
+
+	return claims
+}
+
+// GetJwtClaim returns value of claim with key, nil would be returned if not exists
+func GetJwtClaim(ctx context.Context, key string) interface{} {
+	return GetJwtClaims(ctx)[key]
+}
+
+// GetJwtSubject returns sub claim of JWT
+func GetJwtSubject(ctx context.Context) string {
+	if sub, ok := GetJwtClaim(ctx, "sub").(string); ok {
+		return sub
+	}
+
+	return ""
+}
+
+// GetJwtScopes returns scopes of JWT from scope claim separated by space or scp claim as list
+func GetJwtScopes(ctx context.Context) []string {
+	claims := GetJwtClaims(ctx)
+
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+
+	return ClaimToStrings(claims["scp"])
+}
+
+// GetJwtAudience returns aud claim of JWT, either a string or a list
+func GetJwtAudience(ctx context.Context) []string {
+	return ClaimToStrings(GetJwtClaim(ctx, "aud"))
+}
+
+// GetJwtExpiry returns exp claim of JWT, zero time would be returned if not exists
+func GetJwtExpiry(ctx context.Context) time.Time {
+	switch exp := GetJwtClaim(ctx, "exp").(type) {
+	case float64:
+		return time.Unix(int64(exp), 0)
+	case int64:
+		return time.Unix(exp, 0)
+	case json.Number:
+		v, _ := exp.Int64()
+		return time.Unix(v, 0)
+	}
+
+	return time.Time{}
+}
+
+// RegisterJwtClaimsType register type of custom claims with an instance, like RegisterJwtClaimsType(&MyClaims{}).
+//
+// Claims of JWT would be decoded into new instance of the type with JSON tags by GetJwtCustomClaims.
+func RegisterJwtClaimsType(claims interface{}) {
+	t := reflect.TypeOf(claims)
+	if t == nil {
+		return
+	}
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	jwtClaimsType.Store(t)
+}
+
+// GetJwtCustomClaims returns pointer of registered custom claims type decoded from JWT,
+// nil would be returned if type not registered, token not exists or failed to decode.
+func GetJwtCustomClaims(ctx context.Context) interface{} {
+	t, ok := jwtClaimsType.Load().(reflect.Type)
+	if !ok {
+		return nil
+	}
+
+	res := reflect.New(t).Interface()
+	if err := DecodeJwtClaims(ctx, res); err != nil {
+		return nil
+	}
+
+	return res
+}
+
+// DecodeJwtClaims decode claims of JWT into pointer of struct with JSON tags
+func DecodeJwtClaims(ctx context.Context, out interface{}) error {
+	token := GetJwtToken(ctx)
+	if token == nil || token.Claims == nil {
+		return errors.New("jwt token not found in context")
+	}
+
+	bytes, err := json.Marshal(token.Claims)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, out)
+}
+
+// ClaimToStrings convert claim into string list, a string claim would be a list with single element
+func ClaimToStrings(claim interface{}) []string {
+	switch v := claim.(type) {
+	case nil:
+		return []string{}
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for i := range v {
+			res = append(res, fmt.Sprintf("%v", v[i]))
+		}
+		return res
+	default:
+		return []string{fmt.Sprintf("%v", v)}
+	}
+}
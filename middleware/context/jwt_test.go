@@ -0,0 +1,120 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcctx
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type utClaims struct {
+	Tenant string `json:"tenant"`
+	jwt.RegisteredClaims
+}
+
+func newUtJwtContext(claims jwt.Claims) context.Context {
+	return context.WithValue(context.TODO(), rkmid.JwtTokenKey, &jwt.Token{Claims: claims})
+}
+
+func TestGetJwtClaims(t *testing.T) {
+	// without token
+	assert.Empty(t, GetJwtClaims(context.TODO()))
+	assert.Empty(t, GetJwtSubject(context.TODO()))
+	assert.Empty(t, GetJwtScopes(context.TODO()))
+	assert.Empty(t, GetJwtAudience(context.TODO()))
+	assert.True(t, GetJwtExpiry(context.TODO()).IsZero())
+	assert.Nil(t, GetJwtClaim(context.TODO(), "sub"))
+
+	// with map claims
+	ctx := newUtJwtContext(jwt.MapClaims{
+		"sub":    "ut-user",
+		"scope":  "read write",
+		"aud":    "ut-aud",
+		"exp":    float64(1949),
+		"tenant": "ut-tenant",
+	})
+	assert.Equal(t, "ut-user", GetJwtSubject(ctx))
+	assert.Equal(t, []string{"read", "write"}, GetJwtScopes(ctx))
+	assert.Equal(t, []string{"ut-aud"}, GetJwtAudience(ctx))
+	assert.Equal(t, time.Unix(1949, 0), GetJwtExpiry(ctx))
+	assert.Equal(t, "ut-tenant", GetJwtClaim(ctx, "tenant"))
+
+	// scp as list, exp as json number
+	ctx = newUtJwtContext(jwt.MapClaims{
+		"scp": []interface{}{"read", "write"},
+		"aud": []interface{}{"ut-a", "ut-b"},
+		"exp": json.Number("1949"),
+	})
+	assert.Equal(t, []string{"read", "write"}, GetJwtScopes(ctx))
+	assert.Equal(t, []string{"ut-a", "ut-b"}, GetJwtAudience(ctx))
+	assert.Equal(t, time.Unix(1949, 0), GetJwtExpiry(ctx))
+
+	// with struct claims
+	ctx = newUtJwtContext(&utClaims{
+		Tenant: "ut-tenant",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "ut-user",
+			Audience:  jwt.ClaimStrings{"ut-aud"},
+			ExpiresAt: jwt.NewNumericDate(time.Unix(1949, 0)),
+		},
+	})
+	assert.Equal(t, "ut-user", GetJwtSubject(ctx))
+	assert.Equal(t, []string{"ut-aud"}, GetJwtAudience(ctx))
+	assert.Equal(t, time.Unix(1949, 0), GetJwtExpiry(ctx))
+	assert.Equal(t, "ut-tenant", GetJwtClaim(ctx, "tenant"))
+}
+
+func TestGetJwtCustomClaims(t *testing.T) {
+	jwtClaimsType = atomic.Value{}
+	defer func() {
+		jwtClaimsType = atomic.Value{}
+	}()
+
+	ctx := newUtJwtContext(jwt.MapClaims{"sub": "ut-user", "tenant": "ut-tenant"})
+
+	// not registered
+	assert.Nil(t, GetJwtCustomClaims(ctx))
+
+	// registered with nil
+	RegisterJwtClaimsType(nil)
+	assert.Nil(t, GetJwtCustomClaims(ctx))
+
+	// registered
+	RegisterJwtClaimsType(&utClaims{})
+	claims, ok := GetJwtCustomClaims(ctx).(*utClaims)
+	assert.True(t, ok)
+	assert.Equal(t, "ut-tenant", claims.Tenant)
+	assert.Equal(t, "ut-user", claims.Subject)
+
+	// without token
+	assert.Nil(t, GetJwtCustomClaims(context.TODO()))
+}
+
+func TestDecodeJwtClaims(t *testing.T) {
+	claims := &utClaims{}
+
+	// without token
+	assert.NotNil(t, DecodeJwtClaims(context.TODO(), claims))
+
+	// happy case
+	assert.Nil(t, DecodeJwtClaims(newUtJwtContext(jwt.MapClaims{"tenant": "ut-tenant"}), claims))
+	assert.Equal(t, "ut-tenant", claims.Tenant)
+}
+
+func TestClaimToStrings(t *testing.T) {
+	assert.Empty(t, ClaimToStrings(nil))
+	assert.Equal(t, []string{"ut"}, ClaimToStrings("ut"))
+	assert.Equal(t, []string{"ut"}, ClaimToStrings([]string{"ut"}))
+	assert.Equal(t, []string{"ut", "1"}, ClaimToStrings([]interface{}{"ut", 1}))
+	assert.Equal(t, []string{"true"}, ClaimToStrings(true))
+}
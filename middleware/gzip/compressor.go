@@ -0,0 +1,115 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcgzip
+
+import (
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"io"
+	"sync"
+)
+
+// RegisterCompressors Register gzip and zstd compressors for grpc server.
+//
+// Server would decompress request and compress response with the same encoding client used.
+// Since grpc does not support choosing compressor per method, ignored paths only take effect on grpc-gateway side.
+//
+// Compressors are global in grpc, this function should be called before server starts.
+func RegisterCompressors(opts ...Option) error {
+	set := newOptionSet(opts...)
+
+	// huffmanOnly is not supported by grpc gzip compressor, use default level instead
+	level := set.gzipLevel()
+	if level == gzip.HuffmanOnly {
+		level = gzip.DefaultCompression
+	}
+
+	if err := grpcgzip.SetLevel(level); err != nil {
+		return err
+	}
+
+	if set.enableZstd {
+		encoding.RegisterCompressor(newZstdCompressor(set.zstdLevel()))
+	}
+
+	return nil
+}
+
+// zstdCompressor implements encoding.Compressor
+type zstdCompressor struct {
+	encoderPool sync.Pool
+	decoderPool sync.Pool
+}
+
+func newZstdCompressor(level zstd.EncoderLevel) *zstdCompressor {
+	c := &zstdCompressor{}
+
+	c.encoderPool.New = func() interface{} {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+		return &zstdWriter{Encoder: w, pool: &c.encoderPool}
+	}
+
+	c.decoderPool.New = func() interface{} {
+		r, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		return r
+	}
+
+	return c
+}
+
+// Compress implements encoding.Compressor
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	zw := c.encoderPool.Get().(*zstdWriter)
+	zw.Reset(w)
+	return zw, nil
+}
+
+// Decompress implements encoding.Compressor
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	dec := c.decoderPool.Get().(*zstd.Decoder)
+	if err := dec.Reset(r); err != nil {
+		c.decoderPool.Put(dec)
+		return nil, err
+	}
+	return &zstdReader{Decoder: dec, pool: &c.decoderPool}, nil
+}
+
+// Name implements encoding.Compressor
+func (c *zstdCompressor) Name() string {
+	return EncodingZstd
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+// Close flush remaining bytes and return encoder to pool.
+func (w *zstdWriter) Close() error {
+	defer w.pool.Put(w)
+	return w.Encoder.Close()
+}
+
+type zstdReader struct {
+	*zstd.Decoder
+	pool *sync.Pool
+}
+
+// Read return decoder to pool once EOF reached.
+func (r *zstdReader) Read(p []byte) (n int, err error) {
+	if r.Decoder == nil {
+		return 0, io.EOF
+	}
+
+	n, err = r.Decoder.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r.Decoder)
+		r.Decoder = nil
+	}
+	return n, err
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcgzip
+
+import (
+	"bytes"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/encoding"
+	"io"
+	"testing"
+)
+
+func TestRegisterCompressors(t *testing.T) {
+	// case 1: gzip only
+	assert.Nil(t, RegisterCompressors(WithLevel(BestSpeed)))
+	assert.NotNil(t, encoding.GetCompressor(EncodingGzip))
+
+	// case 2: huffmanOnly is not supported by grpc, fallback to default
+	assert.Nil(t, RegisterCompressors(WithLevel(HuffmanOnly)))
+
+	// case 3: with zstd
+	assert.Nil(t, RegisterCompressors(WithZstd(true)))
+	assert.NotNil(t, encoding.GetCompressor(EncodingZstd))
+}
+
+func TestZstdCompressor(t *testing.T) {
+	c := newZstdCompressor(zstd.SpeedDefault)
+	assert.Equal(t, EncodingZstd, c.Name())
+
+	// compress twice to make sure pooled encoder would be reset
+	for i := 0; i < 2; i++ {
+		buf := &bytes.Buffer{}
+		w, err := c.Compress(buf)
+		assert.Nil(t, err)
+		w.Write([]byte(body))
+		assert.Nil(t, w.Close())
+
+		r, err := c.Decompress(buf)
+		assert.Nil(t, err)
+		decoded, err := io.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Equal(t, body, string(decoded))
+
+		// read after EOF should not return decoder to pool again
+		n, err := r.Read(make([]byte, 1))
+		assert.Zero(t, n)
+		assert.Equal(t, io.EOF, err)
+	}
+}
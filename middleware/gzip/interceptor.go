@@ -0,0 +1,221 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+//
+// Package rkgrpcgzip is a compression interceptor for grpc framework
+
+package rkgrpcgzip
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Interceptor Add compression interceptor on grpc-gateway side.
+//
+// Response would be compressed with zstd or gzip based on Accept-Encoding of request.
+func Interceptor(h http.Handler, opts ...Option) http.Handler {
+	set := newOptionSet(opts...)
+	pool := newWriterPool(set)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// case 1: ignore path
+		if set.ShouldIgnore(req.URL.Path) {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		// case 2: client does not accept any supported encoding
+		encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"), set.enableZstd)
+		if len(encoding) < 1 {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		// case 3: compress response
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			pool:           pool,
+			isHead:         req.Method == http.MethodHead,
+		}
+		defer cw.Close()
+
+		h.ServeHTTP(cw, req)
+	})
+}
+
+// negotiateEncoding returns preferred encoding accepted by client, empty string would be returned if none matched.
+func negotiateEncoding(acceptEncoding string, enableZstd bool) string {
+	gzipAccepted, zstdAccepted := false, false
+
+	for _, token := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(strings.TrimSpace(token), ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+
+		// skip encodings with q=0 which means not acceptable
+		if len(parts) > 1 && strings.Replace(strings.TrimSpace(parts[1]), " ", "", -1) == "q=0" {
+			continue
+		}
+
+		switch name {
+		case EncodingGzip, "*":
+			gzipAccepted = true
+		case EncodingZstd:
+			zstdAccepted = true
+		}
+	}
+
+	if enableZstd && zstdAccepted {
+		return EncodingZstd
+	}
+
+	if gzipAccepted {
+		return EncodingGzip
+	}
+
+	return ""
+}
+
+// ***************** Writer pool *****************
+
+type writerPool struct {
+	gzipPool sync.Pool
+	zstdPool sync.Pool
+}
+
+func newWriterPool(set *optionSet) *writerPool {
+	pool := &writerPool{}
+
+	pool.gzipPool.New = func() interface{} {
+		w, err := gzip.NewWriterLevel(io.Discard, set.gzipLevel())
+		if err != nil {
+			w = gzip.NewWriter(io.Discard)
+		}
+		return w
+	}
+
+	pool.zstdPool.New = func() interface{} {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(set.zstdLevel()))
+		return w
+	}
+
+	return pool
+}
+
+// get returns encoder which writes to dst, release function should be called after encoder closed.
+func (pool *writerPool) get(encoding string, dst io.Writer) (io.WriteCloser, func()) {
+	switch encoding {
+	case EncodingZstd:
+		w := pool.zstdPool.Get().(*zstd.Encoder)
+		w.Reset(dst)
+		return w, func() { pool.zstdPool.Put(w) }
+	default:
+		w := pool.gzipPool.Get().(*gzip.Writer)
+		w.Reset(dst)
+		return w, func() { pool.gzipPool.Put(w) }
+	}
+}
+
+// ***************** Response writer *****************
+
+// compressWriter compress body written by handler lazily.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	pool        *writerPool
+	isHead      bool
+	wroteHeader bool
+	skip        bool
+	writer      io.WriteCloser
+	release     func()
+}
+
+// WriteHeader decide whether compression should be applied before writing status code.
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	header := cw.Header()
+	header.Add("Vary", "Accept-Encoding")
+
+	// do not compress empty body or response which is already encoded
+	if cw.isHead ||
+		code == http.StatusNoContent ||
+		code == http.StatusNotModified ||
+		(code >= 100 && code < 200) ||
+		len(header.Get("Content-Encoding")) > 0 {
+		cw.skip = true
+	} else {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+	}
+
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// Write compress bytes into underlying writer.
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		// content type would be sniffed from compressed body if not set
+		if len(cw.Header().Get("Content-Type")) < 1 {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.skip {
+		return cw.ResponseWriter.Write(b)
+	}
+
+	if cw.writer == nil {
+		cw.writer, cw.release = cw.pool.get(cw.encoding, cw.ResponseWriter)
+	}
+
+	return cw.writer.Write(b)
+}
+
+// Flush flush compressed bytes to client, required by streaming of grpc-gateway.
+func (cw *compressWriter) Flush() {
+	if cw.writer != nil {
+		if f, ok := cw.writer.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("http.Hijacker is not implemented by underlying response writer")
+}
+
+// Close flush remaining bytes and return encoder to pool.
+func (cw *compressWriter) Close() error {
+	if cw.writer == nil {
+		return nil
+	}
+
+	err := cw.writer.Close()
+	cw.release()
+	cw.writer = nil
+
+	return err
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcgzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var body = strings.Repeat("rk-grpc-gzip-", 100)
+
+func TestInterceptor_WithGzip(t *testing.T) {
+	defer assertNotPanic(t)
+
+	inter := Interceptor(userHandler, WithLevel(BestSpeed))
+	req := httptest.NewRequest(http.MethodGet, "/ut", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	inter.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, EncodingGzip, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Less(t, w.Body.Len(), len(body))
+
+	reader, err := gzip.NewReader(w.Body)
+	assert.Nil(t, err)
+	decoded, _ := io.ReadAll(reader)
+	assert.Equal(t, body, string(decoded))
+}
+
+func TestInterceptor_WithZstd(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// case 1: zstd enabled
+	inter := Interceptor(userHandler, WithZstd(true))
+	req := httptest.NewRequest(http.MethodGet, "/ut", nil)
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	w := httptest.NewRecorder()
+	inter.ServeHTTP(w, req)
+
+	assert.Equal(t, EncodingZstd, w.Header().Get("Content-Encoding"))
+	reader, err := zstd.NewReader(w.Body)
+	assert.Nil(t, err)
+	decoded, _ := io.ReadAll(reader)
+	assert.Equal(t, body, string(decoded))
+
+	// case 2: zstd disabled, fallback to gzip
+	inter = Interceptor(userHandler)
+	w = httptest.NewRecorder()
+	inter.ServeHTTP(w, req)
+	assert.Equal(t, EncodingGzip, w.Header().Get("Content-Encoding"))
+}
+
+func TestInterceptor_WithoutCompression(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// case 1: ignored path
+	inter := Interceptor(userHandler, WithPathToIgnore("/ut-ignore"))
+	req := httptest.NewRequest(http.MethodGet, "/ut-ignore", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	inter.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, w.Body.String())
+
+	// case 2: encoding not accepted
+	req = httptest.NewRequest(http.MethodGet, "/ut", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, br")
+	w = httptest.NewRecorder()
+	inter.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, w.Body.String())
+
+	// case 3: no content
+	inter = Interceptor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	inter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+}
+
+func TestInterceptor_WithFlush(t *testing.T) {
+	defer assertNotPanic(t)
+
+	inter := Interceptor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(body))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/ut", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	inter.ServeHTTP(w, req)
+
+	assert.True(t, w.Flushed)
+	reader, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+	assert.Nil(t, err)
+	decoded, _ := io.ReadAll(reader)
+	assert.Equal(t, body+body, string(decoded))
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "", negotiateEncoding("", true))
+	assert.Equal(t, "", negotiateEncoding("br, deflate", true))
+	assert.Equal(t, EncodingGzip, negotiateEncoding("GZIP", false))
+	assert.Equal(t, EncodingGzip, negotiateEncoding("*", true))
+	assert.Equal(t, EncodingGzip, negotiateEncoding("zstd, gzip", false))
+	assert.Equal(t, EncodingZstd, negotiateEncoding("zstd;q=0.5, gzip", true))
+	assert.Equal(t, "", negotiateEncoding("gzip; q=0", false))
+}
+
+// ************ Test utility ************
+
+func assertNotPanic(t *testing.T) {
+	if r := recover(); r != nil {
+		// Expect panic to be called with non nil error
+		assert.True(t, false)
+	} else {
+		// This should never be called in case of a bug
+		assert.True(t, true)
+	}
+}
+
+type user struct{}
+
+func (h *user) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(body))
+}
+
+var userHandler *user
@@ -0,0 +1,174 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcgzip
+
+import (
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"strings"
+)
+
+const (
+	// NoCompression copy given data from reader to writer directly.
+	NoCompression = "noCompression"
+	// BestSpeed compress request with the lowest compression level for speed.
+	BestSpeed = "bestSpeed"
+	// BestCompression compress request with the highest compression level.
+	BestCompression = "bestCompression"
+	// DefaultCompression default compression level.
+	DefaultCompression = "defaultCompression"
+	// HuffmanOnly use huffman encoding only.
+	HuffmanOnly = "huffmanOnly"
+
+	// EncodingGzip is value of Content-Encoding for gzip.
+	EncodingGzip = "gzip"
+	// EncodingZstd is value of Content-Encoding for zstd.
+	EncodingZstd = "zstd"
+)
+
+// ***************** OptionSet *****************
+
+// Options which is used while initializing extension interceptor
+type optionSet struct {
+	entryName    string
+	entryType    string
+	level        string
+	enableZstd   bool
+	pathToIgnore []string
+}
+
+// newOptionSet Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:    "fake-entry",
+		entryType:    "",
+		level:        DefaultCompression,
+		pathToIgnore: []string{},
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// ShouldIgnore determine whether compression should be ignored based on path
+func (set *optionSet) ShouldIgnore(path string) bool {
+	for i := range set.pathToIgnore {
+		if strings.HasPrefix(path, set.pathToIgnore[i]) {
+			return true
+		}
+	}
+
+	return rkmid.ShouldIgnoreGlobal(path)
+}
+
+// gzipLevel convert level into compress/gzip level.
+func (set *optionSet) gzipLevel() int {
+	switch strings.ToLower(set.level) {
+	case strings.ToLower(NoCompression):
+		return gzip.NoCompression
+	case strings.ToLower(BestSpeed):
+		return gzip.BestSpeed
+	case strings.ToLower(BestCompression):
+		return gzip.BestCompression
+	case strings.ToLower(HuffmanOnly):
+		return gzip.HuffmanOnly
+	default:
+		return gzip.DefaultCompression
+	}
+}
+
+// zstdLevel convert level into zstd level.
+// zstd has no equivalent of noCompression and huffmanOnly, fastest level would be used.
+func (set *optionSet) zstdLevel() zstd.EncoderLevel {
+	switch strings.ToLower(set.level) {
+	case strings.ToLower(NoCompression), strings.ToLower(BestSpeed), strings.ToLower(HuffmanOnly):
+		return zstd.SpeedFastest
+	case strings.ToLower(BestCompression):
+		return zstd.SpeedBestCompression
+	default:
+		return zstd.SpeedDefault
+	}
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML
+type BootConfig struct {
+	Enabled    bool     `yaml:"enabled" json:"enabled"`
+	Ignore     []string `yaml:"ignore" json:"ignore"`
+	Level      string   `yaml:"level" json:"level"`
+	EnableZstd bool     `yaml:"enableZstd" json:"enableZstd"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithLevel(config.Level),
+			WithZstd(config.EnableZstd),
+			WithPathToIgnore(config.Ignore...))
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
+// Option options provided to Interceptor or optionsSet while creating
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithLevel provide compression level.
+// Options: noCompression, bestSpeed, bestCompression, defaultCompression, huffmanOnly
+func WithLevel(level string) Option {
+	return func(set *optionSet) {
+		if len(level) > 0 {
+			set.level = level
+		}
+	}
+}
+
+// WithZstd enable zstd encoding while client accepts it.
+func WithZstd(enable bool) Option {
+	return func(set *optionSet) {
+		set.enableZstd = enable
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will ignore.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
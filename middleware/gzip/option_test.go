@@ -0,0 +1,53 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcgzip
+
+import (
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{
+		Enabled:    false,
+		Ignore:     []string{"/ut-ignore"},
+		Level:      BestCompression,
+		EnableZstd: true,
+	}
+
+	// case 1: disabled
+	assert.Empty(t, ToOptions(config, "ut-entry", "ut-type"))
+
+	// case 2: enabled
+	config.Enabled = true
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.True(t, set.enableZstd)
+	assert.True(t, set.ShouldIgnore("/ut-ignore"))
+	assert.False(t, set.ShouldIgnore("/ut"))
+	assert.Equal(t, gzip.BestCompression, set.gzipLevel())
+	assert.Equal(t, zstd.SpeedBestCompression, set.zstdLevel())
+}
+
+func TestWithLevel(t *testing.T) {
+	// empty level would be ignored
+	set := newOptionSet(WithLevel(""))
+	assert.Equal(t, gzip.DefaultCompression, set.gzipLevel())
+	assert.Equal(t, zstd.SpeedDefault, set.zstdLevel())
+
+	set = newOptionSet(WithLevel(NoCompression))
+	assert.Equal(t, gzip.NoCompression, set.gzipLevel())
+	assert.Equal(t, zstd.SpeedFastest, set.zstdLevel())
+
+	set = newOptionSet(WithLevel("bestspeed"))
+	assert.Equal(t, gzip.BestSpeed, set.gzipLevel())
+
+	set = newOptionSet(WithLevel(HuffmanOnly))
+	assert.Equal(t, gzip.HuffmanOnly, set.gzipLevel())
+}
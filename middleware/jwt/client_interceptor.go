@@ -0,0 +1,71 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcjwt
+
+import (
+	"context"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkmidjwt "github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
+	rkgrpcerr "github.com/tegarajipangestu/rk-grpc/v2/boot/error"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryClientInterceptor create new unary client interceptor.
+//
+// The token attached to outgoing metadata would be validated before sending request to server.
+func UnaryClientInterceptor(opts ...rkmidjwt.Option) grpc.UnaryClientInterceptor {
+	set := rkmidjwt.NewOptionSet(opts...)
+
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		outgoingMD, _ := metadata.FromOutgoingContext(ctx)
+		beforeCtx := set.BeforeCtx(createReqByCopyingMD(outgoingMD, method), nil)
+		set.Before(beforeCtx)
+
+		// case 1: error response
+		if beforeCtx.Output.ErrResp != nil {
+			return rkgrpcerr.Unauthenticated(beforeCtx.Output.ErrResp.Message()).Err()
+		}
+
+		// insert into context
+		ctx = context.WithValue(ctx, rkmid.JwtTokenKey, beforeCtx.Output.JwtToken)
+
+		// case 2: call next
+		return invoker(ctx, method, req, resp, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor create new stream client interceptor.
+//
+// The token attached to outgoing metadata would be validated before creating stream.
+func StreamClientInterceptor(opts ...rkmidjwt.Option) grpc.StreamClientInterceptor {
+	set := rkmidjwt.NewOptionSet(opts...)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		outgoingMD, _ := metadata.FromOutgoingContext(ctx)
+		beforeCtx := set.BeforeCtx(createReqByCopyingMD(outgoingMD, method), nil)
+		set.Before(beforeCtx)
+
+		// case 1: error response
+		if beforeCtx.Output.ErrResp != nil {
+			return nil, rkgrpcerr.Unauthenticated(beforeCtx.Output.ErrResp.Message()).Err()
+		}
+
+		// insert into context
+		ctx = context.WithValue(ctx, rkmid.JwtTokenKey, beforeCtx.Output.JwtToken)
+
+		// case 2: call next
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcjwt
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	beforeCtx := rkmidjwt.NewBeforeCtx()
+	mock := rkmidjwt.NewOptionSetMock(beforeCtx)
+	inter := UnaryClientInterceptor(rkmidjwt.WithMockOptionSet(mock))
+
+	// case 1: with error response
+	beforeCtx.Output.ErrResp = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "")
+	assert.NotNil(t, inter(NewUnaryClientInput()))
+
+	// case 2: happy case
+	beforeCtx.Output.ErrResp = nil
+	assert.Nil(t, inter(NewUnaryClientInput()))
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	beforeCtx := rkmidjwt.NewBeforeCtx()
+	mock := rkmidjwt.NewOptionSetMock(beforeCtx)
+	inter := StreamClientInterceptor(rkmidjwt.WithMockOptionSet(mock))
+
+	// case 1: with error response
+	beforeCtx.Output.ErrResp = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "")
+	_, err := inter(NewStreamClientInput())
+	assert.NotNil(t, err)
+
+	// case 2: happy case
+	beforeCtx.Output.ErrResp = nil
+	_, err = inter(NewStreamClientInput())
+	assert.Nil(t, err)
+}
+
+// ************ Test utility ************
+
+func NewUnaryClientInput() (context.Context, string, interface{}, interface{}, *grpc.ClientConn, grpc.UnaryInvoker) {
+	cc, _ := grpc.Dial("ut-target", grpc.WithInsecure())
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	return context.TODO(), "ut-method", nil, nil, cc, invoker
+}
+
+func NewStreamClientInput() (context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, grpc.Streamer) {
+	cc, _ := grpc.Dial("ut-target", grpc.WithInsecure())
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, nil
+	}
+
+	return context.TODO(), &grpc.StreamDesc{}, cc, "ut-method", streamer
+}
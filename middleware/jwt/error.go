@@ -0,0 +1,120 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcjwt
+
+import (
+	"context"
+	"errors"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	rkgrpcerr "github.com/tegarajipangestu/rk-grpc/v2/boot/error"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Reasons of JWT failures, attached as ErrorDetail and label of error counter.
+const (
+	ReasonMissingToken  = "MISSING_TOKEN"
+	ReasonExpired       = "EXPIRED"
+	ReasonBadSignature  = "BAD_SIGNATURE"
+	ReasonWrongAudience = "WRONG_AUDIENCE"
+	ReasonWrongIssuer   = "WRONG_ISSUER"
+	ReasonInvalidToken  = "INVALID_TOKEN"
+)
+
+// errorCounter counts JWT failures by entry and reason
+var errorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "rk",
+	Subsystem: "jwt",
+	Name:      "errors",
+	Help:      "Number of failed JWT authentications by reason.",
+}, []string{"entryName", "reason"})
+
+// RegisterMetrics register counter of JWT failures into registerer, registering more than once is allowed.
+func RegisterMetrics(registerer prometheus.Registerer) error {
+	if registerer == nil {
+		return nil
+	}
+
+	if err := registerer.Register(errorCounter); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyRecorder records error returned by signer while verifying jwt of a request
+type verifyRecorder struct {
+	rkentry.SignerJwt
+	verified bool
+	err      error
+}
+
+// VerifyJwt verify jwt with signer and record error
+func (r *verifyRecorder) VerifyJwt(raw string) (*jwt.Token, error) {
+	token, err := r.SignerJwt.VerifyJwt(raw)
+	r.verified, r.err = true, err
+
+	return token, err
+}
+
+// verifyFailure records and returns Unauthenticated error with reason as detail.
+func verifyFailure(ctx context.Context, entryName string, recorder *verifyRecorder, msg string) error {
+	reason, err := classify(recorder)
+
+	errorCounter.WithLabelValues(entryName, reason).Inc()
+	rkgrpcctx.GetEvent(ctx).AddPair("jwtError", reason)
+
+	fields := []zap.Field{zap.String("reason", reason)}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	rkgrpcctx.GetLogger(ctx).Warn("Jwt authentication failed", fields...)
+
+	return rkgrpcerr.Unauthenticated(msg, status.Error(codes.Unauthenticated, reason)).Err()
+}
+
+// classify returns reason and error of failed request with error recorded while verifying
+func classify(recorder *verifyRecorder) (string, error) {
+	// case 1: signer is unknown
+	if recorder == nil {
+		return ReasonInvalidToken, nil
+	}
+
+	// case 2: signer never called since token could not be extracted from request
+	if !recorder.verified {
+		return ReasonMissingToken, nil
+	}
+
+	// case 3: classify with error of signer
+	return reasonOf(recorder.err), recorder.err
+}
+
+// reasonOf returns reason of error returned by signer, signature is checked before claims
+func reasonOf(err error) string {
+	switch {
+	case err == nil:
+		return ReasonInvalidToken
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ReasonInvalidToken
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return ReasonBadSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ReasonExpired
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ReasonWrongAudience
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ReasonWrongIssuer
+	}
+
+	return ReasonInvalidToken
+}
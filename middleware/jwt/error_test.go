@@ -0,0 +1,140 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcjwt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	rkmidjwt "github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
+	"github.com/stretchr/testify/assert"
+	rkerror "github.com/tegarajipangestu/rk-grpc/v2/boot/error/gen"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// callWithToken call unary interceptor with token in authorization header and returns reason in error detail
+func callWithToken(t *testing.T, inter grpc.UnaryServerInterceptor, token string) string {
+	ctx := context.TODO()
+	if len(token) > 0 {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	_, err := inter(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "ut-method"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	if err == nil {
+		return ""
+	}
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.Unauthenticated, st.Code())
+	assert.Len(t, st.Details(), 2)
+
+	return st.Details()[1].(*rkerror.ErrorDetail).Message
+}
+
+func TestVerifyFailure(t *testing.T) {
+	entryName := "ut-jwt-error"
+	key := []byte("ut-key")
+	signer := rkentry.RegisterSymmetricJwtSigner(entryName, jwt.SigningMethodHS256.Name, key)
+	defer rkentry.GlobalAppCtx.RemoveEntry(signer)
+
+	inter := UnaryServerInterceptorWithSigner(signer, nil,
+		rkmidjwt.WithEntryNameAndType(entryName, "ut-type"))
+
+	sign := func(claims jwt.MapClaims, key []byte) string {
+		res, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		return res
+	}
+	count := func(reason string) float64 {
+		return testutil.ToFloat64(errorCounter.WithLabelValues(entryName, reason))
+	}
+
+	// case 1: happy case
+	assert.Empty(t, callWithToken(t, inter, sign(jwt.MapClaims{"sub": "ut-user"}, key)))
+
+	// case 2: missing token
+	assert.Equal(t, ReasonMissingToken, callWithToken(t, inter, ""))
+	assert.Equal(t, float64(1), count(ReasonMissingToken))
+
+	// case 3: malformed token
+	assert.Equal(t, ReasonInvalidToken, callWithToken(t, inter, "ut-invalid"))
+	assert.Equal(t, float64(1), count(ReasonInvalidToken))
+
+	// case 4: bad signature
+	assert.Equal(t, ReasonBadSignature, callWithToken(t, inter, sign(jwt.MapClaims{}, []byte("ut-other"))))
+	assert.Equal(t, float64(1), count(ReasonBadSignature))
+
+	// case 5: expired
+	expired := jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}
+	assert.Equal(t, ReasonExpired, callWithToken(t, inter, sign(expired, key)))
+	assert.Equal(t, float64(1), count(ReasonExpired))
+
+	// case 6: signer unknown by interceptor, error of signer is not available
+	inter = UnaryServerInterceptor(
+		rkmidjwt.WithEntryNameAndType(entryName, "ut-type"),
+		rkmidjwt.WithSigner(signer))
+	assert.Equal(t, ReasonInvalidToken, callWithToken(t, inter, ""))
+	assert.Equal(t, ReasonInvalidToken, callWithToken(t, inter, sign(expired, key)))
+	assert.Equal(t, float64(1), count(ReasonExpired))
+}
+
+func TestVerifyFailure_Jwks(t *testing.T) {
+	key, jwk := newUtRsaKey(t, "ut-rsa")
+	server := newUtJwksServer(jwk)
+	defer server.Close()
+
+	entryName := "ut-jwt-jwks-error"
+	// signer is not registered
+	signer, _ := NewJwksSigner(entryName,
+		WithJwksUrl(server.URL+"/keys"),
+		WithJwksIssuer("ut-iss"),
+		WithJwksAudience("ut-aud"))
+
+	inter := UnaryServerInterceptorWithSigner(signer, nil,
+		rkmidjwt.WithEntryNameAndType(entryName, "ut-type"))
+
+	assert.Equal(t, ReasonWrongAudience, callWithToken(t, inter,
+		signUtToken(t, jwt.SigningMethodRS256, "ut-rsa", key, jwt.MapClaims{"iss": "ut-iss", "aud": "ut-other"})))
+	assert.Equal(t, ReasonWrongIssuer, callWithToken(t, inter,
+		signUtToken(t, jwt.SigningMethodRS256, "ut-rsa", key, jwt.MapClaims{"iss": "ut-other", "aud": "ut-aud"})))
+	assert.Equal(t, ReasonBadSignature, callWithToken(t, inter,
+		signUtToken(t, jwt.SigningMethodRS256, "ut-unknown", key, jwt.MapClaims{"iss": "ut-iss", "aud": "ut-aud"})))
+	assert.Equal(t, float64(1), testutil.ToFloat64(errorCounter.WithLabelValues(entryName, ReasonWrongAudience)))
+}
+
+func TestReasonOf(t *testing.T) {
+	assert.Equal(t, ReasonInvalidToken, reasonOf(nil))
+	assert.Equal(t, ReasonInvalidToken, reasonOf(errors.New("ut-error")))
+	assert.Equal(t, ReasonInvalidToken, reasonOf(jwt.NewValidationError("", jwt.ValidationErrorNotValidYet)))
+	assert.Equal(t, ReasonInvalidToken, reasonOf(jwt.NewValidationError("", jwt.ValidationErrorMalformed)))
+	// signature is checked before expiration
+	assert.Equal(t, ReasonBadSignature, reasonOf(jwt.NewValidationError("",
+		jwt.ValidationErrorSignatureInvalid|jwt.ValidationErrorExpired)))
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	assert.Nil(t, RegisterMetrics(nil))
+	assert.Nil(t, RegisterMetrics(registry))
+	// registered twice
+	assert.Nil(t, RegisterMetrics(registry))
+
+	// conflicted with other collector
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "rk_jwt_errors", Help: "ut"}))
+	assert.NotNil(t, RegisterMetrics(registry))
+}
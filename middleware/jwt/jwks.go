@@ -0,0 +1,519 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcjwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+)
+
+const (
+	defaultJwksRefreshInterval    = time.Hour
+	defaultJwksMinRefreshInterval = 10 * time.Second
+	defaultJwksTimeout            = 10 * time.Second
+	oidcDiscoveryPath             = "/.well-known/openid-configuration"
+)
+
+// jwk is JSON web key of RSA or EC public key
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwksKey is parsed public key with algorithm
+type jwksKey struct {
+	alg string
+	key interface{}
+}
+
+// JwksSigner implements rkentry.SignerJwt, verifies JWT with public keys fetched from JWKS.
+//
+// JWKS is read from URL, local file or jwks_uri of OIDC discovery document of issuer. Keys are cached by kid,
+// refreshed on unknown kid and periodically after bootstrapped. Issuer and audience are validated if provided.
+// Signing is not supported.
+type JwksSigner struct {
+	entryName          string
+	url                string
+	filePath           string
+	issuer             string
+	audience           []string
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	client             *http.Client
+
+	keys          atomic.Value // map[string]*jwksKey
+	raw           atomic.Value // []byte
+	lastRefresh   int64        // unix nano of last refresh attempt
+	refreshLock   sync.Mutex
+	stopRefresh   chan struct{}
+	lifecycleLock sync.Mutex
+}
+
+// JwksOption options provided to JwksSigner while creating
+type JwksOption func(*JwksSigner)
+
+// WithJwksUrl provide URL of JWKS.
+func WithJwksUrl(url string) JwksOption {
+	return func(s *JwksSigner) {
+		s.url = url
+	}
+}
+
+// WithJwksFile provide path of local JWKS file.
+func WithJwksFile(filePath string) JwksOption {
+	return func(s *JwksSigner) {
+		s.filePath = filePath
+	}
+}
+
+// WithJwksIssuer provide expected iss claim, JWKS would be discovered from issuer with OIDC if URL and file are missing.
+func WithJwksIssuer(issuer string) JwksOption {
+	return func(s *JwksSigner) {
+		s.issuer = issuer
+	}
+}
+
+// WithJwksAudience provide expected aud claim, token must contain one of audience.
+func WithJwksAudience(audience ...string) JwksOption {
+	return func(s *JwksSigner) {
+		for i := range audience {
+			if len(audience[i]) > 0 {
+				s.audience = append(s.audience, audience[i])
+			}
+		}
+	}
+}
+
+// WithJwksRefreshInterval provide interval of refreshing keys, default: 1 hour.
+func WithJwksRefreshInterval(interval time.Duration) JwksOption {
+	return func(s *JwksSigner) {
+		if interval > 0 {
+			s.refreshInterval = interval
+		}
+	}
+}
+
+// WithJwksMinRefreshInterval provide min interval between refreshes triggered by unknown kid, default: 10 seconds.
+func WithJwksMinRefreshInterval(interval time.Duration) JwksOption {
+	return func(s *JwksSigner) {
+		if interval >= 0 {
+			s.minRefreshInterval = interval
+		}
+	}
+}
+
+// WithJwksHttpClient provide http client to fetch JWKS.
+func WithJwksHttpClient(client *http.Client) JwksOption {
+	return func(s *JwksSigner) {
+		if client != nil {
+			s.client = client
+		}
+	}
+}
+
+// NewJwksSigner create JwksSigner with options, keys would be fetched while bootstrapping or verifying.
+func NewJwksSigner(entryName string, opts ...JwksOption) (*JwksSigner, error) {
+	s := &JwksSigner{
+		entryName:          entryName,
+		audience:           make([]string, 0),
+		refreshInterval:    defaultJwksRefreshInterval,
+		minRefreshInterval: defaultJwksMinRefreshInterval,
+		client:             &http.Client{Timeout: defaultJwksTimeout},
+	}
+
+	for i := range opts {
+		opts[i](s)
+	}
+
+	if len(s.url) < 1 && len(s.filePath) < 1 && len(s.issuer) < 1 {
+		return nil, errors.New("one of url, file or issuer of jwks is required")
+	}
+
+	s.keys.Store(map[string]*jwksKey{})
+	s.raw.Store([]byte{})
+
+	return s, nil
+}
+
+// Bootstrap fetch keys and refresh keys periodically until interrupted, keys would be refreshed on schedule
+// even if failed to fetch at first. Bootstrap a running signer is noop.
+func (s *JwksSigner) Bootstrap(context.Context) {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+
+	if s.stopRefresh != nil {
+		return
+	}
+	s.stopRefresh = make(chan struct{})
+
+	s.refresh(true)
+	go s.refreshPeriodically(s.stopRefresh)
+}
+
+// Interrupt stop refreshing keys periodically, cached keys are still used for verifying
+func (s *JwksSigner) Interrupt(context.Context) {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+
+	if s.stopRefresh != nil {
+		close(s.stopRefresh)
+		s.stopRefresh = nil
+	}
+}
+
+// GetName returns name of entry
+func (s *JwksSigner) GetName() string {
+	return s.entryName
+}
+
+// GetType returns type of entry
+func (s *JwksSigner) GetType() string {
+	return rkentry.SignerJwtEntryType
+}
+
+// GetDescription returns description of entry
+func (s *JwksSigner) GetDescription() string {
+	return "JWKS jwt signer"
+}
+
+// String returns entry as string
+func (s *JwksSigner) String() string {
+	// url would be discovered while refreshing
+	s.refreshLock.Lock()
+	url := s.url
+	s.refreshLock.Unlock()
+
+	m := map[string]interface{}{
+		"name":     s.entryName,
+		"url":      url,
+		"file":     s.filePath,
+		"issuer":   s.issuer,
+		"audience": s.audience,
+		"kids":     s.kids(),
+	}
+
+	bytes, _ := json.Marshal(m)
+	return string(bytes)
+}
+
+// SignJwt is not supported since private keys are not available
+func (s *JwksSigner) SignJwt(jwt.Claims) (string, error) {
+	return "", errors.New("jwks signer could not sign jwt")
+}
+
+// VerifyJwt verify jwt with key of kid in header, issuer and audience
+func (s *JwksSigner) VerifyJwt(raw string) (*jwt.Token, error) {
+	// keys never fetched would be fetched by keyFunc
+	token, err := jwt.Parse(raw, s.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid claims")
+	}
+
+	if len(s.issuer) > 0 && !claims.VerifyIssuer(s.issuer, true) {
+		return nil, fmt.Errorf("%w, expected %s", jwt.ErrTokenInvalidIssuer, s.issuer)
+	}
+
+	if len(s.audience) > 0 {
+		matched := false
+		for i := range s.audience {
+			if claims.VerifyAudience(s.audience[i], true) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("%w, expected one of %v", jwt.ErrTokenInvalidAudience, s.audience)
+		}
+	}
+
+	return token, nil
+}
+
+// PubKey returns JWKS fetched last time
+func (s *JwksSigner) PubKey() []byte {
+	return s.raw.Load().([]byte)
+}
+
+// Algorithms supported algorithms
+func (s *JwksSigner) Algorithms() []string {
+	return []string{
+		jwt.SigningMethodRS256.Name,
+		jwt.SigningMethodRS384.Name,
+		jwt.SigningMethodRS512.Name,
+		jwt.SigningMethodPS256.Name,
+		jwt.SigningMethodPS384.Name,
+		jwt.SigningMethodPS512.Name,
+		jwt.SigningMethodES256.Name,
+		jwt.SigningMethodES384.Name,
+		jwt.SigningMethodES512.Name,
+	}
+}
+
+// keyFunc returns key of kid in header of token, keys would be refreshed if kid is unknown
+func (s *JwksSigner) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key := s.getKey(kid)
+	if key == nil {
+		s.refresh(false)
+		key = s.getKey(kid)
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("unknown jwt kid=%s", kid)
+	}
+
+	if len(key.alg) > 0 && key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("unexpected jwt signing algorithm=%v", token.Header["alg"])
+	}
+
+	switch k := key.key.(type) {
+	case *rsa.PublicKey:
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return k, nil
+		}
+	case *ecdsa.PublicKey:
+		if method, ok := token.Method.(*jwt.SigningMethodECDSA); ok && method.CurveBits == k.Curve.Params().BitSize {
+			return k, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected jwt signing algorithm=%v", token.Header["alg"])
+}
+
+// getKey returns key of kid, the only key would be returned if kid is empty
+func (s *JwksSigner) getKey(kid string) *jwksKey {
+	keys := s.keys.Load().(map[string]*jwksKey)
+
+	if len(kid) < 1 && len(keys) == 1 {
+		for _, v := range keys {
+			return v
+		}
+	}
+
+	return keys[kid]
+}
+
+// kids returns kid of cached keys
+func (s *JwksSigner) kids() []string {
+	res := make([]string, 0)
+	for kid := range s.keys.Load().(map[string]*jwksKey) {
+		res = append(res, kid)
+	}
+
+	return res
+}
+
+// refreshPeriodically refresh keys every refresh interval until stopped
+func (s *JwksSigner) refreshPeriodically(stop chan struct{}) {
+	ticker := time.NewTicker(s.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.refresh(true)
+		}
+	}
+}
+
+// refresh fetch and replace keys, refreshing would be skipped within min refresh interval unless forced.
+// Previous keys would be kept if failed.
+func (s *JwksSigner) refresh(force bool) error {
+	s.refreshLock.Lock()
+	defer s.refreshLock.Unlock()
+
+	if !force && time.Since(time.Unix(0, atomic.LoadInt64(&s.lastRefresh))) < s.minRefreshInterval {
+		return nil
+	}
+	atomic.StoreInt64(&s.lastRefresh, time.Now().UnixNano())
+
+	raw, err := s.fetch()
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJwks(raw)
+	if err != nil {
+		return err
+	}
+
+	s.keys.Store(keys)
+	s.raw.Store(raw)
+	return nil
+}
+
+// fetch read JWKS from file or URL, URL would be discovered from issuer if missing
+func (s *JwksSigner) fetch() ([]byte, error) {
+	if len(s.filePath) > 0 {
+		return os.ReadFile(s.filePath)
+	}
+
+	if len(s.url) < 1 {
+		raw, err := s.get(strings.TrimSuffix(s.issuer, "/") + oidcDiscoveryPath)
+		if err != nil {
+			return nil, err
+		}
+
+		discovery := &struct {
+			JwksUri string `json:"jwks_uri"`
+		}{}
+		if err := json.Unmarshal(raw, discovery); err != nil {
+			return nil, err
+		}
+
+		if len(discovery.JwksUri) < 1 {
+			return nil, errors.New("jwks_uri is missing in OIDC discovery document")
+		}
+		s.url = discovery.JwksUri
+	}
+
+	return s.get(s.url)
+}
+
+// get returns body of URL, error would be returned if status is not 200
+func (s *JwksSigner) get(url string) ([]byte, error) {
+	resp, err := s.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get %s, status=%d", url, resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// parseJwks parse RSA and EC public keys used for signature, error would be returned if none of them is valid
+func parseJwks(raw []byte) (map[string]*jwksKey, error) {
+	jwks := &struct {
+		Keys []*jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(raw, jwks); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*jwksKey)
+	for _, k := range jwks.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+
+		res[k.Kid] = &jwksKey{alg: k.Alg, key: key}
+	}
+
+	if len(res) < 1 {
+		return nil, errors.New("no valid key found in jwks")
+	}
+
+	return res, nil
+}
+
+// publicKey convert JSON web key into *rsa.PublicKey or *ecdsa.PublicKey
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC key")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// decodeBigInt decode base64url encoded big endian integer
+func decodeBigInt(str string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes) < 1 {
+		return nil, errors.New("empty value")
+	}
+
+	return new(big.Int).SetBytes(bytes), nil
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcjwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+)
+
+// utJwksServer serves JWKS with keys which could be rotated
+type utJwksServer struct {
+	*httptest.Server
+	lock  sync.Mutex
+	keys  []map[string]string
+	calls int32
+}
+
+func newUtJwksServer(keys ...map[string]string) *utJwksServer {
+	s := &utJwksServer{keys: keys}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   s.URL,
+			"jwks_uri": s.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.calls, 1)
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+	})
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+func (s *utJwksServer) rotate(keys ...map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.keys = keys
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func newUtRsaKey(t *testing.T, kid string) (*rsa.PrivateKey, map[string]string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	return key, map[string]string{
+		"kid": kid,
+		"kty": "RSA",
+		"alg": "RS256",
+		"use": "sig",
+		"n":   encodeBigInt(key.N),
+		"e":   encodeBigInt(big.NewInt(int64(key.E))),
+	}
+}
+
+func newUtEcKey(t *testing.T, kid string) (*ecdsa.PrivateKey, map[string]string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	return key, map[string]string{
+		"kid": kid,
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   encodeBigInt(key.X),
+		"y":   encodeBigInt(key.Y),
+	}
+}
+
+func signUtToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if len(kid) > 0 {
+		token.Header["kid"] = kid
+	}
+
+	res, err := token.SignedString(key)
+	assert.Nil(t, err)
+	return res
+}
+
+func TestNewJwksSigner(t *testing.T) {
+	// without source
+	signer, err := NewJwksSigner("ut-signer")
+	assert.Nil(t, signer)
+	assert.NotNil(t, err)
+
+	// happy case
+	signer, err = NewJwksSigner("ut-signer",
+		WithJwksUrl("http://ut-url"),
+		WithJwksAudience("ut-aud", ""),
+		WithJwksRefreshInterval(time.Minute),
+		WithJwksMinRefreshInterval(time.Second),
+		WithJwksHttpClient(http.DefaultClient))
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-signer", signer.GetName())
+	assert.Equal(t, rkentry.SignerJwtEntryType, signer.GetType())
+	assert.NotEmpty(t, signer.GetDescription())
+	assert.Contains(t, signer.String(), "http://ut-url")
+	assert.Equal(t, []string{"ut-aud"}, signer.audience)
+	assert.Equal(t, time.Minute, signer.refreshInterval)
+	assert.Equal(t, time.Second, signer.minRefreshInterval)
+	assert.Empty(t, signer.PubKey())
+	assert.NotEmpty(t, signer.Algorithms())
+
+	_, err = signer.SignJwt(jwt.MapClaims{})
+	assert.NotNil(t, err)
+}
+
+func TestJwksSigner_VerifyJwt(t *testing.T) {
+	rsaKey, rsaJwk := newUtRsaKey(t, "ut-rsa")
+	ecKey, ecJwk := newUtEcKey(t, "ut-ec")
+	server := newUtJwksServer(rsaJwk, ecJwk)
+	defer server.Close()
+
+	signer, err := NewJwksSigner("ut-signer",
+		WithJwksUrl(server.URL+"/keys"),
+		WithJwksIssuer("ut-iss"),
+		WithJwksAudience("ut-aud", "ut-other"))
+	assert.Nil(t, err)
+	signer.Bootstrap(context.TODO())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.calls))
+	assert.Contains(t, string(signer.PubKey()), "ut-rsa")
+
+	claims := jwt.MapClaims{"iss": "ut-iss", "aud": []string{"ut-other"}, "sub": "ut-user"}
+
+	// RSA
+	token, err := signer.VerifyJwt(signUtToken(t, jwt.SigningMethodRS256, "ut-rsa", rsaKey, claims))
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-user", token.Claims.(jwt.MapClaims)["sub"])
+
+	// EC
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodES256, "ut-ec", ecKey, claims))
+	assert.Nil(t, err)
+
+	// algorithm mismatched with key
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodRS384, "ut-rsa", rsaKey, claims))
+	assert.NotNil(t, err)
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodHS256, "ut-rsa", []byte("ut-key"), claims))
+	assert.NotNil(t, err)
+
+	// invalid issuer
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodRS256, "ut-rsa", rsaKey,
+		jwt.MapClaims{"iss": "ut-invalid", "aud": "ut-aud"}))
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+
+	// invalid audience
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodRS256, "ut-rsa", rsaKey,
+		jwt.MapClaims{"iss": "ut-iss", "aud": "ut-invalid"}))
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+
+	// no more fetching for known keys
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.calls))
+}
+
+func TestJwksSigner_Refresh(t *testing.T) {
+	oldKey, oldJwk := newUtRsaKey(t, "ut-old")
+	newKey, newJwk := newUtRsaKey(t, "ut-new")
+	server := newUtJwksServer(oldJwk)
+	defer server.Close()
+
+	signer, err := NewJwksSigner("ut-signer",
+		WithJwksUrl(server.URL+"/keys"),
+		WithJwksMinRefreshInterval(0))
+	assert.Nil(t, err)
+
+	// case 1: keys fetched on first unknown kid
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodRS256, "ut-old", oldKey, jwt.MapClaims{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.calls))
+
+	// case 2: keys rotated, refresh on unknown kid
+	server.rotate(newJwk)
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodRS256, "ut-new", newKey, jwt.MapClaims{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.calls))
+	assert.Equal(t, []string{"ut-new"}, signer.kids())
+
+	// case 3: refresh on unknown kid is limited by min refresh interval
+	signer.minRefreshInterval = time.Hour
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodRS256, "ut-old", oldKey, jwt.MapClaims{}))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.calls))
+
+	// case 4: keys kept if failed to fetch
+	server.Close()
+	assert.NotNil(t, signer.refresh(true))
+	assert.Equal(t, []string{"ut-new"}, signer.kids())
+}
+
+func TestJwksSigner_Bootstrap(t *testing.T) {
+	key, jwk := newUtRsaKey(t, "ut-rsa")
+	// without valid keys at first
+	server := newUtJwksServer()
+	defer server.Close()
+
+	signer, err := NewJwksSigner("ut-signer",
+		WithJwksUrl(server.URL+"/keys"),
+		WithJwksRefreshInterval(10*time.Millisecond))
+	assert.Nil(t, err)
+
+	// case 1: keys refreshed on schedule even if failed to fetch while bootstrapping
+	signer.Bootstrap(context.TODO())
+	defer signer.Interrupt(context.TODO())
+	assert.Empty(t, signer.kids())
+
+	// bootstrap running signer is noop
+	signer.Bootstrap(context.TODO())
+
+	server.rotate(jwk)
+	assert.Eventually(t, func() bool {
+		return len(signer.kids()) == 1
+	}, time.Second, 10*time.Millisecond)
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodRS256, "ut-rsa", key, jwt.MapClaims{}))
+	assert.Nil(t, err)
+
+	// case 2: refreshing stopped after interrupted
+	signer.Interrupt(context.TODO())
+	time.Sleep(30 * time.Millisecond)
+	calls := atomic.LoadInt32(&server.calls)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, calls, atomic.LoadInt32(&server.calls))
+}
+
+func TestJwksSigner_Discovery(t *testing.T) {
+	key, jwk := newUtRsaKey(t, "ut-rsa")
+	server := newUtJwksServer(jwk)
+	defer server.Close()
+
+	signer, err := NewJwksSigner("ut-signer", WithJwksIssuer(server.URL+"/"))
+	assert.Nil(t, err)
+
+	// url discovered while printing signer
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NotEmpty(t, signer.String())
+	}()
+	defer wg.Wait()
+
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodRS256, "ut-rsa", key, jwt.MapClaims{"iss": server.URL + "/"}))
+	assert.Nil(t, err)
+	assert.Equal(t, server.URL+"/keys", signer.url)
+}
+
+func TestJwksSigner_File(t *testing.T) {
+	key, jwk := newUtRsaKey(t, "")
+	_, encJwk := newUtRsaKey(t, "ut-enc")
+	encJwk["use"] = "enc"
+
+	bytes, _ := json.Marshal(map[string]interface{}{
+		"keys": []interface{}{jwk, encJwk, map[string]string{"kid": "ut-oct", "kty": "oct"}},
+	})
+	filePath := filepath.Join(t.TempDir(), "jwks.json")
+	assert.Nil(t, os.WriteFile(filePath, bytes, 0644))
+
+	signer, err := NewJwksSigner("ut-signer", WithJwksFile(filePath))
+	assert.Nil(t, err)
+	signer.Bootstrap(context.TODO())
+
+	// only signing key is kept, token without kid is verified by the only key
+	assert.Equal(t, []string{""}, signer.kids())
+	_, err = signer.VerifyJwt(signUtToken(t, jwt.SigningMethodRS256, "", key, jwt.MapClaims{}))
+	assert.Nil(t, err)
+}
+
+func TestParseJwks(t *testing.T) {
+	// invalid json
+	_, err := parseJwks([]byte("{"))
+	assert.NotNil(t, err)
+
+	// no valid key
+	_, err = parseJwks([]byte(`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}, {"kty": "RSA", "n": "", "e": "AQAB"}]}`))
+	assert.NotNil(t, err)
+
+	// unsupported curve
+	_, err = parseJwks([]byte(`{"keys": [{"kty": "EC", "crv": "P-224", "x": "AQ", "y": "AQ"}]}`))
+	assert.NotNil(t, err)
+}
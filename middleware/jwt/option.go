@@ -0,0 +1,94 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcjwt
+
+import (
+	"time"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	rkmidjwt "github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
+)
+
+// BootConfig for YAML, extends rkmidjwt.BootConfig with claims copied into logger, event and trace span.
+type BootConfig struct {
+	rkmidjwt.BootConfig `yaml:",inline" mapstructure:",squash"`
+	ClaimsToLog         []string        `yaml:"claimsToLog" json:"claimsToLog"`
+	Jwks                *BootConfigJwks `yaml:"jwks" json:"jwks"`
+}
+
+// BootConfigJwks Boot config of JWKS key source, JWKS would be discovered from issuer with OIDC if url and file are missing.
+type BootConfigJwks struct {
+	Url               string   `yaml:"url" json:"url"`
+	File              string   `yaml:"file" json:"file"`
+	RefreshIntervalMs int64    `yaml:"refreshIntervalMs" json:"refreshIntervalMs"`
+	Issuer            string   `yaml:"issuer" json:"issuer"`
+	Audience          []string `yaml:"audience" json:"audience"`
+}
+
+// ToOptions convert BootConfig into Option list, signer of JWKS would be registered into rkentry.GlobalAppCtx.
+func ToOptions(config *BootConfig, entryName, entryType string) []rkmidjwt.Option {
+	signer := ToJwksSigner(config, entryName)
+	if signer != nil {
+		// register with name of entry like symmetric and asymmetric signers, so that failures could be classified
+		rkentry.GlobalAppCtx.AddEntry(signer)
+	}
+
+	return ToOptionsWithSigner(config, entryName, entryType, signer)
+}
+
+// ToJwksSigner convert BootConfig into JwksSigner without registering it, nil if JWKS is not configured.
+func ToJwksSigner(config *BootConfig, entryName string) *JwksSigner {
+	if !config.Enabled || config.Jwks == nil {
+		return nil
+	}
+
+	signer, err := NewJwksSigner(entryName,
+		WithJwksUrl(config.Jwks.Url),
+		WithJwksFile(config.Jwks.File),
+		WithJwksRefreshInterval(time.Duration(config.Jwks.RefreshIntervalMs)*time.Millisecond),
+		WithJwksIssuer(config.Jwks.Issuer),
+		WithJwksAudience(config.Jwks.Audience...))
+	if err != nil {
+		rkentry.ShutdownWithError(err)
+	}
+
+	return signer
+}
+
+// ToOptionsWithSigner convert BootConfig into Option list with signer of JWKS, signer would not be registered.
+func ToOptionsWithSigner(config *BootConfig, entryName, entryType string, signer *JwksSigner) []rkmidjwt.Option {
+	opts := rkmidjwt.ToOptions(&config.BootConfig, entryName, entryType)
+
+	if signer != nil {
+		opts = append(opts, rkmidjwt.WithSigner(signer))
+	}
+
+	return opts
+}
+
+// ToSigner returns signer verifying jwt of BootConfig after options built, signer of JWKS is preferred.
+//
+// Symmetric and asymmetric signers are registered by ToOptions with name of entry, nil if verifying is skipped
+// or signer is not configured.
+func ToSigner(config *BootConfig, entryName string, jwks *JwksSigner) rkentry.SignerJwt {
+	if jwks != nil {
+		return jwks
+	}
+
+	if config.SkipVerify {
+		return nil
+	}
+
+	if len(config.SignerEntry) > 0 {
+		return rkentry.GlobalAppCtx.GetSignerJwtEntry(config.SignerEntry)
+	}
+
+	if config.Symmetric != nil || config.Asymmetric != nil {
+		return rkentry.GlobalAppCtx.GetSignerJwtEntry(entryName)
+	}
+
+	return nil
+}
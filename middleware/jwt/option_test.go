@@ -0,0 +1,109 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcjwt
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	rkmidjwt "github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBootConfig(t *testing.T) {
+	config := &struct {
+		Jwt BootConfig `yaml:"jwt"`
+	}{}
+
+	rkentry.UnmarshalBootYAML([]byte(`
+jwt:
+  enabled: true
+  skipVerify: true
+  ignore: ["/ut-ignore"]
+  claimsToLog: ["sub", "tenant"]
+`), config)
+
+	assert.True(t, config.Jwt.Enabled)
+	assert.True(t, config.Jwt.SkipVerify)
+	assert.Equal(t, []string{"/ut-ignore"}, config.Jwt.Ignore)
+	assert.Equal(t, []string{"sub", "tenant"}, config.Jwt.ClaimsToLog)
+	assert.NotEmpty(t, ToOptions(&config.Jwt, "ut-entry", "ut-type"))
+
+	// disabled
+	config.Jwt.Enabled = false
+	assert.Empty(t, ToOptions(&config.Jwt, "ut-entry", "ut-type"))
+}
+
+func TestBootConfig_Jwks(t *testing.T) {
+	config := &struct {
+		Jwt BootConfig `yaml:"jwt"`
+	}{}
+
+	rkentry.UnmarshalBootYAML([]byte(`
+jwt:
+  enabled: true
+  jwks:
+    url: "http://ut-url/keys"
+    refreshIntervalMs: 1000
+    issuer: "ut-iss"
+    audience: ["ut-aud"]
+`), config)
+
+	assert.Equal(t, "http://ut-url/keys", config.Jwt.Jwks.Url)
+	assert.Equal(t, int64(1000), config.Jwt.Jwks.RefreshIntervalMs)
+	assert.Equal(t, "ut-iss", config.Jwt.Jwks.Issuer)
+	assert.Equal(t, []string{"ut-aud"}, config.Jwt.Jwks.Audience)
+
+	// signer appended
+	withoutJwks := len(rkmidjwt.ToOptions(&config.Jwt.BootConfig, "ut-entry", "ut-type"))
+	assert.Len(t, ToOptions(&config.Jwt, "ut-entry", "ut-type"), withoutJwks+1)
+	assert.NotNil(t, rkentry.GlobalAppCtx.GetEntry(rkentry.SignerJwtEntryType, "ut-entry"))
+
+	// signer built without registering
+	rkentry.GlobalAppCtx.RemoveEntryByType(rkentry.SignerJwtEntryType)
+	signer := ToJwksSigner(&config.Jwt, "ut-entry-unregistered")
+	assert.NotNil(t, signer)
+	assert.Nil(t, rkentry.GlobalAppCtx.GetEntry(rkentry.SignerJwtEntryType, "ut-entry-unregistered"))
+	assert.Len(t, ToOptionsWithSigner(&config.Jwt, "ut-entry-unregistered", "ut-type", signer), withoutJwks+1)
+	assert.Nil(t, rkentry.GlobalAppCtx.GetEntry(rkentry.SignerJwtEntryType, "ut-entry-unregistered"))
+
+	// without jwks
+	config.Jwt.Jwks = nil
+	assert.Nil(t, ToJwksSigner(&config.Jwt, "ut-entry"))
+
+	// invalid jwks
+	config.Jwt.Jwks = &BootConfigJwks{}
+	assert.Panics(t, func() {
+		ToOptions(&config.Jwt, "ut-entry", "ut-type")
+	})
+}
+
+func TestToSigner(t *testing.T) {
+	config := &BootConfig{}
+	config.Enabled = true
+	defer rkentry.GlobalAppCtx.RemoveEntryByType(rkentry.SignerJwtEntryType)
+
+	// signer of jwks preferred
+	jwks, _ := NewJwksSigner("ut-entry", WithJwksUrl("http://ut-url/keys"))
+	assert.Equal(t, jwks, ToSigner(config, "ut-entry", jwks))
+
+	// signer not configured, default one of rkmidjwt is unknown
+	assert.Nil(t, ToSigner(config, "ut-entry", nil))
+
+	// symmetric signer registered by options
+	config.Symmetric = &rkmidjwt.SymmetricConfig{Algorithm: jwt.SigningMethodHS256.Name, Token: "ut-token"}
+	ToOptions(config, "ut-entry", "ut-type")
+	assert.Equal(t, rkentry.GlobalAppCtx.GetSignerJwtEntry("ut-entry"), ToSigner(config, "ut-entry", nil))
+
+	// signer entry
+	config.SignerEntry = "ut-other"
+	assert.Nil(t, ToSigner(config, "ut-entry", nil))
+
+	// verifying skipped
+	config.SkipVerify = true
+	assert.Nil(t, ToSigner(config, "ut-entry", nil))
+}
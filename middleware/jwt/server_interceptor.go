@@ -7,39 +7,53 @@ package rkgrpcjwt
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
 	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
 	rkmidjwt "github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
-	rkgrpcerr "github.com/tegarajipangestu/rk-grpc/v2/boot/error"
 	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
 	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 // UnaryServerInterceptor create new unary server interceptor.
 func UnaryServerInterceptor(opts ...rkmidjwt.Option) grpc.UnaryServerInterceptor {
-	set := rkmidjwt.NewOptionSet(opts...)
+	return UnaryServerInterceptorWithClaims(nil, opts...)
+}
+
+// UnaryServerInterceptorWithClaims create new unary server interceptor which copies claims into logger, event and
+// trace span of request.
+func UnaryServerInterceptorWithClaims(claims []string, opts ...rkmidjwt.Option) grpc.UnaryServerInterceptor {
+	return UnaryServerInterceptorWithSigner(nil, claims, opts...)
+}
+
+// UnaryServerInterceptorWithSigner create new unary server interceptor which verifies jwt with signer and copies
+// claims into logger, event and trace span of request.
+//
+// Failures are classified with error returned by signer, reason would be INVALID_TOKEN if signer is nil.
+func UnaryServerInterceptorWithSigner(signer rkentry.SignerJwt, claims []string, opts ...rkmidjwt.Option) grpc.UnaryServerInterceptor {
+	v := newVerifier(signer, opts)
 
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		ctx = rkgrpcmid.WrapContextForServer(ctx)
-		rkgrpcmid.AddToServerContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+		rkgrpcmid.AddToServerContextPayload(ctx, rkmid.EntryNameKey, v.set.GetEntryName())
 
-		beforeCtx := set.BeforeCtx(createReqByCopyingHeader(ctx, info.FullMethod), nil)
-		set.Before(beforeCtx)
+		beforeCtx, recorder := v.verify(createReqByCopyingHeader(ctx, info.FullMethod))
 
 		// case 1: error response
 		if beforeCtx.Output.ErrResp != nil {
-			fmt.Println(beforeCtx.Output.ErrResp.Error())
-			fmt.Println(beforeCtx.Output.ErrResp.Message())
-
-			return nil, rkgrpcerr.Unauthenticated(beforeCtx.Output.ErrResp.Message()).Err()
+			return nil, verifyFailure(ctx, v.set.GetEntryName(), recorder, beforeCtx.Output.ErrResp.Message())
 		}
 
 		// insert into context
 		ctx = context.WithValue(ctx, rkmid.JwtTokenKey, beforeCtx.Output.JwtToken)
+		copyClaims(ctx, claims)
 
 		// case 2: call next
 		return handler(ctx, req)
@@ -48,32 +62,122 @@ func UnaryServerInterceptor(opts ...rkmidjwt.Option) grpc.UnaryServerInterceptor
 
 // StreamServerInterceptor create new stream server interceptor.
 func StreamServerInterceptor(opts ...rkmidjwt.Option) grpc.StreamServerInterceptor {
-	set := rkmidjwt.NewOptionSet(opts...)
+	return StreamServerInterceptorWithClaims(nil, opts...)
+}
+
+// StreamServerInterceptorWithClaims create new stream server interceptor which copies claims into logger, event and
+// trace span of request.
+func StreamServerInterceptorWithClaims(claims []string, opts ...rkmidjwt.Option) grpc.StreamServerInterceptor {
+	return StreamServerInterceptorWithSigner(nil, claims, opts...)
+}
+
+// StreamServerInterceptorWithSigner create new stream server interceptor which verifies jwt with signer and copies
+// claims into logger, event and trace span of request.
+//
+// Failures are classified with error returned by signer, reason would be INVALID_TOKEN if signer is nil.
+func StreamServerInterceptorWithSigner(signer rkentry.SignerJwt, claims []string, opts ...rkmidjwt.Option) grpc.StreamServerInterceptor {
+	v := newVerifier(signer, opts)
 
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		// Before invoking
 		wrappedStream := rkgrpcctx.WrapServerStream(stream)
 		wrappedStream.WrappedContext = rkgrpcmid.WrapContextForServer(wrappedStream.WrappedContext)
 
-		rkgrpcmid.AddToServerContextPayload(wrappedStream.WrappedContext, rkmid.EntryNameKey, set.GetEntryName())
+		rkgrpcmid.AddToServerContextPayload(wrappedStream.WrappedContext, rkmid.EntryNameKey, v.set.GetEntryName())
 
-		beforeCtx := set.BeforeCtx(createReqByCopyingHeader(wrappedStream.WrappedContext, info.FullMethod), nil)
-		set.Before(beforeCtx)
+		beforeCtx, recorder := v.verify(createReqByCopyingHeader(wrappedStream.WrappedContext, info.FullMethod))
 
 		// case 1: error response
 		if beforeCtx.Output.ErrResp != nil {
-			return rkgrpcerr.Unauthenticated(beforeCtx.Output.ErrResp.Message()).Err()
+			return verifyFailure(wrappedStream.WrappedContext, v.set.GetEntryName(), recorder, beforeCtx.Output.ErrResp.Message())
 		}
 
 		// insert into context
 		wrappedStream.WrappedContext = context.WithValue(wrappedStream.WrappedContext, rkmid.JwtTokenKey, beforeCtx.Output.JwtToken)
+		copyClaims(wrappedStream.WrappedContext, claims)
 
 		// Invoking
 		return handler(srv, wrappedStream)
 	}
 }
 
+// verifier verifies jwt of request with option set, error returned by signer is recorded if signer is known
+type verifier struct {
+	set    rkmidjwt.OptionSetInterface
+	opts   []rkmidjwt.Option
+	signer rkentry.SignerJwt
+}
+
+// newVerifier create verifier with signer and options, signer overrides the one in options
+func newVerifier(signer rkentry.SignerJwt, opts []rkmidjwt.Option) *verifier {
+	if signer != nil {
+		opts = append(opts[:len(opts):len(opts)], rkmidjwt.WithSigner(signer))
+	}
+
+	return &verifier{
+		set:    rkmidjwt.NewOptionSet(opts...),
+		opts:   opts,
+		signer: signer,
+	}
+}
+
+// verify returns before context of request and recorder of signer, recorder would be nil if signer is unknown
+func (v *verifier) verify(req *http.Request) (*rkmidjwt.BeforeCtx, *verifyRecorder) {
+	if v.signer == nil {
+		beforeCtx := v.set.BeforeCtx(req, nil)
+		v.set.Before(beforeCtx)
+		return beforeCtx, nil
+	}
+
+	// rkmidjwt would not expose error of signer, option set is created per request to record it
+	recorder := &verifyRecorder{SignerJwt: v.signer}
+	opts := make([]rkmidjwt.Option, 0, len(v.opts)+1)
+	opts = append(opts, v.opts...)
+	set := rkmidjwt.NewOptionSet(append(opts, rkmidjwt.WithSigner(recorder))...)
+
+	beforeCtx := set.BeforeCtx(req, nil)
+	set.Before(beforeCtx)
+	return beforeCtx, recorder
+}
+
+// copyClaims copy claims of JWT in context into logger, event and trace span with key of jwt.<claim>
+func copyClaims(ctx context.Context, keys []string) {
+	if len(keys) < 1 {
+		return
+	}
+
+	claims := rkgrpcctx.GetJwtClaims(ctx)
+	fields := make([]zap.Field, 0, len(keys))
+	attrs := make([]attribute.KeyValue, 0, len(keys))
+
+	for _, key := range keys {
+		claim, ok := claims[key]
+		if !ok {
+			continue
+		}
+
+		value := strings.Join(rkgrpcctx.ClaimToStrings(claim), ",")
+		fields = append(fields, zap.String("jwt."+key, value))
+		attrs = append(attrs, attribute.String("jwt."+key, value))
+	}
+
+	if len(fields) < 1 {
+		return
+	}
+
+	// logger in payload would be used by handler and logging middleware
+	if logger, ok := rkgrpcmid.GetServerContextPayload(ctx)[rkmid.LoggerKey].(*zap.Logger); ok {
+		rkgrpcmid.AddToServerContextPayload(ctx, rkmid.LoggerKey, logger.With(fields...))
+	}
+	rkgrpcctx.GetEvent(ctx).AddPayloads(fields...)
+	rkgrpcctx.GetTraceSpan(ctx).SetAttributes(attrs...)
+}
+
 func createReqByCopyingHeader(ctx context.Context, method string) *http.Request {
+	return createReqByCopyingMD(rkgrpcctx.GetIncomingHeaders(ctx), method)
+}
+
+func createReqByCopyingMD(md metadata.MD, method string) *http.Request {
 	req := &http.Request{
 		URL: &url.URL{
 			Path: method,
@@ -81,7 +185,7 @@ func createReqByCopyingHeader(ctx context.Context, method string) *http.Request
 		Header: http.Header{},
 	}
 
-	for k, list := range rkgrpcctx.GetIncomingHeaders(ctx) {
+	for k, list := range md {
 		if len(list) > 0 {
 			req.Header.Set(k, list[0])
 		}
@@ -7,9 +7,14 @@ package rkgrpcjwt
 
 import (
 	"context"
+	"github.com/golang-jwt/jwt/v4"
 	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
 	"github.com/stretchr/testify/assert"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"net/http"
@@ -48,6 +53,44 @@ func TestStreamServerInterceptor(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestServerInterceptorWithClaims(t *testing.T) {
+	beforeCtx := rkmidjwt.NewBeforeCtx()
+	beforeCtx.Output.JwtToken = &jwt.Token{
+		Claims: jwt.MapClaims{"sub": "ut-user", "aud": []interface{}{"ut-a", "ut-b"}, "secret": "ut-secret"},
+	}
+	mock := rkmidjwt.NewOptionSetMock(beforeCtx)
+	claims := []string{"sub", "aud", "missing"}
+
+	// unary, claims copied into logger of request
+	core, logs := observer.New(zap.InfoLevel)
+	ctx := rkgrpcmid.WrapContextForServer(context.TODO())
+	rkgrpcmid.AddToServerContextPayload(ctx, rkmid.LoggerKey, zap.New(core))
+
+	inter := UnaryServerInterceptorWithClaims(claims, rkmidjwt.WithMockOptionSet(mock))
+	_, err := inter(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "ut-method"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			assert.Equal(t, "ut-user", rkgrpcctx.GetJwtSubject(ctx))
+			rkgrpcctx.GetLogger(ctx).Info("ut-log")
+			return nil, nil
+		})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "ut-user", fields["jwt.sub"])
+	assert.Equal(t, "ut-a,ut-b", fields["jwt.aud"])
+	assert.NotContains(t, fields, "jwt.secret")
+
+	// stream, claims available from context of stream
+	streamInter := StreamServerInterceptorWithClaims(claims, rkmidjwt.WithMockOptionSet(mock))
+	err = streamInter(nil, &ServerStreamMock{ctx: context.TODO()}, &grpc.StreamServerInfo{FullMethod: "ut-method"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			assert.Equal(t, "ut-user", rkgrpcctx.GetJwtSubject(stream.Context()))
+			assert.Equal(t, []string{"ut-a", "ut-b"}, rkgrpcctx.GetJwtAudience(stream.Context()))
+			return nil
+		})
+	assert.Nil(t, err)
+}
+
 // ************ Test utility ************
 
 type ServerStreamMock struct {
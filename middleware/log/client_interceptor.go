@@ -0,0 +1,104 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclog
+
+import (
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkmidlog "github.com/rookie-ninja/rk-entry/v2/middleware/log"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor Create new unary client interceptor.
+func UnaryClientInterceptor(opts ...rkmidlog.Option) grpc.UnaryClientInterceptor {
+	set := rkmidlog.NewOptionSet(opts...)
+
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		// call before
+		beforeCtx := set.BeforeCtx(nil)
+		beforeCtx.Input.UrlPath = method
+		beforeCtx.Input.RemoteAddr = cc.Target()
+
+		// grpc fields
+		grpcService, grpcMethod := rkgrpcmid.GetGrpcInfo(method)
+		beforeCtx.Input.Fields = append(beforeCtx.Input.Fields, []zap.Field{
+			zap.String("grpcService", grpcService),
+			zap.String("grpcMethod", grpcMethod),
+			zap.String("grpcType", "UnaryClient"),
+		}...)
+
+		set.Before(beforeCtx)
+
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EventKey, beforeCtx.Output.Event)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.LoggerKey, beforeCtx.Output.Logger)
+
+		// call invoker, headers returned from server would be stored in client payload
+		opts = append(opts, grpc.Header(rkgrpcmid.GetIncomingHeadersOfClient(ctx)))
+		err := invoker(ctx, method, req, resp, cc, opts...)
+
+		// call after
+		afterCtx := set.AfterCtx(
+			rkgrpcctx.GetRequestId(ctx),
+			rkgrpcctx.GetTraceId(ctx),
+			status.Code(err).String())
+		set.After(beforeCtx, afterCtx)
+
+		return err
+	}
+}
+
+// StreamClientInterceptor Create new stream client interceptor.
+func StreamClientInterceptor(opts ...rkmidlog.Option) grpc.StreamClientInterceptor {
+	set := rkmidlog.NewOptionSet(opts...)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		// call before
+		beforeCtx := set.BeforeCtx(nil)
+		beforeCtx.Input.UrlPath = method
+		beforeCtx.Input.RemoteAddr = cc.Target()
+
+		// grpc fields
+		grpcService, grpcMethod := rkgrpcmid.GetGrpcInfo(method)
+		beforeCtx.Input.Fields = append(beforeCtx.Input.Fields, []zap.Field{
+			zap.String("grpcService", grpcService),
+			zap.String("grpcMethod", grpcMethod),
+			zap.String("grpcType", "StreamClient"),
+		}...)
+
+		set.Before(beforeCtx)
+
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EventKey, beforeCtx.Output.Event)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.LoggerKey, beforeCtx.Output.Logger)
+
+		// call after once stream finished
+		after := func(err error) {
+			afterCtx := set.AfterCtx(
+				rkgrpcctx.GetRequestId(ctx),
+				rkgrpcctx.GetTraceId(ctx),
+				status.Code(err).String())
+			set.After(beforeCtx, afterCtx)
+		}
+
+		// call streamer
+		clientStream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			after(err)
+			return nil, err
+		}
+
+		return rkgrpcmid.WrapClientStreamWithFinish(clientStream, desc, after), nil
+	}
+}
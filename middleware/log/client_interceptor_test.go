@@ -0,0 +1,125 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclog
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/log"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	beforeCtx := rkmidlog.NewBeforeCtx()
+	afterCtx := rkmidlog.NewAfterCtx()
+	mock := rkmidlog.NewOptionSetMock(beforeCtx, afterCtx)
+	inter := UnaryClientInterceptor(rkmidlog.WithMockOptionSet(mock))
+
+	beforeCtx.Output.Event = rkentry.EventEntryNoop.CreateEventNoop()
+	beforeCtx.Output.Logger = rkentry.LoggerEntryNoop.Logger
+
+	assert.Nil(t, inter(NewUnaryClientInput()))
+	assert.Equal(t, "UnaryClient", beforeCtx.Input.Fields[2].String)
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	beforeCtx := rkmidlog.NewBeforeCtx()
+	afterCtx := rkmidlog.NewAfterCtx()
+	mock := rkmidlog.NewOptionSetMock(beforeCtx, afterCtx)
+	inter := StreamClientInterceptor(rkmidlog.WithMockOptionSet(mock))
+
+	beforeCtx.Output.Event = rkentry.EventEntryNoop.CreateEventNoop()
+	beforeCtx.Output.Logger = rkentry.LoggerEntryNoop.Logger
+
+	_, err := inter(NewStreamClientInput())
+	assert.Nil(t, err)
+	assert.Equal(t, "StreamClient", beforeCtx.Input.Fields[2].String)
+}
+
+func TestStreamClientInterceptor_WithFinishedStream(t *testing.T) {
+	beforeCtx := rkmidlog.NewBeforeCtx()
+	beforeCtx.Output.Event = rkentry.EventEntryNoop.CreateEventNoop()
+	beforeCtx.Output.Logger = rkentry.LoggerEntryNoop.Logger
+	recorder := &afterRecorder{
+		OptionSetInterface: rkmidlog.NewOptionSetMock(beforeCtx, rkmidlog.NewAfterCtx()),
+	}
+	inter := StreamClientInterceptor(rkmidlog.WithMockOptionSet(recorder))
+	ctx, desc, cc, method, _ := NewStreamClientInput()
+	desc.ServerStreams = true
+
+	// event is logged once stream finished with io.EOF
+	stream, err := inter(ctx, desc, cc, method, streamerOf(&finishedClientStream{err: io.EOF}, nil))
+	assert.Nil(t, err)
+	assert.Empty(t, recorder.codes)
+	assert.Equal(t, io.EOF, stream.RecvMsg(nil))
+	assert.Equal(t, []string{"OK"}, recorder.codes)
+
+	// event is logged with code of error stream finished with
+	stream, err = inter(ctx, desc, cc, method,
+		streamerOf(&finishedClientStream{err: status.Error(codes.Internal, "ut-error")}, nil))
+	assert.Nil(t, err)
+	assert.NotNil(t, stream.RecvMsg(nil))
+	assert.Equal(t, []string{"OK", "Internal"}, recorder.codes)
+
+	// event is logged at once if stream is not created
+	_, err = inter(ctx, desc, cc, method, streamerOf(nil, status.Error(codes.Unavailable, "ut-error")))
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"OK", "Internal", "Unavailable"}, recorder.codes)
+}
+
+// ************ Test utility ************
+
+func NewUnaryClientInput() (context.Context, string, interface{}, interface{}, *grpc.ClientConn, grpc.UnaryInvoker) {
+	cc, _ := grpc.Dial("ut-target", grpc.WithInsecure())
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	return context.TODO(), "ut-method", nil, nil, cc, invoker
+}
+
+func NewStreamClientInput() (context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, grpc.Streamer) {
+	cc, _ := grpc.Dial("ut-target", grpc.WithInsecure())
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, nil
+	}
+
+	return context.TODO(), &grpc.StreamDesc{}, cc, "ut-method", streamer
+}
+
+// afterRecorder records codes of events logged
+type afterRecorder struct {
+	rkmidlog.OptionSetInterface
+	codes []string
+}
+
+func (r *afterRecorder) AfterCtx(reqId, traceId, resCode string) *rkmidlog.AfterCtx {
+	r.codes = append(r.codes, resCode)
+	return r.OptionSetInterface.AfterCtx(reqId, traceId, resCode)
+}
+
+// finishedClientStream is finished with err once received
+type finishedClientStream struct {
+	grpc.ClientStream
+	err error
+}
+
+func (s *finishedClientStream) RecvMsg(m interface{}) error {
+	return s.err
+}
+
+// streamerOf returns streamer which creates stream finished with err, or fails with err if stream is nil
+func streamerOf(stream grpc.ClientStream, err error) grpc.Streamer {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return stream, err
+	}
+}
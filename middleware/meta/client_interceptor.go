@@ -0,0 +1,62 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcmeta
+
+import (
+	"context"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkmidmeta "github.com/rookie-ninja/rk-entry/v2/middleware/meta"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"google.golang.org/grpc"
+)
+
+// UnaryClientInterceptor Add common headers as extension style in grpc outgoing metadata.
+func UnaryClientInterceptor(opts ...rkmidmeta.Option) grpc.UnaryClientInterceptor {
+	set := rkmidmeta.NewOptionSet(opts...)
+
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		beforeCtx := set.BeforeCtx(nil, rkgrpcctx.GetEvent(ctx))
+		beforeCtx.Input.UrlPath = method
+		set.Before(beforeCtx)
+
+		ctx = addHeadersToServer(ctx, beforeCtx.Output.HeadersToReturn)
+
+		return invoker(ctx, method, req, resp, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor Add common headers as extension style in grpc outgoing metadata.
+func StreamClientInterceptor(opts ...rkmidmeta.Option) grpc.StreamClientInterceptor {
+	set := rkmidmeta.NewOptionSet(opts...)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		beforeCtx := set.BeforeCtx(nil, rkgrpcctx.GetEvent(ctx))
+		beforeCtx.Input.UrlPath = method
+		set.Before(beforeCtx)
+
+		ctx = addHeadersToServer(ctx, beforeCtx.Output.HeadersToReturn)
+
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// Add headers into outgoing metadata and record them in client payload.
+func addHeadersToServer(ctx context.Context, headers map[string]string) context.Context {
+	for k, v := range headers {
+		ctx = rkgrpcctx.AddHeaderToServer(ctx, k, v)
+		rkgrpcmid.AddToClientContextPayload(ctx, k, v)
+	}
+
+	return ctx
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcmeta
+
+import (
+	"context"
+	"testing"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/meta"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	beforeCtx := rkmidmeta.NewBeforeCtx()
+	mock := rkmidmeta.NewOptionSetMock(beforeCtx)
+	inter := UnaryClientInterceptor(rkmidmeta.WithMockOptionSet(mock))
+
+	beforeCtx.Output.HeadersToReturn[rkmid.HeaderRequestId] = "ut-request-id"
+
+	ctx, method, req, resp, cc, _ := NewUnaryClientInput()
+	err := inter(ctx, method, req, resp, cc, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, []string{"ut-request-id"}, md.Get(rkmid.HeaderRequestId))
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	beforeCtx := rkmidmeta.NewBeforeCtx()
+	mock := rkmidmeta.NewOptionSetMock(beforeCtx)
+	inter := StreamClientInterceptor(rkmidmeta.WithMockOptionSet(mock))
+
+	beforeCtx.Output.HeadersToReturn[rkmid.HeaderRequestId] = "ut-request-id"
+
+	ctx, desc, cc, method, _ := NewStreamClientInput()
+	_, err := inter(ctx, desc, cc, method, func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, []string{"ut-request-id"}, md.Get(rkmid.HeaderRequestId))
+		return nil, nil
+	})
+	assert.Nil(t, err)
+}
+
+// ************ Test utility ************
+
+func NewUnaryClientInput() (context.Context, string, interface{}, interface{}, *grpc.ClientConn, grpc.UnaryInvoker) {
+	cc, _ := grpc.Dial("ut-target", grpc.WithInsecure())
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	return context.TODO(), "ut-method", nil, nil, cc, invoker
+}
+
+func NewStreamClientInput() (context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, grpc.Streamer) {
+	cc, _ := grpc.Dial("ut-target", grpc.WithInsecure())
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, nil
+	}
+
+	return context.TODO(), &grpc.StreamDesc{}, cc, "ut-method", streamer
+}
@@ -78,3 +78,54 @@ func StreamServerInterceptor(opts ...rkmidpanic.Option) grpc.StreamServerInterce
 		return handler(srv, stream)
 	}
 }
+
+// UnaryClientInterceptor Create new unary client interceptor.
+func UnaryClientInterceptor(opts ...rkmidpanic.Option) grpc.UnaryClientInterceptor {
+	set := rkmidpanic.NewOptionSet(opts...)
+
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		defer func() {
+			if recv := recover(); recv != nil {
+				err = recoverToStatus(recv).Err()
+
+				rkgrpcctx.GetEvent(ctx).SetCounter("panic", 1)
+				rkgrpcctx.GetLogger(ctx).Error(fmt.Sprintf("panic occurs:\n%s", string(debug.Stack())), zap.Error(err))
+			}
+		}()
+
+		return invoker(ctx, method, req, resp, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor Create new stream client interceptor.
+func StreamClientInterceptor(opts ...rkmidpanic.Option) grpc.StreamClientInterceptor {
+	set := rkmidpanic.NewOptionSet(opts...)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (stream grpc.ClientStream, err error) {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		defer func() {
+			if recv := recover(); recv != nil {
+				stream, err = nil, recoverToStatus(recv).Err()
+
+				rkgrpcctx.GetEvent(ctx).SetCounter("panic", 1)
+				rkgrpcctx.GetLogger(ctx).Error(fmt.Sprintf("panic occurs:\n%s", string(debug.Stack())), zap.Error(err))
+			}
+		}()
+
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// Convert recovered value into grpc status.
+func recoverToStatus(recv interface{}) *status.Status {
+	if se, ok := recv.(interface{ GRPCStatus() *status.Status }); ok {
+		return se.GRPCStatus()
+	}
+
+	return status.New(codes.Internal, fmt.Sprintf("%v", recv))
+}
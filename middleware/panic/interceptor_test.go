@@ -60,6 +60,49 @@ func TestStreamServerInterceptor_WithPanic(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestUnaryClientInterceptor(t *testing.T) {
+	inter := UnaryClientInterceptor(
+		rkmidpanic.WithEntryNameAndType("ut-entry", "ut-type"))
+
+	assert.Nil(t, inter(NewUnaryClientInput()))
+}
+
+func TestUnaryClientInterceptor_WithPanic(t *testing.T) {
+	inter := UnaryClientInterceptor(
+		rkmidpanic.WithEntryNameAndType("ut-entry", "ut-type"))
+
+	ctx, method, req, resp, cc, _ := NewUnaryClientInput()
+
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		panic(errors.New("ut expected"))
+	}
+
+	assert.NotNil(t, inter(ctx, method, req, resp, cc, invoker))
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	inter := StreamClientInterceptor(
+		rkmidpanic.WithEntryNameAndType("ut-entry", "ut-type"))
+
+	_, err := inter(NewStreamClientInput())
+	assert.Nil(t, err)
+}
+
+func TestStreamClientInterceptor_WithPanic(t *testing.T) {
+	inter := StreamClientInterceptor(
+		rkmidpanic.WithEntryNameAndType("ut-entry", "ut-type"))
+
+	ctx, desc, cc, method, _ := NewStreamClientInput()
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		panic(errors.New("ut expected"))
+	}
+
+	stream, err := inter(ctx, desc, cc, method, streamer)
+	assert.Nil(t, stream)
+	assert.NotNil(t, err)
+}
+
 // ************ Test utility ************
 
 type ServerStreamMock struct {
@@ -113,3 +156,21 @@ func NewStreamServerInput() (interface{}, grpc.ServerStream, *grpc.StreamServerI
 
 	return nil, serverStream, info, handler
 }
+
+func NewUnaryClientInput() (context.Context, string, interface{}, interface{}, *grpc.ClientConn, grpc.UnaryInvoker) {
+	cc, _ := grpc.Dial("ut-target", grpc.WithInsecure())
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	return context.TODO(), "ut-method", nil, nil, cc, invoker
+}
+
+func NewStreamClientInput() (context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, grpc.Streamer) {
+	cc, _ := grpc.Dial("ut-target", grpc.WithInsecure())
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, nil
+	}
+
+	return context.TODO(), &grpc.StreamDesc{}, cc, "ut-method", streamer
+}
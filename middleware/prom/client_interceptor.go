@@ -0,0 +1,75 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcprom
+
+import (
+	"context"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkmidprom "github.com/rookie-ninja/rk-entry/v2/middleware/prom"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor Create new unary client interceptor.
+func UnaryClientInterceptor(opts ...rkmidprom.Option) grpc.UnaryClientInterceptor {
+	set := rkmidprom.NewOptionSet(opts...)
+
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		beforeCtx := set.BeforeCtx(nil)
+
+		grpcService, grpcMethod := rkgrpcmid.GetGrpcInfo(method)
+		beforeCtx.Input.GrpcService = grpcService
+		beforeCtx.Input.GrpcMethod = grpcMethod
+		beforeCtx.Input.GrpcType = "UnaryClient"
+
+		set.Before(beforeCtx)
+
+		err := invoker(ctx, method, req, resp, cc, opts...)
+
+		afterCtx := set.AfterCtx(status.Code(err).String())
+		set.After(beforeCtx, afterCtx)
+
+		return err
+	}
+}
+
+// StreamClientInterceptor Create new stream client interceptor.
+func StreamClientInterceptor(opts ...rkmidprom.Option) grpc.StreamClientInterceptor {
+	set := rkmidprom.NewOptionSet(opts...)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		beforeCtx := set.BeforeCtx(nil)
+
+		grpcService, grpcMethod := rkgrpcmid.GetGrpcInfo(method)
+		beforeCtx.Input.GrpcService = grpcService
+		beforeCtx.Input.GrpcMethod = grpcMethod
+		beforeCtx.Input.GrpcType = "StreamClient"
+
+		set.Before(beforeCtx)
+
+		// record metrics once stream finished
+		after := func(err error) {
+			afterCtx := set.AfterCtx(status.Code(err).String())
+			set.After(beforeCtx, afterCtx)
+		}
+
+		clientStream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			after(err)
+			return nil, err
+		}
+
+		return rkgrpcmid.WrapClientStreamWithFinish(clientStream, desc, after), nil
+	}
+}
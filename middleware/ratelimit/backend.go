@@ -0,0 +1,171 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultKeyLimiterSize default number of per-key limiters kept in LRU
+const DefaultKeyLimiterSize = 10000
+
+// TakeResult is result of Backend.Take.
+type TakeResult struct {
+	// Allowed is true if token was taken
+	Allowed bool
+	// Remaining tokens of key
+	Remaining int
+	// RetryAfter duration until next token is available, zero if key is blocked
+	RetryAfter time.Duration
+}
+
+// Backend takes tokens of keys for KeyLimiter, implemented by limiters in memory and limiters over shared store
+// which apply limits across replicas.
+type Backend interface {
+	// Take one token of key which allows limit requests per second with burst
+	Take(ctx context.Context, key string, limit, burst int) (*TakeResult, error)
+
+	// Refund one token of key taken by Take, used if call is rejected by limits of other keys
+	Refund(ctx context.Context, key string, limit, burst int) error
+
+	// Close releases resources of backend, like connections to shared store
+	Close() error
+}
+
+// LocalBackend keeps token bucket of each key in LRU of this process.
+type LocalBackend struct {
+	size  int
+	lock  sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+// NewLocalBackend create LocalBackend with max number of token buckets.
+func NewLocalBackend(size int) *LocalBackend {
+	if size < 1 {
+		size = DefaultKeyLimiterSize
+	}
+
+	return &LocalBackend{
+		size:  size,
+		lru:   list.New(),
+		items: map[string]*list.Element{},
+		now:   time.Now,
+	}
+}
+
+// Take one token from token bucket of key.
+func (b *LocalBackend) Take(_ context.Context, key string, limit, burst int) (*TakeResult, error) {
+	remaining, retryAfter, ok := b.get(key, limit, burst).take(b.now())
+
+	return &TakeResult{
+		Allowed:    ok,
+		Remaining:  remaining,
+		RetryAfter: retryAfter,
+	}, nil
+}
+
+// Refund one token to token bucket of key.
+func (b *LocalBackend) Refund(_ context.Context, key string, limit, burst int) error {
+	b.get(key, limit, burst).refund()
+	return nil
+}
+
+// Close is noop since token buckets are kept in memory.
+func (b *LocalBackend) Close() error {
+	return nil
+}
+
+// Len returns number of token buckets in LRU.
+func (b *LocalBackend) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.lru.Len()
+}
+
+// get token bucket of key from LRU, evict the least recently used one if full
+func (b *LocalBackend) get(key string, limit, burst int) *tokenBucket {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if elem, ok := b.items[key]; ok {
+		b.lru.MoveToFront(elem)
+		return elem.Value.(*lruItem).bucket
+	}
+
+	if b.lru.Len() >= b.size {
+		if oldest := b.lru.Back(); oldest != nil {
+			b.lru.Remove(oldest)
+			delete(b.items, oldest.Value.(*lruItem).key)
+		}
+	}
+
+	bucket := newTokenBucket(limit, burst, b.now())
+	b.items[key] = b.lru.PushFront(&lruItem{key: key, bucket: bucket})
+
+	return bucket
+}
+
+type lruItem struct {
+	key    string
+	bucket *tokenBucket
+}
+
+// tokenBucket refills rate tokens per second up to burst
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// take one token, returns remaining tokens and duration to wait if rejected
+func (b *tokenBucket) take(now time.Time) (int, time.Duration, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return int(b.tokens), 0, true
+	}
+
+	// blocked key would never be refilled
+	if b.rate <= 0 {
+		return 0, 0, false
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return 0, wait, false
+}
+
+// refund one token, tokens would not exceed burst
+func (b *tokenBucket) refund() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
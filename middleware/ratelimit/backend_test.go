@@ -0,0 +1,85 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalBackend_Take(t *testing.T) {
+	backend := NewLocalBackend(0)
+	assert.Equal(t, DefaultKeyLimiterSize, backend.size)
+	now := time.Now()
+	backend.now = func() time.Time { return now }
+
+	// burst
+	for i := 0; i < 3; i++ {
+		res, err := backend.Take(context.TODO(), "ut-key", 1, 3)
+		assert.Nil(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 2-i, res.Remaining)
+	}
+
+	res, _ := backend.Take(context.TODO(), "ut-key", 1, 3)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// refilled
+	now = now.Add(time.Second)
+	res, _ = backend.Take(context.TODO(), "ut-key", 1, 3)
+	assert.True(t, res.Allowed)
+}
+
+func TestLocalBackend_Evict(t *testing.T) {
+	backend := NewLocalBackend(2)
+	now := time.Now()
+	backend.now = func() time.Time { return now }
+
+	take := func(key string) bool {
+		res, _ := backend.Take(context.TODO(), key, 1, 1)
+		return res.Allowed
+	}
+
+	take("ut-a")
+	take("ut-b")
+	assert.False(t, take("ut-a"))
+
+	// ut-b is the least recently used one
+	take("ut-c")
+	assert.Equal(t, 2, backend.Len())
+	assert.True(t, take("ut-b"))
+
+	// ut-a was evicted by ut-b
+	assert.True(t, take("ut-a"))
+}
+
+func TestLocalBackend_Close(t *testing.T) {
+	assert.Nil(t, NewLocalBackend(1).Close())
+}
+
+func TestLocalBackend_Refund(t *testing.T) {
+	backend := NewLocalBackend(1)
+	now := time.Now()
+	backend.now = func() time.Time { return now }
+
+	res, _ := backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.True(t, res.Allowed)
+	assert.Nil(t, backend.Refund(context.TODO(), "ut-key", 1, 1))
+	res, _ = backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.True(t, res.Allowed)
+
+	// tokens would not exceed burst
+	assert.Nil(t, backend.Refund(context.TODO(), "ut-key", 1, 1))
+	assert.Nil(t, backend.Refund(context.TODO(), "ut-key", 1, 1))
+	res, _ = backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.True(t, res.Allowed)
+	res, _ = backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.False(t, res.Allowed)
+}
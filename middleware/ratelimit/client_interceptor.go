@@ -0,0 +1,58 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"context"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkmidlimit "github.com/rookie-ninja/rk-entry/v2/middleware/ratelimit"
+	rkgrpcerr "github.com/tegarajipangestu/rk-grpc/v2/boot/error"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	"google.golang.org/grpc"
+)
+
+// UnaryClientInterceptor Add rate limit interceptors.
+func UnaryClientInterceptor(opts ...rkmidlimit.Option) grpc.UnaryClientInterceptor {
+	set := rkmidlimit.NewOptionSet(opts...)
+
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		beforeCtx := set.BeforeCtx(nil)
+		beforeCtx.Input.UrlPath = method
+
+		set.Before(beforeCtx)
+
+		if beforeCtx.Output.ErrResp != nil {
+			return rkgrpcerr.ResourceExhausted(beforeCtx.Output.ErrResp.Message()).Err()
+		}
+
+		return invoker(ctx, method, req, resp, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor Add rate limit interceptors.
+func StreamClientInterceptor(opts ...rkmidlimit.Option) grpc.StreamClientInterceptor {
+	set := rkmidlimit.NewOptionSet(opts...)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		beforeCtx := set.BeforeCtx(nil)
+		beforeCtx.Input.UrlPath = method
+
+		set.Before(beforeCtx)
+
+		if beforeCtx.Output.ErrResp != nil {
+			return nil, rkgrpcerr.ResourceExhausted(beforeCtx.Output.ErrResp.Message()).Err()
+		}
+
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"go.uber.org/zap"
+)
+
+const (
+	// KeyTypeIp limit callers by remote IP
+	KeyTypeIp = "ip"
+	// KeyTypeMetadata limit callers by value of metadata, like x-tenant-id
+	KeyTypeMetadata = "metadata"
+	// KeyTypeApiKey limit callers by API key
+	KeyTypeApiKey = "apiKey"
+	// KeyTypeJwtSubject limit callers by subject of JWT, jwt middleware must run before rate limit middleware
+	KeyTypeJwtSubject = "jwtSub"
+)
+
+// KeyClass defines how to extract key of caller and quota of each key.
+type KeyClass struct {
+	// Type of key, one of ip, metadata, apiKey and jwtSub
+	Type string
+	// Header name of metadata, required if Type is metadata
+	Header string
+	// ReqPerSec default quota of each key
+	ReqPerSec int
+	// Burst max requests allowed at once, default is ReqPerSec
+	Burst int
+	// Quotas per key quotas which override ReqPerSec, zero blocks the key
+	Quotas map[string]int
+	// TrustedProxies proxies whose forwarded addresses are respected if Type is ip, transport peer is used otherwise
+	TrustedProxies []*net.IPNet
+}
+
+// Name returns name of key class used in logs, events and limiter keys.
+func (c *KeyClass) Name() string {
+	if c.Type == KeyTypeMetadata {
+		return c.Type + ":" + c.Header
+	}
+
+	return c.Type
+}
+
+// Key extracts key of caller from context, empty string would be returned if missing.
+func (c *KeyClass) Key(ctx context.Context) string {
+	switch c.Type {
+	case KeyTypeIp:
+		ip, _ := rkgrpcmid.GetPeerAddressSet(ctx, c.TrustedProxies)
+		return ip
+	case KeyTypeMetadata:
+		return firstHeader(ctx, c.Header)
+	case KeyTypeApiKey:
+		return firstHeader(ctx, rkmid.HeaderApiKey)
+	case KeyTypeJwtSubject:
+		return rkgrpcctx.GetJwtSubject(ctx)
+	}
+
+	return ""
+}
+
+// quota returns requests per second and burst of key
+func (c *KeyClass) quota(key string) (int, int) {
+	if v, ok := c.Quotas[key]; ok {
+		return v, v
+	}
+
+	burst := c.Burst
+	if burst < 1 {
+		burst = c.ReqPerSec
+	}
+
+	return c.ReqPerSec, burst
+}
+
+func (c *KeyClass) validate() error {
+	switch c.Type {
+	case KeyTypeIp, KeyTypeApiKey, KeyTypeJwtSubject:
+	case KeyTypeMetadata:
+		if len(c.Header) < 1 {
+			return fmt.Errorf("header is required for key type %s", c.Type)
+		}
+	default:
+		return fmt.Errorf("invalid key type %s", c.Type)
+	}
+
+	if c.ReqPerSec < 1 {
+		return fmt.Errorf("reqPerSec of key type %s must be positive", c.Name())
+	}
+
+	for k, v := range c.Quotas {
+		if v < 0 {
+			return fmt.Errorf("quota of key %s in key type %s must not be negative", k, c.Name())
+		}
+	}
+
+	return nil
+}
+
+// KeyDecision is result of Allow.
+type KeyDecision struct {
+	// Class which rejected the call, nil if allowed
+	Class *KeyClass
+	// Key of caller in Class
+	Key string
+	// Limit requests per second of key
+	Limit int
+	// Remaining tokens of key
+	Remaining int
+	// RetryAfter duration until next token is available, zero if key is blocked
+	RetryAfter time.Duration
+}
+
+// KeyLimiter limits calls of each caller identified by key classes with per-key limiters of Backend.
+type KeyLimiter struct {
+	classes []*KeyClass
+	backend Backend
+}
+
+// NewKeyLimiter create KeyLimiter with max number of per-key limiters kept in memory and key classes.
+func NewKeyLimiter(size int, classes ...*KeyClass) (*KeyLimiter, error) {
+	return NewKeyLimiterWithBackend(NewLocalBackend(size), classes...)
+}
+
+// NewKeyLimiterWithBackend create KeyLimiter with Backend and key classes.
+func NewKeyLimiterWithBackend(backend Backend, classes ...*KeyClass) (*KeyLimiter, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("backend of key limiter is nil")
+	}
+
+	for i := range classes {
+		if err := classes[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &KeyLimiter{
+		classes: classes,
+		backend: backend,
+	}, nil
+}
+
+// Allow takes one token from limiter of each key class, the first rejection would be returned.
+//
+// Tokens taken from key classes before the rejection would be refunded, calls would be allowed if Backend failed.
+func (l *KeyLimiter) Allow(ctx context.Context) (*KeyDecision, bool) {
+	if l == nil {
+		return nil, true
+	}
+
+	taken := make([]*keyToken, 0, len(l.classes))
+	for _, class := range l.classes {
+		key := class.Key(ctx)
+		if len(key) < 1 {
+			continue
+		}
+
+		token := &keyToken{class: class, key: backendKey(class, key)}
+		token.limit, token.burst = class.quota(key)
+		res, err := l.backend.Take(ctx, token.key, token.limit, token.burst)
+		if err != nil {
+			rkgrpcctx.GetLogger(ctx).Warn("Failed to take token of rate limit key",
+				zap.String("keyType", class.Name()), zap.Error(err))
+			continue
+		}
+
+		if !res.Allowed {
+			l.refund(ctx, taken)
+			return &KeyDecision{
+				Class:      class,
+				Key:        key,
+				Limit:      token.limit,
+				Remaining:  res.Remaining,
+				RetryAfter: res.RetryAfter,
+			}, false
+		}
+
+		taken = append(taken, token)
+	}
+
+	return nil, true
+}
+
+// keyToken is token taken from Backend for key of caller
+type keyToken struct {
+	class *KeyClass
+	key   string
+	limit int
+	burst int
+}
+
+// refund tokens taken for call which is rejected
+func (l *KeyLimiter) refund(ctx context.Context, taken []*keyToken) {
+	for _, token := range taken {
+		if err := l.backend.Refund(ctx, token.key, token.limit, token.burst); err != nil {
+			rkgrpcctx.GetLogger(ctx).Warn("Failed to refund token of rate limit key",
+				zap.String("keyType", token.class.Name()), zap.Error(err))
+		}
+	}
+}
+
+// backendKey returns key of caller in Backend, key is hashed so that secrets like API key would not be exposed by
+// shared store
+func backendKey(class *KeyClass, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return class.Name() + "/" + hex.EncodeToString(sum[:])
+}
+
+// Close closes Backend of limiter.
+func (l *KeyLimiter) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	return l.backend.Close()
+}
+
+func firstHeader(ctx context.Context, key string) string {
+	if values := rkgrpcctx.GetIncomingHeaders(ctx).Get(strings.ToLower(key)); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
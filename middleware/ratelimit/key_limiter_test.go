@@ -0,0 +1,237 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestNewKeyLimiter(t *testing.T) {
+	// default size
+	limiter, err := NewKeyLimiter(0)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultKeyLimiterSize, limiter.backend.(*LocalBackend).size)
+
+	// nil backend
+	_, err = NewKeyLimiterWithBackend(nil)
+	assert.NotNil(t, err)
+
+	// invalid type
+	_, err = NewKeyLimiter(1, &KeyClass{Type: "ut-type", ReqPerSec: 1})
+	assert.NotNil(t, err)
+
+	// header missing
+	_, err = NewKeyLimiter(1, &KeyClass{Type: KeyTypeMetadata, ReqPerSec: 1})
+	assert.NotNil(t, err)
+
+	// invalid reqPerSec
+	_, err = NewKeyLimiter(1, &KeyClass{Type: KeyTypeIp})
+	assert.NotNil(t, err)
+
+	// negative quota
+	_, err = NewKeyLimiter(1, &KeyClass{Type: KeyTypeIp, ReqPerSec: 1, Quotas: map[string]int{"ut-ip": -1}})
+	assert.NotNil(t, err)
+}
+
+func TestKeyClass_Key(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(
+		"x-tenant-id", "ut-tenant",
+		rkmid.HeaderApiKey, "ut-api-key"))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("1.1.1.1"), Port: 8080}})
+
+	assert.Equal(t, "1.1.1.1", (&KeyClass{Type: KeyTypeIp}).Key(ctx))
+
+	// rotating x-forwarded-for of untrusted peer would not change key
+	forwarded := metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "2.2.2.2"))
+	assert.Equal(t, "1.1.1.1", (&KeyClass{Type: KeyTypeIp}).Key(forwarded))
+	trusted := []*net.IPNet{{IP: net.ParseIP("1.1.1.1").To4(), Mask: net.CIDRMask(32, 32)}}
+	assert.Equal(t, "2.2.2.2", (&KeyClass{Type: KeyTypeIp, TrustedProxies: trusted}).Key(forwarded))
+	assert.Equal(t, "ut-tenant", (&KeyClass{Type: KeyTypeMetadata, Header: "X-Tenant-Id"}).Key(ctx))
+	assert.Equal(t, "ut-api-key", (&KeyClass{Type: KeyTypeApiKey}).Key(ctx))
+	assert.Empty(t, (&KeyClass{Type: KeyTypeJwtSubject}).Key(ctx))
+	assert.Equal(t, "metadata:X-Tenant-Id", (&KeyClass{Type: KeyTypeMetadata, Header: "X-Tenant-Id"}).Name())
+}
+
+func TestKeyLimiter_Allow(t *testing.T) {
+	// nil limiter
+	var nilLimiter *KeyLimiter
+	_, ok := nilLimiter.Allow(context.TODO())
+	assert.True(t, ok)
+
+	limiter, err := NewKeyLimiter(10, &KeyClass{
+		Type:      KeyTypeMetadata,
+		Header:    "x-tenant-id",
+		ReqPerSec: 2,
+		Quotas:    map[string]int{"ut-vip": 4, "ut-blocked": 0},
+	})
+	assert.Nil(t, err)
+	now := time.Now()
+	limiter.backend.(*LocalBackend).now = func() time.Time { return now }
+
+	// case 1: key missing
+	for i := 0; i < 10; i++ {
+		_, ok = limiter.Allow(context.TODO())
+		assert.True(t, ok)
+	}
+
+	// case 2: default quota exhausted
+	for i := 0; i < 2; i++ {
+		_, ok = limiter.Allow(tenant("ut-a"))
+		assert.True(t, ok)
+	}
+	decision, ok := limiter.Allow(tenant("ut-a"))
+	assert.False(t, ok)
+	assert.Equal(t, "ut-a", decision.Key)
+	assert.Equal(t, 2, decision.Limit)
+	assert.Equal(t, 0, decision.Remaining)
+	assert.Equal(t, 500*time.Millisecond, decision.RetryAfter)
+
+	// case 3: other tenant is not affected
+	_, ok = limiter.Allow(tenant("ut-b"))
+	assert.True(t, ok)
+
+	// case 4: refilled
+	now = now.Add(500 * time.Millisecond)
+	_, ok = limiter.Allow(tenant("ut-a"))
+	assert.True(t, ok)
+
+	// case 5: quota of key
+	for i := 0; i < 4; i++ {
+		_, ok = limiter.Allow(tenant("ut-vip"))
+		assert.True(t, ok)
+	}
+	decision, ok = limiter.Allow(tenant("ut-vip"))
+	assert.False(t, ok)
+	assert.Equal(t, 4, decision.Limit)
+
+	// case 6: blocked key
+	decision, ok = limiter.Allow(tenant("ut-blocked"))
+	assert.False(t, ok)
+	assert.Zero(t, decision.RetryAfter)
+}
+
+func TestKeyLimiter_RefundOnRejection(t *testing.T) {
+	limiter, err := NewKeyLimiter(10,
+		&KeyClass{Type: KeyTypeApiKey, ReqPerSec: 2},
+		&KeyClass{Type: KeyTypeMetadata, Header: "x-tenant-id", ReqPerSec: 1, Quotas: map[string]int{"ut-blocked": 0}})
+	assert.Nil(t, err)
+	now := time.Now()
+	limiter.backend.(*LocalBackend).now = func() time.Time { return now }
+
+	withKeys := func(tenant string) context.Context {
+		return metadata.NewIncomingContext(context.TODO(), metadata.Pairs(
+			rkmid.HeaderApiKey, "ut-api-key",
+			"x-tenant-id", tenant))
+	}
+
+	// rejected by second class would not spend tokens of first class
+	for i := 0; i < 5; i++ {
+		decision, ok := limiter.Allow(withKeys("ut-blocked"))
+		assert.False(t, ok)
+		assert.Equal(t, "ut-blocked", decision.Key)
+	}
+
+	// tokens of API key are still available
+	for _, tenant := range []string{"ut-a", "ut-b"} {
+		_, ok := limiter.Allow(withKeys(tenant))
+		assert.True(t, ok)
+	}
+	decision, ok := limiter.Allow(withKeys("ut-c"))
+	assert.False(t, ok)
+	assert.Equal(t, "ut-api-key", decision.Key)
+
+	// refund errors are ignored
+	limiter, _ = NewKeyLimiterWithBackend(&utRejectBackend{},
+		&KeyClass{Type: KeyTypeApiKey, ReqPerSec: 1},
+		&KeyClass{Type: KeyTypeMetadata, Header: "x-tenant-id", ReqPerSec: 1})
+	_, ok = limiter.Allow(withKeys("ut-a"))
+	assert.False(t, ok)
+}
+
+func TestKeyLimiter_WithBackendError(t *testing.T) {
+	limiter, err := NewKeyLimiterWithBackend(&utFailedBackend{}, &KeyClass{Type: KeyTypeApiKey, ReqPerSec: 1})
+	assert.Nil(t, err)
+
+	// allowed if backend failed
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(rkmid.HeaderApiKey, "ut-api-key"))
+	_, ok := limiter.Allow(ctx)
+	assert.True(t, ok)
+}
+
+func TestKeyLimiter_HashKey(t *testing.T) {
+	backend := &utRecordBackend{}
+	limiter, _ := NewKeyLimiterWithBackend(backend, &KeyClass{Type: KeyTypeApiKey, ReqPerSec: 1})
+
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(rkmid.HeaderApiKey, "ut-api-key"))
+	_, ok := limiter.Allow(ctx)
+	assert.True(t, ok)
+
+	// secret is not sent to backend
+	assert.Len(t, backend.keys, 1)
+	assert.True(t, strings.HasPrefix(backend.keys[0], KeyTypeApiKey+"/"))
+	assert.NotContains(t, backend.keys[0], "ut-api-key")
+	assert.Equal(t, backendKey(limiter.classes[0], "ut-api-key"), backend.keys[0])
+}
+
+func TestKeyLimiter_Close(t *testing.T) {
+	// nil limiter
+	var nilLimiter *KeyLimiter
+	assert.Nil(t, nilLimiter.Close())
+
+	limiter, _ := NewKeyLimiterWithBackend(&utFailedBackend{}, &KeyClass{Type: KeyTypeApiKey, ReqPerSec: 1})
+	assert.NotNil(t, limiter.Close())
+}
+
+// ************ Test utility ************
+
+// utRejectBackend allows the first key only and fails to refund
+type utRejectBackend struct {
+	utFailedBackend
+	taken int
+}
+
+func (b *utRejectBackend) Take(context.Context, string, int, int) (*TakeResult, error) {
+	b.taken++
+	return &TakeResult{Allowed: b.taken < 2}, nil
+}
+
+type utRecordBackend struct {
+	LocalBackend
+	keys []string
+}
+
+func (b *utRecordBackend) Take(_ context.Context, key string, _, _ int) (*TakeResult, error) {
+	b.keys = append(b.keys, key)
+	return &TakeResult{Allowed: true}, nil
+}
+
+type utFailedBackend struct{}
+
+func (b *utFailedBackend) Refund(context.Context, string, int, int) error {
+	return errors.New("ut-error")
+}
+
+func (b *utFailedBackend) Close() error {
+	return errors.New("ut-error")
+}
+
+func (b *utFailedBackend) Take(context.Context, string, int, int) (*TakeResult, error) {
+	return nil, errors.New("ut-error")
+}
+
+func tenant(id string) context.Context {
+	return metadata.NewIncomingContext(context.TODO(), metadata.Pairs("x-tenant-id", id))
+}
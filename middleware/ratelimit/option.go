@@ -0,0 +1,138 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	rkmidlimit "github.com/rookie-ninja/rk-entry/v2/middleware/ratelimit"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+)
+
+// BootConfig for YAML, extends rkmidlimit.BootConfig with limits of each caller.
+type BootConfig struct {
+	rkmidlimit.BootConfig `yaml:",inline" mapstructure:",squash"`
+	LruSize               int              `yaml:"lruSize" json:"lruSize"`
+	Keys                  []BootConfigKey  `yaml:"keys" json:"keys"`
+	Store                 *BootConfigStore `yaml:"store" json:"store"`
+	TrustedProxies        []string         `yaml:"trustedProxies" json:"trustedProxies"`
+}
+
+// BootConfigKey Boot config of key class, quotas are list of key:reqPerSec pairs.
+type BootConfigKey struct {
+	Type      string   `yaml:"type" json:"type"`
+	Header    string   `yaml:"header" json:"header"`
+	ReqPerSec int      `yaml:"reqPerSec" json:"reqPerSec"`
+	Burst     int      `yaml:"burst" json:"burst"`
+	Quotas    []string `yaml:"quotas" json:"quotas"`
+}
+
+// BootConfigStore Boot config of shared store which counts requests of keys across replicas in sliding windows,
+// local limits would be used while store is unreachable.
+type BootConfigStore struct {
+	Type       string `yaml:"type" json:"type"`
+	Addr       string `yaml:"addr" json:"addr"`
+	Password   string `yaml:"password" json:"password"`
+	DB         int    `yaml:"db" json:"db"`
+	Prefix     string `yaml:"prefix" json:"prefix"`
+	WindowMs   int64  `yaml:"windowMs" json:"windowMs"`
+	TimeoutMs  int64  `yaml:"timeoutMs" json:"timeoutMs"`
+	FallbackMs int64  `yaml:"fallbackMs" json:"fallbackMs"`
+}
+
+// StoreTypeRedis store speaks Redis protocol
+const StoreTypeRedis = "redis"
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string) []rkmidlimit.Option {
+	return rkmidlimit.ToOptions(&config.BootConfig, entryName, entryType)
+}
+
+// ToKeyLimiter convert BootConfig into KeyLimiter, nil would be returned if disabled or keys are missing.
+func ToKeyLimiter(config *BootConfig) *KeyLimiter {
+	if !config.Enabled || len(config.Keys) < 1 {
+		return nil
+	}
+
+	trustedProxies, err := rkgrpcmid.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		rkentry.ShutdownWithError(err)
+	}
+
+	classes := make([]*KeyClass, 0, len(config.Keys))
+	for i := range config.Keys {
+		key := config.Keys[i]
+		class := &KeyClass{
+			Type:      key.Type,
+			Header:    key.Header,
+			ReqPerSec: key.ReqPerSec,
+			Burst:     key.Burst,
+			Quotas:    map[string]int{},
+		}
+
+		if class.Type == KeyTypeIp {
+			class.TrustedProxies = trustedProxies
+		}
+
+		for _, pair := range key.Quotas {
+			tokens := strings.SplitN(pair, ":", 2)
+			if len(tokens) != 2 {
+				rkentry.ShutdownWithError(fmt.Errorf("invalid quota %s, expect key:reqPerSec", pair))
+			}
+
+			quota, err := strconv.Atoi(strings.TrimSpace(tokens[1]))
+			if err != nil {
+				rkentry.ShutdownWithError(fmt.Errorf("invalid quota %s, %v", pair, err))
+			}
+
+			class.Quotas[strings.TrimSpace(tokens[0])] = quota
+		}
+
+		classes = append(classes, class)
+	}
+
+	limiter, err := NewKeyLimiterWithBackend(toBackend(config), classes...)
+	if err != nil {
+		rkentry.ShutdownWithError(err)
+	}
+
+	return limiter
+}
+
+// toBackend convert store of BootConfig into Backend, LocalBackend would be returned if store is missing
+func toBackend(config *BootConfig) Backend {
+	local := NewLocalBackend(config.LruSize)
+	if config.Store == nil {
+		return local
+	}
+
+	if len(config.Store.Type) > 0 && config.Store.Type != StoreTypeRedis {
+		rkentry.ShutdownWithError(fmt.Errorf("invalid store type %s, expect %s", config.Store.Type, StoreTypeRedis))
+	}
+
+	store, err := NewRedisStore(config.Store.Addr,
+		WithRedisPassword(config.Store.Password),
+		WithRedisDB(config.Store.DB),
+		WithRedisTimeout(time.Duration(config.Store.TimeoutMs)*time.Millisecond))
+	if err != nil {
+		rkentry.ShutdownWithError(err)
+	}
+
+	backend, err := NewSlidingWindowBackend(store,
+		WithKeyPrefix(config.Store.Prefix),
+		WithWindow(time.Duration(config.Store.WindowMs)*time.Millisecond),
+		WithFallbackInterval(time.Duration(config.Store.FallbackMs)*time.Millisecond),
+		WithFallback(local))
+	if err != nil {
+		rkentry.ShutdownWithError(err)
+	}
+
+	return backend
+}
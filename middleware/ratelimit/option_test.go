@@ -0,0 +1,140 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"testing"
+	"time"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBootConfig(t *testing.T) {
+	config := &struct {
+		RateLimit BootConfig `yaml:"rateLimit"`
+	}{}
+
+	rkentry.UnmarshalBootYAML([]byte(`
+rateLimit:
+  enabled: true
+  reqPerSec: 100
+  lruSize: 10
+  keys:
+    - type: metadata
+      header: x-tenant-id
+      reqPerSec: 10
+      burst: 20
+      quotas: ["tenant-a:50", "tenant-b:0"]
+    - type: ip
+      reqPerSec: 5
+`), config)
+
+	assert.True(t, config.RateLimit.Enabled)
+	assert.Equal(t, 100, *config.RateLimit.ReqPerSec)
+	assert.Equal(t, 10, config.RateLimit.LruSize)
+	assert.Len(t, config.RateLimit.Keys, 2)
+	assert.NotEmpty(t, ToOptions(&config.RateLimit, "ut-entry", "ut-type"))
+
+	limiter := ToKeyLimiter(&config.RateLimit)
+	assert.NotNil(t, limiter)
+	assert.Equal(t, 10, limiter.backend.(*LocalBackend).size)
+	assert.Equal(t, map[string]int{"tenant-a": 50, "tenant-b": 0}, limiter.classes[0].Quotas)
+	assert.Equal(t, 20, limiter.classes[0].Burst)
+
+	// disabled
+	config.RateLimit.Enabled = false
+	assert.Empty(t, ToOptions(&config.RateLimit, "ut-entry", "ut-type"))
+	assert.Nil(t, ToKeyLimiter(&config.RateLimit))
+}
+
+func TestBootConfig_Store(t *testing.T) {
+	config := &struct {
+		RateLimit BootConfig `yaml:"rateLimit"`
+	}{}
+
+	rkentry.UnmarshalBootYAML([]byte(`
+rateLimit:
+  enabled: true
+  keys:
+    - type: ip
+      reqPerSec: 5
+  store:
+    type: redis
+    addr: localhost:6379
+    db: 1
+    prefix: ut-prefix
+    windowMs: 2000
+    timeoutMs: 50
+    fallbackMs: 3000
+`), config)
+
+	limiter := ToKeyLimiter(&config.RateLimit)
+	backend, ok := limiter.backend.(*SlidingWindowBackend)
+	assert.True(t, ok)
+	assert.Equal(t, "ut-prefix", backend.prefix)
+	assert.Equal(t, 2*time.Second, backend.window)
+	assert.Equal(t, 3*time.Second, backend.fallbackInterval)
+	assert.IsType(t, &LocalBackend{}, backend.fallback)
+
+	store := backend.store.(*RedisStore)
+	assert.Equal(t, "localhost:6379", store.addr)
+	assert.Equal(t, 1, store.db)
+	assert.Equal(t, 50*time.Millisecond, store.timeout)
+}
+
+func TestToKeyLimiter_WithInvalidStore(t *testing.T) {
+	defer assertPanic(t)
+
+	config := &BootConfig{
+		Keys:  []BootConfigKey{{Type: KeyTypeIp, ReqPerSec: 1}},
+		Store: &BootConfigStore{Type: "ut-store"},
+	}
+	config.Enabled = true
+
+	ToKeyLimiter(config)
+}
+
+func TestToKeyLimiter_WithInvalidConfig(t *testing.T) {
+	defer assertPanic(t)
+
+	config := &BootConfig{
+		Keys: []BootConfigKey{{Type: KeyTypeIp, ReqPerSec: 1, Quotas: []string{"invalid"}}},
+	}
+	config.Enabled = true
+
+	ToKeyLimiter(config)
+}
+
+func TestToKeyLimiter_WithTrustedProxies(t *testing.T) {
+	config := &BootConfig{
+		Keys: []BootConfigKey{
+			{Type: KeyTypeIp, ReqPerSec: 1},
+			{Type: KeyTypeApiKey, ReqPerSec: 1},
+		},
+		TrustedProxies: []string{"10.0.0.0/8"},
+	}
+	config.Enabled = true
+
+	limiter := ToKeyLimiter(config)
+	assert.Len(t, limiter.classes[0].TrustedProxies, 1)
+	assert.Empty(t, limiter.classes[1].TrustedProxies)
+
+	// invalid trusted proxy
+	defer assertPanic(t)
+	config.TrustedProxies = []string{"ut-proxy"}
+	ToKeyLimiter(config)
+}
+
+func assertPanic(t *testing.T) {
+	if r := recover(); r != nil {
+		// expect panic to be called with non nil error
+		assert.True(t, true)
+	} else {
+		// this should never be called in case of a bug
+		assert.True(t, false)
+	}
+}
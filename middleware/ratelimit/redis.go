@@ -0,0 +1,368 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRedisTimeout default timeout of dialing and each command of RedisStore
+	DefaultRedisTimeout = 100 * time.Millisecond
+	// DefaultRedisPoolSize default number of idle connections kept by RedisStore
+	DefaultRedisPoolSize = 10
+)
+
+// errRedisStoreClosed is returned by commands sent after RedisStore is closed
+var errRedisStoreClosed = errors.New("redis store is closed")
+
+// RedisOption options of RedisStore
+type RedisOption func(*RedisStore)
+
+// WithRedisPassword provide password sent with AUTH after connected.
+func WithRedisPassword(password string) RedisOption {
+	return func(s *RedisStore) {
+		s.password = password
+	}
+}
+
+// WithRedisDB provide database selected with SELECT after connected.
+func WithRedisDB(db int) RedisOption {
+	return func(s *RedisStore) {
+		s.db = db
+	}
+}
+
+// WithRedisTimeout provide timeout of dialing and each command.
+func WithRedisTimeout(timeout time.Duration) RedisOption {
+	return func(s *RedisStore) {
+		if timeout > 0 {
+			s.timeout = timeout
+		}
+	}
+}
+
+// WithRedisPoolSize provide number of idle connections.
+func WithRedisPoolSize(size int) RedisOption {
+	return func(s *RedisStore) {
+		if size > 0 {
+			s.poolSize = size
+		}
+	}
+}
+
+// RedisStore is KVStore over Redis protocol, any server speaks RESP with INCR, PEXPIRE and GET is supported.
+type RedisStore struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	poolSize int
+	pool     chan *redisConn
+	lock     sync.Mutex
+	closed   bool
+}
+
+// NewRedisStore create RedisStore with address of server, connections are created lazily.
+func NewRedisStore(addr string, opts ...RedisOption) (*RedisStore, error) {
+	if len(addr) < 1 {
+		return nil, fmt.Errorf("address of redis is empty")
+	}
+
+	s := &RedisStore{
+		addr:     addr,
+		timeout:  DefaultRedisTimeout,
+		poolSize: DefaultRedisPoolSize,
+	}
+
+	for i := range opts {
+		opts[i](s)
+	}
+
+	s.pool = make(chan *redisConn, s.poolSize)
+
+	return s, nil
+}
+
+// Incr increases counter of key with INCR and PEXPIRE in one round trip.
+func (s *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	replies, err := s.do(ctx,
+		[]string{"INCR", key},
+		[]string{"PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10)})
+	if err != nil {
+		return 0, err
+	}
+
+	return toInt(replies[0])
+}
+
+// Decr decreases counter of key with DECR and PEXPIRE in one round trip.
+func (s *RedisStore) Decr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	replies, err := s.do(ctx,
+		[]string{"DECR", key},
+		[]string{"PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10)})
+	if err != nil {
+		return 0, err
+	}
+
+	return toInt(replies[0])
+}
+
+// Get returns counter of key with GET.
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	replies, err := s.do(ctx, []string{"GET", key})
+	if err != nil {
+		return 0, err
+	}
+
+	return toInt(replies[0])
+}
+
+// Close closes idle connections, connections in use would be closed once commands finished.
+//
+// Commands sent after Close would fail.
+func (s *RedisStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	for {
+		select {
+		case conn := <-s.pool:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends commands in pipeline and reads replies
+func (s *RedisStore) do(ctx context.Context, cmds ...[]string) ([]interface{}, error) {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := conn.do(s.deadline(ctx), cmds...)
+	if err != nil {
+		// connection state is unknown
+		conn.Close()
+		return nil, err
+	}
+
+	s.put(conn)
+
+	// error replies would not break connection
+	for i := range replies {
+		if e, ok := replies[i].(redisError); ok {
+			return nil, e
+		}
+	}
+
+	return replies, nil
+}
+
+// get idle connection or dial a new one
+func (s *RedisStore) get(ctx context.Context) (*redisConn, error) {
+	if s.isClosed() {
+		return nil, errRedisStoreClosed
+	}
+
+	select {
+	case conn := <-s.pool:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: s.timeout}
+	raw, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{Conn: raw, reader: bufio.NewReader(raw)}
+
+	setup := make([][]string, 0)
+	if len(s.password) > 0 {
+		setup = append(setup, []string{"AUTH", s.password})
+	}
+	if s.db > 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+
+	if len(setup) > 0 {
+		replies, err := conn.do(s.deadline(ctx), setup...)
+		if err == nil {
+			for i := range replies {
+				if e, ok := replies[i].(redisError); ok {
+					err = e
+				}
+			}
+		}
+
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// put connection back to pool, close it if pool is full or store is closed
+func (s *RedisStore) put(conn *redisConn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		conn.Close()
+		return
+	}
+
+	select {
+	case s.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// isClosed returns true if store is closed
+func (s *RedisStore) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.closed
+}
+
+// deadline returns the earlier one of timeout and deadline of context
+func (s *RedisStore) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+
+	return deadline
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// do writes commands as RESP arrays and reads one reply of each command
+func (c *redisConn) do(deadline time.Time, cmds ...[]string) ([]interface{}, error) {
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, 64)
+	for _, cmd := range cmds {
+		buf = append(buf, '*')
+		buf = strconv.AppendInt(buf, int64(len(cmd)), 10)
+		buf = append(buf, '\r', '\n')
+		for _, arg := range cmd {
+			buf = append(buf, '$')
+			buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+			buf = append(buf, '\r', '\n')
+			buf = append(buf, arg...)
+			buf = append(buf, '\r', '\n')
+		}
+	}
+
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, 0, len(cmds))
+	for range cmds {
+		reply, err := readReply(c.reader)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+
+	return replies, nil
+}
+
+// readReply reads simple string, error, integer and bulk string of RESP, nil bulk string would be returned as nil
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 1 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	}
+
+	return nil, fmt.Errorf("redis: unsupported reply %q", line)
+}
+
+// readLine reads line without CRLF
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: invalid line %q", line)
+	}
+
+	return line[:len(line)-2], nil
+}
+
+// toInt converts integer or bulk string reply into int64, nil is zero
+func toInt(reply interface{}) (int64, error) {
+	switch v := reply.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+
+	return 0, fmt.Errorf("redis: unexpected reply %v", reply)
+}
@@ -0,0 +1,325 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRedisStore(t *testing.T) {
+	// address missing
+	_, err := NewRedisStore("")
+	assert.NotNil(t, err)
+
+	store, err := NewRedisStore("ut-addr",
+		WithRedisPassword("ut-pass"),
+		WithRedisDB(1),
+		WithRedisTimeout(time.Second),
+		WithRedisPoolSize(1))
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-pass", store.password)
+	assert.Equal(t, 1, store.db)
+	assert.Equal(t, time.Second, store.timeout)
+	assert.Equal(t, 1, cap(store.pool))
+}
+
+func TestRedisStore(t *testing.T) {
+	server := newUtRedisServer(t, "ut-pass")
+	defer server.Close()
+
+	store, err := NewRedisStore(server.Addr(), WithRedisPassword("ut-pass"), WithRedisDB(1))
+	assert.Nil(t, err)
+	defer store.Close()
+
+	// missing key
+	v, err := store.Get(context.TODO(), "ut-key")
+	assert.Nil(t, err)
+	assert.Zero(t, v)
+
+	// incr
+	for i := 1; i <= 3; i++ {
+		v, err = store.Incr(context.TODO(), "ut-key", time.Second)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(i), v)
+	}
+
+	v, err = store.Get(context.TODO(), "ut-key")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), v)
+
+	// decr
+	v, err = store.Decr(context.TODO(), "ut-key", time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), v)
+	v, err = store.Incr(context.TODO(), "ut-key", time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), v)
+	assert.Equal(t, time.Second, server.ttl("ut-key"))
+
+	// connection reused
+	assert.Equal(t, 1, server.conns())
+
+	// error reply
+	server.set("ut-str", "ut-value")
+	_, err = store.Incr(context.TODO(), "ut-str", time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestRedisStore_Close(t *testing.T) {
+	server := newUtRedisServer(t, "")
+	defer server.Close()
+
+	store, _ := NewRedisStore(server.Addr())
+	_, err := store.Get(context.TODO(), "ut-key")
+	assert.Nil(t, err)
+
+	// idle connection is closed
+	assert.Nil(t, store.Close())
+	assert.Eventually(t, func() bool { return server.releasedConns() == 1 }, time.Second, 10*time.Millisecond)
+
+	// commands after close would fail without dialing
+	_, err = store.Get(context.TODO(), "ut-key")
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, server.conns())
+
+	// connection in use is closed once returned
+	conn, err := net.Dial("tcp", server.Addr())
+	assert.Nil(t, err)
+	store.put(&redisConn{Conn: conn, reader: bufio.NewReader(conn)})
+	assert.Empty(t, store.pool)
+	assert.Eventually(t, func() bool { return server.releasedConns() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestRedisStore_WithInvalidPassword(t *testing.T) {
+	server := newUtRedisServer(t, "ut-pass")
+	defer server.Close()
+
+	store, _ := NewRedisStore(server.Addr(), WithRedisPassword("ut-invalid"))
+	_, err := store.Get(context.TODO(), "ut-key")
+	assert.NotNil(t, err)
+}
+
+func TestRedisStore_WithServerDown(t *testing.T) {
+	server := newUtRedisServer(t, "")
+	store, _ := NewRedisStore(server.Addr())
+	_, err := store.Get(context.TODO(), "ut-key")
+	assert.Nil(t, err)
+
+	// broken idle connection would be dropped
+	server.Close()
+	_, err = store.Get(context.TODO(), "ut-key")
+	assert.NotNil(t, err)
+	_, err = store.Get(context.TODO(), "ut-key")
+	assert.NotNil(t, err)
+}
+
+// ************ Test utility ************
+
+// utRedisServer is an in-process server speaks subset of Redis protocol
+type utRedisServer struct {
+	t        *testing.T
+	listener net.Listener
+	password string
+	lock     sync.Mutex
+	values   map[string]string
+	ttls     map[string]time.Duration
+	accepted int
+	released int
+	wg       sync.WaitGroup
+	clients  []net.Conn
+}
+
+func newUtRedisServer(t *testing.T, password string) *utRedisServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	s := &utRedisServer{
+		t:        t,
+		listener: listener,
+		password: password,
+		values:   map[string]string{},
+		ttls:     map[string]time.Duration{},
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+func (s *utRedisServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *utRedisServer) Close() {
+	s.listener.Close()
+	s.lock.Lock()
+	for i := range s.clients {
+		s.clients[i].Close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+}
+
+func (s *utRedisServer) conns() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.accepted
+}
+
+func (s *utRedisServer) releasedConns() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.released
+}
+
+func (s *utRedisServer) ttl(key string) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.ttls[key]
+}
+
+func (s *utRedisServer) set(key, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values[key] = value
+}
+
+func (s *utRedisServer) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.lock.Lock()
+		s.accepted++
+		s.clients = append(s.clients, conn)
+		s.lock.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *utRedisServer) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+	defer func() {
+		s.lock.Lock()
+		s.released++
+		s.lock.Unlock()
+	}()
+
+	reader := bufio.NewReader(conn)
+	authed := len(s.password) < 1
+
+	for {
+		cmd, err := readUtCommand(reader)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		switch strings.ToUpper(cmd[0]) {
+		case "AUTH":
+			if cmd[1] == s.password {
+				authed = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case "SELECT":
+			reply = "+OK\r\n"
+		default:
+			if !authed {
+				reply = "-NOAUTH Authentication required\r\n"
+			} else {
+				reply = s.exec(cmd)
+			}
+		}
+
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *utRedisServer) exec(cmd []string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch strings.ToUpper(cmd[0]) {
+	case "INCR":
+		v, err := strconv.ParseInt(s.getOrZero(cmd[1]), 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		s.values[cmd[1]] = strconv.FormatInt(v+1, 10)
+		return fmt.Sprintf(":%d\r\n", v+1)
+	case "DECR":
+		v, err := strconv.ParseInt(s.getOrZero(cmd[1]), 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		s.values[cmd[1]] = strconv.FormatInt(v-1, 10)
+		return fmt.Sprintf(":%d\r\n", v-1)
+	case "PEXPIRE":
+		ms, _ := strconv.ParseInt(cmd[2], 10, 64)
+		s.ttls[cmd[1]] = time.Duration(ms) * time.Millisecond
+		return ":1\r\n"
+	case "GET":
+		v, ok := s.values[cmd[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	}
+
+	return "-ERR unknown command\r\n"
+}
+
+func (s *utRedisServer) getOrZero(key string) string {
+	if v, ok := s.values[key]; ok {
+		return v
+	}
+	return "0"
+}
+
+func readUtCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := strconv.Atoi(strings.TrimPrefix(line, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := make([]string, 0, size)
+	for i := 0; i < size; i++ {
+		arg, err := readReply(reader)
+		if err != nil {
+			return nil, err
+		}
+		cmd = append(cmd, arg.(string))
+	}
+
+	return cmd, nil
+}
@@ -7,17 +7,40 @@ package rkgrpclimit
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"time"
 
 	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
 	rkmidlimit "github.com/rookie-ninja/rk-entry/v2/middleware/ratelimit"
 	rkgrpcerr "github.com/tegarajipangestu/rk-grpc/v2/boot/error"
 	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
 	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	// HeaderLimit header of requests per second allowed for key of caller
+	HeaderLimit = "x-ratelimit-limit"
+	// HeaderRemaining header of remaining requests for key of caller
+	HeaderRemaining = "x-ratelimit-remaining"
+	// HeaderReset header of seconds until next request is allowed for key of caller
+	HeaderReset = "x-ratelimit-reset"
 )
 
 // UnaryServerInterceptor Add rate limit interceptors.
 func UnaryServerInterceptor(opts ...rkmidlimit.Option) grpc.UnaryServerInterceptor {
+	return UnaryServerInterceptorWithKeys(nil, opts...)
+}
+
+// UnaryServerInterceptorWithKeys Add rate limit interceptors which limit each caller with KeyLimiter after
+// limits of path.
+func UnaryServerInterceptorWithKeys(limiter *KeyLimiter, opts ...rkmidlimit.Option) grpc.UnaryServerInterceptor {
 	set := rkmidlimit.NewOptionSet(opts...)
 
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
@@ -33,6 +56,11 @@ func UnaryServerInterceptor(opts ...rkmidlimit.Option) grpc.UnaryServerIntercept
 			return nil, rkgrpcerr.ResourceExhausted(beforeCtx.Output.ErrResp.Message()).Err()
 		}
 
+		if decision, ok := limiter.Allow(ctx); !ok {
+			_ = grpc.SetHeader(ctx, toHeaders(decision))
+			return nil, keyLimitExceeded(ctx, decision)
+		}
+
 		resp, err := handler(ctx, req)
 		return resp, err
 	}
@@ -40,6 +68,12 @@ func UnaryServerInterceptor(opts ...rkmidlimit.Option) grpc.UnaryServerIntercept
 
 // StreamServerInterceptor Add rate limit interceptors.
 func StreamServerInterceptor(opts ...rkmidlimit.Option) grpc.StreamServerInterceptor {
+	return StreamServerInterceptorWithKeys(nil, opts...)
+}
+
+// StreamServerInterceptorWithKeys Add rate limit interceptors which limit each caller with KeyLimiter after
+// limits of path.
+func StreamServerInterceptorWithKeys(limiter *KeyLimiter, opts ...rkmidlimit.Option) grpc.StreamServerInterceptor {
 	set := rkmidlimit.NewOptionSet(opts...)
 
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
@@ -58,6 +92,43 @@ func StreamServerInterceptor(opts ...rkmidlimit.Option) grpc.StreamServerInterce
 			return rkgrpcerr.ResourceExhausted(beforeCtx.Output.ErrResp.Message()).Err()
 		}
 
+		if decision, ok := limiter.Allow(wrappedStream.WrappedContext); !ok {
+			_ = wrappedStream.SetHeader(toHeaders(decision))
+			return keyLimitExceeded(wrappedStream.WrappedContext, decision)
+		}
+
 		return handler(srv, wrappedStream)
 	}
 }
+
+// keyLimitExceeded record key class into event and returns ResourceExhausted with RetryInfo
+func keyLimitExceeded(ctx context.Context, decision *KeyDecision) error {
+	rkgrpcctx.GetEvent(ctx).AddPair("rateLimitKey", decision.Class.Name())
+
+	// key of caller is not returned since it could be an API key
+	msg := fmt.Sprintf("Too many requests of %s", decision.Class.Name())
+	st := rkgrpcerr.ResourceExhausted(msg, status.Error(codes.ResourceExhausted, decision.Class.Name()))
+
+	if decision.RetryAfter > 0 {
+		if withRetry, err := st.WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(decision.RetryAfter),
+		}); err == nil {
+			st = withRetry
+		}
+	}
+
+	return st.Err()
+}
+
+// toHeaders convert decision into x-ratelimit-* headers
+func toHeaders(decision *KeyDecision) metadata.MD {
+	reset := int64(decision.RetryAfter / time.Second)
+	if decision.RetryAfter%time.Second > 0 {
+		reset++
+	}
+
+	return metadata.Pairs(
+		HeaderLimit, strconv.Itoa(decision.Limit),
+		HeaderRemaining, strconv.Itoa(decision.Remaining),
+		HeaderReset, strconv.FormatInt(reset, 10))
+}
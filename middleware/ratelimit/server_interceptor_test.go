@@ -5,10 +5,15 @@ import (
 	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/ratelimit"
 	"github.com/stretchr/testify/assert"
+	rkerror "github.com/tegarajipangestu/rk-grpc/v2/boot/error/gen"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"net/http"
 	"testing"
+	"time"
 )
 
 func TestUnaryServerInterceptor(t *testing.T) {
@@ -43,6 +48,60 @@ func TestStreamServerInterceptor(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestUnaryServerInterceptorWithKeys(t *testing.T) {
+	limiter, err := NewKeyLimiter(10, &KeyClass{Type: KeyTypeApiKey, ReqPerSec: 1})
+	assert.Nil(t, err)
+	now := time.Now()
+	limiter.backend.(*LocalBackend).now = func() time.Time { return now }
+
+	beforeCtx := rkmidlimit.NewBeforeCtx()
+	mock := rkmidlimit.NewOptionSetMock(beforeCtx)
+	inter := UnaryServerInterceptorWithKeys(limiter, rkmidlimit.WithMockOptionSet(mock))
+
+	ctx, req, info, handler := NewUnaryServerInput()
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(rkmid.HeaderApiKey, "ut-api-key"))
+
+	// case 1: happy case
+	_, err = inter(ctx, req, info, handler)
+	assert.Nil(t, err)
+
+	// case 2: quota of key exhausted
+	_, err = inter(ctx, req, info, handler)
+	st := status.Convert(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.NotContains(t, st.Message(), "ut-api-key")
+	assert.Len(t, st.Details(), 3)
+	assert.Equal(t, KeyTypeApiKey, st.Details()[1].(*rkerror.ErrorDetail).Message)
+	assert.Equal(t, time.Second, st.Details()[2].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+
+	// case 3: headers
+	md := toHeaders(&KeyDecision{Limit: 1, Remaining: 0, RetryAfter: 1500 * time.Millisecond})
+	assert.Equal(t, []string{"1"}, md.Get(HeaderLimit))
+	assert.Equal(t, []string{"0"}, md.Get(HeaderRemaining))
+	assert.Equal(t, []string{"2"}, md.Get(HeaderReset))
+}
+
+func TestStreamServerInterceptorWithKeys(t *testing.T) {
+	limiter, err := NewKeyLimiter(10, &KeyClass{Type: KeyTypeMetadata, Header: "x-tenant-id", ReqPerSec: 1,
+		Quotas: map[string]int{"ut-blocked": 0}})
+	assert.Nil(t, err)
+
+	beforeCtx := rkmidlimit.NewBeforeCtx()
+	mock := rkmidlimit.NewOptionSetMock(beforeCtx)
+	inter := StreamServerInterceptorWithKeys(limiter, rkmidlimit.WithMockOptionSet(mock))
+
+	srv, _, info, handler := NewStreamServerInput()
+	stream := &ServerStreamMock{
+		ctx: metadata.NewIncomingContext(context.TODO(), metadata.Pairs("x-tenant-id", "ut-blocked")),
+	}
+
+	// blocked key without RetryInfo
+	err = inter(srv, stream, info, handler)
+	st := status.Convert(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Len(t, st.Details(), 2)
+}
+
 // ************ Test utility ************
 
 type ServerStreamMock struct {
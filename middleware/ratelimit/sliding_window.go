@@ -0,0 +1,209 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultWindow default window of SlidingWindowBackend
+	DefaultWindow = time.Second
+	// DefaultFallbackInterval default duration to use fallback after store failed
+	DefaultFallbackInterval = 5 * time.Second
+	// DefaultKeyPrefix default prefix of keys in store
+	DefaultKeyPrefix = "rk-ratelimit"
+)
+
+// KVStore is a key-value store of counters shared by replicas.
+type KVStore interface {
+	// Incr increases counter of key by one, and expires the key after ttl, returns counter after increment
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+
+	// Decr decreases counter of key by one, and expires the key after ttl, returns counter after decrement
+	Decr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+
+	// Get returns counter of key, zero would be returned if missing
+	Get(ctx context.Context, key string) (int64, error)
+
+	// Close releases connections to store
+	Close() error
+}
+
+// SlidingWindowOption options of SlidingWindowBackend
+type SlidingWindowOption func(*SlidingWindowBackend)
+
+// WithWindow provide size of window, limits in requests per second are scaled to the window.
+func WithWindow(window time.Duration) SlidingWindowOption {
+	return func(b *SlidingWindowBackend) {
+		if window > 0 {
+			b.window = window
+		}
+	}
+}
+
+// WithKeyPrefix provide prefix of keys in store.
+func WithKeyPrefix(prefix string) SlidingWindowOption {
+	return func(b *SlidingWindowBackend) {
+		if len(prefix) > 0 {
+			b.prefix = prefix
+		}
+	}
+}
+
+// WithFallback provide Backend used while store is unreachable, LocalBackend would be used by default.
+func WithFallback(fallback Backend) SlidingWindowOption {
+	return func(b *SlidingWindowBackend) {
+		if fallback != nil {
+			b.fallback = fallback
+		}
+	}
+}
+
+// WithFallbackInterval provide duration to use fallback after store failed before retrying store.
+func WithFallbackInterval(interval time.Duration) SlidingWindowOption {
+	return func(b *SlidingWindowBackend) {
+		if interval > 0 {
+			b.fallbackInterval = interval
+		}
+	}
+}
+
+// SlidingWindowBackend counts requests of key in windows of KVStore, so limits are shared by replicas.
+//
+// Requests of current window and weighted requests of previous window are counted, rejected requests are counted
+// as well. Fallback would be used until fallback interval passed if store failed, so limits of each replica apply.
+type SlidingWindowBackend struct {
+	store            KVStore
+	window           time.Duration
+	prefix           string
+	fallback         Backend
+	fallbackInterval time.Duration
+	// unix nano until which fallback is used
+	fallbackUntil int64
+	now           func() time.Time
+}
+
+// NewSlidingWindowBackend create SlidingWindowBackend over KVStore.
+func NewSlidingWindowBackend(store KVStore, opts ...SlidingWindowOption) (*SlidingWindowBackend, error) {
+	if store == nil {
+		return nil, fmt.Errorf("store of sliding window backend is nil")
+	}
+
+	b := &SlidingWindowBackend{
+		store:            store,
+		window:           DefaultWindow,
+		prefix:           DefaultKeyPrefix,
+		fallbackInterval: DefaultFallbackInterval,
+		now:              time.Now,
+	}
+
+	for i := range opts {
+		opts[i](b)
+	}
+
+	if b.fallback == nil {
+		b.fallback = NewLocalBackend(DefaultKeyLimiterSize)
+	}
+
+	return b, nil
+}
+
+// Take one token of key from store, fallback would be used if store failed.
+func (b *SlidingWindowBackend) Take(ctx context.Context, key string, limit, burst int) (*TakeResult, error) {
+	now := b.now()
+	if now.UnixNano() < atomic.LoadInt64(&b.fallbackUntil) {
+		return b.fallback.Take(ctx, key, limit, burst)
+	}
+
+	res, err := b.take(ctx, key, limit, now)
+	if err != nil {
+		atomic.StoreInt64(&b.fallbackUntil, now.Add(b.fallbackInterval).UnixNano())
+		rkgrpcctx.GetLogger(ctx).Warn("Rate limit store is unreachable, fallback to local limits",
+			zap.Duration("fallbackInterval", b.fallbackInterval), zap.Error(err))
+
+		return b.fallback.Take(ctx, key, limit, burst)
+	}
+
+	return res, nil
+}
+
+// Refund one request of key in current window of store, fallback would be refunded if it is in use.
+func (b *SlidingWindowBackend) Refund(ctx context.Context, key string, limit, burst int) error {
+	now := b.now()
+	if now.UnixNano() < atomic.LoadInt64(&b.fallbackUntil) {
+		return b.fallback.Refund(ctx, key, limit, burst)
+	}
+
+	_, err := b.store.Decr(ctx, b.windowKey(key, now.Truncate(b.window)), 2*b.window)
+	return err
+}
+
+// Close closes store and fallback.
+func (b *SlidingWindowBackend) Close() error {
+	err := b.store.Close()
+	if fallbackErr := b.fallback.Close(); err == nil {
+		err = fallbackErr
+	}
+
+	return err
+}
+
+// take one token from windows of store
+func (b *SlidingWindowBackend) take(ctx context.Context, key string, limit int, now time.Time) (*TakeResult, error) {
+	// requests allowed in one window
+	allowed := float64(limit) * b.window.Seconds()
+
+	start := now.Truncate(b.window)
+	elapsed := float64(now.Sub(start)) / float64(b.window)
+
+	prev, err := b.store.Get(ctx, b.windowKey(key, start.Add(-b.window)))
+	if err != nil {
+		return nil, err
+	}
+
+	// keep counter until next window passed, since it is previous window of next one
+	cur, err := b.store.Incr(ctx, b.windowKey(key, start), 2*b.window)
+	if err != nil {
+		return nil, err
+	}
+
+	count := float64(prev)*(1-elapsed) + float64(cur)
+	if count <= allowed {
+		return &TakeResult{
+			Allowed:   true,
+			Remaining: int(allowed - count),
+		}, nil
+	}
+
+	res := &TakeResult{}
+	if allowed <= 0 {
+		// blocked key
+		return res, nil
+	}
+
+	// wait until weighted requests of previous window drop below limit, or until next window starts
+	if over := count - allowed; float64(prev) > 0 && over <= float64(prev)*(1-elapsed) {
+		res.RetryAfter = time.Duration(math.Ceil(over / float64(prev) * float64(b.window)))
+	} else {
+		res.RetryAfter = start.Add(b.window).Sub(now)
+	}
+
+	return res, nil
+}
+
+// windowKey returns key of window in store
+func (b *SlidingWindowBackend) windowKey(key string, start time.Time) string {
+	return b.prefix + ":" + key + ":" + strconv.FormatInt(start.UnixNano()/int64(b.window), 10)
+}
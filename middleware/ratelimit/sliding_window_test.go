@@ -0,0 +1,194 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpclimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSlidingWindowBackend(t *testing.T) {
+	// store missing
+	_, err := NewSlidingWindowBackend(nil)
+	assert.NotNil(t, err)
+
+	// default
+	backend, err := NewSlidingWindowBackend(&utFailedStore{})
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultWindow, backend.window)
+	assert.Equal(t, DefaultKeyPrefix, backend.prefix)
+	assert.Equal(t, DefaultFallbackInterval, backend.fallbackInterval)
+	assert.NotNil(t, backend.fallback)
+
+	// with options
+	fallback := NewLocalBackend(1)
+	backend, err = NewSlidingWindowBackend(&utFailedStore{},
+		WithWindow(time.Minute),
+		WithKeyPrefix("ut-prefix"),
+		WithFallback(fallback),
+		WithFallbackInterval(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, backend.window)
+	assert.Equal(t, "ut-prefix", backend.prefix)
+	assert.Equal(t, fallback, backend.fallback)
+	assert.Equal(t, time.Second, backend.fallbackInterval)
+}
+
+func TestSlidingWindowBackend_Take(t *testing.T) {
+	server := newUtRedisServer(t, "")
+	defer server.Close()
+	store, _ := NewRedisStore(server.Addr())
+	defer store.Close()
+
+	// two replicas share one store
+	start := time.Now().Truncate(time.Second)
+	now := start
+	replicas := make([]*SlidingWindowBackend, 2)
+	for i := range replicas {
+		replicas[i], _ = NewSlidingWindowBackend(store)
+		replicas[i].now = func() time.Time { return now }
+	}
+
+	// case 1: limit is shared by replicas
+	for i := 0; i < 4; i++ {
+		res, err := replicas[i%2].Take(context.TODO(), "ut-key", 4, 4)
+		assert.Nil(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3-i, res.Remaining)
+	}
+	res, err := replicas[0].Take(context.TODO(), "ut-key", 4, 4)
+	assert.Nil(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// case 2: requests of previous window are weighted, 5 * 0.25 + 1 <= 4
+	now = start.Add(1750 * time.Millisecond)
+	res, _ = replicas[1].Take(context.TODO(), "ut-key", 4, 4)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	// case 3: wait until requests of previous window drop below limit, 5 * 0.75 + 1 > 4
+	now = start.Add(1250 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		replicas[0].Take(context.TODO(), "ut-next", 4, 4)
+	}
+	now = start.Add(2250 * time.Millisecond)
+	res, _ = replicas[0].Take(context.TODO(), "ut-next", 4, 4)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 150*time.Millisecond, res.RetryAfter)
+
+	// case 4: blocked key
+	res, _ = replicas[0].Take(context.TODO(), "ut-blocked", 0, 0)
+	assert.False(t, res.Allowed)
+	assert.Zero(t, res.RetryAfter)
+}
+
+func TestSlidingWindowBackend_Refund(t *testing.T) {
+	server := newUtRedisServer(t, "")
+	defer server.Close()
+	store, _ := NewRedisStore(server.Addr())
+	defer store.Close()
+
+	backend, _ := NewSlidingWindowBackend(store, WithFallbackInterval(time.Second))
+	now := time.Now().Truncate(time.Second)
+	backend.now = func() time.Time { return now }
+
+	res, _ := backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.True(t, res.Allowed)
+	assert.Nil(t, backend.Refund(context.TODO(), "ut-key", 1, 1))
+	res, _ = backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.True(t, res.Allowed)
+
+	// fallback is refunded while store is unreachable
+	fallback := NewLocalBackend(1)
+	fallback.now = backend.now
+	backend, _ = NewSlidingWindowBackend(&utFailedStore{}, WithFallback(fallback), WithFallbackInterval(time.Second))
+	backend.now = fallback.now
+	res, _ = backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.True(t, res.Allowed)
+	assert.Nil(t, backend.Refund(context.TODO(), "ut-key", 1, 1))
+	res, _ = backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.True(t, res.Allowed)
+}
+
+func TestSlidingWindowBackend_Fallback(t *testing.T) {
+	store := &utFailedStore{}
+	fallback := NewLocalBackend(1)
+	backend, _ := NewSlidingWindowBackend(store, WithFallback(fallback), WithFallbackInterval(time.Second))
+	now := time.Now()
+	backend.now = func() time.Time { return now }
+	fallback.now = backend.now
+
+	// case 1: local limits apply while store is unreachable
+	res, err := backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+	res, _ = backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 1, store.calls)
+
+	// case 2: store would not be called within fallback interval
+	now = now.Add(500 * time.Millisecond)
+	backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.Equal(t, 1, store.calls)
+
+	// case 3: store is retried after fallback interval
+	now = now.Add(time.Second)
+	store.healthy = true
+	res, _ = backend.Take(context.TODO(), "ut-key", 1, 1)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, store.calls)
+}
+
+func TestSlidingWindowBackend_Close(t *testing.T) {
+	store := &utFailedStore{}
+	backend, _ := NewSlidingWindowBackend(store, WithFallback(&utClosedBackend{}))
+
+	// store is closed and error of fallback is returned
+	assert.NotNil(t, backend.Close())
+	assert.True(t, store.closed)
+}
+
+// ************ Test utility ************
+
+type utClosedBackend struct {
+	LocalBackend
+}
+
+func (b *utClosedBackend) Close() error {
+	return errors.New("ut-error")
+}
+
+type utFailedStore struct {
+	calls   int
+	healthy bool
+	closed  bool
+}
+
+func (s *utFailedStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *utFailedStore) Incr(context.Context, string, time.Duration) (int64, error) {
+	return 1, nil
+}
+
+func (s *utFailedStore) Decr(context.Context, string, time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func (s *utFailedStore) Get(context.Context, string) (int64, error) {
+	s.calls++
+	if s.healthy {
+		return 0, nil
+	}
+	return 0, errors.New("ut-error")
+}
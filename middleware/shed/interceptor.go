@@ -0,0 +1,149 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkgrpcshed is concurrency limiting and load shedding interceptor for grpc framework
+package rkgrpcshed
+
+import (
+	"context"
+	"time"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkgrpcerr "github.com/tegarajipangestu/rk-grpc/v2/boot/error"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ReasonGlobalLimit in-flight calls of server reached limit
+	ReasonGlobalLimit = "GLOBAL_LIMIT"
+	// ReasonMethodLimit in-flight calls of method reached limit
+	ReasonMethodLimit = "METHOD_LIMIT"
+)
+
+// UnaryServerInterceptor create new unary server interceptor.
+//
+// Latency of unary calls is sampled by adaptive algorithms, calls failed with DeadlineExceeded or ResourceExhausted
+// are treated as dropped.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	return unaryServerInterceptor(newOptionSet(opts...))
+}
+
+// StreamServerInterceptor create new stream server interceptor.
+//
+// Streams hold slots until finished, latency of streams is not sampled since streams may live long.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	return streamServerInterceptor(newOptionSet(opts...))
+}
+
+// ServerInterceptors create unary and stream server interceptors which share limits of in-flight calls.
+func ServerInterceptors(opts ...Option) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	set := newOptionSet(opts...)
+
+	return unaryServerInterceptor(set), streamServerInterceptor(set)
+}
+
+func unaryServerInterceptor(set *optionSet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		ctx = rkgrpcmid.WrapContextForServer(ctx)
+		rkgrpcmid.AddToServerContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		if set.ShouldIgnore(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		p, err := set.acquire(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		// release in defer since handler may panic
+		defer func() {
+			p.release(err, true)
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+func streamServerInterceptor(set *optionSet) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		// Before invoking
+		wrappedStream := rkgrpcctx.WrapServerStream(stream)
+		wrappedStream.WrappedContext = rkgrpcmid.WrapContextForServer(wrappedStream.WrappedContext)
+
+		rkgrpcmid.AddToServerContextPayload(wrappedStream.WrappedContext, rkmid.EntryNameKey, set.GetEntryName())
+
+		if set.ShouldIgnore(info.FullMethod) {
+			return handler(srv, wrappedStream)
+		}
+
+		p, err := set.acquire(wrappedStream.WrappedContext, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer p.release(nil, false)
+
+		// Invoking
+		return handler(srv, wrappedStream)
+	}
+}
+
+// permit holds slots of global and method limiters
+type permit struct {
+	global *limiter
+	method *limiter
+	start  time.Time
+}
+
+// release slots, latency of call would be sampled if required
+func (p *permit) release(err error, sample bool) {
+	if !sample {
+		p.global.release()
+		p.method.release()
+		return
+	}
+
+	rtt := time.Since(p.start)
+	code := status.Code(err)
+	dropped := code == codes.DeadlineExceeded || code == codes.ResourceExhausted
+
+	p.global.releaseWithSample(rtt, dropped)
+	p.method.releaseWithSample(rtt, dropped)
+}
+
+// acquire slots of global and method limiters, returns error with reason as detail if rejected
+func (set *optionSet) acquire(ctx context.Context, method string) (*permit, error) {
+	priority := set.priority(ctx, method)
+	methodLimiter := set.methods[method]
+
+	if !set.global.acquire(priority, set.sheddableRatio) {
+		return nil, set.reject(ctx, priority, ReasonGlobalLimit)
+	}
+
+	if !methodLimiter.acquire(priority, set.sheddableRatio) {
+		set.global.release()
+		return nil, set.reject(ctx, priority, ReasonMethodLimit)
+	}
+
+	return &permit{
+		global: set.global,
+		method: methodLimiter,
+		start:  time.Now(),
+	}, nil
+}
+
+// reject returns error with configured code, and records reason into event
+func (set *optionSet) reject(ctx context.Context, priority, reason string) error {
+	event := rkgrpcctx.GetEvent(ctx)
+	event.AddPair("shed", reason)
+	event.AddPair("shedPriority", priority)
+
+	return rkgrpcerr.BaseErrorWrapper(set.rejectCode)("Server is overloaded, please retry later",
+		status.Error(set.rejectCode, reason)).Err()
+}
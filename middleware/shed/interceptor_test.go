@@ -0,0 +1,202 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcshed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	rkerror "github.com/tegarajipangestu/rk-grpc/v2/boot/error/gen"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	inter := UnaryServerInterceptor(WithMaxInFlight(1),
+		WithMaxInFlightByMethod(map[string]int{"/ut.v1.Greeter/Slow": 1}))
+
+	// case 1: hold the only slot
+	release, done := holdUnary(inter, context.TODO(), "/ut.v1.Greeter/Hello")
+
+	// case 2: rejected with reason in detail
+	_, err := inter(newUnaryServerInput(context.TODO(), "/ut.v1.Greeter/Hello"))
+	st := status.Convert(err)
+	assert.Equal(t, codes.Unavailable, st.Code())
+	assert.Len(t, st.Details(), 2)
+	assert.Equal(t, ReasonGlobalLimit, st.Details()[1].(*rkerror.ErrorDetail).Message)
+
+	// case 3: health check is never shed
+	_, err = inter(newUnaryServerInput(context.TODO(), "/grpc.health.v1.Health/Check"))
+	assert.Nil(t, err)
+
+	// case 4: critical priority from metadata is ignored
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(DefaultPriorityHeader, "Critical"))
+	_, err = inter(newUnaryServerInput(ctx, "/ut.v1.Greeter/Hello"))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// case 5: slot released
+	close(release)
+	<-done
+	_, err = inter(newUnaryServerInput(context.TODO(), "/ut.v1.Greeter/Hello"))
+	assert.Nil(t, err)
+
+	// case 6: method limit
+	inter = UnaryServerInterceptor(WithMaxInFlight(10), WithRejectCode(codes.ResourceExhausted),
+		WithMaxInFlightByMethod(map[string]int{"/ut.v1.Greeter/Slow": 1}))
+	release, done = holdUnary(inter, context.TODO(), "/ut.v1.Greeter/Slow")
+	_, err = inter(newUnaryServerInput(context.TODO(), "/ut.v1.Greeter/Slow"))
+	st = status.Convert(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Equal(t, ReasonMethodLimit, st.Details()[1].(*rkerror.ErrorDetail).Message)
+	_, err = inter(newUnaryServerInput(context.TODO(), "/ut.v1.Greeter/Hello"))
+	assert.Nil(t, err)
+	close(release)
+	<-done
+
+	// case 7: ignored path
+	inter = UnaryServerInterceptor(WithMaxInFlight(1), WithPathToIgnore("/ut.v1.Greeter/Ignored"))
+	release, done = holdUnary(inter, context.TODO(), "/ut.v1.Greeter/Hello")
+	_, err = inter(newUnaryServerInput(context.TODO(), "/ut.v1.Greeter/Ignored"))
+	assert.Nil(t, err)
+	close(release)
+	<-done
+}
+
+func TestUnaryServerInterceptor_WithPanic(t *testing.T) {
+	inter := UnaryServerInterceptor(WithMaxInFlight(1))
+
+	ctx, req, info, _ := newUnaryServerInput(context.TODO(), "/ut.v1.Greeter/Hello")
+	assert.Panics(t, func() {
+		inter(ctx, req, info, func(context.Context, interface{}) (interface{}, error) {
+			panic("ut-panic")
+		})
+	})
+
+	// slot released
+	_, err := inter(newUnaryServerInput(context.TODO(), "/ut.v1.Greeter/Hello"))
+	assert.Nil(t, err)
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	inter := StreamServerInterceptor(WithMaxInFlight(1))
+
+	// hold the only slot
+	release := make(chan struct{})
+	done := make(chan struct{})
+	started := make(chan struct{})
+	srv, stream, info, _ := newStreamServerInput(context.TODO(), "/ut.v1.Greeter/Watch")
+	go func() {
+		defer close(done)
+		inter(srv, stream, info, func(interface{}, grpc.ServerStream) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	// rejected
+	err := inter(newStreamServerInput(context.TODO(), "/ut.v1.Greeter/Watch"))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// sheddable calls are rejected first
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(DefaultPriorityHeader, PrioritySheddable))
+	err = inter(newStreamServerInput(ctx, "/ut.v1.Greeter/Watch"))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// health check is never shed
+	err = inter(newStreamServerInput(context.TODO(), "/grpc.health.v1.Health/Watch"))
+	assert.Nil(t, err)
+
+	// released
+	close(release)
+	<-done
+	err = inter(newStreamServerInput(context.TODO(), "/ut.v1.Greeter/Watch"))
+	assert.Nil(t, err)
+}
+
+func TestServerInterceptors(t *testing.T) {
+	unary, stream := ServerInterceptors(WithMaxInFlight(1))
+
+	// unary and stream share limits
+	release, done := holdUnary(unary, context.TODO(), "/ut.v1.Greeter/Hello")
+	err := stream(newStreamServerInput(context.TODO(), "/ut.v1.Greeter/Watch"))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	close(release)
+	<-done
+	assert.Nil(t, stream(newStreamServerInput(context.TODO(), "/ut.v1.Greeter/Watch")))
+}
+
+// ************ Test utility ************
+
+type ServerStreamMock struct {
+	ctx context.Context
+}
+
+func (f ServerStreamMock) SetHeader(md metadata.MD) error {
+	return nil
+}
+
+func (f ServerStreamMock) SendHeader(md metadata.MD) error {
+	return nil
+}
+
+func (f ServerStreamMock) SetTrailer(md metadata.MD) {
+	return
+}
+
+func (f ServerStreamMock) Context() context.Context {
+	return f.ctx
+}
+
+func (f ServerStreamMock) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (f ServerStreamMock) RecvMsg(m interface{}) error {
+	return nil
+}
+
+// holdUnary call interceptor in background which holds slot until release is closed
+func holdUnary(inter grpc.UnaryServerInterceptor, ctx context.Context, method string) (chan struct{}, chan struct{}) {
+	release := make(chan struct{})
+	done := make(chan struct{})
+	started := make(chan struct{})
+
+	ctx, req, info, _ := newUnaryServerInput(ctx, method)
+	go func() {
+		defer close(done)
+		inter(ctx, req, info, func(context.Context, interface{}) (interface{}, error) {
+			close(started)
+			<-release
+			return nil, nil
+		})
+	}()
+	<-started
+
+	return release, done
+}
+
+func newUnaryServerInput(ctx context.Context, method string) (context.Context, interface{}, *grpc.UnaryServerInfo, grpc.UnaryHandler) {
+	return ctx, nil,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		}
+}
+
+func newStreamServerInput(ctx context.Context, method string) (interface{}, grpc.ServerStream, *grpc.StreamServerInfo, grpc.StreamHandler) {
+	return nil,
+		ServerStreamMock{ctx: ctx},
+		&grpc.StreamServerInfo{FullMethod: method},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			return nil
+		}
+}
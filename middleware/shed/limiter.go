@@ -0,0 +1,183 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcshed
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// AlgorithmStatic limit of in-flight calls is fixed
+	AlgorithmStatic = "static"
+	// AlgorithmAimd limit increases additively while latency is fine and decreases multiplicatively otherwise
+	AlgorithmAimd = "aimd"
+	// AlgorithmGradient limit follows gradient of long term latency over latest latency
+	AlgorithmGradient = "gradient"
+
+	// aimdBackoff ratio of limit after latency exceeded threshold or call dropped
+	aimdBackoff = 0.9
+	// gradientWindow number of samples averaged as long term latency
+	gradientWindow = 100
+	// gradientTolerance ratio of latest latency over long term latency which is tolerated
+	gradientTolerance = 1.5
+	// gradientSmoothing weight of new limit
+	gradientSmoothing = 0.2
+)
+
+// limiter caps in-flight calls, limit is adjusted with latency of calls in adaptive algorithms
+type limiter struct {
+	lock      sync.Mutex
+	algorithm string
+	limit     float64
+	min       float64
+	max       float64
+	latency   time.Duration
+	inFlight  int
+	// long term latency in nanoseconds of gradient
+	longRtt float64
+}
+
+// newLimiter create limiter which starts with max limit, nil would be returned if max is not positive
+func newLimiter(algorithm string, max, min int, latency time.Duration) *limiter {
+	if max < 1 {
+		return nil
+	}
+
+	if min < 1 || min > max {
+		min = 1
+	}
+
+	return &limiter{
+		algorithm: algorithm,
+		limit:     float64(max),
+		min:       float64(min),
+		max:       float64(max),
+		latency:   latency,
+	}
+}
+
+// acquire one slot, calls of critical priority are always admitted, sheddable calls are admitted only if in-flight
+// calls are below ratio of limit
+func (l *limiter) acquire(priority string, ratio float64) bool {
+	if l == nil {
+		return true
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	switch priority {
+	case PriorityCritical:
+	case PrioritySheddable:
+		if float64(l.inFlight) >= math.Max(1, math.Floor(l.limit*ratio)) {
+			return false
+		}
+	default:
+		if float64(l.inFlight) >= math.Max(1, math.Floor(l.limit)) {
+			return false
+		}
+	}
+
+	l.inFlight++
+	return true
+}
+
+// release slot without sample
+func (l *limiter) release() {
+	if l == nil {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.inFlight--
+}
+
+// releaseWithSample release slot and adjust limit with latency of call
+func (l *limiter) releaseWithSample(rtt time.Duration, dropped bool) {
+	if l == nil {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	inFlight := l.inFlight
+	l.inFlight--
+
+	switch l.algorithm {
+	case AlgorithmAimd:
+		l.limit = l.aimd(rtt, dropped, inFlight)
+	case AlgorithmGradient:
+		l.limit = l.gradient(rtt, dropped, inFlight)
+	}
+}
+
+// getLimit returns current limit
+func (l *limiter) getLimit() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return int(l.limit)
+}
+
+// getInFlight returns number of in-flight calls
+func (l *limiter) getInFlight() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.inFlight
+}
+
+// aimd decreases limit if call was slow or dropped, increases limit by one if at least half of limit was in use
+func (l *limiter) aimd(rtt time.Duration, dropped bool, inFlight int) float64 {
+	if dropped || (l.latency > 0 && rtt > l.latency) {
+		return math.Max(l.min, l.limit*aimdBackoff)
+	}
+
+	if float64(inFlight)*2 >= l.limit {
+		return math.Min(l.max, l.limit+1)
+	}
+
+	return l.limit
+}
+
+// gradient scales limit by long term latency over latest latency, and leaves room of square root of limit for queueing
+func (l *limiter) gradient(rtt time.Duration, dropped bool, inFlight int) float64 {
+	sample := float64(rtt)
+	if sample <= 0 {
+		return l.limit
+	}
+
+	if l.longRtt <= 0 {
+		l.longRtt = sample
+	} else {
+		l.longRtt += (sample - l.longRtt) / gradientWindow
+	}
+
+	// latency recovered, drain long term latency faster
+	if l.longRtt/sample > 2 {
+		l.longRtt *= 0.95
+	}
+
+	// limit is not in use, keep it
+	if !dropped && float64(inFlight)*2 < l.limit {
+		return l.limit
+	}
+
+	gradient := math.Max(0.5, math.Min(1, gradientTolerance*l.longRtt/sample))
+	if dropped {
+		gradient = 0.5
+	}
+
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	newLimit = l.limit*(1-gradientSmoothing) + newLimit*gradientSmoothing
+
+	return math.Max(l.min, math.Min(l.max, newLimit))
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcshed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLimiter(t *testing.T) {
+	// unlimited
+	assert.Nil(t, newLimiter(AlgorithmStatic, 0, 0, 0))
+
+	// invalid min
+	l := newLimiter(AlgorithmStatic, 10, 20, 0)
+	assert.Equal(t, 10, l.getLimit())
+	assert.Equal(t, float64(1), l.min)
+
+	// nil limiter always admits
+	var nilLimiter *limiter
+	assert.True(t, nilLimiter.acquire(PriorityNormal, 1))
+	nilLimiter.release()
+	nilLimiter.releaseWithSample(time.Second, true)
+}
+
+func TestLimiter_Acquire(t *testing.T) {
+	l := newLimiter(AlgorithmStatic, 4, 1, 0)
+
+	// sheddable calls could use 50% of limit
+	assert.True(t, l.acquire(PrioritySheddable, 0.5))
+	assert.True(t, l.acquire(PrioritySheddable, 0.5))
+	assert.False(t, l.acquire(PrioritySheddable, 0.5))
+
+	// normal calls could use all of limit
+	assert.True(t, l.acquire(PriorityNormal, 0.5))
+	assert.True(t, l.acquire(PriorityNormal, 0.5))
+	assert.False(t, l.acquire(PriorityNormal, 0.5))
+
+	// critical calls are never rejected
+	assert.True(t, l.acquire(PriorityCritical, 0.5))
+	assert.Equal(t, 5, l.getInFlight())
+
+	// static limit is not changed with samples
+	l.releaseWithSample(time.Hour, true)
+	l.release()
+	assert.Equal(t, 3, l.getInFlight())
+	assert.Equal(t, 4, l.getLimit())
+}
+
+func TestLimiter_Aimd(t *testing.T) {
+	l := newLimiter(AlgorithmAimd, 10, 2, 100*time.Millisecond)
+
+	// case 1: decrease if slow
+	l.acquire(PriorityNormal, 1)
+	l.releaseWithSample(time.Second, false)
+	assert.Equal(t, 9, l.getLimit())
+
+	// case 2: decrease if dropped
+	l.acquire(PriorityNormal, 1)
+	l.releaseWithSample(time.Millisecond, true)
+	assert.Equal(t, 8, l.getLimit())
+
+	// case 3: min limit
+	for i := 0; i < 100; i++ {
+		l.acquire(PriorityNormal, 1)
+		l.releaseWithSample(time.Second, false)
+	}
+	assert.Equal(t, 2, l.getLimit())
+
+	// case 4: increase if limit is in use
+	l.acquire(PriorityNormal, 1)
+	l.releaseWithSample(time.Millisecond, false)
+	assert.Equal(t, 3, l.getLimit())
+
+	// case 5: keep limit if not in use
+	l.limit = 8
+	l.acquire(PriorityNormal, 1)
+	l.releaseWithSample(time.Millisecond, false)
+	assert.Equal(t, 8, l.getLimit())
+
+	// case 6: max limit
+	l.limit = 10
+	for i := 0; i < 10; i++ {
+		l.acquire(PriorityNormal, 1)
+	}
+	l.releaseWithSample(time.Millisecond, false)
+	assert.Equal(t, 10, l.getLimit())
+}
+
+func TestLimiter_Gradient(t *testing.T) {
+	l := newLimiter(AlgorithmGradient, 100, 5, 0)
+	fill := func(n int) {
+		for i := 0; i < n; i++ {
+			l.acquire(PriorityNormal, 1)
+		}
+	}
+	drain := func() {
+		for l.getInFlight() > 0 {
+			l.release()
+		}
+	}
+
+	// case 1: stable latency, limit kept at max
+	for i := 0; i < 10; i++ {
+		fill(100)
+		l.releaseWithSample(10*time.Millisecond, false)
+		drain()
+	}
+	assert.Equal(t, 100, l.getLimit())
+
+	// case 2: latency rises, limit decreases
+	for i := 0; i < 10; i++ {
+		fill(l.getLimit())
+		l.releaseWithSample(100*time.Millisecond, false)
+		drain()
+	}
+	assert.True(t, l.getLimit() < 100)
+
+	// case 3: not in use, limit kept
+	limit := l.getLimit()
+	l.acquire(PriorityNormal, 1)
+	l.releaseWithSample(time.Second, false)
+	assert.Equal(t, limit, l.getLimit())
+
+	// case 4: dropped
+	fill(1)
+	l.releaseWithSample(10*time.Millisecond, true)
+	assert.True(t, l.getLimit() < limit)
+
+	// case 5: min limit
+	for i := 0; i < 100; i++ {
+		fill(l.getLimit())
+		l.releaseWithSample(10*time.Millisecond, true)
+		drain()
+	}
+	assert.Equal(t, 5, l.getLimit())
+
+	// case 6: latency recovers, limit increases
+	for i := 0; i < 100; i++ {
+		fill(l.getLimit())
+		l.releaseWithSample(10*time.Millisecond, false)
+		drain()
+	}
+	assert.True(t, l.getLimit() > 5)
+
+	// invalid sample
+	limit = l.getLimit()
+	fill(1)
+	l.releaseWithSample(0, false)
+	assert.Equal(t, limit, l.getLimit())
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcshed
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// PriorityCritical calls of critical methods are never shed, health checks are always critical
+	PriorityCritical = "critical"
+	// PriorityNormal calls are shed if in-flight calls reached limit
+	PriorityNormal = "normal"
+	// PrioritySheddable calls are shed if in-flight calls reached ratio of limit
+	PrioritySheddable = "sheddable"
+
+	// DefaultPriorityHeader default metadata of priority
+	DefaultPriorityHeader = "x-priority"
+	// DefaultSheddableRatio default ratio of limit which sheddable calls could use
+	DefaultSheddableRatio = 0.8
+	// DefaultLatency default latency above which limit decreases in aimd algorithm
+	DefaultLatency = time.Second
+
+	// healthPrefix methods of grpc health check
+	healthPrefix = "/grpc.health.v1.Health/"
+)
+
+// ***************** OptionSet *****************
+
+// Options which is used while initializing extension interceptor
+type optionSet struct {
+	entryName       string
+	entryType       string
+	algorithm       string
+	maxInFlight     int
+	minInFlight     int
+	latency         time.Duration
+	rejectCode      codes.Code
+	priorityHeader  string
+	sheddableRatio  float64
+	criticalMethods []string
+	methodLimits    map[string]int
+	pathToIgnore    []string
+	global          *limiter
+	methods         map[string]*limiter
+}
+
+// newOptionSet Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:       "fake-entry",
+		entryType:       "",
+		algorithm:       AlgorithmStatic,
+		latency:         DefaultLatency,
+		rejectCode:      codes.Unavailable,
+		priorityHeader:  DefaultPriorityHeader,
+		sheddableRatio:  DefaultSheddableRatio,
+		criticalMethods: []string{healthPrefix},
+		methodLimits:    make(map[string]int),
+		pathToIgnore:    []string{},
+		methods:         make(map[string]*limiter),
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	set.global = newLimiter(set.algorithm, set.maxInFlight, set.minInFlight, set.latency)
+	for method, max := range set.methodLimits {
+		set.methods[method] = newLimiter(set.algorithm, max, set.minInFlight, set.latency)
+	}
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// ShouldIgnore determine whether shedding should be ignored based on path
+func (set *optionSet) ShouldIgnore(path string) bool {
+	for i := range set.pathToIgnore {
+		if strings.HasPrefix(path, set.pathToIgnore[i]) {
+			return true
+		}
+	}
+
+	return rkmid.ShouldIgnoreGlobal(path)
+}
+
+// priority returns priority of call, critical methods are always critical.
+//
+// Metadata of priority is supplied by caller, so it could only lower priority of call to sheddable, other values are
+// treated as normal.
+func (set *optionSet) priority(ctx context.Context, method string) string {
+	for i := range set.criticalMethods {
+		if strings.HasPrefix(method, set.criticalMethods[i]) {
+			return PriorityCritical
+		}
+	}
+
+	if values := rkgrpcctx.GetIncomingHeaders(ctx).Get(set.priorityHeader); len(values) > 0 {
+		if strings.ToLower(strings.TrimSpace(values[0])) == PrioritySheddable {
+			return PrioritySheddable
+		}
+	}
+
+	return PriorityNormal
+}
+
+// BootConfig for YAML
+type BootConfig struct {
+	Enabled         bool               `yaml:"enabled" json:"enabled"`
+	Ignore          []string           `yaml:"ignore" json:"ignore"`
+	Algorithm       string             `yaml:"algorithm" json:"algorithm"`
+	MaxInFlight     int                `yaml:"maxInFlight" json:"maxInFlight"`
+	MinInFlight     int                `yaml:"minInFlight" json:"minInFlight"`
+	LatencyMs       int64              `yaml:"latencyMs" json:"latencyMs"`
+	RejectCode      string             `yaml:"rejectCode" json:"rejectCode"`
+	PriorityHeader  string             `yaml:"priorityHeader" json:"priorityHeader"`
+	SheddableRatio  float64            `yaml:"sheddableRatio" json:"sheddableRatio"`
+	CriticalMethods []string           `yaml:"criticalMethods" json:"criticalMethods"`
+	Methods         []BootConfigMethod `yaml:"methods" json:"methods"`
+}
+
+// BootConfigMethod Boot config of in-flight limit of method.
+type BootConfigMethod struct {
+	Method      string `yaml:"method" json:"method"`
+	MaxInFlight int    `yaml:"maxInFlight" json:"maxInFlight"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		switch config.Algorithm {
+		case "", AlgorithmStatic, AlgorithmAimd, AlgorithmGradient:
+		default:
+			rkentry.ShutdownWithError(fmt.Errorf("invalid shed algorithm %s", config.Algorithm))
+		}
+
+		code := codes.Unavailable
+		switch strings.ToLower(config.RejectCode) {
+		case "", "unavailable":
+		case "resourceexhausted":
+			code = codes.ResourceExhausted
+		default:
+			rkentry.ShutdownWithError(fmt.Errorf("invalid shed reject code %s, expect unavailable or resourceExhausted",
+				config.RejectCode))
+		}
+
+		methods := make(map[string]int)
+		for _, element := range config.Methods {
+			methods[element.Method] = element.MaxInFlight
+		}
+
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithAlgorithm(config.Algorithm),
+			WithMaxInFlight(config.MaxInFlight),
+			WithMinInFlight(config.MinInFlight),
+			WithLatency(time.Duration(config.LatencyMs)*time.Millisecond),
+			WithRejectCode(code),
+			WithPriorityHeader(config.PriorityHeader),
+			WithSheddableRatio(config.SheddableRatio),
+			WithCriticalMethods(config.CriticalMethods...),
+			WithMaxInFlightByMethod(methods),
+			WithPathToIgnore(config.Ignore...))
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
+// Option options provided to Interceptor or optionsSet while creating
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithAlgorithm provide algorithm of limit, one of static, aimd and gradient.
+func WithAlgorithm(algorithm string) Option {
+	return func(set *optionSet) {
+		if len(algorithm) > 0 {
+			set.algorithm = algorithm
+		}
+	}
+}
+
+// WithMaxInFlight provide max in-flight calls of server, zero means unlimited.
+func WithMaxInFlight(max int) Option {
+	return func(set *optionSet) {
+		set.maxInFlight = max
+	}
+}
+
+// WithMinInFlight provide min limit of in-flight calls in adaptive algorithms.
+func WithMinInFlight(min int) Option {
+	return func(set *optionSet) {
+		set.minInFlight = min
+	}
+}
+
+// WithLatency provide latency above which limit decreases in aimd algorithm.
+func WithLatency(latency time.Duration) Option {
+	return func(set *optionSet) {
+		if latency > 0 {
+			set.latency = latency
+		}
+	}
+}
+
+// WithRejectCode provide code of rejected calls, Unavailable or ResourceExhausted.
+func WithRejectCode(code codes.Code) Option {
+	return func(set *optionSet) {
+		if code == codes.Unavailable || code == codes.ResourceExhausted {
+			set.rejectCode = code
+		}
+	}
+}
+
+// WithPriorityHeader provide metadata of priority, value of sheddable lowers priority of call, others are normal.
+func WithPriorityHeader(header string) Option {
+	return func(set *optionSet) {
+		if len(header) > 0 {
+			set.priorityHeader = strings.ToLower(header)
+		}
+	}
+}
+
+// WithSheddableRatio provide ratio of limit which sheddable calls could use.
+func WithSheddableRatio(ratio float64) Option {
+	return func(set *optionSet) {
+		if ratio > 0 && ratio <= 1 {
+			set.sheddableRatio = ratio
+		}
+	}
+}
+
+// WithCriticalMethods provide prefixes of methods which are never shed, grpc health check is always included.
+func WithCriticalMethods(methods ...string) Option {
+	return func(set *optionSet) {
+		for i := range methods {
+			if len(methods[i]) > 0 {
+				set.criticalMethods = append(set.criticalMethods, methods[i])
+			}
+		}
+	}
+}
+
+// WithMaxInFlightByMethod provide max in-flight calls of full method names.
+func WithMaxInFlightByMethod(limits map[string]int) Option {
+	return func(set *optionSet) {
+		for k, v := range limits {
+			set.methodLimits[k] = v
+		}
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will ignore.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpcshed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestNewOptionSet(t *testing.T) {
+	// default
+	set := newOptionSet()
+	assert.Equal(t, AlgorithmStatic, set.algorithm)
+	assert.Equal(t, codes.Unavailable, set.rejectCode)
+	assert.Equal(t, DefaultPriorityHeader, set.priorityHeader)
+	assert.Equal(t, DefaultSheddableRatio, set.sheddableRatio)
+	assert.Nil(t, set.global)
+	assert.Empty(t, set.methods)
+
+	// with options
+	set = newOptionSet(
+		WithEntryNameAndType("ut-entry", "ut-type"),
+		WithAlgorithm(AlgorithmAimd),
+		WithMaxInFlight(100),
+		WithMinInFlight(10),
+		WithLatency(time.Millisecond),
+		WithRejectCode(codes.ResourceExhausted),
+		WithPriorityHeader("X-Ut-Priority"),
+		WithSheddableRatio(0.5),
+		WithCriticalMethods("/ut.v1.Admin/"),
+		WithMaxInFlightByMethod(map[string]int{"/ut.v1.Greeter/Hello": 5}),
+		WithPathToIgnore("/ut-ignore"))
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.Equal(t, 100, set.global.getLimit())
+	assert.Equal(t, float64(10), set.global.min)
+	assert.Equal(t, time.Millisecond, set.global.latency)
+	assert.Equal(t, AlgorithmAimd, set.methods["/ut.v1.Greeter/Hello"].algorithm)
+	assert.Equal(t, codes.ResourceExhausted, set.rejectCode)
+	assert.Equal(t, "x-ut-priority", set.priorityHeader)
+	assert.Equal(t, 0.5, set.sheddableRatio)
+	assert.True(t, set.ShouldIgnore("/ut-ignore"))
+	assert.False(t, set.ShouldIgnore("/ut.v1.Greeter/Hello"))
+
+	// invalid reject code and ratio are ignored
+	set = newOptionSet(WithRejectCode(codes.Internal), WithSheddableRatio(2))
+	assert.Equal(t, codes.Unavailable, set.rejectCode)
+	assert.Equal(t, DefaultSheddableRatio, set.sheddableRatio)
+}
+
+func TestOptionSet_Priority(t *testing.T) {
+	set := newOptionSet(WithCriticalMethods("/ut.v1.Admin/"))
+	withPriority := func(p string) context.Context {
+		return metadata.NewIncomingContext(context.TODO(), metadata.Pairs(DefaultPriorityHeader, p))
+	}
+
+	assert.Equal(t, PriorityCritical, set.priority(context.TODO(), "/grpc.health.v1.Health/Check"))
+	assert.Equal(t, PriorityCritical, set.priority(context.TODO(), "/ut.v1.Admin/Delete"))
+	assert.Equal(t, PriorityNormal, set.priority(context.TODO(), "/ut.v1.Greeter/Hello"))
+	assert.Equal(t, PrioritySheddable, set.priority(withPriority("sheddable"), "/ut.v1.Greeter/Hello"))
+	assert.Equal(t, PrioritySheddable, set.priority(withPriority(" SHEDDABLE "), "/ut.v1.Greeter/Hello"))
+	// metadata could not raise priority
+	assert.Equal(t, PriorityNormal, set.priority(withPriority("critical"), "/ut.v1.Greeter/Hello"))
+	assert.Equal(t, PriorityNormal, set.priority(withPriority("ut-unknown"), "/ut.v1.Greeter/Hello"))
+
+	// health check could not be lowered
+	assert.Equal(t, PriorityCritical, set.priority(withPriority("sheddable"), "/grpc.health.v1.Health/Check"))
+}
+
+func TestToOptions(t *testing.T) {
+	config := &struct {
+		Shed BootConfig `yaml:"shed"`
+	}{}
+
+	rkentry.UnmarshalBootYAML([]byte(`
+shed:
+  enabled: true
+  algorithm: gradient
+  maxInFlight: 100
+  minInFlight: 10
+  latencyMs: 500
+  rejectCode: resourceExhausted
+  priorityHeader: x-ut-priority
+  sheddableRatio: 0.5
+  criticalMethods: ["/ut.v1.Admin/"]
+  methods:
+    - method: /ut.v1.Greeter/Hello
+      maxInFlight: 5
+`), config)
+
+	set := newOptionSet(ToOptions(&config.Shed, "ut-entry", "ut-type")...)
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, AlgorithmGradient, set.algorithm)
+	assert.Equal(t, 100, set.global.getLimit())
+	assert.Equal(t, 500*time.Millisecond, set.latency)
+	assert.Equal(t, codes.ResourceExhausted, set.rejectCode)
+	assert.Equal(t, "x-ut-priority", set.priorityHeader)
+	assert.Equal(t, 0.5, set.sheddableRatio)
+	assert.Contains(t, set.criticalMethods, "/ut.v1.Admin/")
+	assert.Equal(t, 5, set.methods["/ut.v1.Greeter/Hello"].getLimit())
+
+	// disabled
+	config.Shed.Enabled = false
+	assert.Empty(t, ToOptions(&config.Shed, "ut-entry", "ut-type"))
+}
+
+func TestToOptions_WithInvalidConfig(t *testing.T) {
+	// invalid algorithm
+	assert.Panics(t, func() {
+		ToOptions(&BootConfig{Enabled: true, Algorithm: "ut-algorithm"}, "ut-entry", "ut-type")
+	})
+
+	// invalid reject code
+	assert.Panics(t, func() {
+		ToOptions(&BootConfig{Enabled: true, RejectCode: "internal"}, "ut-entry", "ut-type")
+	})
+}
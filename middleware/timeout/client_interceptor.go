@@ -0,0 +1,90 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpctimeout
+
+import (
+	"context"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	"google.golang.org/grpc"
+)
+
+// UnaryClientInterceptor Add timeout interceptors.
+//
+// Call is timed out with the earlier one of caller deadline and timeout of method, which is the deadline of context
+// passed to invoker, so that call would be canceled on backend side as well.
+func UnaryClientInterceptor(opts ...Option) grpc.UnaryClientInterceptor {
+	set := newOptionSet(opts...)
+
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		if set.ShouldIgnore(method) {
+			return invoker(ctx, method, req, resp, cc, opts...)
+		}
+
+		ctx, cancel, reason := set.withDeadline(ctx, method)
+		defer cancel()
+
+		err := invoker(ctx, method, req, resp, cc, opts...)
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			recordTimeout(ctx, reason)
+			return timeoutError(reason)
+		}
+
+		return err
+	}
+}
+
+// StreamClientInterceptor Add timeout interceptors.
+//
+// Whole stream is timed out with the earlier one of caller deadline and timeout of method, context of stream would be
+// canceled once stream finished.
+func StreamClientInterceptor(opts ...Option) grpc.StreamClientInterceptor {
+	set := newOptionSet(opts...)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+
+		if set.ShouldIgnore(method) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		ctx, cancel, reason := set.withDeadline(ctx, method)
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			if ctx.Err() == context.DeadlineExceeded {
+				recordTimeout(ctx, reason)
+				return nil, timeoutError(reason)
+			}
+			return nil, err
+		}
+
+		return &cancelClientStream{ClientStream: stream, cancel: cancel}, nil
+	}
+}
+
+// *************** utility ***************
+
+// cancelClientStream cancels context of stream once stream finished
+type cancelClientStream struct {
+	grpc.ClientStream
+	cancel context.CancelFunc
+}
+
+// RecvMsg receives message, context would be canceled if stream finished with error or io.EOF
+func (s *cancelClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.cancel()
+	}
+	return err
+}
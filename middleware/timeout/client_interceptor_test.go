@@ -0,0 +1,118 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpctimeout
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptor_WithTimeout(t *testing.T) {
+	inter := UnaryClientInterceptor(WithTimeout(time.Nanosecond))
+
+	canceled := make(chan struct{})
+	err := inter(context.TODO(), "/ut-method", req, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	})
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// context passed to invoker should be canceled
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		assert.Fail(t, "context of invoker is not canceled")
+	}
+}
+
+func TestUnaryClientInterceptor_HappyCase(t *testing.T) {
+	// with timeout
+	inter := UnaryClientInterceptor(WithTimeout(time.Second))
+	err := inter(context.TODO(), "/ut-method", req, nil, nil, returnInvoker)
+	assert.Nil(t, err)
+
+	// with ignored path
+	inter = UnaryClientInterceptor(
+		WithTimeout(time.Second),
+		WithPathToIgnore("/ut-method"))
+	err = inter(context.TODO(), "/ut-method", req, nil, nil, returnInvoker)
+	assert.Nil(t, err)
+}
+
+func TestStreamClientInterceptor_WithTimeout(t *testing.T) {
+	inter := StreamClientInterceptor(WithTimeout(time.Nanosecond))
+
+	clientStream, err := inter(context.TODO(), &grpc.StreamDesc{}, nil, "/ut-method", func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	})
+	assert.Nil(t, clientStream)
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
+
+	// stream is bounded by the earlier deadline of caller
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond)
+	defer cancel()
+	inter = StreamClientInterceptor(WithTimeout(time.Minute))
+
+	var streamCtx context.Context
+	_, err = inter(ctx, &grpc.StreamDesc{}, nil, "/ut-method", func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		streamCtx = ctx
+		return &eofClientStream{}, nil
+	})
+	assert.Nil(t, err)
+	<-streamCtx.Done()
+	assert.Equal(t, context.DeadlineExceeded, streamCtx.Err())
+}
+
+func TestStreamClientInterceptor_HappyCase(t *testing.T) {
+	inter := StreamClientInterceptor(WithTimeout(time.Second))
+
+	_, err := inter(context.TODO(), &grpc.StreamDesc{}, nil, "/ut-method", returnStreamer)
+	assert.Nil(t, err)
+}
+
+func TestStreamClientInterceptor_WithFinishedStream(t *testing.T) {
+	inter := StreamClientInterceptor(WithTimeout(time.Second))
+
+	var streamCtx context.Context
+	clientStream, err := inter(context.TODO(), &grpc.StreamDesc{}, nil, "/ut-method", func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		streamCtx = ctx
+		return &eofClientStream{}, nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, streamCtx.Err())
+
+	// context should be canceled once stream finished
+	assert.Equal(t, io.EOF, clientStream.RecvMsg(nil))
+	assert.NotNil(t, streamCtx.Err())
+}
+
+// ************ Test utility ************
+
+type eofClientStream struct {
+	grpc.ClientStream
+}
+
+func (s *eofClientStream) RecvMsg(m interface{}) error {
+	return io.EOF
+}
+
+func returnInvoker(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+	return nil
+}
+
+func returnStreamer(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, nil
+}
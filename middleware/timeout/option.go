@@ -0,0 +1,231 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpctimeout
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	rkmidtimeout "github.com/rookie-ninja/rk-entry/v2/middleware/timeout"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+)
+
+// defaultTimeout timeout of methods without timeout provided
+const defaultTimeout = 10 * time.Second
+
+// ***************** OptionSet *****************
+
+// Options which is used while initializing extension interceptor.
+//
+// Timeouts of methods are kept here, rkmidtimeout keeps them unexported, while they are required to set deadline of
+// context.
+type optionSet struct {
+	entryName     string
+	entryType     string
+	timeout       time.Duration
+	timeouts      map[string]time.Duration
+	pathToIgnore  []string
+	minBudget     time.Duration
+	streamTimeout *StreamTimeout
+	mid           rkmidtimeout.OptionSetInterface
+}
+
+// newOptionSet Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:    "fake-entry",
+		entryType:    "",
+		timeout:      defaultTimeout,
+		timeouts:     make(map[string]time.Duration),
+		pathToIgnore: []string{},
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	midOpts := []rkmidtimeout.Option{
+		rkmidtimeout.WithEntryNameAndType(set.entryName, set.entryType),
+		rkmidtimeout.WithTimeout(set.timeout),
+		rkmidtimeout.WithPathToIgnore(set.pathToIgnore...),
+	}
+	for path, timeout := range set.timeouts {
+		midOpts = append(midOpts, rkmidtimeout.WithTimeoutByPath(path, timeout))
+	}
+	set.mid = rkmidtimeout.NewOptionSet(midOpts...)
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// ShouldIgnore determine whether timeout should be ignored based on path
+func (set *optionSet) ShouldIgnore(path string) bool {
+	return set.mid.ShouldIgnore(path)
+}
+
+// of returns timeout of method, global timeout would be returned if method is missing
+func (set *optionSet) of(method string) time.Duration {
+	if v, ok := set.timeouts[method]; ok {
+		return v
+	}
+
+	return set.timeout
+}
+
+// withDeadline returns context with the earlier one of client deadline and timeout of method, and reason of timeout
+// once the deadline is exceeded.
+func (set *optionSet) withDeadline(ctx context.Context, method string) (context.Context, context.CancelFunc, string) {
+	deadline := time.Now().Add(set.of(method))
+	reason := ReasonTimeout
+	if clientDeadline, ok := ctx.Deadline(); ok && clientDeadline.Before(deadline) {
+		deadline, reason = clientDeadline, ReasonDeadline
+	}
+
+	newCtx, cancel := context.WithDeadline(ctx, deadline)
+	return newCtx, cancel, reason
+}
+
+// checkBudget returns DeadlineExceeded if remaining budget of client deadline is below min budget
+func (set *optionSet) checkBudget(ctx context.Context) error {
+	if deadline, ok := ctx.Deadline(); ok && set.minBudget > 0 && time.Until(deadline) < set.minBudget {
+		rkgrpcctx.GetEvent(ctx).AddPair("timeoutReason", ReasonBudget)
+		return timeoutError(ReasonBudget)
+	}
+
+	return nil
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML, extends rkmidtimeout.BootConfig with timeouts of streams and min budget of client deadline.
+type BootConfig struct {
+	rkmidtimeout.BootConfig `yaml:",inline" mapstructure:",squash"`
+	MinBudgetMs             int64            `yaml:"minBudgetMs" json:"minBudgetMs"`
+	Stream                  BootConfigStream `yaml:"stream" json:"stream"`
+}
+
+// BootConfigStream Boot config of stream timeouts, idleMs and maxAgeMs are used in idle mode.
+type BootConfigStream struct {
+	Mode     string `yaml:"mode" json:"mode"`
+	IdleMs   int64  `yaml:"idleMs" json:"idleMs"`
+	MaxAgeMs int64  `yaml:"maxAgeMs" json:"maxAgeMs"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithTimeout(time.Duration(config.TimeoutMs)*time.Millisecond))
+
+		for i := range config.Paths {
+			e := config.Paths[i]
+			opts = append(opts, WithTimeoutByPath(e.Path, time.Duration(e.TimeoutMs)*time.Millisecond))
+		}
+
+		opts = append(opts, WithPathToIgnore(config.Ignore...))
+	}
+
+	return opts
+}
+
+// ToMinBudget convert BootConfig into min budget of client deadline, zero disables the check.
+func ToMinBudget(config *BootConfig) time.Duration {
+	return time.Duration(config.MinBudgetMs) * time.Millisecond
+}
+
+// ToStreamTimeout convert BootConfig into StreamTimeout, nil would be returned in deadline mode.
+func ToStreamTimeout(config *BootConfig) *StreamTimeout {
+	switch config.Stream.Mode {
+	case "", StreamModeDeadline:
+		return nil
+	case StreamModeIdle:
+		return &StreamTimeout{
+			Idle:   time.Duration(config.Stream.IdleMs) * time.Millisecond,
+			MaxAge: time.Duration(config.Stream.MaxAgeMs) * time.Millisecond,
+		}
+	}
+
+	rkentry.ShutdownWithError(fmt.Errorf("invalid stream timeout mode %s, expect %s or %s",
+		config.Stream.Mode, StreamModeDeadline, StreamModeIdle))
+	return nil
+}
+
+// ***************** Option *****************
+
+// Option options provided to Interceptor or optionsSet while creating
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithTimeout provide global timeout, default timeout would be used if zero.
+func WithTimeout(timeout time.Duration) Option {
+	return func(set *optionSet) {
+		if timeout > 0 {
+			set.timeout = timeout
+		}
+	}
+}
+
+// WithTimeoutByPath provide timeout of method, global timeout would be used if zero.
+func WithTimeoutByPath(path string, timeout time.Duration) Option {
+	return func(set *optionSet) {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		if timeout > 0 {
+			set.timeouts[path] = timeout
+		}
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will ignore.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
+
+// WithMinBudget provide min budget of client deadline, calls with less remaining budget would be rejected with
+// DeadlineExceeded. Zero disables the check.
+func WithMinBudget(minBudget time.Duration) Option {
+	return func(set *optionSet) {
+		set.minBudget = minBudget
+	}
+}
+
+// WithStreamTimeout provide timeouts of stream in idle mode, whole stream would be timed out with timeout of method
+// if nil.
+func WithStreamTimeout(timeout *StreamTimeout) Option {
+	return func(set *optionSet) {
+		set.streamTimeout = timeout
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpctimeout
+
+import (
+	"testing"
+	"time"
+
+	rkentry "github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOptionSet(t *testing.T) {
+	// without options
+	set := newOptionSet()
+	assert.Equal(t, defaultTimeout, set.of(unaryInfo.FullMethod))
+
+	// with options
+	set = newOptionSet(
+		WithEntryNameAndType("ut-entry", "ut-type"),
+		WithTimeout(time.Minute),
+		WithTimeoutByPath("ut.v1.Service/Method", time.Hour),
+		WithPathToIgnore("/ut.v1.Ignored"))
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.Equal(t, time.Hour, set.of("/ut.v1.Service/Method"))
+	assert.Equal(t, time.Minute, set.of("/ut.v1.Other/Method"))
+	assert.True(t, set.ShouldIgnore("/ut.v1.Ignored/Method"))
+	assert.False(t, set.ShouldIgnore("/ut.v1.Service/Method"))
+}
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{}
+	config.Enabled = true
+	config.TimeoutMs = 100
+	config.Paths = append(config.Paths, struct {
+		Path      string `yaml:"path" json:"path"`
+		TimeoutMs int    `yaml:"timeoutMs" json:"timeoutMs"`
+	}{Path: "ut.v1.Service/Method", TimeoutMs: 200})
+
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, 200*time.Millisecond, set.of("/ut.v1.Service/Method"))
+	assert.Equal(t, 100*time.Millisecond, set.of("/ut.v1.Other/Method"))
+
+	// disabled
+	assert.Empty(t, ToOptions(&BootConfig{}, "ut-entry", "ut-type"))
+}
+
+func TestToStreamTimeout(t *testing.T) {
+	config := &BootConfig{}
+
+	// default mode
+	assert.Nil(t, ToStreamTimeout(config))
+
+	// deadline mode
+	config.Stream.Mode = StreamModeDeadline
+	assert.Nil(t, ToStreamTimeout(config))
+
+	// idle mode
+	config.Stream = BootConfigStream{
+		Mode:     StreamModeIdle,
+		IdleMs:   100,
+		MaxAgeMs: 1000,
+	}
+	assert.Equal(t, &StreamTimeout{
+		Idle:   100 * time.Millisecond,
+		MaxAge: time.Second,
+	}, ToStreamTimeout(config))
+}
+
+func TestToStreamTimeout_WithInvalidMode(t *testing.T) {
+	defer assertPanic(t)
+
+	ToStreamTimeout(&BootConfig{Stream: BootConfigStream{Mode: "invalid"}})
+}
+
+func TestBootConfig_FromYAML(t *testing.T) {
+	bootYAML := `
+timeout:
+  enabled: true
+  timeoutMs: 100
+  minBudgetMs: 20
+  stream:
+    mode: idle
+    idleMs: 50
+    maxAgeMs: 500
+`
+	config := &struct {
+		Timeout BootConfig `yaml:"timeout"`
+	}{}
+	rkentry.UnmarshalBootYAML([]byte(bootYAML), config)
+
+	assert.True(t, config.Timeout.Enabled)
+	assert.Equal(t, 100, config.Timeout.TimeoutMs)
+	assert.Equal(t, 20*time.Millisecond, ToMinBudget(&config.Timeout))
+	assert.Equal(t, StreamModeIdle, config.Timeout.Stream.Mode)
+	assert.Equal(t, int64(50), config.Timeout.Stream.IdleMs)
+	assert.Equal(t, int64(500), config.Timeout.Stream.MaxAgeMs)
+	assert.NotEmpty(t, ToOptions(&config.Timeout, "ut-entry", "ut-type"))
+}
@@ -7,28 +7,44 @@ package rkgrpctimeout
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
 	rkmidtimeout "github.com/rookie-ninja/rk-entry/v2/middleware/timeout"
-	rkgrpcerr "github.com/tegarajipangestu/rk-grpc/v2/boot/error"
 	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
 	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
 	"google.golang.org/grpc"
 )
 
-var defaultResponse = rkgrpcerr.Canceled("Request timed out!").Err()
-
 // UnaryServerInterceptor Add timeout interceptors.
-func UnaryServerInterceptor(opts ...rkmidtimeout.Option) grpc.UnaryServerInterceptor {
-	set := rkmidtimeout.NewOptionSet(opts...)
+//
+// Call is timed out with the earlier one of client deadline and timeout of method, which is the deadline of context
+// of handler, so downstream calls would carry it as well.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	set := newOptionSet(opts...)
 
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		ctx = rkgrpcmid.WrapContextForServer(ctx)
 		rkgrpcmid.AddToServerContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
 
-		beforeCtx := set.BeforeCtx(nil, rkgrpcctx.GetEvent(ctx))
+		if set.ShouldIgnore(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		if err := set.checkBudget(ctx); err != nil {
+			return nil, err
+		}
+
+		// handler would see DeadlineExceeded once timed out
+		ctx, cancel, reason := set.withDeadline(ctx, info.FullMethod)
+		defer cancel()
+
+		beforeCtx := set.mid.BeforeCtx(nil, rkgrpcctx.GetEvent(ctx))
 		beforeCtx.Input.UrlPath = info.FullMethod
 		toCtx := &unaryTimeoutCtx{
+			cancel:  cancel,
+			reason:  reason,
 			req:     req,
 			grpcCtx: ctx,
 			handler: handler,
@@ -41,17 +57,24 @@ func UnaryServerInterceptor(opts ...rkmidtimeout.Option) grpc.UnaryServerInterce
 		beforeCtx.Input.FinishHandler = unaryFinishHandler(toCtx)
 		beforeCtx.Input.TimeoutHandler = unaryTimeoutHandler(toCtx)
 		// call before
-		set.Before(beforeCtx)
+		set.mid.Before(beforeCtx)
 
 		beforeCtx.Output.WaitFunc()
 
-		return toCtx.resp, toCtx.err
+		return toCtx.result()
 	}
 }
 
-// StreamServerInterceptor Add rate limit interceptors.
-func StreamServerInterceptor(opts ...rkmidtimeout.Option) grpc.StreamServerInterceptor {
-	set := rkmidtimeout.NewOptionSet(opts...)
+// UnaryServerInterceptorWithMinBudget Add timeout interceptors, calls whose remaining budget of client deadline
+// is below minBudget would be rejected with DeadlineExceeded before handler is invoked. Zero disables the check.
+func UnaryServerInterceptorWithMinBudget(minBudget time.Duration, opts ...Option) grpc.UnaryServerInterceptor {
+	return UnaryServerInterceptor(append(opts, WithMinBudget(minBudget))...)
+}
+
+// StreamServerInterceptor Add timeout interceptors, whole stream would be timed out with timeout of method unless
+// StreamTimeout is provided.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	set := newOptionSet(opts...)
 
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		// Before invoking
@@ -60,10 +83,30 @@ func StreamServerInterceptor(opts ...rkmidtimeout.Option) grpc.StreamServerInter
 
 		rkgrpcmid.AddToServerContextPayload(wrappedStream.WrappedContext, rkmid.EntryNameKey, set.GetEntryName())
 
-		beforeCtx := set.BeforeCtx(nil, rkgrpcctx.GetEvent(wrappedStream.WrappedContext))
+		if set.ShouldIgnore(info.FullMethod) {
+			return handler(srv, wrappedStream)
+		}
+
+		if err := set.checkBudget(wrappedStream.WrappedContext); err != nil {
+			return err
+		}
+
+		if set.streamTimeout != nil {
+			return runIdle(set.streamTimeout, srv, wrappedStream, handler)
+		}
+
+		// handler would see DeadlineExceeded once timed out
+		ctx, cancel, reason := set.withDeadline(wrappedStream.WrappedContext, info.FullMethod)
+		defer cancel()
+		wrappedStream.WrappedContext = ctx
+
+		beforeCtx := set.mid.BeforeCtx(nil, rkgrpcctx.GetEvent(wrappedStream.WrappedContext))
+		beforeCtx.Input.UrlPath = info.FullMethod
 		toCtx := &streamTimeoutCtx{
+			cancel:  cancel,
+			reason:  reason,
 			srv:     srv,
-			stream:  stream,
+			stream:  wrappedStream,
 			handler: handler,
 			before:  beforeCtx,
 		}
@@ -74,28 +117,85 @@ func StreamServerInterceptor(opts ...rkmidtimeout.Option) grpc.StreamServerInter
 		beforeCtx.Input.FinishHandler = streamFinishHandler(toCtx)
 		beforeCtx.Input.TimeoutHandler = streamTimeoutHandler(toCtx)
 		// call before
-		set.Before(beforeCtx)
+		set.mid.Before(beforeCtx)
 
 		beforeCtx.Output.WaitFunc()
 
-		return toCtx.err
+		return toCtx.result()
 	}
 }
 
+// StreamServerInterceptorWithMinBudget Add timeout interceptors, streams whose remaining budget of client deadline
+// is below minBudget would be rejected with DeadlineExceeded before handler is invoked. Zero disables the check.
+func StreamServerInterceptorWithMinBudget(minBudget time.Duration, opts ...Option) grpc.StreamServerInterceptor {
+	return StreamServerInterceptor(append(opts, WithMinBudget(minBudget))...)
+}
+
+// StreamServerInterceptorWithStreamTimeout Add timeout interceptors, stream would be timed out if idle or too old
+// instead of timeout of method if StreamTimeout is provided.
+func StreamServerInterceptorWithStreamTimeout(timeout *StreamTimeout, opts ...Option) grpc.StreamServerInterceptor {
+	return StreamServerInterceptor(append(opts, WithStreamTimeout(timeout))...)
+}
+
 // *************** utility ***************
 
 type unaryTimeoutCtx struct {
-	req     interface{}
-	resp    interface{}
-	err     error
-	grpcCtx context.Context
-	handler grpc.UnaryHandler
-	before  *rkmidtimeout.BeforeCtx
+	req      interface{}
+	resp     interface{}
+	err      error
+	finished bool
+	lock     sync.Mutex
+	cancel   context.CancelFunc
+	reason   string
+	grpcCtx  context.Context
+	handler  grpc.UnaryHandler
+	before   *rkmidtimeout.BeforeCtx
+}
+
+// finish records result of call, result of handler which returned after timed out would be dropped
+func (ctx *unaryTimeoutCtx) finish(resp interface{}, err error) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	if !ctx.finished {
+		ctx.resp, ctx.err, ctx.finished = resp, err, true
+	}
+}
+
+// result returns result of call
+func (ctx *unaryTimeoutCtx) result() (interface{}, error) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	return ctx.resp, ctx.err
+}
+
+// handle calls handler, returns DeadlineExceeded if deadline of context passed before handler returned
+func (ctx *unaryTimeoutCtx) handle() (interface{}, error) {
+	resp, err := ctx.handler(ctx.grpcCtx, ctx.req)
+	if ctx.grpcCtx.Err() == context.DeadlineExceeded {
+		recordTimeout(ctx.grpcCtx, ctx.reason)
+		return nil, timeoutError(ctx.reason)
+	}
+
+	return resp, err
+}
+
+// expire waits for context to exceed its deadline if it is due, so that handler would see DeadlineExceeded instead of
+// Canceled, context would be canceled otherwise
+func expire(ctx context.Context, cancel context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok && !deadline.After(time.Now()) {
+		<-ctx.Done()
+	}
+
+	cancel()
 }
 
 func unaryTimeoutHandler(ctx *unaryTimeoutCtx) func() {
 	return func() {
-		ctx.err = defaultResponse
+		recordTimeout(ctx.grpcCtx, ctx.reason)
+		ctx.finish(nil, timeoutError(ctx.reason))
+		expire(ctx.grpcCtx, ctx.cancel)
 	}
 }
 
@@ -109,7 +209,7 @@ func unaryPanicHandler(ctx *unaryTimeoutCtx) func() {
 
 func unaryNextHandler(ctx *unaryTimeoutCtx) func() {
 	return func() {
-		ctx.resp, ctx.err = ctx.handler(ctx.grpcCtx, ctx.req)
+		ctx.finish(ctx.handle())
 	}
 }
 
@@ -118,16 +218,40 @@ func unaryInitHandler(ctx *unaryTimeoutCtx) func() {
 }
 
 type streamTimeoutCtx struct {
-	srv     interface{}
-	stream  grpc.ServerStream
-	err     error
-	handler grpc.StreamHandler
-	before  *rkmidtimeout.BeforeCtx
+	srv      interface{}
+	stream   grpc.ServerStream
+	err      error
+	finished bool
+	lock     sync.Mutex
+	cancel   context.CancelFunc
+	reason   string
+	handler  grpc.StreamHandler
+	before   *rkmidtimeout.BeforeCtx
+}
+
+// finish records result of stream, result of handler which returned after timed out would be dropped
+func (ctx *streamTimeoutCtx) finish(err error) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	if !ctx.finished {
+		ctx.err, ctx.finished = err, true
+	}
+}
+
+// result returns result of stream
+func (ctx *streamTimeoutCtx) result() error {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	return ctx.err
 }
 
 func streamTimeoutHandler(ctx *streamTimeoutCtx) func() {
 	return func() {
-		ctx.err = defaultResponse
+		recordTimeout(ctx.stream.Context(), ctx.reason)
+		ctx.finish(timeoutError(ctx.reason))
+		expire(ctx.stream.Context(), ctx.cancel)
 	}
 }
 
@@ -141,7 +265,13 @@ func streamPanicHandler(ctx *streamTimeoutCtx) func() {
 
 func streamNextHandler(ctx *streamTimeoutCtx) func() {
 	return func() {
-		ctx.err = ctx.handler(ctx.srv, ctx.stream)
+		err := ctx.handler(ctx.srv, ctx.stream)
+		if ctx.stream.Context().Err() == context.DeadlineExceeded {
+			recordTimeout(ctx.stream.Context(), ctx.reason)
+			err = timeoutError(ctx.reason)
+		}
+
+		ctx.finish(err)
 	}
 }
 
@@ -8,36 +8,38 @@ package rkgrpctimeout
 import (
 	"context"
 	"fmt"
-	"github.com/rookie-ninja/rk-entry/v2/middleware/timeout"
 	"github.com/stretchr/testify/assert"
+	"github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"testing"
 	"time"
 )
 
 func TestUnaryServerInterceptor_WithTimeout(t *testing.T) {
 	// with global timeout
-	inter := UnaryServerInterceptor(rkmidtimeout.WithTimeout(time.Nanosecond))
+	inter := UnaryServerInterceptor(WithTimeout(time.Nanosecond))
 
 	resp, err := inter(context.TODO(), req, unaryInfo, sleepHandlerUnary)
 	assert.Nil(t, resp)
-	assert.Equal(t, defaultResponse, err)
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
 
 	// with method
 	inter = UnaryServerInterceptor(
-		rkmidtimeout.WithTimeoutByPath(unaryInfo.FullMethod, time.Nanosecond))
+		WithTimeoutByPath(unaryInfo.FullMethod, time.Nanosecond))
 
 	resp, err = inter(context.TODO(), req, unaryInfo, sleepHandlerUnary)
 	assert.Nil(t, resp)
-	assert.Equal(t, defaultResponse, err)
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
 }
 
 func TestUnaryServerInterceptor_WithPanic(t *testing.T) {
 	defer assertPanic(t)
 
 	inter := UnaryServerInterceptor(
-		rkmidtimeout.WithTimeout(time.Second))
+		WithTimeout(time.Second))
 
 	resp, err := inter(context.TODO(), req, unaryInfo, panicHandlerUnary)
 	assert.Nil(t, resp)
@@ -51,13 +53,13 @@ func TestUnaryServerInterceptor_HappyCase(t *testing.T) {
 	// Let's add two routes /timeout and /happy
 	// We expect interceptor acts as the name describes
 	inter := UnaryServerInterceptor(
-		rkmidtimeout.WithTimeoutByPath(timeoutMethod, time.Nanosecond),
-		rkmidtimeout.WithTimeoutByPath(happyMethod, time.Second))
+		WithTimeoutByPath(timeoutMethod, time.Nanosecond),
+		WithTimeoutByPath(happyMethod, time.Second))
 
 	// timeout on /timeout
 	resp, err := inter(context.TODO(), req, &grpc.UnaryServerInfo{FullMethod: timeoutMethod}, sleepHandlerUnary)
 	assert.Nil(t, resp)
-	assert.Equal(t, defaultResponse, err)
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
 
 	// OK on /happy
 	resp, err = inter(context.TODO(), req, &grpc.UnaryServerInfo{FullMethod: happyMethod}, returnHandlerUnary)
@@ -65,27 +67,179 @@ func TestUnaryServerInterceptor_HappyCase(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestUnaryServerInterceptor_WithClientDeadline(t *testing.T) {
+	// handler reports deadline and error of its context
+	deadlines := make(chan time.Time, 1)
+	errs := make(chan error, 1)
+	waitHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+		<-ctx.Done()
+		errs <- ctx.Err()
+		return nil, ctx.Err()
+	}
+
+	inter := UnaryServerInterceptor(WithTimeoutByPath(unaryInfo.FullMethod, time.Second))
+
+	// client deadline is earlier than timeout of method
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	clientDeadline, _ := ctx.Deadline()
+
+	resp, err := inter(ctx, req, unaryInfo, waitHandler)
+	assert.Nil(t, resp)
+	assert.Equal(t, timeoutError(ReasonDeadline), err)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, clientDeadline, <-deadlines)
+	assert.Equal(t, context.DeadlineExceeded, <-errs)
+
+	// client deadline is later than timeout of method
+	inter = UnaryServerInterceptor(WithTimeoutByPath(unaryInfo.FullMethod, 10*time.Millisecond))
+	ctx, cancel = context.WithTimeout(context.TODO(), time.Minute)
+	defer cancel()
+
+	resp, err = inter(ctx, req, unaryInfo, waitHandler)
+	assert.Nil(t, resp)
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
+	assert.True(t, (<-deadlines).Before(time.Now().Add(time.Second)))
+	assert.Equal(t, context.DeadlineExceeded, <-errs)
+
+	// returned before client deadline
+	resp, err = inter(ctx, req, unaryInfo, returnHandlerUnary)
+	assert.Equal(t, "ut-resp", resp)
+	assert.Nil(t, err)
+}
+
+func TestUnaryServerInterceptor_WithClientDeadlineIgnored(t *testing.T) {
+	inter := UnaryServerInterceptor(WithTimeoutByPath(unaryInfo.FullMethod, 50*time.Millisecond))
+
+	// client deadline fired first while handler ignores it
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	resp, err := inter(ctx, req, unaryInfo, sleepHandlerUnary)
+	assert.Nil(t, resp)
+	assert.Equal(t, timeoutError(ReasonDeadline), err)
+}
+
+func TestUnaryServerInterceptor_WithCancel(t *testing.T) {
+	inter := UnaryServerInterceptor(WithTimeoutByPath(unaryInfo.FullMethod, 10*time.Millisecond))
+
+	canceled := make(chan struct{})
+	resp, err := inter(context.TODO(), req, unaryInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
+
+	// context of handler should be canceled once timed out
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		assert.Fail(t, "context of handler is not canceled")
+	}
+}
+
+func TestUnaryServerInterceptorWithMinBudget(t *testing.T) {
+	inter := UnaryServerInterceptorWithMinBudget(100*time.Millisecond,
+		WithTimeoutByPath(unaryInfo.FullMethod, time.Second))
+
+	// budget is below floor
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	resp, err := inter(ctx, req, unaryInfo, returnHandlerUnary)
+	assert.Nil(t, resp)
+	assert.Equal(t, timeoutError(ReasonBudget), err)
+
+	// enough budget
+	ctx, cancel = context.WithTimeout(context.TODO(), time.Minute)
+	defer cancel()
+
+	resp, err = inter(ctx, req, unaryInfo, returnHandlerUnary)
+	assert.Equal(t, "ut-resp", resp)
+	assert.Nil(t, err)
+
+	// without client deadline
+	resp, err = inter(context.TODO(), req, unaryInfo, returnHandlerUnary)
+	assert.Equal(t, "ut-resp", resp)
+	assert.Nil(t, err)
+}
+
+func TestStreamServerInterceptorWithMinBudget(t *testing.T) {
+	inter := StreamServerInterceptorWithMinBudget(100*time.Millisecond,
+		WithTimeoutByPath(streamInfo.FullMethod, time.Second))
+
+	// budget is below floor
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	err := inter(fakeServer, FakeServerStream{ctx: ctx}, streamInfo, returnHandlerStream)
+	assert.Equal(t, timeoutError(ReasonBudget), err)
+
+	// enough budget
+	ctx, cancel = context.WithTimeout(context.TODO(), time.Minute)
+	defer cancel()
+
+	err = inter(fakeServer, FakeServerStream{ctx: ctx}, streamInfo, returnHandlerStream)
+	assert.Nil(t, err)
+}
+
+func TestUnaryServerInterceptor_WithIgnore(t *testing.T) {
+	inter := UnaryServerInterceptorWithMinBudget(time.Minute,
+		WithTimeoutByPath(unaryInfo.FullMethod, time.Nanosecond),
+		WithPathToIgnore(unaryInfo.FullMethod))
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	resp, err := inter(ctx, req, unaryInfo, returnHandlerUnary)
+	assert.Equal(t, "ut-resp", resp)
+	assert.Nil(t, err)
+}
+
+func TestStreamServerInterceptor_WithCancel(t *testing.T) {
+	inter := StreamServerInterceptor(WithTimeoutByPath(streamInfo.FullMethod, 10*time.Millisecond))
+
+	canceled := make(chan error, 1)
+	err := inter(fakeServer, stream, streamInfo, func(srv interface{}, stream grpc.ServerStream) error {
+		<-stream.Context().Done()
+		canceled <- stream.Context().Err()
+		return nil
+	})
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
+
+	select {
+	case err = <-canceled:
+		assert.Equal(t, context.DeadlineExceeded, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "context of handler is not canceled")
+	}
+}
+
 func TestStreamServerInterceptor_WithTimeout(t *testing.T) {
 	// with global timeout
 	inter := StreamServerInterceptor(
-		rkmidtimeout.WithTimeout(time.Nanosecond))
+		WithTimeout(time.Nanosecond))
 
 	err := inter(fakeServer, stream, streamInfo, sleepHandlerStream)
-	assert.Equal(t, defaultResponse, err)
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
 
 	// with method
 	inter = StreamServerInterceptor(
-		rkmidtimeout.WithTimeoutByPath(streamInfo.FullMethod, time.Nanosecond))
+		WithTimeoutByPath(streamInfo.FullMethod, time.Nanosecond))
 
 	err = inter(fakeServer, stream, streamInfo, sleepHandlerStream)
-	assert.Equal(t, defaultResponse, err)
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
 }
 
 func TestStreamServerInterceptor_WithPanic(t *testing.T) {
 	defer assertPanic(t)
 
 	inter := StreamServerInterceptor(
-		rkmidtimeout.WithTimeout(time.Second))
+		WithTimeout(time.Second))
 
 	err := inter(fakeServer, stream, streamInfo, panicHandlerStream)
 	assert.Nil(t, err)
@@ -98,14 +252,14 @@ func TestStreamServerInterceptor_HappyCase(t *testing.T) {
 	// Let's add two routes /timeout and /happy
 	// We expect interceptor acts as the name describes
 	inter := StreamServerInterceptor(
-		rkmidtimeout.WithTimeoutByPath(timeoutMethod, time.Nanosecond),
-		rkmidtimeout.WithTimeoutByPath(happyMethod, time.Second))
+		WithTimeoutByPath(timeoutMethod, time.Nanosecond),
+		WithTimeoutByPath(happyMethod, time.Second))
 
 	// timeout on /timeout
 	err := inter(fakeServer, stream, &grpc.StreamServerInfo{
 		FullMethod: timeoutMethod,
 	}, sleepHandlerStream)
-	assert.Equal(t, defaultResponse, err)
+	assert.Equal(t, timeoutError(ReasonTimeout), err)
 
 	// OK on /happy
 	err = inter(fakeServer, stream, &grpc.StreamServerInfo{
@@ -114,6 +268,44 @@ func TestStreamServerInterceptor_HappyCase(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestStreamServerInterceptor_WithWrappedStream(t *testing.T) {
+	inter := StreamServerInterceptor(WithTimeoutByPath(streamInfo.FullMethod, time.Second))
+
+	err := inter(fakeServer, stream, streamInfo, func(srv interface{}, stream grpc.ServerStream) error {
+		// handler should receive wrapped stream which carries context of interceptors
+		_, ok := stream.(*rkgrpcctx.WrappedServerStream)
+		assert.True(t, ok)
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestStreamServerInterceptor_WithIgnore(t *testing.T) {
+	inter := StreamServerInterceptor(
+		WithTimeout(time.Nanosecond),
+		WithPathToIgnore(streamInfo.FullMethod))
+
+	err := inter(fakeServer, stream, streamInfo, returnHandlerStream)
+	assert.Nil(t, err)
+}
+
+func TestStreamServerInterceptorWithStreamTimeout(t *testing.T) {
+	// long-lived stream is not timed out by timeout of method in idle mode
+	inter := StreamServerInterceptorWithStreamTimeout(&StreamTimeout{Idle: time.Second},
+		WithTimeout(time.Nanosecond))
+
+	err := inter(fakeServer, stream, streamInfo, func(srv interface{}, stream grpc.ServerStream) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// idle stream
+	inter = StreamServerInterceptorWithStreamTimeout(&StreamTimeout{Idle: 10 * time.Millisecond})
+	err = inter(fakeServer, stream, streamInfo, sleepHandlerStream)
+	assert.Equal(t, timeoutError(ReasonIdle), err)
+}
+
 // ************ Test utility ************
 
 var (
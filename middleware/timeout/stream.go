@@ -0,0 +1,193 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpctimeout
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	rkgrpcerr "github.com/tegarajipangestu/rk-grpc/v2/boot/error"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// StreamModeDeadline whole stream is timed out with timeout of method
+	StreamModeDeadline = "deadline"
+	// StreamModeIdle stream is timed out if idle or too old
+	StreamModeIdle = "idle"
+
+	// ReasonTimeout call exceeded timeout of method
+	ReasonTimeout = "TIMEOUT"
+	// ReasonDeadline call exceeded deadline of client which is earlier than timeout of method
+	ReasonDeadline = "CLIENT_DEADLINE"
+	// ReasonBudget remaining budget of client deadline is below min budget
+	ReasonBudget = "INSUFFICIENT_BUDGET"
+	// ReasonIdle no message was received or sent within idle timeout
+	ReasonIdle = "IDLE_TIMEOUT"
+	// ReasonMaxAge stream lived longer than max age
+	ReasonMaxAge = "MAX_AGE"
+)
+
+// StreamTimeout timeouts of stream in idle mode, zero disables either of them.
+type StreamTimeout struct {
+	// Idle cancels stream if no message was received or sent within duration
+	Idle time.Duration
+	// MaxAge cancels stream after duration since started
+	MaxAge time.Duration
+}
+
+// timeoutError returns DeadlineExceeded error of timed out call with reason as detail
+func timeoutError(reason string) error {
+	return rkgrpcerr.DeadlineExceeded("Request timed out!", status.Error(codes.DeadlineExceeded, reason)).Err()
+}
+
+// recordTimeout records reason into event
+func recordTimeout(ctx context.Context, reason string) {
+	event := rkgrpcctx.GetEvent(ctx)
+	event.SetCounter("timeout", 1)
+	event.AddPair("timeoutReason", reason)
+}
+
+// idleGracePeriod time to wait for handler to return after stream timed out
+const idleGracePeriod = 100 * time.Millisecond
+
+// activeStream records time of last message received or sent, messages are refused once stream timed out
+type activeStream struct {
+	grpc.ServerStream
+	// unix nano of last message
+	last int64
+	// error of timed out stream
+	timedOut atomic.Value
+}
+
+// RecvMsg receives message and records activity
+func (s *activeStream) RecvMsg(m interface{}) error {
+	if err := s.timeoutErr(); err != nil {
+		return err
+	}
+
+	err := s.ServerStream.RecvMsg(m)
+	atomic.StoreInt64(&s.last, time.Now().UnixNano())
+	return err
+}
+
+// SendMsg sends message and records activity
+func (s *activeStream) SendMsg(m interface{}) error {
+	if err := s.timeoutErr(); err != nil {
+		return err
+	}
+
+	err := s.ServerStream.SendMsg(m)
+	atomic.StoreInt64(&s.last, time.Now().UnixNano())
+	return err
+}
+
+// timeout marks stream as timed out, following messages would be refused with err
+func (s *activeStream) timeout(err error) {
+	s.timedOut.Store(err)
+}
+
+// timeoutErr returns error of timed out stream, nil if not timed out
+func (s *activeStream) timeoutErr() error {
+	if err, ok := s.timedOut.Load().(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// runIdle runs handler and returns error with reason if stream was idle or too old, context of stream would be
+// canceled so that handler could stop.
+//
+// Handler is waited for at most idleGracePeriod after timed out, messages it sends or receives later are refused.
+func runIdle(timeout *StreamTimeout, srv interface{}, stream *rkgrpcctx.WrappedServerStream, handler grpc.StreamHandler) error {
+	if timeout.Idle <= 0 && timeout.MaxAge <= 0 {
+		return handler(srv, stream)
+	}
+
+	ctx, cancel := context.WithCancel(stream.WrappedContext)
+	defer cancel()
+	stream.WrappedContext = ctx
+
+	start := time.Now()
+	active := &activeStream{ServerStream: stream, last: start.UnixNano()}
+
+	finishChan := make(chan error, 1)
+	panicChan := make(chan interface{}, 1)
+
+	go func() {
+		defer func() {
+			if recv := recover(); recv != nil {
+				panicChan <- recv
+			}
+		}()
+
+		finishChan <- handler(srv, active)
+	}()
+
+	timer := time.NewTimer(nextCheck(timeout, start, start, start))
+	defer timer.Stop()
+
+	for {
+		select {
+		case recv := <-panicChan:
+			panic(recv)
+		case err := <-finishChan:
+			return err
+		case <-timer.C:
+			now := time.Now()
+			last := time.Unix(0, atomic.LoadInt64(&active.last))
+
+			reason := ""
+			if timeout.MaxAge > 0 && now.Sub(start) >= timeout.MaxAge {
+				reason = ReasonMaxAge
+			} else if timeout.Idle > 0 && now.Sub(last) >= timeout.Idle {
+				reason = ReasonIdle
+			}
+
+			if len(reason) > 0 {
+				recordTimeout(ctx, reason)
+				err := timeoutError(reason)
+				active.timeout(err)
+				cancel()
+
+				select {
+				case <-finishChan:
+				case <-panicChan:
+				case <-time.After(idleGracePeriod):
+				}
+
+				return err
+			}
+
+			timer.Reset(nextCheck(timeout, start, last, now))
+		}
+	}
+}
+
+// nextCheck returns duration until stream may be idle or too old
+func nextCheck(timeout *StreamTimeout, start, last, now time.Time) time.Duration {
+	next := timeout.Idle
+	if timeout.Idle > 0 {
+		next = last.Add(timeout.Idle).Sub(now)
+	}
+
+	if timeout.MaxAge > 0 {
+		if age := start.Add(timeout.MaxAge).Sub(now); timeout.Idle <= 0 || age < next {
+			next = age
+		}
+	}
+
+	if next <= 0 {
+		next = time.Millisecond
+	}
+
+	return next
+}
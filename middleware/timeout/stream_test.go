@@ -0,0 +1,134 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpctimeout
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	rkerror "github.com/tegarajipangestu/rk-grpc/v2/boot/error/gen"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTimeoutError(t *testing.T) {
+	st := status.Convert(timeoutError(ReasonIdle))
+	assert.Equal(t, codes.DeadlineExceeded, st.Code())
+	assert.Len(t, st.Details(), 2)
+	assert.Equal(t, ReasonIdle, st.Details()[1].(*rkerror.ErrorDetail).Message)
+}
+
+func TestRunIdle_WithIdle(t *testing.T) {
+	var handlerCtx context.Context
+	err := runIdle(&StreamTimeout{Idle: 10 * time.Millisecond}, fakeServer, rkgrpcctx.WrapServerStream(stream),
+		func(srv interface{}, stream grpc.ServerStream) error {
+			handlerCtx = stream.Context()
+			<-handlerCtx.Done()
+			return nil
+		})
+
+	assert.Equal(t, timeoutError(ReasonIdle), err)
+	// context of handler should be canceled
+	assert.NotNil(t, handlerCtx.Err())
+}
+
+func TestRunIdle_WithActivity(t *testing.T) {
+	// messages keep stream alive longer than idle timeout
+	err := runIdle(&StreamTimeout{Idle: 30 * time.Millisecond}, fakeServer, rkgrpcctx.WrapServerStream(stream),
+		func(srv interface{}, stream grpc.ServerStream) error {
+			for i := 0; i < 6; i++ {
+				time.Sleep(10 * time.Millisecond)
+				assert.Nil(t, stream.SendMsg("ut-msg"))
+			}
+			return nil
+		})
+
+	assert.Nil(t, err)
+}
+
+func TestRunIdle_WithMaxAge(t *testing.T) {
+	err := runIdle(&StreamTimeout{Idle: time.Second, MaxAge: 30 * time.Millisecond}, fakeServer,
+		rkgrpcctx.WrapServerStream(stream),
+		func(srv interface{}, stream grpc.ServerStream) error {
+			for {
+				select {
+				case <-stream.Context().Done():
+					return nil
+				case <-time.After(5 * time.Millisecond):
+					stream.RecvMsg(nil)
+				}
+			}
+		})
+
+	assert.Equal(t, timeoutError(ReasonMaxAge), err)
+}
+
+func TestRunIdle_WithHandlerIgnoresCancel(t *testing.T) {
+	counter := &countingServerStream{ServerStream: stream}
+	errs := make(chan error, 1)
+
+	start := time.Now()
+	err := runIdle(&StreamTimeout{Idle: 10 * time.Millisecond}, fakeServer, rkgrpcctx.WrapServerStream(counter),
+		func(srv interface{}, stream grpc.ServerStream) error {
+			// handler keeps running after timed out
+			time.Sleep(5 * idleGracePeriod)
+			errs <- stream.SendMsg("ut-msg")
+			return nil
+		})
+	assert.Equal(t, timeoutError(ReasonIdle), err)
+	// handler is waited for a bounded time
+	assert.True(t, time.Since(start) < 3*idleGracePeriod)
+
+	// message sent after timed out is refused
+	assert.Equal(t, timeoutError(ReasonIdle), <-errs)
+	assert.Zero(t, atomic.LoadInt32(&counter.sent))
+}
+
+func TestRunIdle_WithoutTimeout(t *testing.T) {
+	err := runIdle(&StreamTimeout{}, fakeServer, rkgrpcctx.WrapServerStream(stream), returnHandlerStream)
+	assert.Nil(t, err)
+}
+
+func TestRunIdle_WithPanic(t *testing.T) {
+	defer assertPanic(t)
+
+	runIdle(&StreamTimeout{Idle: time.Second}, fakeServer, rkgrpcctx.WrapServerStream(stream), panicHandlerStream)
+}
+
+func TestNextCheck(t *testing.T) {
+	now := time.Now()
+
+	// idle only
+	assert.Equal(t, 7*time.Second,
+		nextCheck(&StreamTimeout{Idle: 10 * time.Second}, now, now.Add(-3*time.Second), now))
+
+	// max age comes first
+	assert.Equal(t, 2*time.Second,
+		nextCheck(&StreamTimeout{Idle: 10 * time.Second, MaxAge: 5 * time.Second}, now.Add(-3*time.Second), now, now))
+
+	// max age only
+	assert.Equal(t, 5*time.Second, nextCheck(&StreamTimeout{MaxAge: 5 * time.Second}, now, now, now))
+
+	// already expired
+	assert.Equal(t, time.Millisecond,
+		nextCheck(&StreamTimeout{Idle: time.Second}, now, now.Add(-2*time.Second), now))
+}
+
+// countingServerStream counts messages sent
+type countingServerStream struct {
+	grpc.ServerStream
+	sent int32
+}
+
+func (s *countingServerStream) SendMsg(m interface{}) error {
+	atomic.AddInt32(&s.sent, 1)
+	return s.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpctrace
+
+import (
+	"context"
+
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	rkmidtrace "github.com/rookie-ninja/rk-entry/v2/middleware/tracing"
+	rkgrpcmid "github.com/tegarajipangestu/rk-grpc/v2/middleware"
+	rkgrpcctx "github.com/tegarajipangestu/rk-grpc/v2/middleware/context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor Create new unary client interceptor.
+func UnaryClientInterceptor(opts ...rkmidtrace.Option) grpc.UnaryClientInterceptor {
+	set := rkmidtrace.NewOptionSet(opts...)
+
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.TracerKey, set.GetTracer())
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.TracerProviderKey, set.GetProvider())
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.PropagatorKey, set.GetPropagator())
+
+		beforeCtx := set.BeforeCtx(nil, true)
+		beforeCtx.Input.UrlPath = method
+		beforeCtx.Input.RequestCtx = ctx
+		beforeCtx.Input.SpanName = method
+
+		// metadata carrier, span of caller would be extracted from outgoing metadata if exists
+		outgoingMD, _ := metadata.FromOutgoingContext(ctx)
+		outgoingMD = outgoingMD.Copy()
+		beforeCtx.Input.Carrier = &rkgrpcctx.GrpcMetadataCarrier{Md: &outgoingMD}
+		// grpc related meta
+		beforeCtx.Input.Attributes = append(beforeCtx.Input.Attributes, grpcClientInfoToAttributes(
+			cc.Target(), method, "UnaryClient")...)
+
+		set.Before(beforeCtx)
+
+		// new context and span
+		if beforeCtx.Output.Span != nil {
+			ctx = beforeCtx.Output.NewCtx
+			rkgrpcmid.AddToClientContextPayload(ctx, rkmid.SpanKey, beforeCtx.Output.Span)
+			rkgrpcmid.AddToClientContextPayload(ctx, rkmid.HeaderTraceId, beforeCtx.Output.Span.SpanContext().TraceID().String())
+
+			// inject span into outgoing metadata
+			if propagator := set.GetPropagator(); propagator != nil {
+				propagator.Inject(ctx, beforeCtx.Input.Carrier)
+				ctx = metadata.NewOutgoingContext(ctx, outgoingMD)
+			}
+		}
+
+		// call invoker
+		err := invoker(ctx, method, req, resp, cc, opts...)
+
+		set.After(beforeCtx, toAfterCtx(set, err))
+
+		return err
+	}
+}
+
+// StreamClientInterceptor Create new stream client interceptor.
+func StreamClientInterceptor(opts ...rkmidtrace.Option) grpc.StreamClientInterceptor {
+	set := rkmidtrace.NewOptionSet(opts...)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = rkgrpcmid.WrapContextForClient(ctx)
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.EntryNameKey, set.GetEntryName())
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.TracerKey, set.GetTracer())
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.TracerProviderKey, set.GetProvider())
+		rkgrpcmid.AddToClientContextPayload(ctx, rkmid.PropagatorKey, set.GetPropagator())
+
+		beforeCtx := set.BeforeCtx(nil, true)
+		beforeCtx.Input.UrlPath = method
+		beforeCtx.Input.RequestCtx = ctx
+		beforeCtx.Input.SpanName = method
+
+		// metadata carrier, span of caller would be extracted from outgoing metadata if exists
+		outgoingMD, _ := metadata.FromOutgoingContext(ctx)
+		outgoingMD = outgoingMD.Copy()
+		beforeCtx.Input.Carrier = &rkgrpcctx.GrpcMetadataCarrier{Md: &outgoingMD}
+		// grpc related meta
+		beforeCtx.Input.Attributes = append(beforeCtx.Input.Attributes, grpcClientInfoToAttributes(
+			cc.Target(), method, "StreamClient")...)
+
+		set.Before(beforeCtx)
+
+		// new context and span
+		if beforeCtx.Output.Span != nil {
+			ctx = beforeCtx.Output.NewCtx
+			rkgrpcmid.AddToClientContextPayload(ctx, rkmid.SpanKey, beforeCtx.Output.Span)
+			rkgrpcmid.AddToClientContextPayload(ctx, rkmid.HeaderTraceId, beforeCtx.Output.Span.SpanContext().TraceID().String())
+
+			// inject span into outgoing metadata
+			if propagator := set.GetPropagator(); propagator != nil {
+				propagator.Inject(ctx, beforeCtx.Input.Carrier)
+				ctx = metadata.NewOutgoingContext(ctx, outgoingMD)
+			}
+		}
+
+		// end span once stream finished
+		after := func(err error) {
+			set.After(beforeCtx, toAfterCtx(set, err))
+		}
+
+		// call streamer
+		clientStream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			after(err)
+			return nil, err
+		}
+
+		return rkgrpcmid.WrapClientStreamWithFinish(clientStream, desc, after), nil
+	}
+}
+
+// Convert grpc error into AfterCtx.
+func toAfterCtx(set rkmidtrace.OptionSetInterface, err error) *rkmidtrace.AfterCtx {
+	var afterCtx *rkmidtrace.AfterCtx
+	if err != nil {
+		s, _ := status.FromError(err)
+		afterCtx = set.AfterCtx(int(codes.Error), s.Message())
+		afterCtx.Input.Attributes = append(afterCtx.Input.Attributes,
+			attribute.Int("grpc.code", int(s.Code())),
+			attribute.String("grpc.status", s.Code().String()))
+	} else {
+		afterCtx = set.AfterCtx(200, "")
+		afterCtx.Input.Attributes = append(afterCtx.Input.Attributes,
+			attribute.Int("grpc.code", int(codes.Ok)),
+			attribute.String("grpc.status", codes.Ok.String()))
+	}
+
+	return afterCtx
+}
+
+// Convert grpc client information into attributes.
+func grpcClientInfoToAttributes(target, method, rpcType string) []attribute.KeyValue {
+	grpcService, grpcMethod := rkgrpcmid.GetGrpcInfo(method)
+
+	return []attribute.KeyValue{
+		attribute.String("local.IP", rkgrpcmid.LocalIp.String),
+		attribute.String("local.hostname", rkgrpcmid.LocalHostname.String),
+		attribute.String("remote.target", target),
+		attribute.String("grpc.service", grpcService),
+		attribute.String("grpc.method", grpcMethod),
+		attribute.String("client.type", rpcType),
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkgrpctrace
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/rookie-ninja/rk-entry/v2/middleware/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	defer assertNotPanic(t)
+
+	beforeCtx := rkmidtrace.NewBeforeCtx()
+	afterCtx := rkmidtrace.NewAfterCtx()
+	mock := rkmidtrace.NewOptionSetMock(beforeCtx, afterCtx, nil, nil, propagation.TraceContext{})
+	inter := UnaryClientInterceptor(rkmidtrace.WithMockOptionSet(mock))
+
+	// case 1: without span
+	assert.Nil(t, inter(NewUnaryClientInput()))
+
+	// case 2: happy case
+	noopTracerProvider := trace.NewNoopTracerProvider()
+	newCtx, span := noopTracerProvider.Tracer("rk-trace-noop").Start(context.TODO(), "noop-span")
+	beforeCtx.Output.Span = span
+	beforeCtx.Output.NewCtx = newCtx
+
+	assert.Nil(t, inter(NewUnaryClientInput()))
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	defer assertNotPanic(t)
+
+	beforeCtx := rkmidtrace.NewBeforeCtx()
+	afterCtx := rkmidtrace.NewAfterCtx()
+	mock := rkmidtrace.NewOptionSetMock(beforeCtx, afterCtx, nil, nil, propagation.TraceContext{})
+	inter := StreamClientInterceptor(rkmidtrace.WithMockOptionSet(mock))
+
+	// case 1: without span
+	_, err := inter(NewStreamClientInput())
+	assert.Nil(t, err)
+
+	// case 2: happy case
+	noopTracerProvider := trace.NewNoopTracerProvider()
+	newCtx, span := noopTracerProvider.Tracer("rk-trace-noop").Start(context.TODO(), "noop-span")
+	beforeCtx.Output.Span = span
+	beforeCtx.Output.NewCtx = newCtx
+
+	_, err = inter(NewStreamClientInput())
+	assert.Nil(t, err)
+}
+
+func TestStreamClientInterceptor_WithFinishedStream(t *testing.T) {
+	recorder := &afterRecorder{
+		OptionSetInterface: rkmidtrace.NewOptionSetMock(rkmidtrace.NewBeforeCtx(), rkmidtrace.NewAfterCtx(),
+			nil, nil, propagation.TraceContext{}),
+	}
+	inter := StreamClientInterceptor(rkmidtrace.WithMockOptionSet(recorder))
+	ctx, desc, cc, method, _ := NewStreamClientInput()
+	desc.ServerStreams = true
+
+	// span is ended once stream finished with io.EOF
+	stream, err := inter(ctx, desc, cc, method, streamerOf(&finishedClientStream{err: io.EOF}, nil))
+	assert.Nil(t, err)
+	assert.Empty(t, recorder.codes)
+	assert.Equal(t, io.EOF, stream.RecvMsg(nil))
+	assert.Equal(t, []string{"Ok"}, recorder.codes)
+
+	// span is ended with code of error stream finished with
+	stream, err = inter(ctx, desc, cc, method,
+		streamerOf(&finishedClientStream{err: status.Error(codes.Internal, "ut-error")}, nil))
+	assert.Nil(t, err)
+	assert.NotNil(t, stream.RecvMsg(nil))
+	assert.Equal(t, []string{"Ok", "Internal"}, recorder.codes)
+
+	// span is ended at once if stream is not created
+	_, err = inter(ctx, desc, cc, method, streamerOf(nil, status.Error(codes.Unavailable, "ut-error")))
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"Ok", "Internal", "Unavailable"}, recorder.codes)
+}
+
+// ************ Test utility ************
+
+func NewUnaryClientInput() (context.Context, string, interface{}, interface{}, *grpc.ClientConn, grpc.UnaryInvoker) {
+	cc, _ := grpc.Dial("ut-target", grpc.WithInsecure())
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	return context.TODO(), "ut-method", nil, nil, cc, invoker
+}
+
+func NewStreamClientInput() (context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, grpc.Streamer) {
+	cc, _ := grpc.Dial("ut-target", grpc.WithInsecure())
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, nil
+	}
+
+	return context.TODO(), &grpc.StreamDesc{}, cc, "ut-method", streamer
+}
+
+// afterRecorder records grpc status of spans ended
+type afterRecorder struct {
+	rkmidtrace.OptionSetInterface
+	codes []string
+}
+
+func (r *afterRecorder) AfterCtx(resCode int, resMsg string, attrs ...attribute.KeyValue) *rkmidtrace.AfterCtx {
+	return rkmidtrace.NewAfterCtx()
+}
+
+func (r *afterRecorder) After(before *rkmidtrace.BeforeCtx, after *rkmidtrace.AfterCtx) {
+	for _, attr := range after.Input.Attributes {
+		if attr.Key == "grpc.status" {
+			r.codes = append(r.codes, attr.Value.AsString())
+		}
+	}
+	r.OptionSetInterface.After(before, after)
+}
+
+// finishedClientStream is finished with err once received
+type finishedClientStream struct {
+	grpc.ClientStream
+	err error
+}
+
+func (s *finishedClientStream) RecvMsg(m interface{}) error {
+	return s.err
+}
+
+// streamerOf returns streamer which creates stream finished with err, or fails with err if stream is nil
+func streamerOf(stream grpc.ClientStream, err error) grpc.Streamer {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return stream, err
+	}
+}